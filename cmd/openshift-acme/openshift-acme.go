@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/cmd/genericclioptions"
+	cmd "github.com/tnozicka/openshift-acme/pkg/cmd/openshift-acme"
+)
+
+func init() {
+	klog.InitFlags(flag.CommandLine)
+	err := flag.Set("logtostderr", "true")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	if len(os.Getenv("GOMAXPROCS")) == 0 {
+		runtime.GOMAXPROCS(runtime.NumCPU())
+	}
+
+	utilruntime.Must(routev1.Install(scheme.Scheme))
+
+	command := cmd.NewOpenshiftAcmeCommand(genericclioptions.IOStreams{
+		In:     os.Stdin,
+		Out:    os.Stdout,
+		ErrOut: os.Stderr,
+	})
+	err := command.Execute()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
@@ -6,20 +6,25 @@ require (
 	github.com/davecgh/go-spew v1.1.1
 	github.com/ghodss/yaml v1.0.0
 	github.com/google/go-cmp v0.3.1
+	github.com/miekg/dns v1.1.25
 	github.com/onsi/ginkgo v1.11.0
 	github.com/onsi/gomega v1.8.2-0.20191230164726-a31eda7afd3c
 	github.com/openshift/api v0.0.0-20200102191951-7e36eed0d19e
 	github.com/openshift/build-machinery-go v0.0.0-20200211121458-5e3d6e570160
 	github.com/openshift/client-go v0.0.0-20191219165006-ac3b642258cc
+	github.com/pavel-v-chernykh/keystore-go/v4 v4.1.0
 	github.com/prometheus/client_golang v1.3.0
 	github.com/spf13/cobra v0.0.6-0.20191226175542-bf2689566459
 	github.com/spf13/pflag v1.0.5
 	golang.org/x/crypto v0.0.0-20200117160349-530e935923ad
+	golang.org/x/net v0.0.0-20191004110552-13f9640d40b9
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
 	gopkg.in/inf.v0 v0.9.1
-	gopkg.in/yaml.v2 v2.2.7 // indirect
+	gopkg.in/yaml.v2 v2.2.7
 	k8s.io/api v0.17.0
 	k8s.io/apimachinery v0.17.0
 	k8s.io/apiserver v0.17.0
 	k8s.io/client-go v0.17.0
 	k8s.io/klog v1.0.0
+	software.sslmate.com/src/go-pkcs12 v0.0.0-20200830195227-52f69702a001
 )
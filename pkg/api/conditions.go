@@ -0,0 +1,56 @@
+package api
+
+import (
+	"time"
+)
+
+// FindCondition returns the condition of the type or nil if it isn't present.
+func FindCondition(conditions []Condition, conditionType ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+
+	return nil
+}
+
+// IsConditionTrue returns true if the condition of the type is present and has status True.
+func IsConditionTrue(conditions []Condition, conditionType ConditionType) bool {
+	c := FindCondition(conditions, conditionType)
+	return c != nil && c.Status == ConditionTrue
+}
+
+// SetCondition adds or updates the condition. LastTransitionTime is updated only if the status changes.
+func SetCondition(conditions *[]Condition, condition Condition) {
+	existing := FindCondition(*conditions, condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = time.Now()
+		}
+		*conditions = append(*conditions, condition)
+		return
+	}
+
+	if existing.Status != condition.Status {
+		existing.Status = condition.Status
+		if condition.LastTransitionTime.IsZero() {
+			existing.LastTransitionTime = time.Now()
+		} else {
+			existing.LastTransitionTime = condition.LastTransitionTime
+		}
+	}
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+}
+
+// RemoveCondition removes the condition of the type if it's present.
+func RemoveCondition(conditions *[]Condition, conditionType ConditionType) {
+	var res []Condition
+	for _, c := range *conditions {
+		if c.Type != conditionType {
+			res = append(res, c)
+		}
+	}
+	*conditions = res
+}
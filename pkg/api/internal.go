@@ -1,6 +1,8 @@
 package api
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -8,6 +10,9 @@ const (
 	ForwardingRouteSuffix = "acme"
 	ExposerLabelName      = "acme.openshift.io/exposer"
 	ExposerForLabelName   = "acme.openshift.io/exposer-for"
+
+	// DefaultExposerReplicas is the number of pods for every exposer unless configured otherwise.
+	DefaultExposerReplicas = 2
 )
 
 type AcmeState string
@@ -24,3 +29,17 @@ var (
 		"type":       "CertIssuer",
 	}
 )
+
+// DefaultExposerResources returns the resource requirements for the exposer containers.
+func DefaultExposerResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(5, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(50*(1024*1024), resource.BinarySI),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(100, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(50*(1024*1024), resource.BinarySI),
+		},
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
@@ -15,8 +17,57 @@ const (
 	AcmeExposerId                                 = "acme.openshift.io/exposer-id"
 	AcmeExposerKey                                = "acme.openshift.io/exposer-key"
 	AcmeExposerUID                                = "acme.openshift.io/exposer-uid"
+	AcmeExposerResponse                           = "acme.openshift.io/exposer-response"
+	AcmeExposerSpecHash                           = "acme.openshift.io/exposer-spec-hash"
 	AcmeCertIssuerName                            = "acme.openshift.io/cert-issuer-name"
 	AcmeSecretName                                = "acme.openshift.io/secret-name"
+	AcmeResetFailuresAnnotation                   = "acme.openshift.io/reset-failures"
+	AcmeRevocationPolicyAnnotation                = "acme.openshift.io/revocation-policy"
+	AcmeSkipRevocationAnnotation                  = "acme.openshift.io/skip-revocation"
+	AcmeRenewRequestedAtAnnotation                = "acme.openshift.io/renew-requested-at"
+	AcmePausedAnnotation                          = "acme.openshift.io/paused"
+	AcmeRenewBeforeAnnotation                     = "acme.openshift.io/renew-before"
+	AcmeProactiveRenewBeforeAnnotation            = "acme.openshift.io/proactive-renew-before"
+	AcmeSecretTargetsAnnotation                   = "acme.openshift.io/secret-targets"
+	AcmeSecretSourceRouteAnnotation               = "acme.openshift.io/source-route"
+	AcmeSecretFormatsAnnotation                   = "acme.openshift.io/secret-formats"
+	AcmeKeystorePasswordSecretAnnotation          = "acme.openshift.io/keystore-password-secret"
+	AcmeSecretContentHashAnnotation               = "acme.openshift.io/secret-content-hash"
+	AcmeTerminationAnnotation                     = "acme.openshift.io/termination"
+	AcmeInsecureEdgeTerminationPolicyAnnotation   = "acme.openshift.io/insecure-edge-termination-policy"
+
+	// AcmeSecretSyncAllowedLabel on a namespace opts in to receiving certificates from Routes in other namespaces.
+	AcmeSecretSyncAllowedLabel = "acme.openshift.io/allow-secret-sync"
+	// AcmeSecretSourceRouteUIDLabel marks Secrets synced into other namespaces with the UID of the source Route.
+	AcmeSecretSourceRouteUIDLabel = "acme.openshift.io/source-route-uid"
+
+	// AcmeRolloutOnSecretChangeAnnotation on a Deployment, StatefulSet or DaemonSet lists the comma separated names
+	// of Secrets synced by the controller; a change of their data triggers a rollout of the workload.
+	AcmeRolloutOnSecretChangeAnnotation = "acme.openshift.io/rollout-on-secret-change"
+	// AcmeSecretsChecksumAnnotation is set on the pod template to the checksum of the Secrets listed for rollout.
+	AcmeSecretsChecksumAnnotation = "acme.openshift.io/secrets-checksum"
+
+	// AcmeRevocationFinalizer makes sure we revoke the certificate before the Route is gone.
+	AcmeRevocationFinalizer = "acme.openshift.io/revoke-certificate"
+	// AcmeSecretSyncFinalizer makes sure we remove the Secrets synced into other namespaces.
+	AcmeSecretSyncFinalizer = "acme.openshift.io/secret-sync-cleanup"
+)
+
+// SecretFormat is an extra key rendered into the synced Secret in addition to tls.crt and tls.key.
+type SecretFormat string
+
+const (
+	// SecretFormatCACert holds the PEM encoded issuer chain.
+	SecretFormatCACert SecretFormat = "ca.crt"
+	// SecretFormatCombinedPEM holds the PEM encoded certificate chain followed by the private key.
+	SecretFormatCombinedPEM SecretFormat = "tls-combined.pem"
+	// SecretFormatPKCS12 holds a password protected PKCS#12 keystore.
+	SecretFormatPKCS12 SecretFormat = "keystore.p12"
+	// SecretFormatJKS holds a password protected Java KeyStore.
+	SecretFormatJKS SecretFormat = "keystore.jks"
+
+	// KeystorePasswordSecretKey is the key holding the keystore password in the referenced Secret.
+	KeystorePasswordSecretKey = "password"
 )
 
 type CertIssuerType string
@@ -26,6 +77,38 @@ const (
 	CertIssuerTypeAcme CertIssuerType = "ACME"
 )
 
+const (
+	// HostnamePolicyConfigMapName is the name of the ConfigMap in the controller namespace holding the HostnamePolicy.
+	HostnamePolicyConfigMapName = "acme-hostname-policy"
+	HostnamePolicyDataKey       = "hostname-policy.types.acme.openshift.io"
+)
+
+type Http01SolverMode string
+
+const (
+	// Http01SolverModePerChallenge creates a temporary Route, Secret, ReplicaSet and Service
+	// in the Route's namespace for every pending challenge.
+	Http01SolverModePerChallenge Http01SolverMode = "PerChallenge"
+
+	// Http01SolverModeShared serves all challenges from a single exposer Deployment
+	// in the controller namespace and creates only a temporary Route for every pending challenge.
+	Http01SolverModeShared Http01SolverMode = "Shared"
+)
+
+type RevocationPolicy string
+
+const (
+	// RevocationPolicyNever keeps the certificate valid until it expires.
+	RevocationPolicyNever RevocationPolicy = "Never"
+
+	// RevocationPolicyRevoke revokes the certificate when the Route is deleted.
+	RevocationPolicyRevoke RevocationPolicy = "Revoke"
+
+	// RevocationPolicyRevokeOnUnmanage revokes the certificate when the Route is deleted or it is no longer managed.
+	// The Route keeps the revoked certificate when it is no longer managed.
+	RevocationPolicyRevokeOnUnmanage RevocationPolicy = "RevokeOnUnmanage"
+)
+
 type AcmeAccountStatus struct {
 	Hash          string `json:"hash"`
 	URI           string `json:"uri"`
@@ -41,6 +124,77 @@ type AcmeAccount struct {
 type AcmeCertIssuer struct {
 	DirectoryURL string      `json:"directoryURL"`
 	Account      AcmeAccount `json:"account"`
+
+	// caaIdentities are the issuer domain names the CA recognizes in CAA records, e.g. "letsencrypt.org".
+	// Defaults to "letsencrypt.org" for Let's Encrypt directories. Without them CAA records aren't checked.
+	CAAIdentities []string `json:"caaIdentities,omitempty"`
+
+	// selfCheck configures how the controller verifies the http-01 token is reachable before accepting the challenge.
+	SelfCheck *SelfCheck `json:"selfCheck,omitempty"`
+}
+
+type SelfCheckMode string
+
+const (
+	// SelfCheckModeOff accepts the challenge without checking the token.
+	SelfCheckModeOff SelfCheckMode = "Off"
+
+	// SelfCheckModeDirect fetches the token from the public hostname, like the CA does.
+	SelfCheckModeDirect SelfCheckMode = "Direct"
+
+	// SelfCheckModeRouter fetches the token from the router service with the Host header set to the hostname.
+	SelfCheckModeRouter SelfCheckMode = "Router"
+
+	// SelfCheckModeResolver fetches the token from the addresses the hostname resolves to with a custom resolver
+	// or from a static list of addresses.
+	SelfCheckModeResolver SelfCheckMode = "Resolver"
+
+	// SelfCheckModeExternal asks an external probe to fetch the token.
+	SelfCheckModeExternal SelfCheckMode = "External"
+)
+
+type SelfCheck struct {
+	// mode is one of Off, Direct, Router, Resolver or External. Defaults to Direct.
+	Mode SelfCheckMode `json:"mode,omitempty"`
+
+	// routerAddress is the host[:port] of the router service used in Router mode.
+	// Defaults to "router-internal-default.openshift-ingress.svc".
+	RouterAddress string `json:"routerAddress,omitempty"`
+
+	// resolver is the host:port of the DNS resolver used in Resolver mode.
+	Resolver string `json:"resolver,omitempty"`
+
+	// addresses are the ip[:port] addresses used in Resolver mode instead of resolving the hostname.
+	Addresses []string `json:"addresses,omitempty"`
+
+	// probeURL is the URL of the probe used in External mode. The controller sends a GET request with the token URL
+	// in the "url" query parameter and expects the probe to respond with the content it got.
+	ProbeURL string `json:"probeURL,omitempty"`
+
+	// retries is the number of times a failed check is retried before waiting for the next sync. Defaults to 2.
+	Retries *int `json:"retries,omitempty"`
+
+	// retryInterval is the time between the retries. Defaults to 2s.
+	RetryInterval *metav1.Duration `json:"retryInterval,omitempty"`
+}
+
+// RenewalWindow holds thresholds of the time remaining until the certificate expiry either
+// as a duration (e.g. "720h") or as a fraction of the certificate lifetime (e.g. "0.25" or "1/3").
+type RenewalWindow struct {
+	// renewBefore is the deadline for renewing the certificate.
+	RenewBefore string `json:"renewBefore,omitempty"`
+
+	// proactiveRenewBefore starts the period where renewals are spread to avoid spikes.
+	ProactiveRenewBefore string `json:"proactiveRenewBefore,omitempty"`
+}
+
+// DefaultTLSConfig holds the settings used for Routes that don't have a TLS config yet.
+type DefaultTLSConfig struct {
+	// termination is one of edge, reencrypt or passthrough. Defaults to edge.
+	Termination string `json:"termination,omitempty"`
+
+	// insecureEdgeTerminationPolicy is one of None, Allow or Redirect. Defaults to Redirect.
+	InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy,omitempty"`
 }
 
 type CertIssuer struct {
@@ -48,6 +202,43 @@ type CertIssuer struct {
 
 	Type           CertIssuerType  `json:"type"`
 	AcmeCertIssuer *AcmeCertIssuer `json:"acmeCertIssuer"`
+
+	// renewalWindow overrides the controller defaults for Routes using this issuer.
+	RenewalWindow *RenewalWindow `json:"renewalWindow,omitempty"`
+
+	// defaultTLS overrides the TLS config defaults for Routes using this issuer.
+	DefaultTLS *DefaultTLSConfig `json:"defaultTLS,omitempty"`
+
+	// revocationPolicy is the default revocation policy for Routes using this issuer. Defaults to Never.
+	RevocationPolicy RevocationPolicy `json:"revocationPolicy,omitempty"`
+}
+
+// HostnamePolicy restricts the certificates Routes can request, so users able to create an admitted Route
+// can't spend the CA quota on arbitrary hostnames.
+type HostnamePolicy struct {
+	// rules are evaluated in order and the first one matching the namespace of the Route applies.
+	// Routes in namespaces without a matching rule are denied.
+	Rules []HostnamePolicyRule `json:"rules"`
+}
+
+type HostnamePolicyRule struct {
+	// namespaces lists the namespaces the rule applies to.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// namespaceSelector selects the namespaces the rule applies to by their labels.
+	// The rule matches a namespace if it is listed in namespaces or matches the selector.
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// allowedDomainSuffixes restricts the hostnames, e.g. "example.com" allows "example.com" and all its subdomains
+	// while ".example.com" allows only the subdomains. Empty allows any hostname.
+	AllowedDomainSuffixes []string `json:"allowedDomainSuffixes,omitempty"`
+
+	// maxCertificates limits the number of Routes in the namespace having a certificate or an order in progress.
+	// Zero means no limit.
+	MaxCertificates int `json:"maxCertificates,omitempty"`
+
+	// allowedIssuers lists the issuer ConfigMaps as "namespace/name". Empty allows any issuer.
+	AllowedIssuers []string `json:"allowedIssuers,omitempty"`
 }
 
 type CertificateMeta struct {
@@ -80,9 +271,15 @@ type CertProvisioningStatus struct {
 	// EarliestAttemptAt marks the earliest time the provisioning process can be retried.
 	EarliestAttemptAt time.Time `json:"earliestAttemptAt,omitempty"`
 
-	// startedAt marks the time when the provisioning process begun.
+	// failures counts the consecutive failed orders and determines the backoff.
 	Failures int `json:"failures,omitempty"`
 
+	// observedRenewRequestedAt holds the last value of the renew-requested-at annotation that resulted in a new certificate.
+	ObservedRenewRequestedAt string `json:"observedRenewRequestedAt,omitempty"`
+
+	// observedResetFailures holds the last value of the reset-failures annotation that was acted upon.
+	ObservedResetFailures string `json:"observedResetFailures,omitempty"`
+
 	// orderUri, if not empty, holds the URI for active certificate order.
 	OrderURI string `json:"orderURI,omitempty"`
 
@@ -96,6 +293,72 @@ type CertProvisioningStatus struct {
 	AccountHash string `json:"accountHash,omitempty"`
 }
 
+type RevocationStatus struct {
+	// failures counts the consecutive failed attempts to revoke the certificate.
+	Failures int `json:"failures,omitempty"`
+
+	// earliestAttemptAt marks the earliest time revoking the certificate can be retried.
+	EarliestAttemptAt time.Time `json:"earliestAttemptAt,omitempty"`
+}
+
+type ConditionType string
+
+const (
+	// ConditionRateLimited is true when creating an order is deferred because of the CA rate limits.
+	ConditionRateLimited ConditionType = "RateLimited"
+
+	// ConditionPaused is true when syncing the Route is paused by the annotation.
+	ConditionPaused ConditionType = "Paused"
+
+	// ConditionDenied is true when the hostname policy doesn't allow a certificate for the Route.
+	ConditionDenied ConditionType = "Denied"
+
+	// ConditionCAAForbidden is true when the CAA records of the domain don't allow the issuer to issue a certificate
+	// and unknown when the records can't be looked up.
+	ConditionCAAForbidden ConditionType = "CAAForbidden"
+
+	// ConditionSecretCollision is true when the Secret the certificate of a passthrough Route has to be stored in
+	// already exists and isn't owned by the Route.
+	ConditionSecretCollision ConditionType = "SecretCollision"
+
+	// ConditionExposerRejected is true when the controller has failed the current order because a router
+	// rejected the exposer Route. It isn't counted as a failed validation.
+	ConditionExposerRejected ConditionType = "ExposerRejected"
+
+	// ConditionSelfCheckFailed is true when the controller can't verify the http-01 token is reachable
+	// and waits with accepting the challenge.
+	ConditionSelfCheckFailed ConditionType = "SelfCheckFailed"
+
+	// ConditionInvalidRenewalWindow is true when the renewal window from the issuer or the Route annotations
+	// is invalid and ignored.
+	ConditionInvalidRenewalWindow ConditionType = "InvalidRenewalWindow"
+)
+
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+type Condition struct {
+	// type of the condition.
+	Type ConditionType `json:"type"`
+
+	// status of the condition, one of True, False, Unknown.
+	Status ConditionStatus `json:"status"`
+
+	// lastTransitionTime is the last time the condition changed the status.
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+
+	// reason is a machine readable reason for the last transition.
+	Reason string `json:"reason,omitempty"`
+
+	// message is a human readable explanation of the condition.
+	Message string `json:"message,omitempty"`
+}
+
 // Status represents the current state of certificates provisioning.
 type Status struct {
 	// observedGeneration is the most recent generation observed by the controller. It corresponds to the
@@ -105,9 +368,23 @@ type Status struct {
 	// certificateMeta
 	CertificateMeta *CertificateMeta `json:"certificateMeta,omitempty"`
 
+	// certificateExpiresAt is the expiry of the certificate currently on the Route.
+	// It is reported even if syncing the Route is paused.
+	CertificateExpiresAt *time.Time `json:"certificateExpiresAt,omitempty"`
+
 	// provisioningStatus
 	ProvisioningStatus CertProvisioningStatus `json:"provisioningStatus"`
 
+	// conditions describe the state of the Route that needs attention.
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// revocation tracks the attempts to revoke the certificate before the finalizer is removed.
+	Revocation *RevocationStatus `json:"revocation,omitempty"`
+
+	// syncedSecretName is the name of the Secret in the Route's namespace the certificate was last synced into.
+	// It is owned by the secret sync worker and used to delete the Secret when the annotation changes.
+	SyncedSecretName string `json:"syncedSecretName,omitempty"`
+
 	// signature (internal) holds the cryptographic signature controller uses for internal check
 	// that prevents messing with status filed and injection e.g. malicious URLs.
 	Signature string `json:"signature,omitempty"`
@@ -0,0 +1,269 @@
+package caa
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"k8s.io/klog"
+)
+
+const (
+	DefaultResolvConf = "/etc/resolv.conf"
+	DefaultTimeout    = 5 * time.Second
+
+	tagIssue     = "issue"
+	tagIssueWild = "issuewild"
+	tagIodef     = "iodef"
+
+	paramAccountURI        = "accounturi"
+	paramValidationMethods = "validationmethods"
+
+	flagCritical = 128
+)
+
+// Params describe the order the CAA records are checked against.
+type Params struct {
+	// Identities are the issuer domain names the CA recognizes in issue and issuewild records.
+	Identities []string
+
+	// AccountURI is the ACME account the order would be created with.
+	AccountURI string
+
+	// ValidationMethod is the ACME challenge type used to validate the domain, e.g. http-01.
+	ValidationMethod string
+}
+
+// ForbiddenError means the CAA records don't allow the CA to issue a certificate for the domain.
+type ForbiddenError struct {
+	Domain         string
+	RelevantDomain string
+	Reason         string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("CAA records at %q forbid issuing a certificate for %q: %s", e.RelevantDomain, e.Domain, e.Reason)
+}
+
+// Checker checks whether the CAA records of a domain allow the CA to issue a certificate, like the CA does
+// before issuing it (RFC 8659 and RFC 8657).
+type Checker struct {
+	// resolver is the address of the recursive resolver.
+	resolver string
+	timeout  time.Duration
+}
+
+func NewChecker(resolver string, timeout time.Duration) *Checker {
+	return &Checker{
+		resolver: resolver,
+		timeout:  timeout,
+	}
+}
+
+// ResolverFromResolvConf returns the address of the first nameserver in the resolv.conf file.
+func ResolverFromResolvConf(path string) (string, error) {
+	config, err := dns.ClientConfigFromFile(path)
+	if err != nil {
+		return "", fmt.Errorf("can't read %q: %w", path, err)
+	}
+	if len(config.Servers) == 0 {
+		return "", fmt.Errorf("no nameserver in %q", path)
+	}
+
+	return net.JoinHostPort(config.Servers[0], config.Port), nil
+}
+
+func (c *Checker) exchange(ctx context.Context, m *dns.Msg, network string) (*dns.Msg, error) {
+	client := &dns.Client{
+		Net:     network,
+		Timeout: c.timeout,
+	}
+	r, _, err := client.ExchangeContext(ctx, m, c.resolver)
+	return r, err
+}
+
+// lookupCAA returns the CAA records at the name. The resolver follows CNAMEs for us.
+func (c *Checker) lookupCAA(ctx context.Context, name string) ([]*dns.CAA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeCAA)
+	m.SetEdns0(4096, false)
+
+	r, err := c.exchange(ctx, m, "udp")
+	if err == nil && r.Truncated {
+		r, err = c.exchange(ctx, m, "tcp")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't look up CAA records for %q: %w", name, err)
+	}
+
+	switch r.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+		break
+	default:
+		return nil, fmt.Errorf("can't look up CAA records for %q: %s", name, dns.RcodeToString[r.Rcode])
+	}
+
+	var records []*dns.CAA
+	for _, rr := range r.Answer {
+		caa, ok := rr.(*dns.CAA)
+		if ok {
+			records = append(records, caa)
+		}
+	}
+
+	return records, nil
+}
+
+// relevantRecords climbs the DNS tree from the domain up to the top level domain and returns the first non-empty
+// CAA record set together with the domain it was found at.
+func (c *Checker) relevantRecords(ctx context.Context, domain string) (string, []*dns.CAA, error) {
+	labels := dns.SplitDomainName(domain)
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		records, err := c.lookupCAA(ctx, name)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(records) != 0 {
+			return name, records, nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+// parseIssueValue splits the value of an issue or issuewild property into the issuer domain name and parameters.
+func parseIssueValue(value string) (string, map[string]string, error) {
+	parts := strings.Split(value, ";")
+	issuer := strings.TrimSpace(parts[0])
+
+	params := map[string]string{}
+	for _, part := range parts[1:] {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, fmt.Errorf("invalid parameter %q", part)
+		}
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+
+	return issuer, params, nil
+}
+
+func matchesIdentity(issuer string, identities []string) bool {
+	for _, identity := range identities {
+		if strings.EqualFold(strings.TrimSuffix(issuer, "."), strings.TrimSuffix(identity, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns whether the issue or issuewild property value authorizes the order.
+func allows(value string, params Params) (bool, error) {
+	issuer, issueParams, err := parseIssueValue(value)
+	if err != nil {
+		return false, err
+	}
+
+	if !matchesIdentity(issuer, params.Identities) {
+		return false, nil
+	}
+
+	accountURI, ok := issueParams[paramAccountURI]
+	if ok && accountURI != params.AccountURI {
+		return false, nil
+	}
+
+	validationMethods, ok := issueParams[paramValidationMethods]
+	if ok {
+		found := false
+		for _, method := range strings.Split(validationMethods, ",") {
+			if strings.TrimSpace(method) == params.ValidationMethod {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// evaluate returns an empty string if the record set allows issuing the certificate and the reason otherwise.
+func evaluate(records []*dns.CAA, wildcard bool, params Params) string {
+	var issue, issueWild []*dns.CAA
+	for _, r := range records {
+		switch strings.ToLower(r.Tag) {
+		case tagIssue:
+			issue = append(issue, r)
+		case tagIssueWild:
+			issueWild = append(issueWild, r)
+		case tagIodef:
+			continue
+		default:
+			if r.Flag&flagCritical != 0 {
+				return fmt.Sprintf("unknown critical property %q", r.Tag)
+			}
+		}
+	}
+
+	relevant := issue
+	tag := tagIssue
+	if wildcard && len(issueWild) != 0 {
+		relevant = issueWild
+		tag = tagIssueWild
+	}
+
+	if len(relevant) == 0 {
+		return ""
+	}
+
+	var values []string
+	for _, r := range relevant {
+		values = append(values, r.Value)
+
+		ok, err := allows(r.Value, params)
+		if err != nil {
+			klog.V(4).Infof("Ignoring invalid CAA %s record %q: %v", tag, r.Value, err)
+			continue
+		}
+		if ok {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("none of the %s records %q authorize %q with account %q and validation method %q", tag, values, params.Identities, params.AccountURI, params.ValidationMethod)
+}
+
+// Check returns ForbiddenError if the CAA records don't allow issuing a certificate for the domain.
+// Other errors mean the records couldn't be looked up.
+func (c *Checker) Check(ctx context.Context, domain string, params Params) error {
+	wildcard := strings.HasPrefix(domain, "*.")
+	name := strings.TrimPrefix(domain, "*.")
+
+	relevantDomain, records, err := c.relevantRecords(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	reason := evaluate(records, wildcard, params)
+	if len(reason) != 0 {
+		return &ForbiddenError{
+			Domain:         domain,
+			RelevantDomain: relevantDomain,
+			Reason:         reason,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package caa
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startResolver starts a local DNS server answering CAA queries from the records, keyed by FQDN.
+func startResolver(t *testing.T, records map[string][]string) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			for _, q := range r.Question {
+				if q.Qtype != dns.TypeCAA {
+					continue
+				}
+				for _, s := range records[strings.ToLower(q.Name)] {
+					rr, err := dns.NewRR(q.Name + " 300 IN CAA " + s)
+					if err != nil {
+						t.Errorf("invalid record %q: %v", s, err)
+						continue
+					}
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			err := w.WriteMsg(m)
+			if err != nil {
+				t.Error(err)
+			}
+		}),
+	}
+	go func() {
+		err := server.ActivateAndServe()
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	<-started
+
+	return pc.LocalAddr().String(), func() {
+		err := server.Shutdown()
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	params := Params{
+		Identities:       []string{"letsencrypt.org"},
+		AccountURI:       "https://acme-v02.api.letsencrypt.org/acme/acct/1",
+		ValidationMethod: "http-01",
+	}
+
+	tt := []struct {
+		name              string
+		records           map[string][]string
+		domain            string
+		expectedForbidden bool
+		expectedRelevant  string
+	}{
+		{
+			name:              "no records allow everything",
+			records:           nil,
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "issue record for the CA",
+			records: map[string][]string{
+				"foo.example.com.": {`0 issue "letsencrypt.org"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "issue record for another CA",
+			records: map[string][]string{
+				"foo.example.com.": {`0 issue "ca.example.net"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "foo.example.com",
+		},
+		{
+			name: "empty issue record forbids everyone",
+			records: map[string][]string{
+				"foo.example.com.": {`0 issue ";"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "foo.example.com",
+		},
+		{
+			name: "any of the issue records is enough",
+			records: map[string][]string{
+				"foo.example.com.": {`0 issue "ca.example.net"`, `0 issue "LetsEncrypt.org."`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "climbs to the parent domain",
+			records: map[string][]string{
+				"example.com.": {`0 issue "ca.example.net"`},
+			},
+			domain:            "a.b.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "example.com",
+		},
+		{
+			name: "closest record set wins",
+			records: map[string][]string{
+				"foo.example.com.": {`0 issue "letsencrypt.org"`},
+				"example.com.":     {`0 issue "ca.example.net"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "matching accounturi",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org; accounturi=https://acme-v02.api.letsencrypt.org/acme/acct/1"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "different accounturi",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org; accounturi=https://acme-v02.api.letsencrypt.org/acme/acct/2"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "example.com",
+		},
+		{
+			name: "matching validationmethods",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org; validationmethods=dns-01,http-01"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "different validationmethods",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org; validationmethods=dns-01"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "example.com",
+		},
+		{
+			name: "issuewild takes precedence for wildcards",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org"`, `0 issuewild ";"`},
+			},
+			domain:            "*.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "example.com",
+		},
+		{
+			name: "issuewild doesn't apply to other names",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org"`, `0 issuewild ";"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "wildcards fall back to issue",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org"`},
+			},
+			domain:            "*.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "iodef only allows everything",
+			records: map[string][]string{
+				"example.com.": {`0 iodef "mailto:security@example.com"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "unknown non-critical property is ignored",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org"`, `0 tbs "unknown"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: false,
+		},
+		{
+			name: "unknown critical property forbids everyone",
+			records: map[string][]string{
+				"example.com.": {`0 issue "letsencrypt.org"`, `128 tbs "unknown"`},
+			},
+			domain:            "foo.example.com",
+			expectedForbidden: true,
+			expectedRelevant:  "example.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver, stop := startResolver(t, tc.records)
+			defer stop()
+
+			c := NewChecker(resolver, 5*time.Second)
+
+			err := c.Check(context.Background(), tc.domain, params)
+
+			var forbidden *ForbiddenError
+			if err != nil && !errors.As(err, &forbidden) {
+				t.Fatal(err)
+			}
+			if (forbidden != nil) != tc.expectedForbidden {
+				t.Fatalf("expected forbidden %t, got %v", tc.expectedForbidden, err)
+			}
+			if forbidden != nil && forbidden.RelevantDomain != tc.expectedRelevant {
+				t.Errorf("expected relevant domain %q, got %q", tc.expectedRelevant, forbidden.RelevantDomain)
+			}
+		})
+	}
+}
+
+func TestResolverFromResolvConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "caa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := filepath.Join(dir, "resolv.conf")
+	err = ioutil.WriteFile(f, []byte("search example.com\nnameserver 10.0.0.10\nnameserver 10.0.0.11\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ResolverFromResolvConf(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "10.0.0.10:53" {
+		t.Errorf("expected %q, got %q", "10.0.0.10:53", got)
+	}
+}
@@ -11,11 +11,15 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	corev1 "k8s.io/api/core/v1"
 	kvalidation "k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -26,13 +30,19 @@ import (
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 
 	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/caa"
 	"github.com/tnozicka/openshift-acme/pkg/cmd/genericclioptions"
 	cmdutil "github.com/tnozicka/openshift-acme/pkg/cmd/util"
+	"github.com/tnozicka/openshift-acme/pkg/config"
 	acmeissuer "github.com/tnozicka/openshift-acme/pkg/controller/issuer/acme"
+	namespacecontroller "github.com/tnozicka/openshift-acme/pkg/controller/namespace"
 	routecontroller "github.com/tnozicka/openshift-acme/pkg/controller/route"
 	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
 	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
+	"github.com/tnozicka/openshift-acme/pkg/sharding"
 	"github.com/tnozicka/openshift-acme/pkg/signals"
+	"github.com/tnozicka/openshift-acme/pkg/webhook"
 )
 
 type Options struct {
@@ -45,41 +55,169 @@ type Options struct {
 	LeaderelectionLeaseDuration time.Duration
 	LeaderelectionRenewDeadline time.Duration
 	LeaderelectionRetryPeriod   time.Duration
+	LeaderelectionLockType      string
+	Shards                      int
+	MaxShardsPerReplica         int
 	CertOrderBackoffInitial     time.Duration
 	CertOrderBackoffMax         time.Duration
 	CertDefaultRSAKeyBitSize    int
+	RenewBefore                 string
+	ProactiveRenewBefore        string
 	Namespaces                  []string
+	NamespaceSelector           string
 	AcmeOrderTimeout            time.Duration
 
-	ExposerImage string
+	ExposerImage     string
+	Http01SolverMode string
+	// ExposerResources, ExposerReplicas, ExposerPodTemplate, DefaultTLS and SelfCheck can only be set in the config file.
+	ExposerResources   corev1.ResourceRequirements
+	ExposerReplicas    int32
+	ExposerPodTemplate *corev1.PodTemplateSpec
+	DefaultTLS         api.DefaultTLSConfig
+	SelfCheck          *api.SelfCheck
+
+	CAACheck    bool
+	CAAResolver string
+
+	WebhookListenAddress string
+	WebhookTLSCertFile   string
+	WebhookTLSKeyFile    string
+	WebhookStatusWriters []string
+
+	ConfigFile string
 
 	restConfig  *restclient.Config
 	kubeClient  kubernetes.Interface
 	routeClient routeclientset.Interface
+
+	renewalWindow     renewal.Window
+	namespaceSelector labels.Selector
+
+	// config is the config file we started with.
+	config *config.ControllerConfig
 }
 
 func NewOptions(streams genericclioptions.IOStreams) *Options {
-	return &Options{
+	o := &Options{
 		IOStreams:  streams,
-		Workers:    10,
 		Kubeconfig: "",
 
-		LeaderelectionLeaseDuration: 60 * time.Second,
-		LeaderelectionRenewDeadline: 35 * time.Second,
-		LeaderelectionRetryPeriod:   10 * time.Second,
-		CertOrderBackoffInitial:     5 * time.Minute,
-		CertOrderBackoffMax:         24 * time.Hour,
-		CertDefaultRSAKeyBitSize:    4096,
-
-		Annotation:       api.DefaultTlsAcmeAnnotation,
 		AcmeOrderTimeout: 15 * time.Minute,
+	}
+	// The flags default to the config defaults.
+	o.applyConfig(config.NewDefaultConfig(), nil)
+
+	return o
+}
+
+// applyConfig sets the options from the config unless the flags were set explicitly, on the command line or through env.
+func (o *Options) applyConfig(c *config.ControllerConfig, flags *pflag.FlagSet) {
+	set := func(name string, apply func()) {
+		if flags != nil && flags.Changed(name) {
+			return
+		}
+		apply()
+	}
+
+	set("annotation", func() { o.Annotation = c.Annotation })
+	set("workers", func() { o.Workers = c.Workers })
+	set("controller-namespace", func() { o.ControllerNamespace = c.ControllerNamespace })
+	set("namespace", func() {
+		o.Namespaces = c.Namespaces
+		if len(o.Namespaces) == 0 {
+			o.Namespaces = []string{metav1.NamespaceAll}
+		}
+	})
+	set("namespace-selector", func() { o.NamespaceSelector = c.NamespaceSelector })
+
+	set("leaderelection-lease-duration", func() { o.LeaderelectionLeaseDuration = c.LeaderElection.LeaseDuration.Duration })
+	set("leaderelection-renew-deadline", func() { o.LeaderelectionRenewDeadline = c.LeaderElection.RenewDeadline.Duration })
+	set("leaderelection-retry-period", func() { o.LeaderelectionRetryPeriod = c.LeaderElection.RetryPeriod.Duration })
+	set("leaderelection-lock-type", func() { o.LeaderelectionLockType = c.LeaderElection.LockType })
+	set("shards", func() { o.Shards = c.LeaderElection.Shards })
+	set("max-shards-per-replica", func() { o.MaxShardsPerReplica = c.LeaderElection.MaxShardsPerReplica })
+
+	set("cert-order-backoff-initial", func() { o.CertOrderBackoffInitial = c.CertOrder.BackoffInitial.Duration })
+	set("cert-order-backoff-max", func() { o.CertOrderBackoffMax = c.CertOrder.BackoffMax.Duration })
+	set("cert-default-rsa-key-bit-size", func() { o.CertDefaultRSAKeyBitSize = c.CertOrder.DefaultRSAKeyBitSize })
+	set("renew-before", func() { o.RenewBefore = c.RenewalWindow.RenewBefore })
+	set("proactive-renew-before", func() { o.ProactiveRenewBefore = c.RenewalWindow.ProactiveRenewBefore })
+
+	set("exposer-image", func() { o.ExposerImage = c.Exposer.Image })
+	set("http01-solver-mode", func() { o.Http01SolverMode = string(c.Exposer.Http01SolverMode) })
+	o.ExposerResources = c.Exposer.Resources
+	o.ExposerReplicas = c.Exposer.Replicas
+	o.ExposerPodTemplate = c.Exposer.PodTemplate
+	o.DefaultTLS = c.DefaultTLS
+	o.SelfCheck = c.SelfCheck
+
+	set("caa-check", func() { o.CAACheck = *c.CAA.Check })
+	set("caa-resolver", func() { o.CAAResolver = c.CAA.Resolver })
+
+	set("webhook-listen-address", func() { o.WebhookListenAddress = c.Webhook.ListenAddress })
+	set("webhook-tls-cert-file", func() { o.WebhookTLSCertFile = c.Webhook.TLSCertFile })
+	set("webhook-tls-key-file", func() { o.WebhookTLSKeyFile = c.Webhook.TLSKeyFile })
+	set("webhook-status-writer", func() { o.WebhookStatusWriters = c.Webhook.StatusWriters })
+}
 
-		ExposerImage: "",
+// LoadConfig applies the config file, if any, to the options that weren't set by flags.
+func (o *Options) LoadConfig(flags *pflag.FlagSet) error {
+	if len(o.ConfigFile) == 0 {
+		return nil
+	}
 
-		Namespaces: []string{metav1.NamespaceAll},
+	var err error
+	o.config, err = config.Load(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+	klog.V(1).Infof("Using config file %q.", o.ConfigFile)
+
+	o.applyConfig(o.config, flags)
+
+	return nil
+}
+
+func (o *Options) routeSettings() routecontroller.Settings {
+	return routecontroller.Settings{
+		CertOrderBackoffInitial:  o.CertOrderBackoffInitial,
+		CertOrderBackoffMax:      o.CertOrderBackoffMax,
+		CertDefaultRSAKeyBitSize: o.CertDefaultRSAKeyBitSize,
+		RenewalWindow:            o.renewalWindow,
+		ExposerImage:             o.ExposerImage,
+		ExposerResources:         o.ExposerResources,
+		ExposerReplicas:          o.ExposerReplicas,
+		ExposerPodTemplate:       o.ExposerPodTemplate,
+		DefaultTLS:               o.DefaultTLS,
+		SelfCheck:                o.SelfCheck,
 	}
 }
 
+// reloadConfig applies the settings that can change at runtime from the changed config file.
+func (o *Options) reloadConfig(c *config.ControllerConfig, flags *pflag.FlagSet, rc *routecontroller.RouteController) {
+	for _, name := range config.RestartRequired(o.config, c) {
+		klog.Warningf("Changing %q in config file %q requires a restart", name, o.ConfigFile)
+	}
+
+	reloaded := *o
+	reloaded.applyConfig(c, flags)
+	if len(reloaded.ExposerImage) == 0 {
+		reloaded.ExposerImage = o.ExposerImage
+	}
+
+	var err error
+	reloaded.renewalWindow, err = renewal.DefaultWindow().Override(reloaded.RenewBefore, reloaded.ProactiveRenewBefore)
+	if err != nil {
+		klog.Errorf("Ignoring changed config file %q: %v", o.ConfigFile, err)
+		return
+	}
+
+	rc.SetSettings(reloaded.routeSettings())
+
+	// Later reloads are compared to the config we have applied so changes requiring a restart are reported only once.
+	o.config = c
+}
+
 func NewOpenshiftAcmeControllerCommand(streams genericclioptions.IOStreams) *cobra.Command {
 	o := NewOptions(streams)
 
@@ -91,7 +229,12 @@ func NewOpenshiftAcmeControllerCommand(streams genericclioptions.IOStreams) *cob
 		RunE: func(cmd *cobra.Command, args []string) error {
 			defer klog.Flush()
 
-			err := o.Validate()
+			err := o.LoadConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			err = o.Validate()
 			if err != nil {
 				return err
 			}
@@ -122,21 +265,37 @@ func NewOpenshiftAcmeControllerCommand(streams genericclioptions.IOStreams) *cob
 
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
 
+	rootCmd.PersistentFlags().StringVar(&o.ConfigFile, "config", o.ConfigFile, fmt.Sprintf("Path to the %s file. Flags and env vars set explicitly take precedence. Renewal, cert order, TLS, self-check and exposer settings are reloaded when the file changes.", config.Kind))
 	rootCmd.PersistentFlags().StringVarP(&o.Annotation, "annotation", "", o.Annotation, "The annotation marking Routes this controller should manage.")
 	rootCmd.PersistentFlags().IntVarP(&o.Workers, "workers", "", o.Workers, "Number of workers to run")
 	rootCmd.PersistentFlags().StringVarP(&o.Kubeconfig, "kubeconfig", "", o.Kubeconfig, "Path to the kubeconfig file")
 	rootCmd.PersistentFlags().StringVarP(&o.ControllerNamespace, "controller-namespace", "", o.ControllerNamespace, "Namespace where the controller is running. Autodetected if run inside a cluster.")
 	rootCmd.PersistentFlags().StringArrayVarP(&o.Namespaces, "namespace", "n", o.Namespaces, "Restricts controller to namespace(s). If not specified controller watches all namespaces.")
+	rootCmd.PersistentFlags().StringVarP(&o.NamespaceSelector, "namespace-selector", "", o.NamespaceSelector, "Restricts controller to namespaces matching the label selector, picking up label changes at runtime. Can't be combined with --namespace.")
 
 	rootCmd.PersistentFlags().DurationVar(&o.LeaderelectionLeaseDuration, "leaderelection-lease-duration", o.LeaderelectionLeaseDuration, "LeaseDuration is the duration that non-leader candidates will wait to force acquire leadership.")
 	rootCmd.PersistentFlags().DurationVar(&o.LeaderelectionRenewDeadline, "leaderelection-renew-deadline", o.LeaderelectionRenewDeadline, "RenewDeadline is the duration that the acting master will retry refreshing leadership before giving up.")
 	rootCmd.PersistentFlags().DurationVar(&o.LeaderelectionRetryPeriod, "leaderelection-retry-period", o.LeaderelectionRetryPeriod, "RetryPeriod is the duration the LeaderElector clients should wait between tries of actions.")
+	rootCmd.PersistentFlags().StringVar(&o.LeaderelectionLockType, "leaderelection-lock-type", o.LeaderelectionLockType, fmt.Sprintf("Type of the leaderelection lock, one of %q, %q or %q. Use %q while migrating from %q to %q.", resourcelock.ConfigMapsResourceLock, resourcelock.ConfigMapsLeasesResourceLock, resourcelock.LeasesResourceLock, resourcelock.ConfigMapsLeasesResourceLock, resourcelock.ConfigMapsResourceLock, resourcelock.LeasesResourceLock))
+	rootCmd.PersistentFlags().IntVar(&o.Shards, "shards", o.Shards, "Number of shards splitting Routes by a hash of namespace/name. Every shard has its own lease so multiple replicas can work at the same time. 1 disables sharding.")
+	rootCmd.PersistentFlags().IntVar(&o.MaxShardsPerReplica, "max-shards-per-replica", o.MaxShardsPerReplica, "Maximum number of shards a single replica owns so the others get some. 0 means no limit.")
 
 	rootCmd.PersistentFlags().DurationVar(&o.CertOrderBackoffInitial, "cert-order-backoff-initial", o.CertOrderBackoffInitial, "Initial value for the exponential backoff guarding retrying failed orders.")
 	rootCmd.PersistentFlags().DurationVar(&o.CertOrderBackoffMax, "cert-order-backoff-max", o.CertOrderBackoffMax, "The upper limit for for the exponential backoff guarding retrying failed orders.")
 	rootCmd.PersistentFlags().IntVar(&o.CertDefaultRSAKeyBitSize, "cert-default-rsa-key-bit-size", o.CertDefaultRSAKeyBitSize, "The default RSA key bit size for new certificates.")
+	rootCmd.PersistentFlags().StringVar(&o.RenewBefore, "renew-before", o.RenewBefore, "The default deadline for renewing certificates as the time remaining until expiry, either a duration (e.g. 720h) or a fraction of the certificate lifetime (e.g. 0.25 or 1/3).")
+	rootCmd.PersistentFlags().StringVar(&o.ProactiveRenewBefore, "proactive-renew-before", o.ProactiveRenewBefore, "The default start of the period where certificate renewals are spread, in the same format as --renew-before.")
 
 	rootCmd.PersistentFlags().StringVarP(&o.ExposerImage, "exposer-image", "", o.ExposerImage, "Image to use for exposing tokens for http based validation. (In standard configuration this contains openshift-acme-exposer binary, but the API is generic.)")
+	rootCmd.PersistentFlags().StringVarP(&o.Http01SolverMode, "http01-solver-mode", "", o.Http01SolverMode, fmt.Sprintf("Mode for solving http-01 challenges. %q creates exposer pods for every challenge in the Route's namespace, %q serves all challenges from a single exposer Deployment in the controller namespace (requires routers allowing Routes for the same host across namespaces).", api.Http01SolverModePerChallenge, api.Http01SolverModeShared))
+
+	rootCmd.PersistentFlags().BoolVar(&o.CAACheck, "caa-check", o.CAACheck, "Check that the CAA records of the domain allow the issuer before creating an order.")
+	rootCmd.PersistentFlags().StringVar(&o.CAAResolver, "caa-resolver", o.CAAResolver, fmt.Sprintf("Address (host:port) of the recursive DNS resolver used for CAA checks. Defaults to the first nameserver in %s.", caa.DefaultResolvConf))
+
+	rootCmd.PersistentFlags().StringVar(&o.WebhookListenAddress, "webhook-listen-address", o.WebhookListenAddress, "Address (e.g. :8443) to serve the validating admission webhook on. Empty disables the webhook.")
+	rootCmd.PersistentFlags().StringVar(&o.WebhookTLSCertFile, "webhook-tls-cert-file", o.WebhookTLSCertFile, "Serving certificate for the admission webhook. Reloaded when it changes.")
+	rootCmd.PersistentFlags().StringVar(&o.WebhookTLSKeyFile, "webhook-tls-key-file", o.WebhookTLSKeyFile, "Private key for the admission webhook serving certificate.")
+	rootCmd.PersistentFlags().StringArrayVar(&o.WebhookStatusWriters, "webhook-status-writer", o.WebhookStatusWriters, fmt.Sprintf("User allowed to change the %q annotation. Defaults to the openshift-acme service account in the controller namespace.", api.AcmeStatusAnnotation))
 
 	cmdutil.InstallKlog(rootCmd)
 
@@ -155,6 +314,51 @@ func (o *Options) Validate() error {
 			errs = append(errs, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errStrings, ", ")))
 		}
 	}
+
+	if len(o.NamespaceSelector) != 0 {
+		var err error
+		o.namespaceSelector, err = labels.Parse(o.NamespaceSelector)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid namespace selector %q: %w", o.NamespaceSelector, err))
+		}
+
+		if len(o.Namespaces) > 1 || (len(o.Namespaces) == 1 && o.Namespaces[0] != metav1.NamespaceAll) {
+			errs = append(errs, fmt.Errorf("--namespace and --namespace-selector are mutually exclusive"))
+		}
+	}
+
+	switch api.Http01SolverMode(o.Http01SolverMode) {
+	case api.Http01SolverModePerChallenge, api.Http01SolverModeShared:
+		break
+	default:
+		errs = append(errs, fmt.Errorf("invalid http01 solver mode %q", o.Http01SolverMode))
+	}
+
+	switch o.LeaderelectionLockType {
+	case resourcelock.ConfigMapsResourceLock, resourcelock.ConfigMapsLeasesResourceLock, resourcelock.LeasesResourceLock:
+		break
+	default:
+		errs = append(errs, fmt.Errorf("invalid leaderelection lock type %q", o.LeaderelectionLockType))
+	}
+
+	if o.Shards < 1 {
+		errs = append(errs, fmt.Errorf("--shards must be at least 1"))
+	}
+
+	if o.MaxShardsPerReplica < 0 {
+		errs = append(errs, fmt.Errorf("--max-shards-per-replica can't be negative"))
+	}
+
+	if len(o.WebhookListenAddress) != 0 && (len(o.WebhookTLSCertFile) == 0 || len(o.WebhookTLSKeyFile) == 0) {
+		errs = append(errs, fmt.Errorf("--webhook-listen-address requires --webhook-tls-cert-file and --webhook-tls-key-file"))
+	}
+
+	var err error
+	o.renewalWindow, err = renewal.DefaultWindow().Override(o.RenewBefore, o.ProactiveRenewBefore)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return errors.NewAggregate(errs)
 	}
@@ -215,7 +419,10 @@ func (o *Options) Complete() error {
 		return fmt.Errorf("can't build route clientset: %w", err)
 	}
 
-	if len(o.Namespaces) == 0 {
+	if o.namespaceSelector != nil {
+		// Selected namespaces are added at runtime but we must always watch our own namespace for global issuers
+		o.Namespaces = []string{o.ControllerNamespace}
+	} else if len(o.Namespaces) == 0 {
 		// empty namespace will lead to creating cluster wide informers
 		o.Namespaces = []string{metav1.NamespaceAll}
 	} else {
@@ -235,6 +442,17 @@ func (o *Options) Complete() error {
 	}
 	klog.V(1).Infof("Managing namespaces: %#v", o.Namespaces)
 
+	if len(o.WebhookStatusWriters) == 0 {
+		o.WebhookStatusWriters = []string{fmt.Sprintf("system:serviceaccount:%s:openshift-acme", o.ControllerNamespace)}
+	}
+
+	if o.CAACheck && len(o.CAAResolver) == 0 {
+		o.CAAResolver, err = caa.ResolverFromResolvConf(caa.DefaultResolvConf)
+		if err != nil {
+			return fmt.Errorf("can't determine CAA resolver: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -263,6 +481,33 @@ func (o *Options) Run(cmd *cobra.Command, streams genericclioptions.IOStreams) e
 		cancel()
 	}()
 
+	// Every replica serves the webhook, not just the leader.
+	if len(o.WebhookListenAddress) != 0 {
+		webhookServer := webhook.NewServer(o.WebhookListenAddress, o.WebhookTLSCertFile, o.WebhookTLSKeyFile, webhook.NewValidator(o.Annotation, o.WebhookStatusWriters))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := webhookServer.Run()
+			if err != nil {
+				klog.Fatalf("Admission webhook failed: %v", err)
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+
+			err := webhookServer.Shutdown(context.TODO())
+			if err != nil {
+				klog.Errorf("Can't shut down admission webhook: %v", err)
+			}
+		}()
+	}
+
 	hostname, err := os.Hostname()
 	if err != nil {
 		return err
@@ -271,65 +516,92 @@ func (o *Options) Run(cmd *cobra.Command, streams genericclioptions.IOStreams) e
 	id := hostname + "_" + string(uuid.NewUUID())
 	klog.V(4).Infof("Leaderelection ID is %q", id)
 
-	// we use the Lease lock type since edits to Leases are less common
-	// and fewer objects in the cluster watch "all Leases".
-	lock := &resourcelock.ConfigMapLock{
-		ConfigMapMeta: metav1.ObjectMeta{
-			Name:      "acme-controller-locks",
-			Namespace: o.ControllerNamespace,
-		},
-		Client: o.kubeClient.CoreV1(),
-		LockConfig: resourcelock.ResourceLockConfig{
-			Identity: id,
-		},
-	}
-
-	leChan := make(chan struct{})
-	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
-		Lock:            lock,
-		LeaseDuration:   o.LeaderelectionLeaseDuration,
-		RenewDeadline:   o.LeaderelectionRenewDeadline,
-		RetryPeriod:     o.LeaderelectionRetryPeriod,
-		ReleaseOnCancel: true,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStartedLeading: func(ctx context.Context) {
-				close(leChan)
-			},
-			OnStoppedLeading: func() {
-				select {
-				case <-leCtx.Done():
-					// Graceful termination, control loops are already stopped
-					klog.Info("leaderelection lock released")
-
-					// fail safe
-					time.AfterFunc(3*time.Second, func() {
-						klog.Fatalf("Failed to exit in time after releasing leaderelection lock")
-					})
-
-				default:
-					// Leader election lost
-					klog.Fatalf("leaderelection lost")
-				}
+	newLock := func(name string) (resourcelock.Interface, error) {
+		return resourcelock.New(
+			o.LeaderelectionLockType,
+			o.ControllerNamespace,
+			name,
+			o.kubeClient.CoreV1(),
+			o.kubeClient.CoordinationV1(),
+			resourcelock.ResourceLockConfig{
+				Identity: id,
 			},
-		},
-		Name: "openshift-acme",
-	})
-	if err != nil {
-		return fmt.Errorf("leaderelection failed: %v", err)
+		)
 	}
 
-	leWg.Add(1)
-	go func() {
-		defer leWg.Done()
-		le.Run(leCtx)
-	}()
+	var shards *sharding.Set
+	if o.Shards > 1 {
+		shards = sharding.NewSet(o.Shards)
 
-	select {
-	case <-leChan:
-		klog.Infof("Acquired leaderelection")
-	case <-stopCh:
-		klog.Info("Interrupted before leaderelection")
-		return nil
+		// Every replica runs the controllers, they only manage the objects from the shards they own.
+		elector, err := sharding.NewElector(shards, o.MaxShardsPerReplica, func(shard int) (resourcelock.Interface, error) {
+			return newLock(fmt.Sprintf("acme-controller-locks-shard-%d", shard))
+		}, o.LeaderelectionLeaseDuration, o.LeaderelectionRenewDeadline, o.LeaderelectionRetryPeriod)
+		if err != nil {
+			return fmt.Errorf("leaderelection failed: %v", err)
+		}
+
+		leWg.Add(1)
+		go func() {
+			defer leWg.Done()
+			elector.Run(leCtx)
+		}()
+	} else {
+		// The default ConfigMapsLeases lock type holds both locks so we can migrate to Leases,
+		// which are cheaper as fewer objects in the cluster watch "all Leases", without two leaders
+		// running during the upgrade.
+		lock, err := newLock("acme-controller-locks")
+		if err != nil {
+			return fmt.Errorf("leaderelection failed: %v", err)
+		}
+
+		leChan := make(chan struct{})
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   o.LeaderelectionLeaseDuration,
+			RenewDeadline:   o.LeaderelectionRenewDeadline,
+			RetryPeriod:     o.LeaderelectionRetryPeriod,
+			ReleaseOnCancel: true,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					close(leChan)
+				},
+				OnStoppedLeading: func() {
+					select {
+					case <-leCtx.Done():
+						// Graceful termination, control loops are already stopped
+						klog.Info("leaderelection lock released")
+
+						// fail safe
+						time.AfterFunc(3*time.Second, func() {
+							klog.Fatalf("Failed to exit in time after releasing leaderelection lock")
+						})
+
+					default:
+						// Leader election lost
+						klog.Fatalf("leaderelection lost")
+					}
+				},
+			},
+			Name: "openshift-acme",
+		})
+		if err != nil {
+			return fmt.Errorf("leaderelection failed: %v", err)
+		}
+
+		leWg.Add(1)
+		go func() {
+			defer leWg.Done()
+			le.Run(leCtx)
+		}()
+
+		select {
+		case <-leChan:
+			klog.Infof("Acquired leaderelection")
+		case <-stopCh:
+			klog.Info("Interrupted before leaderelection")
+			return nil
+		}
 	}
 
 	klog.Infof("loglevel is set to %q", cmdutil.GetLoglevel())
@@ -337,12 +609,43 @@ func (o *Options) Run(cmd *cobra.Command, streams genericclioptions.IOStreams) e
 	kubeInformersForNamespaces := kubeinformers.NewKubeInformersForNamespaces(o.kubeClient, o.Namespaces)
 	routeInformersForNamespaces := routeinformers.NewRouteInformersForNamespaces(o.routeClient, o.Namespaces)
 
-	ac := acmeissuer.NewAccountController(o.kubeClient, kubeInformersForNamespaces)
+	ac := acmeissuer.NewAccountController(o.kubeClient, kubeInformersForNamespaces, shards)
+
+	var caaChecker *caa.Checker
+	if o.CAACheck {
+		klog.V(1).Infof("Checking CAA records using resolver %q", o.CAAResolver)
+		caaChecker = caa.NewChecker(o.CAAResolver, caa.DefaultTimeout)
+	}
+
+	// Only the cluster-wide deployment can sync Secrets into other namespaces.
+	var secretSyncInformers *routecontroller.SecretSyncInformers
+	if o.namespaceSelector != nil || (len(o.Namespaces) == 1 && o.Namespaces[0] == metav1.NamespaceAll) {
+		secretSyncInformers = routecontroller.NewSecretSyncInformers(o.kubeClient)
+	}
 
-	rc := routecontroller.NewRouteController(o.Annotation, o.CertOrderBackoffInitial, o.CertOrderBackoffMax, o.CertDefaultRSAKeyBitSize, o.ExposerImage, o.ControllerNamespace, o.kubeClient, kubeInformersForNamespaces, o.routeClient, routeInformersForNamespaces)
+	rc := routecontroller.NewRouteController(o.Annotation, o.routeSettings(), api.Http01SolverMode(o.Http01SolverMode), o.ControllerNamespace, caaChecker, shards, secretSyncInformers, o.kubeClient, kubeInformersForNamespaces, o.routeClient, routeInformersForNamespaces)
 
 	kubeInformersForNamespaces.Start(stopCh)
 	routeInformersForNamespaces.Start(stopCh)
+	if secretSyncInformers != nil {
+		secretSyncInformers.Start(stopCh)
+	}
+
+	if o.namespaceSelector != nil {
+		klog.V(1).Infof("Managing namespaces matching selector %q", o.namespaceSelector.String())
+
+		namespaceInformers := informers.NewSharedInformerFactoryWithOptions(o.kubeClient, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = o.namespaceSelector.String()
+		}))
+		nc := namespacecontroller.NewNamespaceController(o.ControllerNamespace, o.routeClient, namespaceInformers.Core().V1().Namespaces(), kubeInformersForNamespaces, routeInformersForNamespaces)
+		namespaceInformers.Start(stopCh)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nc.Run(ctx, o.Workers)
+		}()
+	}
 
 	wg.Add(1)
 	go func() {
@@ -350,6 +653,16 @@ func (o *Options) Run(cmd *cobra.Command, streams genericclioptions.IOStreams) e
 		rc.Run(ctx, o.Workers)
 	}()
 
+	if o.config != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config.Watch(ctx, o.ConfigFile, config.DefaultReloadInterval, func(c *config.ControllerConfig) {
+				o.reloadConfig(c, cmd.Flags(), rc)
+			})
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
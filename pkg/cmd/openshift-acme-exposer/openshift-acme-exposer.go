@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"k8s.io/klog"
 
@@ -25,17 +29,46 @@ import (
 type Options struct {
 	genericclioptions.IOStreams
 
-	ResponseFile string
-	Port         uint16
-	ListenIP     string
+	ResponseFile             string
+	ResponseFilePollInterval time.Duration
+	Port                     uint16
+	ListenIP                 string
+	APIListenAddress         string
+	APITokenFile             string
+	MetricsListenAddress     string
+	AccessLogFormat          string
+	ReadTimeout              time.Duration
+	WriteTimeout             time.Duration
+	IdleTimeout              time.Duration
+	RateLimit                float64
+	RateLimitBurst           int
+	TrustForwardedFor        bool
+
+	apiToken string
 }
 
+const (
+	AccessLogFormatNone = ""
+	AccessLogFormatJSON = "json"
+)
+
 func NewExposerOptions(streams genericclioptions.IOStreams) *Options {
 	return &Options{
-		IOStreams:    streams,
-		ResponseFile: "",
-		Port:         5000,
-		ListenIP:     "0.0.0.0",
+		IOStreams:                streams,
+		ResponseFile:             "",
+		ResponseFilePollInterval: 2 * time.Second,
+		Port:                     5000,
+		ListenIP:                 "0.0.0.0",
+		APIListenAddress:         "",
+		APITokenFile:             "",
+		MetricsListenAddress:     "",
+		AccessLogFormat:          AccessLogFormatNone,
+		ReadTimeout:              10 * time.Second,
+		WriteTimeout:             10 * time.Second,
+		IdleTimeout:              60 * time.Second,
+		RateLimit:                0,
+		RateLimitBurst:           10,
+		TrustForwardedFor:        false,
 	}
 }
 
@@ -80,9 +113,21 @@ func NewOpenShiftAcmeExposerCommand(streams genericclioptions.IOStreams) *cobra.
 
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
 
-	rootCmd.PersistentFlags().StringVarP(&o.ResponseFile, "response-file", "f", o.ResponseFile, "File containing data to expose using format `URI Response`.")
+	rootCmd.PersistentFlags().StringVarP(&o.ResponseFile, "response-file", "f", o.ResponseFile, "File containing data to expose using format `Host URI Response` or `URI Response` (matching any host).")
 	rootCmd.PersistentFlags().Uint16VarP(&o.Port, "port", "p", o.Port, "Port for http-01 server")
 	rootCmd.PersistentFlags().StringVarP(&o.ListenIP, "listen-ip", "l", o.ListenIP, "Listen address for http-01 server")
+	rootCmd.PersistentFlags().DurationVarP(&o.ResponseFilePollInterval, "response-file-poll-interval", "", o.ResponseFilePollInterval, "Interval for checking the response file for changes and reloading it. Zero disables reloading.")
+	rootCmd.PersistentFlags().StringVarP(&o.APIListenAddress, "api-listen-address", "", o.APIListenAddress, "Address (host:port) for the API managing responses. Empty disables the API.")
+	rootCmd.PersistentFlags().StringVarP(&o.APITokenFile, "api-token-file", "", o.APITokenFile, "File containing the bearer token required by the API managing responses.")
+
+	rootCmd.PersistentFlags().StringVarP(&o.MetricsListenAddress, "metrics-listen-address", "", o.MetricsListenAddress, "Address (host:port) for exposing Prometheus metrics. Empty disables metrics.")
+	rootCmd.PersistentFlags().StringVarP(&o.AccessLogFormat, "access-log-format", "", o.AccessLogFormat, fmt.Sprintf("Format of access logs written to stdout. Supported values: %q (disabled), %q.", AccessLogFormatNone, AccessLogFormatJSON))
+	rootCmd.PersistentFlags().DurationVarP(&o.ReadTimeout, "read-timeout", "", o.ReadTimeout, "Maximum duration for reading the entire request. Zero means no timeout.")
+	rootCmd.PersistentFlags().DurationVarP(&o.WriteTimeout, "write-timeout", "", o.WriteTimeout, "Maximum duration before timing out writes of the response. Zero means no timeout.")
+	rootCmd.PersistentFlags().DurationVarP(&o.IdleTimeout, "idle-timeout", "", o.IdleTimeout, "Maximum amount of time to wait for the next request on a keep-alive connection. Zero means no timeout.")
+	rootCmd.PersistentFlags().Float64VarP(&o.RateLimit, "rate-limit", "", o.RateLimit, "Maximum number of requests per second from a single client IP. Zero disables rate limiting.")
+	rootCmd.PersistentFlags().IntVarP(&o.RateLimitBurst, "rate-limit-burst", "", o.RateLimitBurst, "Maximum burst of requests from a single client IP.")
+	rootCmd.PersistentFlags().BoolVarP(&o.TrustForwardedFor, "trust-x-forwarded-for", "", o.TrustForwardedFor, "Determine the client IP from X-Forwarded-For header set by the router. Enable only when all traffic comes through a router appending the header.")
 
 	cmdutil.InstallKlog(rootCmd)
 
@@ -104,10 +149,62 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("invalid listen IP %q: %s", o.ListenIP, strings.Join(errs, ", "))
 	}
 
+	if o.ResponseFilePollInterval < 0 {
+		return fmt.Errorf("response file poll interval can't be negative")
+	}
+
+	if len(o.APIListenAddress) != 0 {
+		_, _, err := net.SplitHostPort(o.APIListenAddress)
+		if err != nil {
+			return fmt.Errorf("invalid API listen address %q: %w", o.APIListenAddress, err)
+		}
+
+		if len(o.APITokenFile) == 0 {
+			return fmt.Errorf("API requires a token file")
+		}
+	}
+
+	if len(o.MetricsListenAddress) != 0 {
+		_, _, err := net.SplitHostPort(o.MetricsListenAddress)
+		if err != nil {
+			return fmt.Errorf("invalid metrics listen address %q: %w", o.MetricsListenAddress, err)
+		}
+	}
+
+	switch o.AccessLogFormat {
+	case AccessLogFormatNone, AccessLogFormatJSON:
+	default:
+		return fmt.Errorf("unsupported access log format %q", o.AccessLogFormat)
+	}
+
+	if o.ReadTimeout < 0 || o.WriteTimeout < 0 || o.IdleTimeout < 0 {
+		return fmt.Errorf("timeouts can't be negative")
+	}
+
+	if o.RateLimit < 0 {
+		return fmt.Errorf("rate limit can't be negative")
+	}
+
+	if o.RateLimit > 0 && o.RateLimitBurst < 1 {
+		return fmt.Errorf("rate limit burst has to be at least 1")
+	}
+
 	return nil
 }
 
 func (o *Options) Complete() error {
+	if len(o.APIListenAddress) != 0 {
+		bytes, err := ioutil.ReadFile(o.APITokenFile)
+		if err != nil {
+			return fmt.Errorf("can't read API token file: %w", err)
+		}
+
+		o.apiToken = strings.TrimSpace(string(bytes))
+		if len(o.apiToken) == 0 {
+			return fmt.Errorf("API token file %q is empty", o.APITokenFile)
+		}
+	}
+
 	return nil
 }
 
@@ -121,26 +218,107 @@ func (o *Options) Run(cmd *cobra.Command, out io.Writer) error {
 
 	klog.Infof("loglevel is set to %q", cmdutil.GetLoglevel())
 
-	bytes, err := ioutil.ReadFile(o.ResponseFile)
-	if err != nil {
-		return err
-	}
-
 	server := httpserver.NewServer(fmt.Sprintf("%s:%d", o.ListenIP, o.Port), nil)
+	server.ReadTimeout = o.ReadTimeout
+	server.WriteTimeout = o.WriteTimeout
+	server.IdleTimeout = o.IdleTimeout
+	server.TrustForwardedFor = o.TrustForwardedFor
+	if o.RateLimit > 0 {
+		server.RateLimiter = httpserver.NewIPRateLimiter(rate.Limit(o.RateLimit), o.RateLimitBurst)
+	}
+	if o.AccessLogFormat == AccessLogFormatJSON {
+		server.AccessLog = o.Out
+	}
 
-	err = server.ParseData(bytes)
+	_, err := server.LoadResponseFile(o.ResponseFile)
 	if err != nil {
 		return err
 	}
 
 	var wg sync.WaitGroup
-	errCh := make(chan error, 2)
+	errCh := make(chan error, 6)
+
+	if o.ResponseFilePollInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				changed, err := server.LoadResponseFile(o.ResponseFile)
+				if err != nil {
+					// Keep serving the previous data, the file might be in the middle of an update.
+					klog.Errorf("Can't reload response file: %v", err)
+					return
+				}
+
+				if changed {
+					klog.V(2).Infof("Reloaded response file %q", o.ResponseFile)
+				}
+			}, o.ResponseFilePollInterval)
+		}()
+	}
+
+	if len(o.APIListenAddress) != 0 {
+		apiServer := httpserver.NewAPIServer(o.APIListenAddress, o.apiToken, server)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := apiServer.Run()
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+
+			err := apiServer.Shutdown(context.TODO())
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}()
+	}
+
+	if len(o.MetricsListenAddress) != 0 {
+		metricsServer := httpserver.NewMetricsServer(o.MetricsListenAddress)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := metricsServer.Run()
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			<-ctx.Done()
+
+			err := metricsServer.Shutdown(context.TODO())
+			if err != nil {
+				errCh <- err
+				return
+			}
+		}()
+	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
-		err = server.Run()
+		err := server.Run()
 		if err != nil {
 			errCh <- err
 			return
@@ -0,0 +1,136 @@
+package openshift_acme
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+)
+
+type IssuersOptions struct {
+	*Options
+
+	AllNamespaces bool
+}
+
+func NewIssuersCommand(o *Options) *cobra.Command {
+	iso := &IssuersOptions{
+		Options:       o,
+		AllNamespaces: false,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "issuers",
+		Short: "Show cert issuers and their ACME account state",
+		Long:  "Show cert issuers available to Routes in the namespace, including the global issuers from the controller namespace, and their ACME account state.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer klog.Flush()
+
+			err := iso.Complete(iso.AllNamespaces)
+			if err != nil {
+				return err
+			}
+
+			return iso.Run()
+		},
+	}
+
+	cmd.Flags().BoolVarP(&iso.AllNamespaces, "all-namespaces", "A", iso.AllNamespaces, "Show issuers in all namespaces.")
+
+	return cmd
+}
+
+func (o *IssuersOptions) Run() error {
+	namespaces := []string{o.namespace}
+	if !o.AllNamespaces && len(o.ControllerNamespace) != 0 && o.ControllerNamespace != o.namespace {
+		namespaces = append(namespaces, o.ControllerNamespace)
+	}
+
+	var configMaps []*corev1.ConfigMap
+	for _, namespace := range namespaces {
+		list, err := o.kubeClient.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{
+			LabelSelector: api.AccountLabelSet.AsSelector().String(),
+		})
+		if err != nil {
+			return fmt.Errorf("can't list issuers: %w", err)
+		}
+
+		for i := range list.Items {
+			configMaps = append(configMaps, &list.Items[i])
+		}
+	}
+
+	sort.Slice(configMaps, func(i, j int) bool {
+		if configMaps[i].Namespace != configMaps[j].Namespace {
+			return configMaps[i].Namespace < configMaps[j].Namespace
+		}
+		return configMaps[i].Name < configMaps[j].Name
+	})
+
+	return printIssuers(o.Out, configMaps)
+}
+
+func printIssuers(out io.Writer, configMaps []*corev1.ConfigMap) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+
+	_, err := fmt.Fprintln(w, "NAMESPACE\tNAME\tPRIORITY\tDIRECTORY\tACCOUNT URI\tSTATUS\tCONTACTS\tREVOCATION")
+	if err != nil {
+		return err
+	}
+
+	for _, cm := range configMaps {
+		_, err = fmt.Fprintln(w, strings.Join(issuerRow(cm), "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func issuerRow(cm *corev1.ConfigMap) []string {
+	priority := cm.Annotations[api.AcmePriorityAnnotation]
+	if len(priority) == 0 {
+		priority = "0"
+	}
+
+	row := []string{cm.Namespace, cm.Name, priority}
+
+	certIssuer, err := controllerutils.CertIssuerFromConfigMap(cm)
+	if err != nil {
+		klog.Warning(err)
+		return append(row, "<invalid>", "", "", "", "")
+	}
+
+	revocationPolicy := string(certIssuer.RevocationPolicy)
+	if len(revocationPolicy) == 0 {
+		revocationPolicy = string(api.RevocationPolicyNever)
+	}
+
+	if certIssuer.Type != api.CertIssuerTypeAcme || certIssuer.AcmeCertIssuer == nil {
+		return append(row, fmt.Sprintf("<%s>", certIssuer.Type), "", "", "", revocationPolicy)
+	}
+
+	account := certIssuer.AcmeCertIssuer.Account
+
+	accountURI := account.Status.URI
+	if len(accountURI) == 0 {
+		accountURI = "<unregistered>"
+	}
+
+	accountStatus := account.Status.AccountStatus
+	if len(accountStatus) == 0 {
+		accountStatus = "<unknown>"
+	}
+
+	return append(row, certIssuer.AcmeCertIssuer.DirectoryURL, accountURI, accountStatus, strings.Join(account.Contacts, ","), revocationPolicy)
+}
@@ -0,0 +1,139 @@
+package openshift_acme
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/cmd/genericclioptions"
+	cmdutil "github.com/tnozicka/openshift-acme/pkg/cmd/util"
+	cmdversion "github.com/tnozicka/openshift-acme/pkg/cmd/version"
+	"github.com/tnozicka/openshift-acme/pkg/version"
+)
+
+// Options are shared by all subcommands.
+type Options struct {
+	genericclioptions.IOStreams
+
+	Kubeconfig          string
+	Context             string
+	Namespace           string
+	ControllerNamespace string
+	Annotation          string
+
+	namespace   string
+	kubeClient  kubernetes.Interface
+	routeClient routeclientset.Interface
+}
+
+func NewOptions(streams genericclioptions.IOStreams) *Options {
+	return &Options{
+		IOStreams:           streams,
+		Kubeconfig:          "",
+		Context:             "",
+		Namespace:           "",
+		ControllerNamespace: "",
+		Annotation:          api.DefaultTlsAcmeAnnotation,
+	}
+}
+
+func NewOpenshiftAcmeCommand(streams genericclioptions.IOStreams) *cobra.Command {
+	o := NewOptions(streams)
+
+	// Parent command to which all subcommands are added.
+	rootCmd := &cobra.Command{
+		Use:   "openshift-acme",
+		Short: "openshift-acme inspects and manages certificates provisioned by openshift-acme-controller.",
+		Long:  "openshift-acme inspects and manages certificates provisioned by openshift-acme-controller.\n\nFind more information at https://github.com/tnozicka/openshift-acme",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			err := cmdutil.ReadFlagsFromEnv("OPENSHIFT_ACME_", cmd)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
+
+	rootCmd.PersistentFlags().StringVarP(&o.Kubeconfig, "kubeconfig", "", o.Kubeconfig, "Path to the kubeconfig file. Defaults to KUBECONFIG environment variable or ~/.kube/config.")
+	rootCmd.PersistentFlags().StringVarP(&o.Context, "context", "", o.Context, "The name of the kubeconfig context to use.")
+	rootCmd.PersistentFlags().StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "Namespace of the Routes. Defaults to the namespace from kubeconfig.")
+	rootCmd.PersistentFlags().StringVarP(&o.ControllerNamespace, "controller-namespace", "", o.ControllerNamespace, "Namespace where the controller is running and global issuers are stored. Autodetected if run inside a cluster, otherwise required.")
+	rootCmd.PersistentFlags().StringVarP(&o.Annotation, "annotation", "", o.Annotation, "The annotation marking Routes the controller manages.")
+
+	rootCmd.AddCommand(NewStatusCommand(o))
+	rootCmd.AddCommand(NewRenewCommand(o))
+	rootCmd.AddCommand(NewRevokeCommand(o))
+	rootCmd.AddCommand(NewIssuersCommand(o))
+	rootCmd.AddCommand(cmdversion.NewVersionCommand("openshift-acme", version.Get(), streams.Out))
+
+	cmdutil.InstallKlog(rootCmd)
+
+	return rootCmd
+}
+
+func (o *Options) Complete(allNamespaces bool) error {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.Kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: o.Context,
+	})
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("can't load kubeconfig: %w", err)
+	}
+
+	switch {
+	case allNamespaces:
+		o.namespace = metav1.NamespaceAll
+	case len(o.Namespace) != 0:
+		o.namespace = o.Namespace
+	default:
+		o.namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return fmt.Errorf("can't determine namespace: %w", err)
+		}
+	}
+	klog.V(4).Infof("Using namespace %q", o.namespace)
+
+	if len(o.ControllerNamespace) == 0 {
+		// Autodetect if running inside a cluster, the same way the controller does. Global issuers can't be
+		// guessed from the kubeconfig namespace as it would silently pick the wrong ones.
+		bytes, err := ioutil.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("--controller-namespace is required when not running inside a cluster")
+			}
+			return fmt.Errorf("can't autodetect controller namespace: %w", err)
+		}
+		o.ControllerNamespace = string(bytes)
+	}
+	klog.V(4).Infof("Using controller namespace %q", o.ControllerNamespace)
+
+	o.kubeClient, err = kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("can't build kubernetes clientset: %w", err)
+	}
+
+	o.routeClient, err = routeclientset.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("can't build route clientset: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package openshift_acme
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+type RenewOptions struct {
+	*Options
+}
+
+func NewRenewCommand(o *Options) *cobra.Command {
+	ro := &RenewOptions{
+		Options: o,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "renew ROUTE...",
+		Short: "Force re-issuance of certificates for managed Routes",
+		Long:  fmt.Sprintf("Force re-issuance of certificates for managed Routes by setting the %q annotation.", api.AcmeRenewRequestedAtAnnotation),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer klog.Flush()
+
+			err := ro.Validate(args)
+			if err != nil {
+				return err
+			}
+
+			err = ro.Complete(false)
+			if err != nil {
+				return err
+			}
+
+			return ro.Run(args)
+		},
+	}
+
+	return cmd
+}
+
+func (o *RenewOptions) Validate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one Route name is required")
+	}
+
+	return nil
+}
+
+func (o *RenewOptions) Run(args []string) error {
+	for _, name := range args {
+		err := requestRenewal(o.Options, name, time.Now())
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(o.Out, "route/%s renewal requested\n", name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func renewPatch(now time.Time) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				api.AcmeRenewRequestedAtAnnotation: now.UTC().Format(time.RFC3339),
+			},
+		},
+	})
+}
+
+// requestRenewal annotates a managed Route so the controller re-issues its certificate.
+func requestRenewal(o *Options, name string, now time.Time) error {
+	route, err := o.routeClient.RouteV1().Routes(o.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !util.IsManaged(route, o.Annotation) {
+		return fmt.Errorf("route %s/%s isn't managed by openshift-acme, it's missing %q annotation", route.Namespace, route.Name, o.Annotation)
+	}
+
+	patch, err := renewPatch(now)
+	if err != nil {
+		return err
+	}
+
+	_, err = o.routeClient.RouteV1().Routes(o.namespace).Patch(name, types.MergePatchType, patch)
+	if err != nil {
+		return fmt.Errorf("can't annotate Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	return nil
+}
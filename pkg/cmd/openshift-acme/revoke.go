@@ -0,0 +1,184 @@
+package openshift_acme
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	routecontroller "github.com/tnozicka/openshift-acme/pkg/controller/route"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+	"github.com/tnozicka/openshift-acme/pkg/helpers"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+type RevokeOptions struct {
+	*Options
+
+	DirectoryURL string
+	Reason       int
+	Renew        bool
+	Timeout      time.Duration
+}
+
+func NewRevokeCommand(o *Options) *cobra.Command {
+	ro := &RevokeOptions{
+		Options:      o,
+		DirectoryURL: "",
+		Reason:       int(acme.CRLReasonUnspecified),
+		Renew:        false,
+		Timeout:      60 * time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "revoke ROUTE",
+		Short: "Revoke the certificate of a managed Route",
+		Long:  "Revoke the certificate of a managed Route using the certificate private key. The Route keeps serving the revoked certificate until it is renewed, use --renew to request a new one right away.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer klog.Flush()
+
+			err := ro.Validate(args)
+			if err != nil {
+				return err
+			}
+
+			err = ro.Complete(false)
+			if err != nil {
+				return err
+			}
+
+			return ro.Run(args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&ro.DirectoryURL, "directory-url", "", ro.DirectoryURL, "ACME directory URL of the CA that issued the certificate. Defaults to the directory of the Route's issuer.")
+	cmd.Flags().IntVarP(&ro.Reason, "reason", "", ro.Reason, "CRL reason code as defined in RFC 5280, section 5.3.1.")
+	cmd.Flags().BoolVarP(&ro.Renew, "renew", "", ro.Renew, "Request a new certificate after the revocation.")
+	cmd.Flags().DurationVarP(&ro.Timeout, "timeout", "", ro.Timeout, "Timeout for the ACME requests.")
+
+	return cmd
+}
+
+func (o *RevokeOptions) Validate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("exactly one Route name is required")
+	}
+
+	// Reason code 7 is unused and reasons above 10 aren't defined.
+	if o.Reason < int(acme.CRLReasonUnspecified) || o.Reason == 7 || o.Reason > int(acme.CRLReasonAACompromise) {
+		return fmt.Errorf("invalid CRL reason code %d", o.Reason)
+	}
+
+	if o.Timeout <= 0 {
+		return fmt.Errorf("timeout has to be positive")
+	}
+
+	return nil
+}
+
+func (o *RevokeOptions) Run(name string) error {
+	route, err := o.routeClient.RouteV1().Routes(o.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !util.IsManaged(route, o.Annotation) {
+		return fmt.Errorf("route %s/%s isn't managed by openshift-acme, it's missing %q annotation", route.Namespace, route.Name, o.Annotation)
+	}
+
+	routeWithCertificate, err := routecontroller.RouteWithCertificate(route, func(namespace, name string) (*corev1.Secret, error) {
+		return o.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return err
+	}
+	tls := routeWithCertificate.Spec.TLS
+	if tls == nil || len(tls.Certificate) == 0 || len(tls.Key) == 0 {
+		return fmt.Errorf("route %s/%s has no certificate", route.Namespace, route.Name)
+	}
+
+	certificate, err := util.CertificateFromPEM([]byte(tls.Certificate))
+	if err != nil {
+		return fmt.Errorf("can't decode certificate from Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	key, err := helpers.PrivateKeyFromPEM([]byte(tls.Key))
+	if err != nil {
+		return fmt.Errorf("can't decode private key from Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	directoryURL, err := o.directoryURLForRoute(route)
+	if err != nil {
+		return err
+	}
+	klog.V(2).Infof("Revoking certificate for Route %s/%s using directory %q", route.Namespace, route.Name, directoryURL)
+
+	client := &acme.Client{
+		DirectoryURL: directoryURL,
+		UserAgent:    "github.com/tnozicka/openshift-acme",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
+	defer cancel()
+
+	// Signing with the certificate key proves the control over the certificate
+	// so we don't need access to the account key.
+	revoked, err := routecontroller.RevokeCertificate(ctx, client, key, certificate, acme.CRLReasonCode(o.Reason))
+	if err != nil {
+		return fmt.Errorf("can't revoke certificate for Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	if revoked {
+		_, err = fmt.Fprintf(o.Out, "route/%s certificate revoked\n", route.Name)
+	} else {
+		_, err = fmt.Fprintf(o.Out, "route/%s certificate has already been revoked\n", route.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !o.Renew {
+		return nil
+	}
+
+	err = requestRenewal(o.Options, route.Name, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(o.Out, "route/%s renewal requested\n", route.Name)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (o *RevokeOptions) directoryURLForRoute(route *routev1.Route) (string, error) {
+	if len(o.DirectoryURL) != 0 {
+		return o.DirectoryURL, nil
+	}
+
+	issuerConfigMaps, err := controllerutils.IssuerConfigMapsForObject(route.ObjectMeta, o.ControllerNamespace, controllerutils.ClientConfigMapGetter{Client: o.kubeClient})
+	if err != nil {
+		return "", fmt.Errorf("can't determine issuer for Route %s/%s, use --directory-url to specify it explicitly: %w", route.Namespace, route.Name, err)
+	}
+
+	certIssuer, err := controllerutils.CertIssuerFromConfigMap(issuerConfigMaps[0])
+	if err != nil {
+		return "", err
+	}
+
+	if certIssuer.Type != api.CertIssuerTypeAcme || certIssuer.AcmeCertIssuer == nil {
+		return "", fmt.Errorf("issuer %s/%s isn't an ACME issuer", issuerConfigMaps[0].Namespace, issuerConfigMaps[0].Name)
+	}
+
+	return certIssuer.AcmeCertIssuer.DirectoryURL, nil
+}
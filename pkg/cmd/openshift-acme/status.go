@@ -0,0 +1,190 @@
+package openshift_acme
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+type StatusOptions struct {
+	*Options
+
+	AllNamespaces bool
+}
+
+func NewStatusCommand(o *Options) *cobra.Command {
+	so := &StatusOptions{
+		Options:       o,
+		AllNamespaces: false,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "status [ROUTE...]",
+		Short: "Show certificate status of managed Routes",
+		Long:  "Show certificate status of managed Routes including the issuer, certificate expiry, order state and the last error.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defer klog.Flush()
+
+			err := so.Validate(args)
+			if err != nil {
+				return err
+			}
+
+			err = so.Complete(so.AllNamespaces)
+			if err != nil {
+				return err
+			}
+
+			return so.Run(args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&so.AllNamespaces, "all-namespaces", "A", so.AllNamespaces, "Show Routes in all namespaces.")
+
+	return cmd
+}
+
+func (o *StatusOptions) Validate(args []string) error {
+	if o.AllNamespaces && len(args) != 0 {
+		return fmt.Errorf("Route names can't be used together with --all-namespaces")
+	}
+
+	return nil
+}
+
+func (o *StatusOptions) Run(args []string) error {
+	var routes []*routev1.Route
+	if len(args) != 0 {
+		for _, name := range args {
+			route, err := o.routeClient.RouteV1().Routes(o.namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			routes = append(routes, route)
+		}
+	} else {
+		list, err := o.routeClient.RouteV1().Routes(o.namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			route := &list.Items[i]
+			if util.IsManaged(route, o.Annotation) {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Namespace != routes[j].Namespace {
+			return routes[i].Namespace < routes[j].Namespace
+		}
+		return routes[i].Name < routes[j].Name
+	})
+
+	return printRouteStatuses(o.Out, routes, o.AllNamespaces, time.Now())
+}
+
+func printRouteStatuses(out io.Writer, routes []*routev1.Route, withNamespace bool, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+
+	header := []string{"NAME", "HOST", "ISSUER", "EXPIRES", "ORDER", "FAILURES", "MESSAGE"}
+	if withNamespace {
+		header = append([]string{"NAMESPACE"}, header...)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(header, "\t"))
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		row := routeStatusRow(route, now)
+		if withNamespace {
+			row = append([]string{route.Namespace}, row...)
+		}
+
+		_, err = fmt.Fprintln(w, strings.Join(row, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func routeStatusRow(route *routev1.Route, now time.Time) []string {
+	issuer := route.Annotations[api.AcmeCertIssuerName]
+	if len(issuer) == 0 {
+		issuer = "<default>"
+	}
+
+	expires := "<none>"
+	if route.Spec.TLS != nil && len(route.Spec.TLS.Certificate) != 0 {
+		certificate, err := util.CertificateFromPEM([]byte(route.Spec.TLS.Certificate))
+		if err != nil {
+			expires = "<invalid>"
+		} else {
+			expires = formatExpiry(certificate.NotAfter, now)
+		}
+	}
+
+	orderStatus := "<none>"
+	failures := "0"
+	message := ""
+
+	status := &api.Status{}
+	err := yaml.Unmarshal([]byte(route.Annotations[api.AcmeStatusAnnotation]), status)
+	if err != nil {
+		message = fmt.Sprintf("can't decode status: %v", err)
+	} else {
+		if len(status.ProvisioningStatus.OrderStatus) != 0 {
+			orderStatus = status.ProvisioningStatus.OrderStatus
+		}
+		failures = strconv.Itoa(status.ProvisioningStatus.Failures)
+		message = statusMessage(status)
+
+		// Passthrough Routes keep the certificate in the synced Secret, the controller reports its expiry.
+		if expires == "<none>" && status.CertificateExpiresAt != nil {
+			expires = formatExpiry(*status.CertificateExpiresAt, now)
+		}
+	}
+
+	return []string{route.Name, route.Spec.Host, issuer, expires, orderStatus, failures, message}
+}
+
+func formatExpiry(notAfter, now time.Time) string {
+	if now.After(notAfter) {
+		return fmt.Sprintf("%s (expired)", notAfter.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (%s)", notAfter.UTC().Format(time.RFC3339), duration.ShortHumanDuration(notAfter.Sub(now)))
+}
+
+// statusMessage returns the most relevant problem from the status.
+func statusMessage(status *api.Status) string {
+	var messages []string
+	for _, c := range status.Conditions {
+		if c.Status == api.ConditionTrue {
+			messages = append(messages, fmt.Sprintf("%s: %s", c.Type, c.Message))
+		}
+	}
+
+	if status.ProvisioningStatus.OrderError != nil {
+		messages = append(messages, status.ProvisioningStatus.OrderError.Detail)
+	}
+
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,110 @@
+package openshift_acme
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestRouteStatusRow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name     string
+		route    *routev1.Route
+		expected []string
+	}{
+		{
+			name: "route without status",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: routev1.RouteSpec{
+					Host: "foo.example.com",
+				},
+			},
+			expected: []string{"foo", "foo.example.com", "<default>", "<none>", "<none>", "0", ""},
+		},
+		{
+			name: "route with failed order",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						api.AcmeCertIssuerName: "staging",
+						api.AcmeStatusAnnotation: `
+provisioningStatus:
+  orderStatus: invalid
+  failures: 3
+  orderError:
+    detail: DNS problem
+conditions:
+- type: RateLimited
+  status: "True"
+  message: too many certificates
+- type: Other
+  status: "False"
+  message: ignored
+`,
+					},
+				},
+				Spec: routev1.RouteSpec{
+					Host: "foo.example.com",
+					TLS: &routev1.TLSConfig{
+						Certificate: "garbage",
+					},
+				},
+			},
+			expected: []string{"foo", "foo.example.com", "staging", "<invalid>", "invalid", "3", "RateLimited: too many certificates; DNS problem"},
+		},
+		{
+			name: "passthrough route with expiry in status",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						api.AcmeStatusAnnotation: `
+certificateExpiresAt: "2020-01-31T00:00:00Z"
+provisioningStatus:
+  orderStatus: valid
+`,
+					},
+				},
+				Spec: routev1.RouteSpec{
+					Host: "foo.example.com",
+					TLS: &routev1.TLSConfig{
+						Termination: routev1.TLSTerminationPassthrough,
+					},
+				},
+			},
+			expected: []string{"foo", "foo.example.com", "<default>", "2020-01-31T00:00:00Z (30d)", "valid", "0", ""},
+		},
+		{
+			name: "route with invalid status",
+			route: &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						api.AcmeStatusAnnotation: "[",
+					},
+				},
+			},
+			expected: []string{"foo", "", "<default>", "<none>", "<none>", "0", "can't decode status: error converting YAML to JSON: yaml: line 1: did not find expected node content"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := routeStatusRow(tc.route, now)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	kvalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	routecontroller "github.com/tnozicka/openshift-acme/pkg/controller/route"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
+)
+
+const (
+	DefaultWorkers                     = 10
+	DefaultLeaderElectionLeaseDuration = 60 * time.Second
+	DefaultLeaderElectionRenewDeadline = 35 * time.Second
+	DefaultLeaderElectionRetryPeriod   = 10 * time.Second
+	DefaultLeaderElectionLockType      = resourcelock.ConfigMapsLeasesResourceLock
+	DefaultCertOrderBackoffInitial     = 5 * time.Minute
+	DefaultCertOrderBackoffMax         = 24 * time.Hour
+	DefaultCertRSAKeyBitSize           = 4096
+
+	// MinCertRSAKeyBitSize is the smallest RSA key size CAs accept.
+	MinCertRSAKeyBitSize = 2048
+
+	// DefaultReloadInterval is how often the config file is checked for changes.
+	// Kubelet updates mounted ConfigMaps in about a minute anyway.
+	DefaultReloadInterval = 10 * time.Second
+)
+
+// SetDefaults sets the defaults for all unset fields.
+func SetDefaults(c *ControllerConfig) {
+	if len(c.APIVersion) == 0 {
+		c.APIVersion = APIVersion
+	}
+	if len(c.Kind) == 0 {
+		c.Kind = Kind
+	}
+
+	if len(c.Annotation) == 0 {
+		c.Annotation = api.DefaultTlsAcmeAnnotation
+	}
+	if c.Workers == 0 {
+		c.Workers = DefaultWorkers
+	}
+
+	le := &c.LeaderElection
+	if le.LeaseDuration.Duration == 0 {
+		le.LeaseDuration.Duration = DefaultLeaderElectionLeaseDuration
+	}
+	if le.RenewDeadline.Duration == 0 {
+		le.RenewDeadline.Duration = DefaultLeaderElectionRenewDeadline
+	}
+	if le.RetryPeriod.Duration == 0 {
+		le.RetryPeriod.Duration = DefaultLeaderElectionRetryPeriod
+	}
+	if len(le.LockType) == 0 {
+		le.LockType = DefaultLeaderElectionLockType
+	}
+	if le.Shards == 0 {
+		le.Shards = 1
+	}
+
+	if c.CertOrder.BackoffInitial.Duration == 0 {
+		c.CertOrder.BackoffInitial.Duration = DefaultCertOrderBackoffInitial
+	}
+	if c.CertOrder.BackoffMax.Duration == 0 {
+		c.CertOrder.BackoffMax.Duration = DefaultCertOrderBackoffMax
+	}
+	if c.CertOrder.DefaultRSAKeyBitSize == 0 {
+		c.CertOrder.DefaultRSAKeyBitSize = DefaultCertRSAKeyBitSize
+	}
+
+	if len(c.RenewalWindow.RenewBefore) == 0 {
+		c.RenewalWindow.RenewBefore = renewal.DefaultRenewBefore
+	}
+	if len(c.RenewalWindow.ProactiveRenewBefore) == 0 {
+		c.RenewalWindow.ProactiveRenewBefore = renewal.DefaultProactiveRenewBefore
+	}
+
+	if len(c.Exposer.Http01SolverMode) == 0 {
+		c.Exposer.Http01SolverMode = api.Http01SolverModePerChallenge
+	}
+	if c.Exposer.Resources.Requests == nil && c.Exposer.Resources.Limits == nil {
+		c.Exposer.Resources = api.DefaultExposerResources()
+	}
+	if c.Exposer.Replicas == 0 {
+		c.Exposer.Replicas = api.DefaultExposerReplicas
+	}
+
+	if c.CAA.Check == nil {
+		check := false
+		c.CAA.Check = &check
+	}
+}
+
+// NewDefaultConfig returns the config used when there is no config file.
+func NewDefaultConfig() *ControllerConfig {
+	c := &ControllerConfig{}
+	SetDefaults(c)
+	return c
+}
+
+func validatePositiveDuration(d metav1.Duration, fldPath *field.Path) field.ErrorList {
+	if d.Duration <= 0 {
+		return field.ErrorList{field.Invalid(fldPath, d.Duration.String(), "must be positive")}
+	}
+	return nil
+}
+
+func validateExposerPodTemplate(template *corev1.PodTemplateSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := fldPath.Child("spec")
+	for i, v := range template.Spec.Volumes {
+		if v.Name == routecontroller.ExposerVolumeName {
+			allErrs = append(allErrs, field.Forbidden(specPath.Child("volumes").Index(i).Child("name"), fmt.Sprintf("%q is reserved for the controller", v.Name)))
+		}
+	}
+
+	containerNames := make(map[string]struct{}, len(template.Spec.Containers))
+	for i, c := range template.Spec.Containers {
+		namePath := specPath.Child("containers").Index(i).Child("name")
+		if len(c.Name) == 0 {
+			allErrs = append(allErrs, field.Required(namePath, ""))
+			continue
+		}
+		_, found := containerNames[c.Name]
+		if found {
+			allErrs = append(allErrs, field.Duplicate(namePath, c.Name))
+			continue
+		}
+		containerNames[c.Name] = struct{}{}
+	}
+
+	return allErrs
+}
+
+// Validate validates the defaulted config.
+func Validate(c *ControllerConfig) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if c.APIVersion != APIVersion {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("apiVersion"), c.APIVersion, []string{APIVersion}))
+	}
+	if c.Kind != Kind {
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("kind"), c.Kind, []string{Kind}))
+	}
+
+	if c.Workers < 1 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("workers"), c.Workers, "must be at least 1"))
+	}
+
+	if len(c.ControllerNamespace) != 0 {
+		for _, msg := range kvalidation.ValidateNamespaceName(c.ControllerNamespace, false) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("controllerNamespace"), c.ControllerNamespace, msg))
+		}
+	}
+
+	for i, namespace := range c.Namespaces {
+		if namespace == metav1.NamespaceAll {
+			continue
+		}
+		for _, msg := range kvalidation.ValidateNamespaceName(namespace, false) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("namespaces").Index(i), namespace, msg))
+		}
+	}
+
+	if len(c.NamespaceSelector) != 0 {
+		_, err := labels.Parse(c.NamespaceSelector)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("namespaceSelector"), c.NamespaceSelector, err.Error()))
+		}
+		if len(c.Namespaces) != 0 {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("namespaceSelector"), "can't be combined with namespaces"))
+		}
+	}
+
+	lePath := field.NewPath("leaderElection")
+	allErrs = append(allErrs, validatePositiveDuration(c.LeaderElection.LeaseDuration, lePath.Child("leaseDuration"))...)
+	allErrs = append(allErrs, validatePositiveDuration(c.LeaderElection.RenewDeadline, lePath.Child("renewDeadline"))...)
+	allErrs = append(allErrs, validatePositiveDuration(c.LeaderElection.RetryPeriod, lePath.Child("retryPeriod"))...)
+	if c.LeaderElection.RenewDeadline.Duration >= c.LeaderElection.LeaseDuration.Duration {
+		allErrs = append(allErrs, field.Invalid(lePath.Child("renewDeadline"), c.LeaderElection.RenewDeadline.Duration.String(), "must be less than leaseDuration"))
+	}
+	switch c.LeaderElection.LockType {
+	case resourcelock.ConfigMapsResourceLock, resourcelock.ConfigMapsLeasesResourceLock, resourcelock.LeasesResourceLock:
+		break
+	default:
+		allErrs = append(allErrs, field.NotSupported(lePath.Child("lockType"), c.LeaderElection.LockType, []string{
+			resourcelock.ConfigMapsResourceLock,
+			resourcelock.ConfigMapsLeasesResourceLock,
+			resourcelock.LeasesResourceLock,
+		}))
+	}
+	if c.LeaderElection.Shards < 1 {
+		allErrs = append(allErrs, field.Invalid(lePath.Child("shards"), c.LeaderElection.Shards, "must be at least 1"))
+	}
+	if c.LeaderElection.MaxShardsPerReplica < 0 {
+		allErrs = append(allErrs, field.Invalid(lePath.Child("maxShardsPerReplica"), c.LeaderElection.MaxShardsPerReplica, "can't be negative"))
+	}
+
+	certOrderPath := field.NewPath("certOrder")
+	allErrs = append(allErrs, validatePositiveDuration(c.CertOrder.BackoffInitial, certOrderPath.Child("backoffInitial"))...)
+	if c.CertOrder.BackoffMax.Duration < c.CertOrder.BackoffInitial.Duration {
+		allErrs = append(allErrs, field.Invalid(certOrderPath.Child("backoffMax"), c.CertOrder.BackoffMax.Duration.String(), "can't be less than backoffInitial"))
+	}
+	if c.CertOrder.DefaultRSAKeyBitSize < MinCertRSAKeyBitSize {
+		allErrs = append(allErrs, field.Invalid(certOrderPath.Child("defaultRSAKeyBitSize"), c.CertOrder.DefaultRSAKeyBitSize, fmt.Sprintf("must be at least %d", MinCertRSAKeyBitSize)))
+	}
+
+	allErrs = append(allErrs, routecontroller.ValidateRenewalWindow(&c.RenewalWindow, field.NewPath("renewalWindow"))...)
+	allErrs = append(allErrs, routecontroller.ValidateDefaultTLS(&c.DefaultTLS, field.NewPath("defaultTLS"))...)
+
+	exposerPath := field.NewPath("exposer")
+	switch c.Exposer.Http01SolverMode {
+	case api.Http01SolverModePerChallenge, api.Http01SolverModeShared:
+		break
+	default:
+		allErrs = append(allErrs, field.NotSupported(exposerPath.Child("http01SolverMode"), c.Exposer.Http01SolverMode, []string{
+			string(api.Http01SolverModePerChallenge),
+			string(api.Http01SolverModeShared),
+		}))
+	}
+	for name, request := range c.Exposer.Resources.Requests {
+		limit, ok := c.Exposer.Resources.Limits[name]
+		if ok && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(exposerPath.Child("resources", "requests").Key(string(name)), request.String(), "must be less than or equal to the limit"))
+		}
+	}
+	if c.Exposer.Replicas < 1 {
+		allErrs = append(allErrs, field.Invalid(exposerPath.Child("replicas"), c.Exposer.Replicas, "must be at least 1"))
+	}
+	if c.Exposer.PodTemplate != nil {
+		allErrs = append(allErrs, validateExposerPodTemplate(c.Exposer.PodTemplate, exposerPath.Child("podTemplate"))...)
+	}
+
+	if c.SelfCheck != nil {
+		allErrs = append(allErrs, routecontroller.ValidateSelfCheck(c.SelfCheck, field.NewPath("selfCheck"))...)
+	}
+
+	if len(c.Webhook.ListenAddress) != 0 {
+		webhookPath := field.NewPath("webhook")
+		if len(c.Webhook.TLSCertFile) == 0 {
+			allErrs = append(allErrs, field.Required(webhookPath.Child("tlsCertFile"), "required when listenAddress is set"))
+		}
+		if len(c.Webhook.TLSKeyFile) == 0 {
+			allErrs = append(allErrs, field.Required(webhookPath.Child("tlsKeyFile"), "required when listenAddress is set"))
+		}
+	}
+
+	return allErrs
+}
+
+// Parse decodes, defaults and validates the config. Unknown fields are rejected to catch typos.
+func Parse(data []byte) (*ControllerConfig, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse config: %w", err)
+	}
+
+	c := &ControllerConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode config: %w", err)
+	}
+
+	if len(c.APIVersion) == 0 || len(c.Kind) == 0 {
+		return nil, fmt.Errorf("config has to specify apiVersion %q and kind %q", APIVersion, Kind)
+	}
+
+	SetDefaults(c)
+
+	errs := Validate(c)
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("invalid config: %w", errs.ToAggregate())
+	}
+
+	return c, nil
+}
+
+func Load(path string) (*ControllerConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file %q: %w", path, err)
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config file %q: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// RestartRequired returns the settings that differ between the configs and can't be changed at runtime.
+func RestartRequired(old, new *ControllerConfig) []string {
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"annotation", old.Annotation, new.Annotation},
+		{"workers", old.Workers, new.Workers},
+		{"controllerNamespace", old.ControllerNamespace, new.ControllerNamespace},
+		{"namespaces", old.Namespaces, new.Namespaces},
+		{"namespaceSelector", old.NamespaceSelector, new.NamespaceSelector},
+		{"leaderElection", old.LeaderElection, new.LeaderElection},
+		{"exposer.http01SolverMode", old.Exposer.Http01SolverMode, new.Exposer.Http01SolverMode},
+		{"caa", old.CAA, new.CAA},
+		{"webhook", old.Webhook, new.Webhook},
+	}
+
+	var changed []string
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			changed = append(changed, f.name)
+		}
+	}
+
+	return changed
+}
+
+// Watch calls the handler with the new config whenever the content of the file changes.
+// Invalid configs are logged and ignored.
+func Watch(ctx context.Context, path string, interval time.Duration, handler func(*ControllerConfig)) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		klog.Errorf("Can't read config file %q: %v", path, err)
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		newData, err := ioutil.ReadFile(path)
+		if err != nil {
+			klog.Errorf("Can't read config file %q: %v", path, err)
+			return
+		}
+
+		if bytes.Equal(newData, data) {
+			return
+		}
+		data = newData
+
+		c, err := Parse(newData)
+		if err != nil {
+			klog.Errorf("Ignoring changed config file %q: %v", path, err)
+			return
+		}
+
+		klog.Infof("Reloading config file %q", path)
+		handler(c)
+	}, interval)
+}
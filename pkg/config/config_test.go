@@ -0,0 +1,359 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		name          string
+		data          string
+		expectedError string
+		// expectedFields lists the fields that have to be reported as invalid.
+		expectedFields []string
+		verify         func(t *testing.T, c *ControllerConfig)
+	}{
+		{
+			name: "minimal config is defaulted",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+`,
+			verify: func(t *testing.T, c *ControllerConfig) {
+				if !reflect.DeepEqual(c, NewDefaultConfig()) {
+					t.Errorf("expected default config, got %#v", c)
+				}
+			},
+		},
+		{
+			name: "full config",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+workers: 3
+namespaces:
+- foo
+- bar
+leaderElection:
+  lockType: leases
+  shards: 4
+  maxShardsPerReplica: 2
+certOrder:
+  backoffInitial: 1m
+  defaultRSAKeyBitSize: 2048
+renewalWindow:
+  renewBefore: 1/3
+defaultTLS:
+  termination: reencrypt
+exposer:
+  http01SolverMode: Shared
+  resources:
+    requests:
+      cpu: 10m
+selfCheck:
+  mode: Router
+`,
+			verify: func(t *testing.T, c *ControllerConfig) {
+				if c.Workers != 3 {
+					t.Errorf("expected 3 workers, got %d", c.Workers)
+				}
+				if !reflect.DeepEqual(c.Namespaces, []string{"foo", "bar"}) {
+					t.Errorf("unexpected namespaces %v", c.Namespaces)
+				}
+				if c.LeaderElection.LockType != "leases" || c.LeaderElection.Shards != 4 || c.LeaderElection.MaxShardsPerReplica != 2 {
+					t.Errorf("unexpected leader election config %#v", c.LeaderElection)
+				}
+				if c.LeaderElection.LeaseDuration.Duration != DefaultLeaderElectionLeaseDuration {
+					t.Errorf("expected default lease duration, got %v", c.LeaderElection.LeaseDuration.Duration)
+				}
+				if c.CertOrder.BackoffInitial.Duration != time.Minute || c.CertOrder.BackoffMax.Duration != DefaultCertOrderBackoffMax {
+					t.Errorf("unexpected cert order config %#v", c.CertOrder)
+				}
+				if c.RenewalWindow.RenewBefore != "1/3" || len(c.RenewalWindow.ProactiveRenewBefore) == 0 {
+					t.Errorf("unexpected renewal window %#v", c.RenewalWindow)
+				}
+				if c.DefaultTLS.Termination != "reencrypt" {
+					t.Errorf("unexpected default TLS %#v", c.DefaultTLS)
+				}
+				if c.Exposer.Http01SolverMode != api.Http01SolverModeShared {
+					t.Errorf("unexpected solver mode %q", c.Exposer.Http01SolverMode)
+				}
+				cpu := c.Exposer.Resources.Requests["cpu"]
+				if cpu.Cmp(resource.MustParse("10m")) != 0 || c.Exposer.Resources.Limits != nil {
+					t.Errorf("exposer resources from the config must not be merged with the defaults, got %#v", c.Exposer.Resources)
+				}
+				if c.SelfCheck == nil || c.SelfCheck.Mode != api.SelfCheckModeRouter {
+					t.Errorf("unexpected self-check %#v", c.SelfCheck)
+				}
+				if c.CAA.Check == nil || *c.CAA.Check {
+					t.Errorf("expected CAA check to default to false")
+				}
+			},
+		},
+		{
+			name: "CAA check can be enabled",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+caa:
+  check: true
+`,
+			verify: func(t *testing.T, c *ControllerConfig) {
+				if c.CAA.Check == nil || !*c.CAA.Check {
+					t.Errorf("expected CAA check to be enabled")
+				}
+			},
+		},
+		{
+			name: "exposer pod template",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+exposer:
+  replicas: 1
+  podTemplate:
+    spec:
+      nodeSelector:
+        node-role.kubernetes.io/infra: ""
+      imagePullSecrets:
+      - name: registry
+      containers:
+      - name: exposer
+        image: registry.example.com/openshift-acme-exposer:latest
+`,
+			verify: func(t *testing.T, c *ControllerConfig) {
+				if c.Exposer.Replicas != 1 {
+					t.Errorf("expected 1 exposer replica, got %d", c.Exposer.Replicas)
+				}
+				template := c.Exposer.PodTemplate
+				if template == nil {
+					t.Fatal("expected exposer pod template")
+				}
+				if _, ok := template.Spec.NodeSelector["node-role.kubernetes.io/infra"]; !ok || len(template.Spec.ImagePullSecrets) != 1 {
+					t.Errorf("unexpected exposer pod template %#v", template.Spec)
+				}
+				if len(template.Spec.Containers) != 1 || template.Spec.Containers[0].Image != "registry.example.com/openshift-acme-exposer:latest" {
+					t.Errorf("unexpected exposer containers %#v", template.Spec.Containers)
+				}
+			},
+		},
+		{
+			name:          "missing apiVersion",
+			data:          `workers: 3`,
+			expectedError: "has to specify apiVersion",
+		},
+		{
+			name: "unsupported version",
+			data: `
+apiVersion: config.acme.openshift.io/v2
+kind: ControllerConfig
+`,
+			expectedError: "apiVersion",
+		},
+		{
+			name: "unknown field",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+wrokers: 3
+`,
+			expectedError: "unknown field",
+		},
+		{
+			name: "invalid exposer pod template",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+exposer:
+  replicas: -1
+  podTemplate:
+    spec:
+      containers:
+      - name: exposer
+      - name: exposer
+      - image: proxy:latest
+      volumes:
+      - name: exposer-data
+        emptyDir: {}
+`,
+			expectedError: "invalid config",
+			expectedFields: []string{
+				"exposer.replicas",
+				"exposer.podTemplate.spec.volumes[0].name",
+				"exposer.podTemplate.spec.containers[1].name",
+				"exposer.podTemplate.spec.containers[2].name",
+			},
+		},
+		{
+			name: "invalid values",
+			data: `
+apiVersion: config.acme.openshift.io/v1alpha1
+kind: ControllerConfig
+namespaces:
+- foo
+namespaceSelector: team=a
+leaderElection:
+  lockType: endpoints
+  renewDeadline: 2m
+certOrder:
+  defaultRSAKeyBitSize: 1024
+renewalWindow:
+  renewBefore: soon
+defaultTLS:
+  termination: edgy
+exposer:
+  http01SolverMode: Magic
+  resources:
+    requests:
+      memory: 100Mi
+    limits:
+      memory: 50Mi
+selfCheck:
+  mode: External
+webhook:
+  listenAddress: :8443
+`,
+			expectedError: "invalid config",
+			expectedFields: []string{
+				"namespaceSelector",
+				"leaderElection.lockType",
+				"leaderElection.renewDeadline",
+				"certOrder.defaultRSAKeyBitSize",
+				"renewalWindow.renewBefore",
+				"defaultTLS",
+				"exposer.http01SolverMode",
+				"exposer.resources.requests[memory]",
+				"selfCheck.probeURL",
+				"webhook.tlsCertFile",
+				"webhook.tlsKeyFile",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse([]byte(tc.data))
+
+			if len(tc.expectedError) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedError, err)
+				}
+				for _, field := range tc.expectedFields {
+					if !strings.Contains(err.Error(), field+":") {
+						t.Errorf("expected error for %q, got %v", field, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.verify(t, c)
+		})
+	}
+}
+
+func TestNewDefaultConfig(t *testing.T) {
+	c := NewDefaultConfig()
+
+	errs := Validate(c)
+	if len(errs) != 0 {
+		t.Fatalf("default config is invalid: %v", errs.ToAggregate())
+	}
+
+	if !reflect.DeepEqual(c.Exposer.Resources, api.DefaultExposerResources()) {
+		t.Errorf("expected default exposer resources, got %#v", c.Exposer.Resources)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := NewDefaultConfig()
+
+	reloadable := NewDefaultConfig()
+	reloadable.RenewalWindow.RenewBefore = "1/2"
+	reloadable.CertOrder.BackoffMax.Duration = time.Hour
+	reloadable.Exposer.Image = "quay.io/example/exposer:latest"
+	reloadable.SelfCheck = &api.SelfCheck{Mode: api.SelfCheckModeOff}
+	reloadable.Exposer.Replicas = 1
+	reloadable.Exposer.PodTemplate = &corev1.PodTemplateSpec{}
+	if changed := RestartRequired(old, reloadable); len(changed) != 0 {
+		t.Errorf("expected no changes requiring a restart, got %v", changed)
+	}
+
+	structural := NewDefaultConfig()
+	structural.Workers = 1
+	structural.LeaderElection.Shards = 2
+	structural.Exposer.Http01SolverMode = api.Http01SolverModeShared
+	expected := []string{"workers", "leaderElection", "exposer.http01SolverMode"}
+	if changed := RestartRequired(old, structural); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected %v, got %v", expected, changed)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openshift-acme-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	header := "apiVersion: config.acme.openshift.io/v1alpha1\nkind: ControllerConfig\n"
+	err = ioutil.WriteFile(path, []byte(header+"workers: 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	configs := make(chan *ControllerConfig, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, path, 10*time.Millisecond, func(c *ControllerConfig) {
+			configs <- c
+		})
+	}()
+
+	// Invalid configs are ignored.
+	err = ioutil.WriteFile(path, []byte(header+"workers: -1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = ioutil.WriteFile(path, []byte(header+"workers: 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case c := <-configs:
+		if c.Workers != 2 {
+			t.Errorf("expected reloaded config with 2 workers, got %d", c.Workers)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("config wasn't reloaded")
+	}
+
+	cancel()
+	<-done
+
+	if len(configs) != 0 {
+		t.Errorf("expected a single reload, got %d more", len(configs))
+	}
+}
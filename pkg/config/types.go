@@ -0,0 +1,123 @@
+package config
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+const (
+	APIVersion = "config.acme.openshift.io/v1alpha1"
+	Kind       = "ControllerConfig"
+)
+
+// ControllerConfig holds all settings of the controller. Flags set explicitly take precedence.
+type ControllerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// annotation marks the Routes the controller manages. Defaults to "kubernetes.io/tls-acme".
+	Annotation string `json:"annotation,omitempty"`
+
+	// workers is the number of workers for every queue. Defaults to 10.
+	Workers int `json:"workers,omitempty"`
+
+	// controllerNamespace is the namespace the controller runs in. Autodetected if run inside a cluster.
+	ControllerNamespace string `json:"controllerNamespace,omitempty"`
+
+	// namespaces restricts the controller to the namespaces. Empty watches all namespaces.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// namespaceSelector restricts the controller to namespaces matching the label selector.
+	// Can't be combined with namespaces.
+	NamespaceSelector string `json:"namespaceSelector,omitempty"`
+
+	LeaderElection LeaderElectionConfig `json:"leaderElection,omitempty"`
+
+	CertOrder CertOrderConfig `json:"certOrder,omitempty"`
+
+	// renewalWindow holds the default renewal thresholds. Issuers and Routes can override it.
+	RenewalWindow api.RenewalWindow `json:"renewalWindow,omitempty"`
+
+	// defaultTLS is the TLS config for Routes that don't have one. Issuers and Routes can override it.
+	DefaultTLS api.DefaultTLSConfig `json:"defaultTLS,omitempty"`
+
+	Exposer ExposerConfig `json:"exposer,omitempty"`
+
+	// selfCheck is used for issuers that don't configure the self-check.
+	SelfCheck *api.SelfCheck `json:"selfCheck,omitempty"`
+
+	CAA CAAConfig `json:"caa,omitempty"`
+
+	Webhook WebhookConfig `json:"webhook,omitempty"`
+}
+
+type LeaderElectionConfig struct {
+	// leaseDuration is the duration that non-leader candidates will wait to force acquire leadership. Defaults to 60s.
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+
+	// renewDeadline is the duration that the acting master will retry refreshing leadership before giving up. Defaults to 35s.
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+
+	// retryPeriod is the duration the clients should wait between tries of actions. Defaults to 10s.
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+
+	// lockType is one of configmaps, configmapsleases or leases. Defaults to configmapsleases.
+	LockType string `json:"lockType,omitempty"`
+
+	// shards is the number of shards splitting Routes between replicas. Defaults to 1 which disables sharding.
+	Shards int `json:"shards,omitempty"`
+
+	// maxShardsPerReplica limits the number of shards a single replica owns. Zero means no limit.
+	MaxShardsPerReplica int `json:"maxShardsPerReplica,omitempty"`
+}
+
+type CertOrderConfig struct {
+	// backoffInitial is the initial backoff for retrying failed orders. Defaults to 5m.
+	BackoffInitial metav1.Duration `json:"backoffInitial,omitempty"`
+
+	// backoffMax caps the exponential backoff for retrying failed orders. Defaults to 24h.
+	BackoffMax metav1.Duration `json:"backoffMax,omitempty"`
+
+	// defaultRSAKeyBitSize is the RSA key size for new certificates. Defaults to 4096.
+	DefaultRSAKeyBitSize int `json:"defaultRSAKeyBitSize,omitempty"`
+}
+
+type ExposerConfig struct {
+	// image is the image used for exposing http-01 tokens. Defaults to the OPENSHIFT_ACME_EXPOSER_IMAGE env var.
+	Image string `json:"image,omitempty"`
+
+	// http01SolverMode is either PerChallenge or Shared. Defaults to PerChallenge.
+	Http01SolverMode api.Http01SolverMode `json:"http01SolverMode,omitempty"`
+
+	// resources are the resource requirements of the exposer containers, adjusted to the LimitRanges in the namespace.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// replicas is the number of pods for every exposer. Defaults to 2.
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// podTemplate is merged into the exposer pods to set e.g. node selectors, tolerations, security contexts,
+	// image pull secrets or a priority class. The container named "exposer" is merged into the exposer container;
+	// its command, args, ports and the "exposer-data" volume are always set by the controller.
+	PodTemplate *corev1.PodTemplateSpec `json:"podTemplate,omitempty"`
+}
+
+type CAAConfig struct {
+	// check enables checking CAA records before creating orders. Defaults to false.
+	Check *bool `json:"check,omitempty"`
+
+	// resolver is the host:port of the recursive DNS resolver. Defaults to the first nameserver in /etc/resolv.conf.
+	Resolver string `json:"resolver,omitempty"`
+}
+
+type WebhookConfig struct {
+	// listenAddress is the address to serve the admission webhook on. Empty disables the webhook.
+	ListenAddress string `json:"listenAddress,omitempty"`
+
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+
+	// statusWriters are the users allowed to change the status annotation.
+	// Defaults to the openshift-acme service account in the controller namespace.
+	StatusWriters []string `json:"statusWriters,omitempty"`
+}
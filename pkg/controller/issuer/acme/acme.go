@@ -22,6 +22,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -33,6 +34,7 @@ import (
 	"github.com/tnozicka/openshift-acme/pkg/api"
 	"github.com/tnozicka/openshift-acme/pkg/helpers"
 	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+	"github.com/tnozicka/openshift-acme/pkg/sharding"
 )
 
 const (
@@ -62,11 +64,15 @@ type AccountController struct {
 	recorder record.EventRecorder
 
 	queue workqueue.RateLimitingInterface
+
+	// shards limits the issuers we manage to the shards owned by this replica. Nil manages all of them.
+	shards *sharding.Set
 }
 
 func NewAccountController(
 	kubeClient kubernetes.Interface,
 	kubeInformersForNamespaces kubeinformers.Interface,
+	shards *sharding.Set,
 ) *AccountController {
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(klog.Infof)
@@ -79,6 +85,8 @@ func NewAccountController(
 		recorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: ControllerName}),
 
 		queue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+
+		shards: shards,
 	}
 
 	if len(kubeInformersForNamespaces.Namespaces()) < 1 {
@@ -86,26 +94,44 @@ func NewAccountController(
 	}
 
 	for _, namespace := range kubeInformersForNamespaces.Namespaces() {
-		klog.V(4).Infof("Setting up kube informers for namespace %q", namespace)
-		informers := kubeInformersForNamespaces.InformersFor(namespace)
-
-		informers.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc:    ac.addConfigMap,
-			UpdateFunc: ac.updateConfigMap,
-			DeleteFunc: ac.deleteConfigMap,
-		})
-		ac.cachesToSync = append(ac.cachesToSync, informers.Core().V1().ConfigMaps().Informer().HasSynced)
+		ac.cachesToSync = append(ac.cachesToSync, ac.setUpInformers(namespace, kubeInformersForNamespaces.InformersFor(namespace))...)
+	}
+	kubeInformersForNamespaces.AddNamespaceHandler(func(namespace string, informers informers.SharedInformerFactory) {
+		ac.setUpInformers(namespace, informers)
+	})
 
-		informers.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			// Controller is only provisioning new secret if it is missing so it only cares to reconcile deletes.
-			DeleteFunc: ac.deleteSecret,
+	if shards != nil {
+		// Issuers skipped while another replica owned the shard need to be synced now.
+		shards.AddHandler(func(int) {
+			ac.enqueueAllAccounts()
 		})
-		ac.cachesToSync = append(ac.cachesToSync, informers.Core().V1().Secrets().Informer().HasSynced)
 	}
 
 	return ac
 }
 
+// setUpInformers registers the event handlers for the namespace and returns the caches we need to wait for.
+func (ac *AccountController) setUpInformers(namespace string, informers informers.SharedInformerFactory) []cache.InformerSynced {
+	klog.V(4).Infof("Setting up kube informers for namespace %q", namespace)
+
+	var cachesToSync []cache.InformerSynced
+
+	informers.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    ac.addConfigMap,
+		UpdateFunc: ac.updateConfigMap,
+		DeleteFunc: ac.deleteConfigMap,
+	})
+	cachesToSync = append(cachesToSync, informers.Core().V1().ConfigMaps().Informer().HasSynced)
+
+	informers.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		// Controller is only provisioning new secret if it is missing so it only cares to reconcile deletes.
+		DeleteFunc: ac.deleteSecret,
+	})
+	cachesToSync = append(cachesToSync, informers.Core().V1().Secrets().Informer().HasSynced)
+
+	return cachesToSync
+}
+
 func (ac *AccountController) Run(ctx context.Context, workers int) {
 	defer utilruntime.HandleCrash()
 	defer ac.queue.ShutDown()
@@ -170,6 +196,25 @@ func (ac *AccountController) enqueueAccount(cm *corev1.ConfigMap) {
 	ac.queue.Add(key)
 }
 
+func (ac *AccountController) enqueueAllAccounts() {
+	for _, namespace := range ac.kubeInformersForNamespaces.Namespaces() {
+		informers := ac.kubeInformersForNamespaces.InformersFor(namespace)
+		if informers == nil {
+			continue
+		}
+
+		cms, err := informers.Core().V1().ConfigMaps().Lister().List(api.AccountLabelSet.AsSelector())
+		if err != nil {
+			klog.Errorf("Can't list ConfigMaps in namespace %q: %v", namespace, err)
+			continue
+		}
+
+		for _, cm := range cms {
+			ac.enqueueAccount(cm)
+		}
+	}
+}
+
 func (ac *AccountController) addConfigMap(obj interface{}) {
 	cm := obj.(*corev1.ConfigMap)
 
@@ -278,7 +323,18 @@ func (ac *AccountController) sync(ctx context.Context, key string) error {
 		return err
 	}
 
-	objReadOnly, exists, err := ac.kubeInformersForNamespaces.InformersForOrGlobal(namespace).Core().V1().ConfigMaps().Informer().GetIndexer().GetByKey(key)
+	if !ac.shards.Owns(key) {
+		klog.V(4).Infof("ConfigMap %q belongs to a shard owned by another replica", key)
+		return nil
+	}
+
+	informers := ac.kubeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		klog.V(4).Infof("ConfigMap %q is in a namespace that isn't watched anymore", key)
+		return nil
+	}
+
+	objReadOnly, exists, err := informers.Core().V1().ConfigMaps().Informer().GetIndexer().GetByKey(key)
 	if err != nil {
 		return fmt.Errorf("fetching object with key %q from store failed: %w", key, err)
 	}
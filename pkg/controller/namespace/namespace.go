@@ -0,0 +1,295 @@
+package namespace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
+)
+
+const (
+	// FinalizeWaitInterval is how often we check whether Routes being deleted in a namespace that stopped matching
+	// have been finalized by the route controller.
+	FinalizeWaitInterval = 10 * time.Second
+)
+
+// controllerFinalizers are the Route finalizers the route controller acts upon.
+var controllerFinalizers = []string{
+	api.AcmeRevocationFinalizer,
+	api.AcmeSecretSyncFinalizer,
+}
+
+// NamespaceController starts and stops the per-namespace informers as namespaces become selected or unselected.
+// The namespace informer is expected to be filtered by the namespace selector so namespaces losing the labels
+// are observed as deleted.
+type NamespaceController struct {
+	controllerNamespace string
+
+	routeClient routeclientset.Interface
+
+	namespaceLister corev1listers.NamespaceLister
+
+	kubeInformersForNamespaces  kubeinformers.Interface
+	routeInformersForNamespaces routeinformers.Interface
+
+	cachesToSync []cache.InformerSynced
+
+	queue workqueue.RateLimitingInterface
+}
+
+func NewNamespaceController(
+	controllerNamespace string,
+	routeClient routeclientset.Interface,
+	namespaceInformer corev1informers.NamespaceInformer,
+	kubeInformersForNamespaces kubeinformers.Interface,
+	routeInformersForNamespaces routeinformers.Interface,
+) *NamespaceController {
+	nc := &NamespaceController{
+		controllerNamespace: controllerNamespace,
+
+		routeClient: routeClient,
+
+		namespaceLister: namespaceInformer.Lister(),
+
+		kubeInformersForNamespaces:  kubeInformersForNamespaces,
+		routeInformersForNamespaces: routeInformersForNamespaces,
+
+		queue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    nc.addNamespace,
+		DeleteFunc: nc.deleteNamespace,
+	})
+	nc.cachesToSync = append(nc.cachesToSync, namespaceInformer.Informer().HasSynced)
+
+	return nc
+}
+
+func (nc *NamespaceController) enqueueNamespace(ns *corev1.Namespace) {
+	key, err := cache.MetaNamespaceKeyFunc(ns)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("couldn't get key for namespace object: %w", err))
+		return
+	}
+
+	nc.queue.Add(key)
+}
+
+func (nc *NamespaceController) addNamespace(obj interface{}) {
+	ns := obj.(*corev1.Namespace)
+	klog.V(4).Infof("Adding Namespace %s UID=%s RV=%s", ns.Name, ns.UID, ns.ResourceVersion)
+	nc.enqueueNamespace(ns)
+}
+
+func (nc *NamespaceController) deleteNamespace(obj interface{}) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("couldn't get object from tombstone %#v", obj))
+			return
+		}
+		ns, ok = tombstone.Obj.(*corev1.Namespace)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a Namespace %#v", obj))
+			return
+		}
+	}
+
+	klog.V(4).Infof("Deleting Namespace %s UID=%s RV=%s", ns.Name, ns.UID, ns.ResourceVersion)
+	nc.enqueueNamespace(ns)
+}
+
+func (nc *NamespaceController) sync(ctx context.Context, key string) error {
+	klog.V(4).Infof("Started syncing Namespace %q", key)
+	defer func() {
+		klog.V(4).Infof("Finished syncing Namespace %q", key)
+	}()
+
+	// We always need to watch our own namespace for global issuers and the shared exposer.
+	if key == nc.controllerNamespace {
+		return nil
+	}
+
+	_, err := nc.namespaceLister.Get(key)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return err
+		}
+
+		return nc.releaseNamespace(key)
+	}
+
+	if nc.routeInformersForNamespaces.HasInformersFor(key) {
+		return nil
+	}
+
+	nc.kubeInformersForNamespaces.AddNamespace(key)
+
+	// Routes are enqueued as soon as their informer starts so everything they depend on has to be synced by then.
+	for informerType, synced := range nc.kubeInformersForNamespaces.InformersFor(key).WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("can't sync %v informer for namespace %q", informerType, key)
+		}
+	}
+
+	nc.routeInformersForNamespaces.AddNamespace(key)
+	klog.Infof("Started managing namespace %q", key)
+
+	return nil
+}
+
+func hasControllerFinalizer(route *routev1.Route) bool {
+	for _, f := range route.Finalizers {
+		for _, cf := range controllerFinalizers {
+			if f == cf {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func removeControllerFinalizers(finalizers []string) []string {
+	var res []string
+	for _, f := range finalizers {
+		ours := false
+		for _, cf := range controllerFinalizers {
+			if f == cf {
+				ours = true
+				break
+			}
+		}
+		if !ours {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// releaseNamespace stops managing the namespace without leaving Routes stuck on our finalizers.
+// Routes that are already being deleted are finalized by the route controller first, so we keep
+// the informers until that's done. Once the route informers are gone the route controller can't
+// add the finalizers back and we remove them from the remaining Routes.
+func (nc *NamespaceController) releaseNamespace(namespace string) error {
+	if !nc.kubeInformersForNamespaces.HasInformersFor(namespace) {
+		return nil
+	}
+
+	if nc.routeInformersForNamespaces.HasInformersFor(namespace) {
+		routes, err := nc.routeInformersForNamespaces.InformersFor(namespace).Route().V1().Routes().Lister().Routes(namespace).List(labels.Everything())
+		if err != nil {
+			return fmt.Errorf("can't list Routes in namespace %q: %w", namespace, err)
+		}
+
+		pending := 0
+		for _, route := range routes {
+			if route.DeletionTimestamp != nil && hasControllerFinalizer(route) {
+				pending++
+			}
+		}
+		if pending != 0 {
+			klog.V(2).Infof("Waiting for %d Route(s) being deleted in namespace %q to be finalized before we stop managing it", pending, namespace)
+			nc.queue.AddAfter(namespace, FinalizeWaitInterval)
+			return nil
+		}
+
+		// Stop the Routes first so we don't process any with the kube informers gone.
+		nc.routeInformersForNamespaces.RemoveNamespace(namespace)
+	}
+
+	routes, err := nc.routeClient.RouteV1().Routes(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("can't list Routes in namespace %q: %w", namespace, err)
+	}
+	for i := range routes.Items {
+		route := &routes.Items[i]
+		if !hasControllerFinalizer(route) {
+			continue
+		}
+
+		klog.V(2).Infof("Removing finalizers from Route %s/%s because we stop managing namespace %q", route.Namespace, route.Name, namespace)
+		route.Finalizers = removeControllerFinalizers(route.Finalizers)
+		_, err = nc.routeClient.RouteV1().Routes(namespace).Update(route)
+		if err != nil && !kapierrors.IsNotFound(err) {
+			return fmt.Errorf("can't remove finalizers from Route %s/%s: %w", route.Namespace, route.Name, err)
+		}
+	}
+
+	nc.kubeInformersForNamespaces.RemoveNamespace(namespace)
+	klog.Infof("Stopped managing namespace %q", namespace)
+
+	return nil
+}
+
+func (nc *NamespaceController) processNextItem(ctx context.Context) bool {
+	key, quit := nc.queue.Get()
+	if quit {
+		return false
+	}
+	defer nc.queue.Done(key)
+
+	err := nc.sync(ctx, key.(string))
+
+	if err == nil {
+		nc.queue.Forget(key)
+		return true
+	}
+
+	utilruntime.HandleError(fmt.Errorf("%v failed with : %v", key, err))
+	nc.queue.AddRateLimited(key)
+
+	return true
+}
+
+func (nc *NamespaceController) runWorker(ctx context.Context) {
+	for nc.processNextItem(ctx) {
+	}
+}
+
+func (nc *NamespaceController) Run(ctx context.Context, workers int) {
+	defer utilruntime.HandleCrash()
+
+	var wg sync.WaitGroup
+	klog.Info("Starting Namespace controller")
+	defer func() {
+		klog.Info("Shutting down Namespace controller")
+		nc.queue.ShutDown()
+		wg.Wait()
+		klog.Info("Namespace controller shut down")
+	}()
+
+	synced := cache.WaitForNamedCacheSync("namespace controller", ctx.Done(), nc.cachesToSync...)
+	if !synced {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, nc.runWorker, time.Second)
+		}()
+	}
+
+	<-ctx.Done()
+}
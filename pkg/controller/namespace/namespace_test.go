@@ -0,0 +1,176 @@
+package namespace
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	routefake "github.com/openshift/client-go/route/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
+)
+
+func TestSync(t *testing.T) {
+	now := metav1.Now()
+	newRoute := func(name string, deletionTimestamp *metav1.Time, finalizers ...string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "tenant",
+				Name:              name,
+				DeletionTimestamp: deletionTimestamp,
+				Finalizers:        finalizers,
+			},
+		}
+	}
+
+	tt := []struct {
+		name               string
+		watchedNamespaces  []string
+		selectedNamespaces []string
+		routes             []*routev1.Route
+		key                string
+		expectedNamespaces []string
+		expectedHandled    []string
+		expectedFinalizers map[string][]string
+	}{
+		{
+			name:               "selected namespace gets informers",
+			watchedNamespaces:  []string{"acme"},
+			selectedNamespaces: []string{"tenant"},
+			key:                "tenant",
+			expectedNamespaces: []string{"acme", "tenant"},
+			expectedHandled:    []string{"tenant"},
+		},
+		{
+			name:               "already watched namespace is kept",
+			watchedNamespaces:  []string{"acme", "tenant"},
+			selectedNamespaces: []string{"tenant"},
+			key:                "tenant",
+			expectedNamespaces: []string{"acme", "tenant"},
+		},
+		{
+			name:               "unselected namespace loses informers",
+			watchedNamespaces:  []string{"acme", "tenant"},
+			selectedNamespaces: []string{},
+			key:                "tenant",
+			expectedNamespaces: []string{"acme"},
+		},
+		{
+			name:               "unselected namespace waits for Routes being deleted to be finalized",
+			watchedNamespaces:  []string{"acme", "tenant"},
+			selectedNamespaces: []string{},
+			routes: []*routev1.Route{
+				newRoute("deleted", &now, api.AcmeRevocationFinalizer),
+				newRoute("foo", nil, api.AcmeRevocationFinalizer),
+			},
+			key:                "tenant",
+			expectedNamespaces: []string{"acme", "tenant"},
+			expectedFinalizers: map[string][]string{
+				"deleted": {api.AcmeRevocationFinalizer},
+				"foo":     {api.AcmeRevocationFinalizer},
+			},
+		},
+		{
+			name:               "unselected namespace releases our finalizers",
+			watchedNamespaces:  []string{"acme", "tenant"},
+			selectedNamespaces: []string{},
+			routes: []*routev1.Route{
+				newRoute("deleted", &now, "example.com/other"),
+				newRoute("foo", nil, api.AcmeRevocationFinalizer, "example.com/other", api.AcmeSecretSyncFinalizer),
+				newRoute("bar", nil, api.AcmeSecretSyncFinalizer),
+			},
+			key:                "tenant",
+			expectedNamespaces: []string{"acme"},
+			expectedFinalizers: map[string][]string{
+				"deleted": {"example.com/other"},
+				"foo":     {"example.com/other"},
+				"bar":     nil,
+			},
+		},
+		{
+			name:               "controller namespace is always watched",
+			watchedNamespaces:  []string{"acme"},
+			selectedNamespaces: []string{},
+			key:                "acme",
+			expectedNamespaces: []string{"acme"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			kubeClient := kubefake.NewSimpleClientset()
+			kubeInformersForNamespaces := kubeinformers.NewKubeInformersForNamespaces(kubeClient, tc.watchedNamespaces)
+			var routeObjects []runtime.Object
+			for _, r := range tc.routes {
+				routeObjects = append(routeObjects, r)
+			}
+			routeClient := routefake.NewSimpleClientset(routeObjects...)
+			routeInformersForNamespaces := routeinformers.NewRouteInformersForNamespaces(routeClient, tc.watchedNamespaces)
+			for _, r := range tc.routes {
+				err := routeInformersForNamespaces.InformersFor(r.Namespace).Route().V1().Routes().Informer().GetIndexer().Add(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var handled []string
+			kubeInformersForNamespaces.AddNamespaceHandler(func(namespace string, informers informers.SharedInformerFactory) {
+				informers.Core().V1().Secrets().Informer()
+				handled = append(handled, namespace)
+			})
+
+			kubeInformersForNamespaces.Start(ctx.Done())
+			routeInformersForNamespaces.Start(ctx.Done())
+
+			namespaceInformer := informers.NewSharedInformerFactory(kubeClient, 0).Core().V1().Namespaces()
+			for _, name := range tc.selectedNamespaces {
+				err := namespaceInformer.Informer().GetIndexer().Add(&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: name,
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			nc := NewNamespaceController("acme", routeClient, namespaceInformer, kubeInformersForNamespaces, routeInformersForNamespaces)
+
+			err := nc.sync(ctx, tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := kubeInformersForNamespaces.Namespaces(); !reflect.DeepEqual(got, tc.expectedNamespaces) {
+				t.Errorf("expected kube informers for namespaces %q, got %q", tc.expectedNamespaces, got)
+			}
+			if got := routeInformersForNamespaces.Namespaces(); !reflect.DeepEqual(got, tc.expectedNamespaces) {
+				t.Errorf("expected route informers for namespaces %q, got %q", tc.expectedNamespaces, got)
+			}
+			if !reflect.DeepEqual(handled, tc.expectedHandled) {
+				t.Errorf("expected handlers to be called for namespaces %q, got %q", tc.expectedHandled, handled)
+			}
+
+			for name, expected := range tc.expectedFinalizers {
+				route, err := routeClient.RouteV1().Routes("tenant").Get(name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(route.Finalizers, expected) {
+					t.Errorf("expected Route %q to have finalizers %q, got %q", name, expected, route.Finalizers)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"golang.org/x/crypto/acme"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	routeutil "github.com/tnozicka/openshift-acme/pkg/route"
+)
+
+// ExposerRejectedError means a router serving the Route has rejected the exposer Route,
+// so the challenge can't be reached and the order would never succeed.
+type ExposerRejectedError struct {
+	ExposerRoute string
+	RouterName   string
+	Reason       string
+	Message      string
+}
+
+func (e *ExposerRejectedError) Error() string {
+	return fmt.Sprintf("exposer Route %s was rejected by router %q: %s: %s", e.ExposerRoute, e.RouterName, e.Reason, e.Message)
+}
+
+// checkExposerAdmission returns true when the exposer Route is admitted by all the routers that admitted the Route,
+// as the domain can resolve to any of them. Routers from other shards are irrelevant. It returns ExposerRejectedError
+// if any of those routers rejected the exposer Route.
+func checkExposerAdmission(routeReadOnly, exposerRoute *routev1.Route) (bool, error) {
+	routers := routeutil.AdmittingRouters(routeReadOnly)
+	if len(routers) == 0 {
+		return routeutil.IsAdmitted(exposerRoute), nil
+	}
+
+	var pending []string
+	for _, routerName := range routers {
+		condition := routeutil.AdmissionCondition(exposerRoute, routerName)
+		if condition == nil {
+			pending = append(pending, routerName)
+			continue
+		}
+
+		switch condition.Status {
+		case corev1.ConditionTrue:
+			continue
+		case corev1.ConditionFalse:
+			return false, &ExposerRejectedError{
+				ExposerRoute: exposerRoute.Namespace + "/" + exposerRoute.Name,
+				RouterName:   routerName,
+				Reason:       condition.Reason,
+				Message:      condition.Message,
+			}
+		default:
+			pending = append(pending, routerName)
+		}
+	}
+
+	if len(pending) != 0 {
+		others := routeutil.AdmittingRouters(exposerRoute)
+		if len(others) != 0 {
+			klog.V(2).Infof("Exposer Route %s/%s is admitted by router(s) %q but Route %s/%s is served by %q; the exposer Route might not match the router shard", exposerRoute.Namespace, exposerRoute.Name, others, routeReadOnly.Namespace, routeReadOnly.Name, pending)
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// failOrderForRejectedExposer deactivates the authorization so the order becomes invalid and is retried later,
+// instead of waiting for the exposer Route which will never be admitted.
+// The CA hasn't validated anything so it's reported by the ExposerRejected condition and doesn't count as a failed validation.
+func (rc *RouteController) failOrderForRejectedExposer(ctx context.Context, acmeClient *acme.Client, routeReadOnly *routev1.Route, key string, authz *acme.Authorization, status *api.Status, rejected *ExposerRejectedError) error {
+	klog.V(2).Infof("Route %q: failing order %q: %v", key, status.ProvisioningStatus.OrderURI, rejected)
+	rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeExposerRejected", "Failing order because the challenge can't be exposed: %v", rejected)
+
+	err := acmeClient.RevokeAuthorization(ctx, authz.URI)
+	if err != nil {
+		return fmt.Errorf("can't deactivate authorization %q: %w", authz.URI, err)
+	}
+
+	status.ProvisioningStatus.OrderError = &api.OrderError{
+		Detail: rejected.Error(),
+	}
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionExposerRejected,
+		Status:  api.ConditionTrue,
+		Reason:  "ExposerRejected",
+		Message: rejected.Error(),
+	})
+
+	// The order will turn invalid.
+	rc.pollAcme(key)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+// deferRejectedExposer schedules the next attempt for an order we have failed because of the rejected exposer Route.
+// Routers don't report back when the exposer Route could be admitted so it is retried after the initial backoff.
+func (rc *RouteController) deferRejectedExposer(key string, status *api.Status) {
+	delay := rc.getSettings().CertOrderBackoffInitial
+	status.ProvisioningStatus.EarliestAttemptAt = time.Now().Add(delay)
+
+	klog.V(2).Infof("Order for Route %q failed because the exposer Route was rejected, next attempt in %v", key, delay)
+	rc.queue.AddAfter(key, delay)
+}
+
+func clearExposerRejected(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionExposerRejected) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionExposerRejected,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
@@ -0,0 +1,141 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestCheckExposerAdmission(t *testing.T) {
+	type admission struct {
+		routerName string
+		status     corev1.ConditionStatus
+		reason     string
+	}
+	newRoute := func(name string, admissions ...admission) *routev1.Route {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      name,
+			},
+		}
+		for _, a := range admissions {
+			route.Status.Ingress = append(route.Status.Ingress, routev1.RouteIngress{
+				RouterName: a.routerName,
+				Conditions: []routev1.RouteIngressCondition{
+					{
+						Type:    routev1.RouteAdmitted,
+						Status:  a.status,
+						Reason:  a.reason,
+						Message: a.reason + " message",
+					},
+				},
+			})
+		}
+		return route
+	}
+
+	tt := []struct {
+		name          string
+		route         *routev1.Route
+		exposerRoute  *routev1.Route
+		expected      bool
+		expectedError error
+	}{
+		{
+			name:         "not processed yet",
+			route:        newRoute("foo", admission{"default", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer"),
+			expected:     false,
+		},
+		{
+			name:         "admitted by the same router",
+			route:        newRoute("foo", admission{"default", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer", admission{"default", corev1.ConditionTrue, ""}),
+			expected:     true,
+		},
+		{
+			name:         "admitted by a router from another shard only",
+			route:        newRoute("foo", admission{"internal", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer", admission{"default", corev1.ConditionTrue, ""}),
+			expected:     false,
+		},
+		{
+			name:         "rejection by a router from another shard doesn't matter",
+			route:        newRoute("foo", admission{"internal", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer", admission{"internal", corev1.ConditionTrue, ""}, admission{"default", corev1.ConditionFalse, "HostAlreadyClaimed"}),
+			expected:     true,
+		},
+		{
+			name:         "waits for all routers serving the Route",
+			route:        newRoute("foo", admission{"default", corev1.ConditionTrue, ""}, admission{"internal", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer", admission{"default", corev1.ConditionTrue, ""}),
+			expected:     false,
+		},
+		{
+			name:         "rejected by a router serving the Route",
+			route:        newRoute("foo", admission{"default", corev1.ConditionTrue, ""}),
+			exposerRoute: newRoute("exposer", admission{"default", corev1.ConditionFalse, "HostAlreadyClaimed"}),
+			expected:     false,
+			expectedError: &ExposerRejectedError{
+				ExposerRoute: "test/exposer",
+				RouterName:   "default",
+				Reason:       "HostAlreadyClaimed",
+				Message:      "HostAlreadyClaimed message",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := checkExposerAdmission(tc.route, tc.exposerRoute)
+			if !reflect.DeepEqual(err, tc.expectedError) {
+				t.Fatalf("expected error %v, got %v", tc.expectedError, err)
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeferRejectedExposer(t *testing.T) {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	rc := &RouteController{
+		queue: queue,
+		settings: Settings{
+			CertOrderBackoffInitial: time.Hour,
+		},
+	}
+
+	status := &api.Status{}
+	status.ProvisioningStatus.Failures = 2
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionExposerRejected,
+		Status: api.ConditionTrue,
+	})
+
+	rc.deferRejectedExposer("test/foo", status)
+
+	if status.ProvisioningStatus.Failures != 2 {
+		t.Errorf("rejected exposer must not count as a failure, got %d failure(s)", status.ProvisioningStatus.Failures)
+	}
+	if delay := time.Until(status.ProvisioningStatus.EarliestAttemptAt); delay <= 59*time.Minute || delay > time.Hour {
+		t.Errorf("expected next attempt in an hour, got %v", delay)
+	}
+
+	clearExposerRejected(status)
+	if api.IsConditionTrue(status.Conditions, api.ConditionExposerRejected) {
+		t.Errorf("expected %s condition to be cleared", api.ConditionExposerRejected)
+	}
+}
@@ -0,0 +1,112 @@
+package route
+
+import (
+	"context"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/caa"
+	"github.com/tnozicka/openshift-acme/pkg/ratelimit"
+)
+
+// caaIdentitiesForIssuer returns the issuer domain names the CA recognizes in CAA records.
+func caaIdentitiesForIssuer(acmeIssuer *api.AcmeCertIssuer) []string {
+	if len(acmeIssuer.CAAIdentities) != 0 {
+		return acmeIssuer.CAAIdentities
+	}
+
+	switch acmeIssuer.DirectoryURL {
+	case ratelimit.LetsEncryptProductionDirectoryURL, ratelimit.LetsEncryptStagingDirectoryURL:
+		return []string{"letsencrypt.org"}
+	default:
+		return nil
+	}
+}
+
+// checkCAA returns caa.ForbiddenError if the CAA records of any of the domains would make the CA refuse the order.
+func (rc *RouteController) checkCAA(ctx context.Context, acmeIssuer *api.AcmeCertIssuer, domains []string) error {
+	if rc.caaChecker == nil {
+		return nil
+	}
+
+	identities := caaIdentitiesForIssuer(acmeIssuer)
+	if len(identities) == 0 {
+		klog.V(4).Infof("Skipping CAA check because the CAA identities of issuer with directory %q are unknown", acmeIssuer.DirectoryURL)
+		return nil
+	}
+
+	params := caa.Params{
+		Identities:       identities,
+		AccountURI:       acmeIssuer.Account.Status.URI,
+		ValidationMethod: "http-01",
+	}
+	for _, domain := range domains {
+		err := rc.caaChecker.Check(ctx, domain, params)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blockByCAA reports the Route as blocked by CAA records and checks again later, as DNS changes can't be watched.
+// It doesn't count as a failed order because we haven't created any.
+func (rc *RouteController) blockByCAA(routeReadOnly *routev1.Route, key string, status *api.Status, forbidden *caa.ForbiddenError) error {
+	klog.V(2).Infof("Route %q is blocked by CAA records: %v", key, forbidden)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionCAAForbidden)
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != forbidden.Error() {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeCAAForbidden", "Not creating order: %v", forbidden)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionCAAForbidden,
+		Status:  api.ConditionTrue,
+		Reason:  "CAAForbidden",
+		Message: forbidden.Error(),
+	})
+
+	rc.acmePollRateLimiter.Forget(key)
+	rc.queue.AddAfter(key, rc.getSettings().CertOrderBackoffInitial)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+// deferCAALookup reports the failed CAA lookup and checks again later instead of retrying on every sync.
+// The CA would refuse the order as well if it couldn't look up the records.
+func (rc *RouteController) deferCAALookup(routeReadOnly *routev1.Route, key string, status *api.Status, lookupErr error) error {
+	klog.V(2).Infof("Can't check CAA records for Route %q: %v", key, lookupErr)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionCAAForbidden)
+	if condition == nil || condition.Status != api.ConditionUnknown || condition.Message != lookupErr.Error() {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeCAALookupFailed", "Not creating order because CAA records can't be checked: %v", lookupErr)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionCAAForbidden,
+		Status:  api.ConditionUnknown,
+		Reason:  "LookupFailed",
+		Message: lookupErr.Error(),
+	})
+
+	rc.acmePollRateLimiter.Forget(key)
+	rc.queue.AddAfter(key, rc.getSettings().CertOrderBackoffInitial)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+func clearCAAForbidden(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionCAAForbidden) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionCAAForbidden,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
@@ -0,0 +1,135 @@
+package route
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+const (
+	// ExposerContainerName is the name of the exposer container. The container with this name
+	// in the configured pod template is merged into it.
+	ExposerContainerName = "exposer"
+
+	// ExposerVolumeName is the name of the volume with the exposer data reserved by the controller.
+	ExposerVolumeName = "exposer-data"
+
+	exposerDataPath = "/etc/openshift-acme-exposer"
+)
+
+func (rc *RouteController) exposerReplicas() int32 {
+	replicas := rc.getSettings().ExposerReplicas
+	if replicas == 0 {
+		return api.DefaultExposerReplicas
+	}
+	return replicas
+}
+
+// mergeStringMaps returns a copy of base with the values from overrides set.
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	res := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		res[k] = v
+	}
+	for k, v := range overrides {
+		res[k] = v
+	}
+	return res
+}
+
+// exposerPodTemplate returns the pod template for the exposer serving responses from the specified Secret.
+// The configured pod template is merged in but the labels, annotations, command, ports and the data volume
+// the controller depends on always take precedence.
+func (rc *RouteController) exposerPodTemplate(labels, annotations map[string]string, secretName string) corev1.PodTemplateSpec {
+	settings := rc.getSettings()
+
+	template := corev1.PodTemplateSpec{}
+	if settings.ExposerPodTemplate != nil {
+		template = *settings.ExposerPodTemplate.DeepCopy()
+	}
+
+	template.Labels = mergeStringMaps(template.Labels, labels)
+	template.Annotations = mergeStringMaps(template.Annotations, annotations)
+
+	exposer := corev1.Container{}
+	var otherContainers []corev1.Container
+	for _, c := range template.Spec.Containers {
+		if c.Name == ExposerContainerName {
+			exposer = c
+		} else {
+			otherContainers = append(otherContainers, c)
+		}
+	}
+
+	exposer.Name = ExposerContainerName
+	// The image can be overridden to use a mirror in a private registry.
+	if len(exposer.Image) == 0 {
+		exposer.Image = settings.ExposerImage
+	}
+	exposer.Command = []string{
+		"openshift-acme-exposer",
+	}
+	exposer.Args = []string{
+		"--response-file=" + exposerDataPath + "/" + ExposerFileKey,
+	}
+	exposer.Ports = []corev1.ContainerPort{
+		{
+			Name:          "http",
+			Protocol:      corev1.ProtocolTCP,
+			ContainerPort: ExposerContainerPort,
+		},
+	}
+
+	var volumeMounts []corev1.VolumeMount
+	for _, m := range exposer.VolumeMounts {
+		if m.Name != ExposerVolumeName {
+			volumeMounts = append(volumeMounts, m)
+		}
+	}
+	exposer.VolumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      ExposerVolumeName,
+		ReadOnly:  true,
+		MountPath: exposerDataPath,
+	})
+
+	if len(exposer.Resources.Requests) == 0 && len(exposer.Resources.Limits) == 0 {
+		exposer.Resources = *settings.ExposerResources.DeepCopy()
+	}
+
+	template.Spec.Containers = append([]corev1.Container{exposer}, otherContainers...)
+
+	var volumes []corev1.Volume
+	for _, v := range template.Spec.Volumes {
+		if v.Name != ExposerVolumeName {
+			volumes = append(volumes, v)
+		}
+	}
+	template.Spec.Volumes = append(volumes, corev1.Volume{
+		Name: ExposerVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	})
+
+	return template
+}
+
+// adjustPodResourceRequirements adjusts the resource requirements of all containers to the LimitRanges.
+func adjustPodResourceRequirements(spec *corev1.PodSpec, limitRanges []*corev1.LimitRange) error {
+	for i := range spec.Containers {
+		err := adjustContainerResourceRequirements(&spec.Containers[i].Resources, limitRanges)
+		if err != nil {
+			return fmt.Errorf("container %q: %w", spec.Containers[i].Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package route
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/diff"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestExposerPodTemplate(t *testing.T) {
+	labels := map[string]string{
+		"app": "foo",
+	}
+	annotations := map[string]string{
+		"acme.openshift.io/exposer-key": "test/foo",
+	}
+
+	exposerContainer := func() corev1.Container {
+		return corev1.Container{
+			Name:    ExposerContainerName,
+			Image:   "exposer:latest",
+			Command: []string{"openshift-acme-exposer"},
+			Args:    []string{"--response-file=/etc/openshift-acme-exposer/" + ExposerFileKey},
+			Ports: []corev1.ContainerPort{
+				{
+					Name:          "http",
+					Protocol:      corev1.ProtocolTCP,
+					ContainerPort: ExposerContainerPort,
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      ExposerVolumeName,
+					ReadOnly:  true,
+					MountPath: "/etc/openshift-acme-exposer",
+				},
+			},
+			Resources: api.DefaultExposerResources(),
+		}
+	}
+	exposerVolume := corev1.Volume{
+		Name: ExposerVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "foo-exposer",
+			},
+		},
+	}
+	expectedTemplate := func(f func(*corev1.PodTemplateSpec)) corev1.PodTemplateSpec {
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{exposerContainer()},
+				Volumes:    []corev1.Volume{exposerVolume},
+			},
+		}
+		if f != nil {
+			f(&template)
+		}
+		return template
+	}
+
+	runAsNonRoot := true
+	sidecar := corev1.Container{
+		Name:  "proxy",
+		Image: "proxy:latest",
+	}
+	cacheVolume := corev1.Volume{
+		Name: "cache",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	tt := []struct {
+		name     string
+		template *corev1.PodTemplateSpec
+		expected corev1.PodTemplateSpec
+	}{
+		{
+			name:     "no template uses the defaults",
+			template: nil,
+			expected: expectedTemplate(nil),
+		},
+		{
+			name: "pod settings are kept",
+			template: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					NodeSelector: map[string]string{
+						"node-role.kubernetes.io/infra": "",
+					},
+					Tolerations: []corev1.Toleration{
+						{
+							Key:      "node-role.kubernetes.io/infra",
+							Operator: corev1.TolerationOpExists,
+							Effect:   corev1.TaintEffectNoSchedule,
+						},
+					},
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: &runAsNonRoot,
+					},
+					ImagePullSecrets: []corev1.LocalObjectReference{
+						{Name: "registry"},
+					},
+					PriorityClassName: "system-cluster-critical",
+				},
+			},
+			expected: expectedTemplate(func(template *corev1.PodTemplateSpec) {
+				template.Spec.NodeSelector = map[string]string{
+					"node-role.kubernetes.io/infra": "",
+				}
+				template.Spec.Tolerations = []corev1.Toleration{
+					{
+						Key:      "node-role.kubernetes.io/infra",
+						Operator: corev1.TolerationOpExists,
+						Effect:   corev1.TaintEffectNoSchedule,
+					},
+				}
+				template.Spec.SecurityContext = &corev1.PodSecurityContext{
+					RunAsNonRoot: &runAsNonRoot,
+				}
+				template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{
+					{Name: "registry"},
+				}
+				template.Spec.PriorityClassName = "system-cluster-critical"
+			}),
+		},
+		{
+			name: "controller labels and annotations take precedence",
+			template: &corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":  "bar",
+						"team": "a",
+					},
+					Annotations: map[string]string{
+						"acme.openshift.io/exposer-key": "test/bar",
+						"example.com/scrape":            "false",
+					},
+				},
+			},
+			expected: expectedTemplate(func(template *corev1.PodTemplateSpec) {
+				template.Labels = map[string]string{
+					"app":  "foo",
+					"team": "a",
+				}
+				template.Annotations = map[string]string{
+					"acme.openshift.io/exposer-key": "test/foo",
+					"example.com/scrape":            "false",
+				}
+			}),
+		},
+		{
+			name: "exposer container is merged but can't change how the exposer is run",
+			template: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:    ExposerContainerName,
+							Image:   "registry.example.com/exposer:latest",
+							Command: []string{"sh"},
+							Args:    []string{"-c", "sleep infinity"},
+							Ports: []corev1.ContainerPort{
+								{ContainerPort: 8080},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      ExposerVolumeName,
+									MountPath: "/tmp",
+								},
+								{
+									Name:      "cache",
+									MountPath: "/var/cache",
+								},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								RunAsNonRoot: &runAsNonRoot,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU: resource.MustParse("10m"),
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						cacheVolume,
+						{
+							Name: ExposerVolumeName,
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			expected: expectedTemplate(func(template *corev1.PodTemplateSpec) {
+				c := &template.Spec.Containers[0]
+				c.Image = "registry.example.com/exposer:latest"
+				c.VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "cache",
+						MountPath: "/var/cache",
+					},
+					c.VolumeMounts[0],
+				}
+				c.SecurityContext = &corev1.SecurityContext{
+					RunAsNonRoot: &runAsNonRoot,
+				}
+				c.Resources = corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU: resource.MustParse("10m"),
+					},
+				}
+				template.Spec.Volumes = []corev1.Volume{cacheVolume, exposerVolume}
+			}),
+		},
+		{
+			name: "other containers are kept after the exposer",
+			template: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						sidecar,
+					},
+				},
+			},
+			expected: expectedTemplate(func(template *corev1.PodTemplateSpec) {
+				template.Spec.Containers = append(template.Spec.Containers, sidecar)
+			}),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var original *corev1.PodTemplateSpec
+			if tc.template != nil {
+				original = tc.template.DeepCopy()
+			}
+
+			rc := &RouteController{
+				settings: Settings{
+					ExposerImage:       "exposer:latest",
+					ExposerResources:   api.DefaultExposerResources(),
+					ExposerPodTemplate: tc.template,
+				},
+			}
+
+			got := rc.exposerPodTemplate(labels, annotations, "foo-exposer")
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected and got differ: %s", diff.ObjectReflectDiff(tc.expected, got))
+			}
+
+			if !reflect.DeepEqual(tc.template, original) {
+				t.Errorf("configured template has been modified: %s", diff.ObjectReflectDiff(original, tc.template))
+			}
+		})
+	}
+}
+
+func TestAdjustPodResourceRequirements(t *testing.T) {
+	limitRanges := []*corev1.LimitRange{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      "limits",
+			},
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{
+					{
+						Type: corev1.LimitTypeContainer,
+						Min: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("10m"),
+						},
+						Max: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("200m"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:      ExposerContainerName,
+				Resources: api.DefaultExposerResources(),
+			},
+			{
+				Name:      "proxy",
+				Resources: api.DefaultExposerResources(),
+			},
+		},
+	}
+
+	err := adjustPodResourceRequirements(spec, limitRanges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range spec.Containers {
+		request := c.Resources.Requests[corev1.ResourceCPU]
+		if request.Cmp(resource.MustParse("10m")) != 0 {
+			t.Errorf("expected container %q to have its CPU request adjusted to 10m, got %s", c.Name, request.String())
+		}
+	}
+
+	spec.Containers[1].Resources.Limits[corev1.ResourceCPU] = resource.MustParse("1")
+	err = adjustPodResourceRequirements(spec, limitRanges)
+	if err == nil || !strings.Contains(err.Error(), `container "proxy"`) {
+		t.Errorf("expected error for container %q, got %v", "proxy", err)
+	}
+}
@@ -0,0 +1,348 @@
+package route
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+// PolicyDeniedError means the hostname policy doesn't allow a certificate for the Route.
+type PolicyDeniedError struct {
+	Reason  string
+	Message string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return e.Message
+}
+
+func parseHostnamePolicy(cm *corev1.ConfigMap) (*api.HostnamePolicy, error) {
+	data, ok := cm.Data[api.HostnamePolicyDataKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s is missing key %q", cm.Namespace, cm.Name, api.HostnamePolicyDataKey)
+	}
+
+	policy := &api.HostnamePolicy{}
+	err := yaml.Unmarshal([]byte(data), policy)
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s/%s contains invalid hostname policy: %w", cm.Namespace, cm.Name, err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.NamespaceSelector != nil {
+			_, err := metav1.LabelSelectorAsSelector(rule.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("configmap %s/%s contains invalid namespace selector in rule %d: %w", cm.Namespace, cm.Name, i, err)
+			}
+		}
+
+		if rule.MaxCertificates < 0 {
+			return nil, fmt.Errorf("configmap %s/%s contains negative maxCertificates in rule %d", cm.Namespace, cm.Name, i)
+		}
+	}
+
+	return policy, nil
+}
+
+// hostnamePolicy returns the hostname policy or nil if there is none and all Routes are allowed.
+func (rc *RouteController) hostnamePolicy() (*api.HostnamePolicy, error) {
+	cm, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().ConfigMaps().Lister().ConfigMaps(rc.controllerNamespace).Get(api.HostnamePolicyConfigMapName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return parseHostnamePolicy(cm)
+}
+
+func needsNamespaceLabels(policy *api.HostnamePolicy) bool {
+	for _, rule := range policy.Rules {
+		if rule.NamespaceSelector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingPolicyRule returns the first rule applying to the namespace or nil.
+func matchingPolicyRule(policy *api.HostnamePolicy, namespace string, namespaceLabels labels.Set) (*api.HostnamePolicyRule, error) {
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+
+		for _, ns := range rule.Namespaces {
+			if ns == namespace {
+				return rule, nil
+			}
+		}
+
+		if rule.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(rule.NamespaceSelector)
+			if err != nil {
+				return nil, err
+			}
+			if selector.Matches(namespaceLabels) {
+				return rule, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func hasAllowedDomainSuffix(host string, suffixes []string) bool {
+	if len(suffixes) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(strings.TrimSuffix(suffix, "."))
+		if strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+			continue
+		}
+
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// certificatesInNamespace counts the other managed Routes in the namespace having a certificate or an order in progress.
+func (rc *RouteController) certificatesInNamespace(routeReadOnly *routev1.Route) (int, error) {
+	routeInformers, err := rc.routeInformersFor(routeReadOnly.Namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	routes, err := routeInformers.Route().V1().Routes().Lister().Routes(routeReadOnly.Namespace).List(labels.Everything())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, route := range routes {
+		if route.UID == routeReadOnly.UID || util.IsTemporary(route) || !util.IsManaged(route, rc.annotation) {
+			continue
+		}
+
+		status, err := rc.getStatus(route)
+		if err != nil {
+			klog.V(4).Infof("Can't get status of Route %s/%s: %v", route.Namespace, route.Name, err)
+			continue
+		}
+
+		if status.CertificateExpiresAt != nil || len(status.ProvisioningStatus.OrderURI) != 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// checkHostnamePolicy returns PolicyDeniedError if the hostname policy doesn't allow a certificate for the Route.
+func (rc *RouteController) checkHostnamePolicy(routeReadOnly *routev1.Route) error {
+	policy, err := rc.hostnamePolicy()
+	if err != nil {
+		// Don't let anyone spend the quota while the policy is broken.
+		return &PolicyDeniedError{
+			Reason:  "InvalidPolicy",
+			Message: fmt.Sprintf("Can't evaluate hostname policy: %v", err),
+		}
+	}
+	if policy == nil {
+		return nil
+	}
+
+	var namespaceLabels labels.Set
+	if needsNamespaceLabels(policy) {
+		ns, err := rc.kubeClient.CoreV1().Namespaces().Get(routeReadOnly.Namespace, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("can't get namespace %q: %w", routeReadOnly.Namespace, err)
+		}
+		namespaceLabels = ns.Labels
+	}
+
+	rule, err := matchingPolicyRule(policy, routeReadOnly.Namespace, namespaceLabels)
+	if err != nil {
+		return err
+	}
+	if rule == nil {
+		return &PolicyDeniedError{
+			Reason:  "NamespaceNotAllowed",
+			Message: fmt.Sprintf("No hostname policy rule allows certificates in namespace %q", routeReadOnly.Namespace),
+		}
+	}
+
+	if !hasAllowedDomainSuffix(routeReadOnly.Spec.Host, rule.AllowedDomainSuffixes) {
+		return &PolicyDeniedError{
+			Reason:  "HostnameNotAllowed",
+			Message: fmt.Sprintf("Hostname %q doesn't match any of the allowed domain suffixes %q", routeReadOnly.Spec.Host, rule.AllowedDomainSuffixes),
+		}
+	}
+
+	if len(rule.AllowedIssuers) != 0 {
+		issuerConfigMaps, err := controllerutils.IssuerConfigMapsForObject(routeReadOnly.ObjectMeta, rc.controllerNamespace, controllerutils.NewInformerConfigMapGetter(rc.kubeInformersForNamespaces))
+		if err != nil {
+			return fmt.Errorf("can't get cert issuer: %w", err)
+		}
+		issuer := issuerConfigMaps[0].Namespace + "/" + issuerConfigMaps[0].Name
+
+		allowed := false
+		for _, allowedIssuer := range rule.AllowedIssuers {
+			if allowedIssuer == issuer {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &PolicyDeniedError{
+				Reason:  "IssuerNotAllowed",
+				Message: fmt.Sprintf("Issuer %q isn't one of the allowed issuers %q", issuer, rule.AllowedIssuers),
+			}
+		}
+	}
+
+	if rule.MaxCertificates > 0 {
+		count, err := rc.certificatesInNamespace(routeReadOnly)
+		if err != nil {
+			return err
+		}
+		if count >= rule.MaxCertificates {
+			return &PolicyDeniedError{
+				Reason:  "CertificateLimitExceeded",
+				Message: fmt.Sprintf("Namespace %q already has %d certificate(s), the limit is %d", routeReadOnly.Namespace, count, rule.MaxCertificates),
+			}
+		}
+	}
+
+	return nil
+}
+
+// denyByPolicy reports the Route as denied. Unless it is over the certificate limit it isn't retried
+// until the Route or the policy changes.
+func (rc *RouteController) denyByPolicy(routeReadOnly *routev1.Route, key string, status *api.Status, denied *PolicyDeniedError) error {
+	klog.V(2).Infof("Route %q is denied by hostname policy: %s", key, denied.Message)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionDenied)
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != denied.Message {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeDenied", "Certificate denied by hostname policy: %s", denied.Message)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionDenied,
+		Status:  api.ConditionTrue,
+		Reason:  denied.Reason,
+		Message: denied.Message,
+	})
+
+	rc.acmePollRateLimiter.Forget(key)
+	if denied.Reason == "CertificateLimitExceeded" {
+		// Other certificates in the namespace can go away without us noticing.
+		rc.queue.AddAfter(key, rc.getSettings().CertOrderBackoffInitial)
+	}
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+func clearDenied(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionDenied) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionDenied,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
+
+// isHostnamePolicy returns true for the ConfigMap holding the hostname policy.
+func (rc *RouteController) isHostnamePolicy(cm *corev1.ConfigMap) bool {
+	return cm.Namespace == rc.controllerNamespace && cm.Name == api.HostnamePolicyConfigMapName
+}
+
+// enqueueAllRoutes requeues all Routes after the hostname policy changed, so denied Routes get a new chance.
+func (rc *RouteController) enqueueAllRoutes() {
+	for _, namespace := range rc.routeInformersForNamespaces.Namespaces() {
+		informers := rc.routeInformersForNamespaces.InformersFor(namespace)
+		if informers == nil {
+			continue
+		}
+
+		routes, err := informers.Route().V1().Routes().Lister().List(labels.Everything())
+		if err != nil {
+			klog.Errorf("Can't list Routes in namespace %q: %v", namespace, err)
+			continue
+		}
+
+		for _, route := range routes {
+			if util.IsTemporary(route) || !util.IsManaged(route, rc.annotation) {
+				continue
+			}
+			rc.enqueueRoute(route)
+		}
+	}
+}
+
+func (rc *RouteController) addConfigMap(obj interface{}) {
+	cm := obj.(*corev1.ConfigMap)
+	if !rc.isHostnamePolicy(cm) {
+		return
+	}
+
+	klog.V(4).Infof("Adding hostname policy ConfigMap %s/%s RV=%s", cm.Namespace, cm.Name, cm.ResourceVersion)
+	rc.enqueueAllRoutes()
+}
+
+func (rc *RouteController) updateConfigMap(old, cur interface{}) {
+	oldConfigMap := old.(*corev1.ConfigMap)
+	newConfigMap := cur.(*corev1.ConfigMap)
+	if !rc.isHostnamePolicy(newConfigMap) || oldConfigMap.ResourceVersion == newConfigMap.ResourceVersion {
+		return
+	}
+
+	klog.V(4).Infof("Updating hostname policy ConfigMap %s/%s RV=%s", newConfigMap.Namespace, newConfigMap.Name, newConfigMap.ResourceVersion)
+	rc.enqueueAllRoutes()
+}
+
+func (rc *RouteController) deleteConfigMap(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("object is not a ConfigMap neither tombstone: %#v", obj))
+			return
+		}
+		cm, ok = tombstone.Obj.(*corev1.ConfigMap)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a ConfigMap %#v", obj))
+			return
+		}
+	}
+	if !rc.isHostnamePolicy(cm) {
+		return
+	}
+
+	klog.V(4).Infof("Deleting hostname policy ConfigMap %s/%s RV=%s", cm.Namespace, cm.Name, cm.ResourceVersion)
+	rc.enqueueAllRoutes()
+}
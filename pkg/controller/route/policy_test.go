@@ -0,0 +1,242 @@
+package route
+
+import (
+	"errors"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestHasAllowedDomainSuffix(t *testing.T) {
+	tt := []struct {
+		host     string
+		suffixes []string
+		expected bool
+	}{
+		{
+			host:     "foo.example.com",
+			suffixes: nil,
+			expected: true,
+		},
+		{
+			host:     "example.com",
+			suffixes: []string{"example.com"},
+			expected: true,
+		},
+		{
+			host:     "foo.Example.com",
+			suffixes: []string{"example.com."},
+			expected: true,
+		},
+		{
+			host:     "badexample.com",
+			suffixes: []string{"example.com"},
+			expected: false,
+		},
+		{
+			host:     "example.com",
+			suffixes: []string{".example.com"},
+			expected: false,
+		},
+		{
+			host:     "foo.example.com",
+			suffixes: []string{"example.org", ".example.com"},
+			expected: true,
+		},
+	}
+
+	for _, tc := range tt {
+		got := hasAllowedDomainSuffix(tc.host, tc.suffixes)
+		if got != tc.expected {
+			t.Errorf("host %q with suffixes %q: expected %t, got %t", tc.host, tc.suffixes, tc.expected, got)
+		}
+	}
+}
+
+func TestCheckHostnamePolicy(t *testing.T) {
+	newRoute := func(name, host, status string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "tenant",
+				Name:      name,
+				UID:       types.UID("uid-" + name),
+				Annotations: map[string]string{
+					"kubernetes.io/tls-acme": "true",
+					api.AcmeStatusAnnotation: status,
+				},
+			},
+			Spec: routev1.RouteSpec{
+				Host: host,
+			},
+		}
+	}
+	newPolicy := func(policy string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "acme",
+				Name:      api.HostnamePolicyConfigMapName,
+			},
+			Data: map[string]string{
+				api.HostnamePolicyDataKey: policy,
+			},
+		}
+	}
+	issuer := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "acme",
+			Name:      "letsencrypt-live",
+			Labels:    api.AccountLabelSet,
+		},
+	}
+
+	tt := []struct {
+		name           string
+		policy         *corev1.ConfigMap
+		otherRoutes    []*routev1.Route
+		host           string
+		expectedReason string
+	}{
+		{
+			name:           "no policy allows everything",
+			host:           "foo.example.com",
+			expectedReason: "",
+		},
+		{
+			name: "allowed by namespace",
+			policy: newPolicy(`
+rules:
+- namespaces: ["tenant"]
+  allowedDomainSuffixes: ["example.com"]
+`),
+			host:           "foo.example.com",
+			expectedReason: "",
+		},
+		{
+			name: "allowed by namespace selector",
+			policy: newPolicy(`
+rules:
+- namespaceSelector:
+    matchLabels:
+      tier: gold
+  allowedIssuers: ["acme/letsencrypt-live"]
+`),
+			host:           "foo.example.com",
+			expectedReason: "",
+		},
+		{
+			name: "namespace without rule",
+			policy: newPolicy(`
+rules:
+- namespaces: ["other"]
+`),
+			host:           "foo.example.com",
+			expectedReason: "NamespaceNotAllowed",
+		},
+		{
+			name: "hostname outside of allowed suffixes",
+			policy: newPolicy(`
+rules:
+- namespaces: ["tenant"]
+  allowedDomainSuffixes: ["example.org"]
+`),
+			host:           "foo.example.com",
+			expectedReason: "HostnameNotAllowed",
+		},
+		{
+			name: "issuer not allowed",
+			policy: newPolicy(`
+rules:
+- namespaces: ["tenant"]
+  allowedIssuers: ["acme/letsencrypt-staging"]
+`),
+			host:           "foo.example.com",
+			expectedReason: "IssuerNotAllowed",
+		},
+		{
+			name: "certificate limit reached",
+			policy: newPolicy(`
+rules:
+- namespaces: ["tenant"]
+  maxCertificates: 2
+`),
+			otherRoutes: []*routev1.Route{
+				newRoute("with-certificate", "a.example.com", `certificateExpiresAt: "2020-01-31T00:00:00Z"`),
+				newRoute("with-order", "b.example.com", "provisioningStatus:\n  orderURI: https://acme/order/1"),
+			},
+			host:           "foo.example.com",
+			expectedReason: "CertificateLimitExceeded",
+		},
+		{
+			name: "certificate limit not reached",
+			policy: newPolicy(`
+rules:
+- namespaces: ["tenant"]
+  maxCertificates: 2
+`),
+			otherRoutes: []*routev1.Route{
+				newRoute("with-certificate", "a.example.com", `certificateExpiresAt: "2020-01-31T00:00:00Z"`),
+				newRoute("without-certificate", "b.example.com", ""),
+			},
+			host:           "foo.example.com",
+			expectedReason: "",
+		},
+		{
+			name:           "invalid policy denies everything",
+			policy:         newPolicy("rules: {"),
+			host:           "foo.example.com",
+			expectedReason: "InvalidPolicy",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			route := newRoute("foo", tc.host, "")
+			routes := append([]*routev1.Route{route}, tc.otherRoutes...)
+
+			rc, kubeClient, _, _ := newTestRouteController(t, routes, nil)
+			rc.controllerNamespace = "acme"
+
+			_, err := kubeClient.CoreV1().Namespaces().Create(&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "tenant",
+					Labels: map[string]string{
+						"tier": "gold",
+					},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			configMaps := []*corev1.ConfigMap{issuer}
+			if tc.policy != nil {
+				configMaps = append(configMaps, tc.policy)
+			}
+			for _, cm := range configMaps {
+				err := rc.kubeInformersForNamespaces.InformersFor("").Core().V1().ConfigMaps().Informer().GetIndexer().Add(cm)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = rc.checkHostnamePolicy(route)
+
+			var reason string
+			if err != nil {
+				var denied *PolicyDeniedError
+				if !errors.As(err, &denied) {
+					t.Fatal(err)
+				}
+				reason = denied.Reason
+			}
+			if reason != tc.expectedReason {
+				t.Errorf("expected reason %q, got %q (%v)", tc.expectedReason, reason, err)
+			}
+		})
+	}
+}
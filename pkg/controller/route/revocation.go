@@ -0,0 +1,280 @@
+package route
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"golang.org/x/crypto/acme"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+const (
+	// MaxRevocationAttempts is the number of failed attempts to revoke a certificate after which we give up
+	// and remove the finalizer so the Route doesn't get stuck.
+	MaxRevocationAttempts = 5
+)
+
+// errIssuerMissing means the certificate can't be revoked because its issuer is gone.
+var errIssuerMissing = errors.New("cert issuer is missing")
+
+func parseRevocationPolicy(s string) (api.RevocationPolicy, error) {
+	switch api.RevocationPolicy(s) {
+	case "", api.RevocationPolicyNever:
+		return api.RevocationPolicyNever, nil
+	case api.RevocationPolicyRevoke:
+		return api.RevocationPolicyRevoke, nil
+	case api.RevocationPolicyRevokeOnUnmanage:
+		return api.RevocationPolicyRevokeOnUnmanage, nil
+	default:
+		return "", fmt.Errorf("invalid revocation policy %q, supported values are %q, %q and %q", s, api.RevocationPolicyNever, api.RevocationPolicyRevoke, api.RevocationPolicyRevokeOnUnmanage)
+	}
+}
+
+// revocationPolicyForRoute returns the revocation policy from the Route annotation or the issuer.
+// It returns false if the policy can't be determined because the issuer isn't available.
+func (rc *RouteController) revocationPolicyForRoute(routeReadOnly *routev1.Route) (api.RevocationPolicy, bool, error) {
+	policyString, ok := routeReadOnly.Annotations[api.AcmeRevocationPolicyAnnotation]
+	if !ok || len(policyString) == 0 {
+		certIssuer, _, err := controllerutils.IssuerForObject(routeReadOnly.ObjectMeta, rc.controllerNamespace, rc.kubeInformersForNamespaces)
+		if err != nil {
+			klog.V(4).Infof("Can't determine revocation policy for Route %s/%s: can't get cert issuer: %v", routeReadOnly.Namespace, routeReadOnly.Name, err)
+			return "", false, nil
+		}
+		policyString = string(certIssuer.RevocationPolicy)
+	}
+
+	policy, err := parseRevocationPolicy(policyString)
+	if err != nil {
+		return "", false, err
+	}
+
+	return policy, true, nil
+}
+
+// syncRevocationFinalizer adds or removes the revocation finalizer to match the revocation policy
+// from the Route annotation or the issuer. It returns true if the Route was updated.
+func (rc *RouteController) syncRevocationFinalizer(routeReadOnly *routev1.Route) (bool, error) {
+	policy, ok, err := rc.revocationPolicyForRoute(routeReadOnly)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		// Leave the finalizer as it is, the issuer might be missing only temporarily.
+		return false, nil
+	}
+
+	wantsFinalizer := policy != api.RevocationPolicyNever
+	if wantsFinalizer == hasFinalizer(routeReadOnly, api.AcmeRevocationFinalizer) {
+		return false, nil
+	}
+
+	route := routeReadOnly.DeepCopy()
+	if wantsFinalizer {
+		route.Finalizers = append(route.Finalizers, api.AcmeRevocationFinalizer)
+	} else {
+		route.Finalizers = removeFinalizer(route.Finalizers, api.AcmeRevocationFinalizer)
+	}
+
+	klog.V(2).Infof("Updating revocation finalizer on Route %s/%s for revocation policy %q", route.Namespace, route.Name, policy)
+	_, err = rc.routeClient.RouteV1().Routes(route.Namespace).Update(route)
+	if err != nil {
+		return false, fmt.Errorf("can't update revocation finalizer on Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	return true, nil
+}
+
+// isIssuedCertificate returns true if the certificate matches the one we have issued according to the status.
+func isIssuedCertificate(certificateMeta *api.CertificateMeta, certificate *x509.Certificate) bool {
+	if certificateMeta == nil {
+		return false
+	}
+
+	return certificateMeta.NotBefore.Equal(certificate.NotBefore) &&
+		certificateMeta.NotAfter.Equal(certificate.NotAfter) &&
+		reflect.DeepEqual(certificateMeta.Domains, certificate.DNSNames)
+}
+
+// revokeCertificate revokes the certificate on the Route if it was issued by us and it is still valid.
+// It returns true if the certificate was revoked or the reason why it was skipped.
+func (rc *RouteController) revokeCertificate(routeReadOnly *routev1.Route) (bool, string, error) {
+	routeWithCertificate, err := rc.routeWithCertificate(routeReadOnly)
+	if err != nil {
+		return false, "", err
+	}
+
+	if routeWithCertificate.Spec.TLS == nil || len(routeWithCertificate.Spec.TLS.Certificate) == 0 {
+		return false, "Route has no certificate", nil
+	}
+
+	certificate, err := util.CertificateFromPEM([]byte(routeWithCertificate.Spec.TLS.Certificate))
+	if err != nil {
+		return false, fmt.Sprintf("Route certificate can't be parsed: %v", err), nil
+	}
+
+	status, err := rc.getStatus(routeReadOnly)
+	if err != nil {
+		return false, "", fmt.Errorf("can't get status: %w", err)
+	}
+
+	if !isIssuedCertificate(status.CertificateMeta, certificate) {
+		return false, "Route certificate wasn't issued by the controller", nil
+	}
+
+	if !time.Now().Before(certificate.NotAfter) {
+		return false, "Route certificate has already expired", nil
+	}
+
+	acmeClient, _, err := rc.acmeClientForObject(routeReadOnly.ObjectMeta)
+	if err != nil {
+		if isIssuerMissing(err) {
+			return false, "", fmt.Errorf("%w: %v", errIssuerMissing, err)
+		}
+		return false, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), AcmeTimeout)
+	defer cancel()
+
+	// Empty key makes the client sign the request with the account key.
+	revoked, err := RevokeCertificate(ctx, acmeClient, nil, certificate, acme.CRLReasonCessationOfOperation)
+	if err != nil {
+		return false, "", err
+	}
+	if !revoked {
+		return false, "Route certificate has already been revoked", nil
+	}
+
+	return true, "", nil
+}
+
+// RevokeCertificate revokes the certificate signing the request with the key. Nil key uses the account key.
+// It returns false if the certificate has already been revoked.
+func RevokeCertificate(ctx context.Context, client *acme.Client, key crypto.Signer, certificate *x509.Certificate, reason acme.CRLReasonCode) (bool, error) {
+	err := client.RevokeCert(ctx, key, certificate.Raw, reason)
+	if err != nil {
+		acmeErr, ok := err.(*acme.Error)
+		if ok && strings.HasSuffix(strings.ToLower(acmeErr.ProblemType), ":alreadyrevoked") {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// isIssuerMissing returns true if the error means the issuer or its account Secret doesn't exist.
+func isIssuerMissing(err error) bool {
+	if errors.Is(err, controllerutils.ErrNoIssuer) {
+		return true
+	}
+
+	var statusErr *kapierrors.StatusError
+	return errors.As(err, &statusErr) && kapierrors.IsNotFound(statusErr)
+}
+
+// finalizeRevocation revokes the certificate and removes the finalizer. Failed attempts are retried with backoff;
+// after MaxRevocationAttempts failures or when the issuer is gone we give up and leave the certificate valid.
+func (rc *RouteController) finalizeRevocation(routeReadOnly *routev1.Route, key string) error {
+	if routeReadOnly.Annotations[api.AcmeSkipRevocationAnnotation] == "true" {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeNormal, "AcmeRevocationSkipped", "Skipped revoking certificate for domain %q: requested by annotation %s", routeReadOnly.Spec.Host, api.AcmeSkipRevocationAnnotation)
+		return rc.removeRevocationFinalizer(routeReadOnly)
+	}
+
+	status, err := rc.getStatus(routeReadOnly)
+	if err != nil {
+		return fmt.Errorf("can't get status: %w", err)
+	}
+
+	if status.Revocation != nil {
+		delay := time.Until(status.Revocation.EarliestAttemptAt)
+		if delay > 0 {
+			klog.V(4).Infof("Route %q: next revocation attempt in %v", key, delay)
+			rc.queue.AddAfter(key, delay)
+			return nil
+		}
+	}
+
+	revoked, skipReason, err := rc.revokeCertificate(routeReadOnly)
+	if err != nil {
+		if status.Revocation == nil {
+			status.Revocation = &api.RevocationStatus{}
+		}
+		status.Revocation.Failures += 1
+
+		if errors.Is(err, errIssuerMissing) || status.Revocation.Failures >= MaxRevocationAttempts {
+			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeRevocationAbandoned", "Gave up revoking certificate for domain %q after %d attempt(s), it stays valid until it expires: %v", routeReadOnly.Spec.Host, status.Revocation.Failures, err)
+			return rc.removeRevocationFinalizer(routeReadOnly)
+		}
+
+		settings := rc.getSettings()
+		backoff := certOrderBackoff(status.Revocation.Failures, settings.CertOrderBackoffInitial, settings.CertOrderBackoffMax, CertOrderBackoffJitter)
+		status.Revocation.EarliestAttemptAt = time.Now().Add(backoff)
+
+		klog.V(2).Infof("Revoking certificate for Route %q failed %d time(s), next attempt in %v: %v", key, status.Revocation.Failures, backoff, err)
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeRevocationFailed", "Can't revoke certificate for domain %q (attempt %d of %d), next attempt at %s: %v", routeReadOnly.Spec.Host, status.Revocation.Failures, MaxRevocationAttempts, status.Revocation.EarliestAttemptAt.UTC().Format(time.RFC3339), err)
+		rc.queue.AddAfter(key, backoff)
+
+		return rc.updateStatus(routeReadOnly, status)
+	}
+
+	if revoked {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeNormal, "AcmeCertificateRevoked", "Revoked certificate for domain %q", routeReadOnly.Spec.Host)
+	} else {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeNormal, "AcmeRevocationSkipped", "Skipped revoking certificate for domain %q: %s", routeReadOnly.Spec.Host, skipReason)
+	}
+
+	return rc.removeRevocationFinalizer(routeReadOnly)
+}
+
+// releaseRevocation handles a Route that is no longer managed. Its certificate is revoked only
+// with the RevokeOnUnmanage policy because the Route still serves it.
+func (rc *RouteController) releaseRevocation(routeReadOnly *routev1.Route, key string) error {
+	policy, ok, err := rc.revocationPolicyForRoute(routeReadOnly)
+	if err != nil {
+		return err
+	}
+	if ok && policy == api.RevocationPolicyRevokeOnUnmanage {
+		return rc.finalizeRevocation(routeReadOnly, key)
+	}
+
+	rc.recorder.Eventf(routeReadOnly, corev1.EventTypeNormal, "AcmeRevocationSkipped", "Skipped revoking certificate for domain %q: Route is no longer managed and still serves the certificate", routeReadOnly.Spec.Host)
+
+	return rc.removeRevocationFinalizer(routeReadOnly)
+}
+
+func (rc *RouteController) removeRevocationFinalizer(routeReadOnly *routev1.Route) error {
+	route := routeReadOnly.DeepCopy()
+	route.Finalizers = removeFinalizer(route.Finalizers, api.AcmeRevocationFinalizer)
+
+	// Failed attempts don't carry over in case the Route gets the finalizer again.
+	status, err := rc.getStatus(route)
+	if err == nil && status.Revocation != nil {
+		status.Revocation = nil
+		err = setStatus(&route.ObjectMeta, status)
+		if err != nil {
+			return fmt.Errorf("can't set status: %w", err)
+		}
+	}
+
+	_, err = rc.routeClient.RouteV1().Routes(route.Namespace).Update(route)
+	if err != nil {
+		return fmt.Errorf("can't remove revocation finalizer from Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package route
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+func TestIsIssuedCertificate(t *testing.T) {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * 24 * time.Hour)
+	certificate := &x509.Certificate{
+		NotBefore: notBefore,
+		NotAfter:  notAfter,
+		DNSNames:  []string{"example.com"},
+	}
+
+	tt := []struct {
+		name            string
+		certificateMeta *api.CertificateMeta
+		expected        bool
+	}{
+		{
+			name:            "no certificate issued",
+			certificateMeta: nil,
+			expected:        false,
+		},
+		{
+			name: "matching certificate",
+			certificateMeta: &api.CertificateMeta{
+				NotBefore: notBefore.Local(),
+				NotAfter:  notAfter,
+				Domains:   []string{"example.com"},
+			},
+			expected: true,
+		},
+		{
+			name: "different validity",
+			certificateMeta: &api.CertificateMeta{
+				NotBefore: notBefore.Add(-time.Hour),
+				NotAfter:  notAfter,
+				Domains:   []string{"example.com"},
+			},
+			expected: false,
+		},
+		{
+			name: "different domains",
+			certificateMeta: &api.CertificateMeta{
+				NotBefore: notBefore,
+				NotAfter:  notAfter,
+				Domains:   []string{"example.org"},
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := isIssuedCertificate(tc.certificateMeta, certificate)
+			if got != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRevocationPolicy(t *testing.T) {
+	tt := []struct {
+		name        string
+		policy      string
+		expected    api.RevocationPolicy
+		expectedErr bool
+	}{
+		{
+			name:     "empty defaults to Never",
+			policy:   "",
+			expected: api.RevocationPolicyNever,
+		},
+		{
+			name:     "Never",
+			policy:   "Never",
+			expected: api.RevocationPolicyNever,
+		},
+		{
+			name:     "Revoke",
+			policy:   "Revoke",
+			expected: api.RevocationPolicyRevoke,
+		},
+		{
+			name:     "RevokeOnUnmanage",
+			policy:   "RevokeOnUnmanage",
+			expected: api.RevocationPolicyRevokeOnUnmanage,
+		},
+		{
+			name:        "invalid",
+			policy:      "revoke",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseRevocationPolicy(tc.policy)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestFinalizeRevocation(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+	certificate, err := util.CertificateFromPEM([]byte(crt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The issuer exists but its account key is broken so every attempt fails without reaching a CA.
+	brokenIssuer := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "issuer",
+			Labels:    api.AccountLabelSet,
+		},
+		Data: map[string]string{
+			api.CertIssuerDataKey: `{"type":"ACME","secretName":"issuer","acmeCertIssuer":{"directoryURL":"https://acme.example.com/directory"}}`,
+		},
+	}
+	brokenIssuerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "issuer",
+		},
+	}
+
+	newRoute := func(managed bool, annotations map[string]string, revocation *api.RevocationStatus) *routev1.Route {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "test",
+				Name:        "foo",
+				Annotations: map[string]string{},
+				Finalizers:  []string{api.AcmeRevocationFinalizer},
+			},
+			Spec: routev1.RouteSpec{
+				Host: "foo.example.com",
+				TLS: &routev1.TLSConfig{
+					Termination: routev1.TLSTerminationEdge,
+					Certificate: crt,
+					Key:         key,
+				},
+			},
+		}
+		if managed {
+			route.Annotations["kubernetes.io/tls-acme"] = "true"
+			deletionTimestamp := metav1.NewTime(now)
+			route.DeletionTimestamp = &deletionTimestamp
+		}
+		for k, v := range annotations {
+			route.Annotations[k] = v
+		}
+
+		err := setStatus(&route.ObjectMeta, &api.Status{
+			CertificateMeta: &api.CertificateMeta{
+				NotBefore: certificate.NotBefore,
+				NotAfter:  certificate.NotAfter,
+				Domains:   certificate.DNSNames,
+			},
+			Revocation: revocation,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return route
+	}
+
+	tt := []struct {
+		name              string
+		route             *routev1.Route
+		brokenIssuer      bool
+		expectedFinalizer bool
+		expectedFailures  int
+		expectedEvent     string
+	}{
+		{
+			name:              "skip-revocation annotation removes the finalizer",
+			route:             newRoute(true, map[string]string{api.AcmeSkipRevocationAnnotation: "true"}, nil),
+			brokenIssuer:      true,
+			expectedFinalizer: false,
+			expectedEvent:     "Normal AcmeRevocationSkipped",
+		},
+		{
+			name:              "missing issuer gives up right away",
+			route:             newRoute(true, nil, nil),
+			expectedFinalizer: false,
+			expectedEvent:     "Warning AcmeRevocationAbandoned",
+		},
+		{
+			name:              "failed revocation is retried",
+			route:             newRoute(true, nil, nil),
+			brokenIssuer:      true,
+			expectedFinalizer: true,
+			expectedFailures:  1,
+			expectedEvent:     "Warning AcmeRevocationFailed",
+		},
+		{
+			name: "failed revocation waits for the backoff",
+			route: newRoute(true, nil, &api.RevocationStatus{
+				Failures:          1,
+				EarliestAttemptAt: now.Add(time.Hour),
+			}),
+			brokenIssuer:      true,
+			expectedFinalizer: true,
+			expectedFailures:  1,
+		},
+		{
+			name: "gives up after the last failed attempt",
+			route: newRoute(true, nil, &api.RevocationStatus{
+				Failures:          MaxRevocationAttempts - 1,
+				EarliestAttemptAt: now.Add(-time.Minute),
+			}),
+			brokenIssuer:      true,
+			expectedFinalizer: false,
+			expectedEvent:     "Warning AcmeRevocationAbandoned",
+		},
+		{
+			name:              "unmanaged Route with Revoke policy keeps the certificate",
+			route:             newRoute(false, map[string]string{api.AcmeRevocationPolicyAnnotation: string(api.RevocationPolicyRevoke)}, nil),
+			brokenIssuer:      true,
+			expectedFinalizer: false,
+			expectedEvent:     "Normal AcmeRevocationSkipped",
+		},
+		{
+			name:              "unmanaged Route with RevokeOnUnmanage policy is revoked",
+			route:             newRoute(false, map[string]string{api.AcmeRevocationPolicyAnnotation: string(api.RevocationPolicyRevokeOnUnmanage)}, nil),
+			brokenIssuer:      true,
+			expectedFinalizer: true,
+			expectedFailures:  1,
+			expectedEvent:     "Warning AcmeRevocationFailed",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var secrets []*corev1.Secret
+			if tc.brokenIssuer {
+				secrets = append(secrets, brokenIssuerSecret)
+			}
+			rc, _, routeClient, recorder := newTestRouteController(t, []*routev1.Route{tc.route}, secrets)
+			rc.settings = Settings{
+				CertOrderBackoffInitial: time.Minute,
+				CertOrderBackoffMax:     time.Hour,
+			}
+			if tc.brokenIssuer {
+				err := rc.kubeInformersForNamespaces.InformersFor("").Core().V1().ConfigMaps().Informer().GetIndexer().Add(brokenIssuer)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var err error
+			if util.IsManaged(tc.route, rc.annotation) {
+				err = rc.finalizeRevocation(tc.route, "test/foo")
+			} else {
+				err = rc.releaseRevocation(tc.route, "test/foo")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			route, err := routeClient.RouteV1().Routes("test").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if hasFinalizer(route, api.AcmeRevocationFinalizer) != tc.expectedFinalizer {
+				t.Errorf("expected finalizer %t, got finalizers %v", tc.expectedFinalizer, route.Finalizers)
+			}
+
+			status, err := rc.getStatus(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			failures := 0
+			if status.Revocation != nil {
+				failures = status.Revocation.Failures
+			}
+			if failures != tc.expectedFailures {
+				t.Errorf("expected %d failures, got %d", tc.expectedFailures, failures)
+			}
+
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if len(tc.expectedEvent) == 0 {
+				if len(events) != 0 {
+					t.Errorf("expected no events, got %q", events)
+				}
+			} else if len(events) != 1 || !strings.HasPrefix(events[0], tc.expectedEvent+" ") {
+				t.Errorf("expected event %q, got %q", tc.expectedEvent, events)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package route
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+// workload is a Deployment, StatefulSet or DaemonSet that can opt in to be rolled out on Secret changes.
+type workload struct {
+	kind                string
+	objectMeta          metav1.ObjectMeta
+	templateAnnotations map[string]string
+	patch               func(data []byte) error
+}
+
+func parseRolloutSecretNames(s string) []string {
+	var names []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) != 0 {
+			names = append(names, item)
+		}
+	}
+	return names
+}
+
+func hasRolloutSecret(w *workload, secretName string) bool {
+	for _, name := range parseRolloutSecretNames(w.objectMeta.Annotations[api.AcmeRolloutOnSecretChangeAnnotation]) {
+		if name == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// secretsChecksum returns the checksum of the data of the named Secrets.
+// The changed Secret takes precedence over the cache which might not have observed the change yet.
+func (rc *RouteController) secretsChecksum(namespace string, names []string, changed *corev1.Secret) (string, error) {
+	names = append([]string{}, names...)
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		var secret *corev1.Secret
+		if name == changed.Name {
+			secret = changed
+		} else {
+			var err error
+			informers := rc.kubeInformersForNamespaces.InformersForOrGlobal(namespace)
+			if informers != nil {
+				secret, err = informers.Core().V1().Secrets().Lister().Secrets(namespace).Get(name)
+			} else {
+				// Secrets can be synced into namespaces we don't watch.
+				secret, err = rc.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+			}
+			if err != nil {
+				if !kapierrors.IsNotFound(err) {
+					return "", fmt.Errorf("can't get Secret %s/%s: %w", namespace, name, err)
+				}
+				secret = &corev1.Secret{}
+			}
+		}
+
+		var keys []string
+		for k := range secret.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		_, _ = fmt.Fprintf(h, "%s\x00", name)
+		for _, k := range keys {
+			_, _ = fmt.Fprintf(h, "%s\x00", k)
+			_, _ = h.Write(secret.Data[k])
+			_, _ = h.Write([]byte{0})
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (rc *RouteController) deploymentWorkload(d *appsv1.Deployment) workload {
+	return workload{
+		kind:                "Deployment",
+		objectMeta:          d.ObjectMeta,
+		templateAnnotations: d.Spec.Template.Annotations,
+		patch: func(data []byte) error {
+			_, err := rc.kubeClient.AppsV1().Deployments(d.Namespace).Patch(d.Name, types.MergePatchType, data)
+			return err
+		},
+	}
+}
+
+func (rc *RouteController) statefulSetWorkload(s *appsv1.StatefulSet) workload {
+	return workload{
+		kind:                "StatefulSet",
+		objectMeta:          s.ObjectMeta,
+		templateAnnotations: s.Spec.Template.Annotations,
+		patch: func(data []byte) error {
+			_, err := rc.kubeClient.AppsV1().StatefulSets(s.Namespace).Patch(s.Name, types.MergePatchType, data)
+			return err
+		},
+	}
+}
+
+func (rc *RouteController) daemonSetWorkload(ds *appsv1.DaemonSet) workload {
+	return workload{
+		kind:                "DaemonSet",
+		objectMeta:          ds.ObjectMeta,
+		templateAnnotations: ds.Spec.Template.Annotations,
+		patch: func(data []byte) error {
+			_, err := rc.kubeClient.AppsV1().DaemonSets(ds.Namespace).Patch(ds.Name, types.MergePatchType, data)
+			return err
+		},
+	}
+}
+
+// listWorkloads returns the workloads in the namespace from the informer caches.
+// Secrets can be synced into namespaces we don't watch in which case we fall back to the API.
+func (rc *RouteController) listWorkloads(namespace string) ([]workload, error) {
+	informers := rc.kubeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		return rc.listWorkloadsLive(namespace)
+	}
+
+	var workloads []workload
+
+	deployments, err := informers.Apps().V1().Deployments().Lister().Deployments(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("can't list Deployments in namespace %q: %w", namespace, err)
+	}
+	for _, d := range deployments {
+		workloads = append(workloads, rc.deploymentWorkload(d))
+	}
+
+	statefulSets, err := informers.Apps().V1().StatefulSets().Lister().StatefulSets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("can't list StatefulSets in namespace %q: %w", namespace, err)
+	}
+	for _, s := range statefulSets {
+		workloads = append(workloads, rc.statefulSetWorkload(s))
+	}
+
+	daemonSets, err := informers.Apps().V1().DaemonSets().Lister().DaemonSets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("can't list DaemonSets in namespace %q: %w", namespace, err)
+	}
+	for _, ds := range daemonSets {
+		workloads = append(workloads, rc.daemonSetWorkload(ds))
+	}
+
+	return workloads, nil
+}
+
+func (rc *RouteController) listWorkloadsLive(namespace string) ([]workload, error) {
+	var workloads []workload
+
+	deployments, err := rc.kubeClient.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't list Deployments in namespace %q: %w", namespace, err)
+	}
+	for i := range deployments.Items {
+		workloads = append(workloads, rc.deploymentWorkload(&deployments.Items[i]))
+	}
+
+	statefulSets, err := rc.kubeClient.AppsV1().StatefulSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't list StatefulSets in namespace %q: %w", namespace, err)
+	}
+	for i := range statefulSets.Items {
+		workloads = append(workloads, rc.statefulSetWorkload(&statefulSets.Items[i]))
+	}
+
+	daemonSets, err := rc.kubeClient.AppsV1().DaemonSets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("can't list DaemonSets in namespace %q: %w", namespace, err)
+	}
+	for i := range daemonSets.Items {
+		workloads = append(workloads, rc.daemonSetWorkload(&daemonSets.Items[i]))
+	}
+
+	return workloads, nil
+}
+
+// rolloutWorkloads triggers a rolling restart of the workloads that opted in to it for the Secret
+// by patching the checksum of the Secrets they reference into their pod templates.
+// Workloads that already carry the current checksum are left alone so it is safe to call on every sync.
+func (rc *RouteController) rolloutWorkloads(route *routev1.Route, secret *corev1.Secret) error {
+	workloads, err := rc.listWorkloads(secret.Namespace)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range workloads {
+		w := &workloads[i]
+		if !hasRolloutSecret(w, secret.Name) {
+			continue
+		}
+
+		checksum, err := rc.secretsChecksum(secret.Namespace, parseRolloutSecretNames(w.objectMeta.Annotations[api.AcmeRolloutOnSecretChangeAnnotation]), secret)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if w.templateAnnotations[api.AcmeSecretsChecksumAnnotation] == checksum {
+			continue
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"annotations": map[string]string{
+							api.AcmeSecretsChecksumAnnotation: checksum,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		klog.V(2).Infof("Rolling out %s %s/%s because Secret %s/%s changed", w.kind, w.objectMeta.Namespace, w.objectMeta.Name, secret.Namespace, secret.Name)
+		err = w.patch(patch)
+		if err != nil {
+			rc.recorder.Eventf(route, corev1.EventTypeWarning, "RolloutFailed", "Can't roll out %s %s/%s after Secret %s/%s changed: %v", w.kind, w.objectMeta.Namespace, w.objectMeta.Name, secret.Namespace, secret.Name, err)
+			errs = append(errs, fmt.Errorf("can't patch %s %s/%s: %w", w.kind, w.objectMeta.Namespace, w.objectMeta.Name, err))
+			continue
+		}
+		rc.recorder.Eventf(route, corev1.EventTypeNormal, "RolloutTriggered", "Rolling out %s %s/%s because Secret %s/%s changed", w.kind, w.objectMeta.Namespace, w.objectMeta.Name, secret.Namespace, secret.Name)
+	}
+
+	return apierrors.NewAggregate(errs)
+}
@@ -0,0 +1,293 @@
+package route
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+)
+
+func TestRolloutWorkloads(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo-tls",
+		},
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("crt"),
+			corev1.TLSPrivateKeyKey: []byte("key"),
+		},
+	}
+	otherSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "bar-tls",
+		},
+		Data: map[string][]byte{
+			corev1.TLSCertKey: []byte("other"),
+		},
+	}
+
+	kubeInformersForNamespaces := kubeinformers.NewKubeInformersForNamespaces(kubefake.NewSimpleClientset(), []string{"test"})
+	informers := kubeInformersForNamespaces.InformersFor("test")
+	err := informers.Core().V1().Secrets().Informer().GetIndexer().Add(otherSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := &RouteController{
+		kubeInformersForNamespaces: kubeInformersForNamespaces,
+	}
+
+	checksum, err := rc.secretsChecksum("test", []string{"foo-tls"}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	combinedChecksum, err := rc.secretsChecksum("test", []string{"foo-tls", "bar-tls"}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum == combinedChecksum {
+		t.Fatalf("expected checksums to differ")
+	}
+
+	podTemplate := func(checksum string) corev1.PodTemplateSpec {
+		template := corev1.PodTemplateSpec{}
+		if len(checksum) != 0 {
+			template.Annotations = map[string]string{
+				api.AcmeSecretsChecksumAnnotation: checksum,
+			}
+		}
+		return template
+	}
+	objectMeta := func(name, rolloutSecrets string) metav1.ObjectMeta {
+		meta := metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      name,
+		}
+		if len(rolloutSecrets) != 0 {
+			meta.Annotations = map[string]string{
+				api.AcmeRolloutOnSecretChangeAnnotation: rolloutSecrets,
+			}
+		}
+		return meta
+	}
+
+	objects := []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: objectMeta("opted-in", "foo-tls"),
+			Spec:       appsv1.DeploymentSpec{Template: podTemplate("")},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: objectMeta("not-opted-in", ""),
+			Spec:       appsv1.DeploymentSpec{Template: podTemplate("")},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: objectMeta("up-to-date", "foo-tls"),
+			Spec:       appsv1.DeploymentSpec{Template: podTemplate(checksum)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: objectMeta("multiple-secrets", "bar-tls, foo-tls"),
+			Spec:       appsv1.StatefulSetSpec{Template: podTemplate(checksum)},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: objectMeta("other-secret", "bar-tls"),
+			Spec:       appsv1.StatefulSetSpec{Template: podTemplate("")},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: objectMeta("opted-in", "foo-tls"),
+			Spec:       appsv1.DaemonSetSpec{Template: podTemplate("stale")},
+		},
+	}
+	for _, obj := range objects {
+		switch obj := obj.(type) {
+		case *appsv1.Deployment:
+			err = informers.Apps().V1().Deployments().Informer().GetIndexer().Add(obj)
+		case *appsv1.StatefulSet:
+			err = informers.Apps().V1().StatefulSets().Informer().GetIndexer().Add(obj)
+		case *appsv1.DaemonSet:
+			err = informers.Apps().V1().DaemonSets().Informer().GetIndexer().Add(obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Workloads in the namespace we don't watch have to be found using the API.
+	unwatchedSecret := secret.DeepCopy()
+	unwatchedSecret.Namespace = "unwatched"
+	unwatchedOtherSecret := otherSecret.DeepCopy()
+	unwatchedOtherSecret.Namespace = "unwatched"
+	unwatchedStatefulSet := &appsv1.StatefulSet{
+		ObjectMeta: objectMeta("multiple-secrets", "bar-tls, foo-tls"),
+		Spec:       appsv1.StatefulSetSpec{Template: podTemplate("")},
+	}
+	unwatchedStatefulSet.Namespace = "unwatched"
+
+	kubeClient := kubefake.NewSimpleClientset(append(objects, unwatchedOtherSecret, unwatchedStatefulSet)...)
+	rc.kubeClient = kubeClient
+	recorder := record.NewFakeRecorder(10)
+	rc.recorder = recorder
+
+	err = rc.rolloutWorkloads(&routev1.Route{}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var patched []string
+	for _, a := range kubeClient.Actions() {
+		if a, ok := a.(kubetesting.PatchAction); ok {
+			patched = append(patched, a.GetResource().Resource+"/"+a.GetName())
+		}
+	}
+	sort.Strings(patched)
+	expectedPatched := []string{"daemonsets/opted-in", "deployments/opted-in", "statefulsets/multiple-secrets"}
+	if !reflect.DeepEqual(patched, expectedPatched) {
+		t.Errorf("expected patched workloads %q, got %q", expectedPatched, patched)
+	}
+
+	deployment, err := kubeClient.AppsV1().Deployments("test").Get("opted-in", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deployment.Spec.Template.Annotations[api.AcmeSecretsChecksumAnnotation]; got != checksum {
+		t.Errorf("expected Deployment checksum %q, got %q", checksum, got)
+	}
+
+	statefulSet, err := kubeClient.AppsV1().StatefulSets("test").Get("multiple-secrets", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statefulSet.Spec.Template.Annotations[api.AcmeSecretsChecksumAnnotation]; got != combinedChecksum {
+		t.Errorf("expected StatefulSet checksum %q, got %q", combinedChecksum, got)
+	}
+
+	if len(recorder.Events) != len(expectedPatched) {
+		t.Errorf("expected %d events, got %d", len(expectedPatched), len(recorder.Events))
+	}
+
+	err = rc.rolloutWorkloads(&routev1.Route{}, unwatchedSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statefulSet, err = kubeClient.AppsV1().StatefulSets("unwatched").Get("multiple-secrets", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statefulSet.Spec.Template.Annotations[api.AcmeSecretsChecksumAnnotation]; got != combinedChecksum {
+		t.Errorf("expected StatefulSet checksum %q in unwatched namespace, got %q", combinedChecksum, got)
+	}
+}
+
+func TestSyncSecretRetriesFailedRollout(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			UID:       "foo-uid",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme": "true",
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "foo.example.com",
+			TLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationEdge,
+				Certificate: crt,
+				Key:         key,
+			},
+		},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			Annotations: map[string]string{
+				api.AcmeRolloutOnSecretChangeAnnotation: "foo-tls",
+			},
+		},
+	}
+
+	rc, kubeClient, _, recorder := newTestRouteController(t, []*routev1.Route{route}, nil)
+	err := kubeClient.Tracker().Add(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rc.kubeInformersForNamespaces.InformersFor("").Apps().V1().Deployments().Informer().GetIndexer().Add(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := 1
+	kubeClient.PrependReactor("patch", "deployments", func(action kubetesting.Action) (bool, runtime.Object, error) {
+		if failures > 0 {
+			failures--
+			return true, nil, errors.New("patch failed")
+		}
+		return false, nil, nil
+	})
+
+	err = rc.syncSecret(route, "foo-tls")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	event := <-recorder.Events
+	if !strings.HasPrefix(event, "Warning RolloutFailed") {
+		t.Errorf("expected RolloutFailed event, got %q", event)
+	}
+
+	// The Secret data are up to date by now so only the workload is left to be reconciled.
+	secret, err := kubeClient.CoreV1().Secrets("test").Get("foo-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rc.kubeInformersForNamespaces.InformersFor("").Core().V1().Secrets().Informer().GetIndexer().Add(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubeClient.ClearActions()
+
+	err = rc.syncSecret(route, "foo-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var verbs []string
+	for _, a := range kubeClient.Actions() {
+		if a.GetVerb() != "list" {
+			verbs = append(verbs, a.GetVerb()+" "+a.GetResource().Resource)
+		}
+	}
+	expectedVerbs := []string{"patch deployments"}
+	if !reflect.DeepEqual(verbs, expectedVerbs) {
+		t.Errorf("expected actions %q, got %q", expectedVerbs, verbs)
+	}
+
+	checksum, err := rc.secretsChecksum("test", []string{"foo-tls"}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment, err = kubeClient.AppsV1().Deployments("test").Get("foo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := deployment.Spec.Template.Annotations[api.AcmeSecretsChecksumAnnotation]; got != checksum {
+		t.Errorf("expected Deployment checksum %q, got %q", checksum, got)
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base32"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"reflect"
 	"regexp"
@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
@@ -43,23 +44,34 @@ import (
 	routev1 "github.com/openshift/api/route/v1"
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 	_ "github.com/openshift/client-go/route/clientset/versioned/scheme"
+	routeinformersexternal "github.com/openshift/client-go/route/informers/externalversions"
 
 	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/caa"
 	"github.com/tnozicka/openshift-acme/pkg/cert"
 	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
 	"github.com/tnozicka/openshift-acme/pkg/helpers"
 	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
 	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
+	"github.com/tnozicka/openshift-acme/pkg/ratelimit"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
 	routeutil "github.com/tnozicka/openshift-acme/pkg/route"
+	"github.com/tnozicka/openshift-acme/pkg/sharding"
 	"github.com/tnozicka/openshift-acme/pkg/util"
 )
 
 const (
-	ControllerName           = "openshift-acme-controller"
-	ExposerFileKey           = "exposer-file"
-	RenewalStandardDeviation = 1
-	RenewalMean              = 0
-	AcmeTimeout              = 60 * time.Second
+	ControllerName       = "openshift-acme-controller"
+	ExposerFileKey       = "exposer-file"
+	AcmeTimeout          = 60 * time.Second
+	ExposerContainerPort = 5000
+	// AcmePollInitialInterval is the initial delay for polling ACME-side state we can't get events for.
+	AcmePollInitialInterval = 2 * time.Second
+	// AcmePollMaxInterval caps the exponential polling of ACME-side state.
+	AcmePollMaxInterval = 2 * time.Minute
+	// CertOrderBackoffJitter is the maximum fraction of the backoff added randomly
+	// so failed orders created at the same time don't hit the CA at once.
+	CertOrderBackoffJitter = 0.2
 	// BackoffGCInterval is the time that has to pass before next iteration of backoff GC is run
 	BackoffGCInterval = 1 * time.Minute
 )
@@ -71,12 +83,13 @@ var (
 )
 
 type RouteController struct {
-	annotation               string
-	certOrderBackoffInitial  time.Duration
-	certOrderBackoffMax      time.Duration
-	certDefaultRSAKeyBitSize int
-	exposerImage             string
-	controllerNamespace      string
+	annotation          string
+	http01SolverMode    api.Http01SolverMode
+	controllerNamespace string
+
+	// settings can be replaced at runtime when the controller config is reloaded.
+	settingsMutex sync.RWMutex
+	settings      Settings
 
 	kubeClient                 kubernetes.Interface
 	kubeInformersForNamespaces kubeinformers.Interface
@@ -90,15 +103,32 @@ type RouteController struct {
 
 	queue                workqueue.RateLimitingInterface
 	routesToSecretsQueue workqueue.RateLimitingInterface
+	sharedExposerQueue   workqueue.RateLimitingInterface
+
+	// acmePollRateLimiter paces requeues for ACME-side state which we can't watch.
+	acmePollRateLimiter workqueue.RateLimiter
+
+	// orderScheduler keeps us within the CA rate limits.
+	orderScheduler *ratelimit.Scheduler
+
+	// caaChecker checks the CAA records before creating orders. Nil disables the check.
+	caaChecker *caa.Checker
+
+	// shards limits the Routes we manage to the shards owned by this replica. Nil manages all of them.
+	shards *sharding.Set
+
+	// secretSyncInformers cache the Secrets synced into other namespaces. Nil uses live calls instead.
+	secretSyncInformers *SecretSyncInformers
 }
 
 func NewRouteController(
 	annotation string,
-	certOrderBackoffInitial time.Duration,
-	certOrderBackoffMax time.Duration,
-	certDefaultRSAKeyBitSize int,
-	exposerImage string,
+	settings Settings,
+	http01SolverMode api.Http01SolverMode,
 	controllerNamespace string,
+	caaChecker *caa.Checker,
+	shards *sharding.Set,
+	secretSyncInformers *SecretSyncInformers,
 	kubeClient kubernetes.Interface,
 	kubeInformersForNamespaces kubeinformers.Interface,
 	routeClient routeclientset.Interface,
@@ -109,12 +139,11 @@ func NewRouteController(
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
 
 	rc := &RouteController{
-		annotation:               annotation,
-		certOrderBackoffInitial:  certOrderBackoffInitial,
-		certOrderBackoffMax:      certOrderBackoffMax,
-		certDefaultRSAKeyBitSize: certDefaultRSAKeyBitSize,
-		exposerImage:             exposerImage,
-		controllerNamespace:      controllerNamespace,
+		annotation:          annotation,
+		http01SolverMode:    http01SolverMode,
+		controllerNamespace: controllerNamespace,
+
+		settings: settings,
 
 		kubeClient:                 kubeClient,
 		kubeInformersForNamespaces: kubeInformersForNamespaces,
@@ -126,6 +155,17 @@ func NewRouteController(
 
 		queue:                workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 		routesToSecretsQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		sharedExposerQueue:   workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+
+		acmePollRateLimiter: workqueue.NewItemExponentialFailureRateLimiter(AcmePollInitialInterval, AcmePollMaxInterval),
+
+		orderScheduler: ratelimit.NewScheduler(),
+
+		caaChecker: caaChecker,
+
+		shards: shards,
+
+		secretSyncInformers: secretSyncInformers,
 	}
 
 	if len(routeInformersForNamespaces.Namespaces()) < 1 {
@@ -133,51 +173,149 @@ func NewRouteController(
 	}
 
 	for _, namespace := range routeInformersForNamespaces.Namespaces() {
-		klog.V(4).Infof("Setting up route informers for namespace %q", namespace)
-
-		informers := routeInformersForNamespaces.InformersFor(namespace)
-
-		informers.Route().V1().Routes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc:    rc.addRoute,
-			UpdateFunc: rc.updateRoute,
-			DeleteFunc: rc.deleteRoute,
-		})
-		rc.cachesToSync = append(rc.cachesToSync, informers.Route().V1().Routes().Informer().HasSynced)
+		rc.cachesToSync = append(rc.cachesToSync, rc.setUpRouteInformers(namespace, routeInformersForNamespaces.InformersFor(namespace))...)
 	}
+	// Namespaces added later on are synced by the namespace controller before any of their Routes are enqueued.
+	routeInformersForNamespaces.AddNamespaceHandler(func(namespace string, informers routeinformersexternal.SharedInformerFactory) {
+		rc.setUpRouteInformers(namespace, informers)
+	})
 
 	if len(kubeInformersForNamespaces.Namespaces()) < 1 {
 		panic("no namespace set up")
 	}
 
 	for _, namespace := range kubeInformersForNamespaces.Namespaces() {
-		klog.V(4).Infof("Setting up kube informers for namespace %q", namespace)
+		rc.cachesToSync = append(rc.cachesToSync, rc.setUpKubeInformers(namespace, kubeInformersForNamespaces.InformersFor(namespace))...)
+	}
+	kubeInformersForNamespaces.AddNamespaceHandler(func(namespace string, informers informers.SharedInformerFactory) {
+		rc.setUpKubeInformers(namespace, informers)
+	})
+
+	// Denied Routes need to be retried when the hostname policy changes.
+	kubeInformersForNamespaces.InformersForOrGlobal(controllerNamespace).Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addConfigMap,
+		UpdateFunc: rc.updateConfigMap,
+		DeleteFunc: rc.deleteConfigMap,
+	})
 
-		informers := kubeInformersForNamespaces.InformersFor(namespace)
+	if http01SolverMode == api.Http01SolverModeShared {
+		informers := kubeInformersForNamespaces.InformersForOrGlobal(controllerNamespace)
 
-		informers.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			UpdateFunc: rc.updateSecret,
-			DeleteFunc: rc.deleteSecret,
+		informers.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    rc.addDeployment,
+			UpdateFunc: rc.updateDeployment,
+			DeleteFunc: rc.deleteDeployment,
 		})
-		rc.cachesToSync = append(rc.cachesToSync, informers.Core().V1().Secrets().Informer().HasSynced)
+		rc.cachesToSync = append(rc.cachesToSync, informers.Apps().V1().Deployments().Informer().HasSynced)
+	}
+
+	if secretSyncInformers != nil {
+		rc.cachesToSync = append(rc.cachesToSync, rc.setUpSecretSyncInformers(secretSyncInformers)...)
+	}
 
-		// FIXME: requeue on exposer objects
-		rc.cachesToSync = append(rc.cachesToSync, informers.Core().V1().Services().Informer().HasSynced)
+	if shards != nil {
+		// Other replicas create orders for the other shards using the same accounts.
+		rc.orderScheduler.SetShards(shards.Count())
 
-		informers.Apps().V1().ReplicaSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc:    rc.addReplicaSet,
-			UpdateFunc: rc.updateReplicaSet,
-			DeleteFunc: rc.deleteReplicaSet,
+		// Routes skipped while another replica owned the shard need to be synced now.
+		shards.AddHandler(func(int) {
+			rc.enqueueAllRoutes()
+			rc.enqueueSharedExposer()
 		})
-		rc.cachesToSync = append(rc.cachesToSync, informers.Apps().V1().ReplicaSets().Informer().HasSynced)
+	}
 
-		// We need to watch CM for global and local issuers
-		rc.cachesToSync = append(rc.cachesToSync, informers.Core().V1().ConfigMaps().Informer().HasSynced)
+	return rc
+}
 
-		// We need to watch LimitRanges to respect Min and Max values on exposer pods
-		rc.cachesToSync = append(rc.cachesToSync, informers.Core().V1().LimitRanges().Informer().HasSynced)
+// setUpRouteInformers registers the event handlers for the namespace and returns the caches we need to wait for.
+func (rc *RouteController) setUpRouteInformers(namespace string, informers routeinformersexternal.SharedInformerFactory) []cache.InformerSynced {
+	klog.V(4).Infof("Setting up route informers for namespace %q", namespace)
+
+	var cachesToSync []cache.InformerSynced
+	err := informers.Route().V1().Routes().Informer().AddIndexers(cache.Indexers{
+		keystorePasswordSecretIndex: indexByKeystorePasswordSecret,
+	})
+	if err != nil {
+		panic(fmt.Errorf("can't add keystore password secret index: %w", err))
 	}
 
-	return rc
+	informers.Route().V1().Routes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addRoute,
+		UpdateFunc: rc.updateRoute,
+		DeleteFunc: rc.deleteRoute,
+	})
+	cachesToSync = append(cachesToSync, informers.Route().V1().Routes().Informer().HasSynced)
+
+	return cachesToSync
+}
+
+// setUpKubeInformers registers the event handlers for the namespace and returns the caches we need to wait for.
+func (rc *RouteController) setUpKubeInformers(namespace string, informers informers.SharedInformerFactory) []cache.InformerSynced {
+	klog.V(4).Infof("Setting up kube informers for namespace %q", namespace)
+
+	var cachesToSync []cache.InformerSynced
+
+	informers.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addSecret,
+		UpdateFunc: rc.updateSecret,
+		DeleteFunc: rc.deleteSecret,
+	})
+	cachesToSync = append(cachesToSync, informers.Core().V1().Secrets().Informer().HasSynced)
+
+	informers.Core().V1().Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addService,
+		UpdateFunc: rc.updateService,
+		DeleteFunc: rc.deleteService,
+	})
+	cachesToSync = append(cachesToSync, informers.Core().V1().Services().Informer().HasSynced)
+
+	informers.Apps().V1().ReplicaSets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addReplicaSet,
+		UpdateFunc: rc.updateReplicaSet,
+		DeleteFunc: rc.deleteReplicaSet,
+	})
+	cachesToSync = append(cachesToSync, informers.Apps().V1().ReplicaSets().Informer().HasSynced)
+
+	// Exposer pods can get stuck on scheduling, quota or image pulls without the ReplicaSet changing
+	informers.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.addPod,
+		UpdateFunc: rc.updatePod,
+		DeleteFunc: rc.deletePod,
+	})
+	cachesToSync = append(cachesToSync, informers.Core().V1().Pods().Informer().HasSynced)
+
+	// We need to watch CM for global and local issuers
+	cachesToSync = append(cachesToSync, informers.Core().V1().ConfigMaps().Informer().HasSynced)
+
+	// We need to watch LimitRanges to respect Min and Max values on exposer pods
+	cachesToSync = append(cachesToSync, informers.Core().V1().LimitRanges().Informer().HasSynced)
+
+	// We need to find workloads that opted in to be rolled out on Secret changes
+	cachesToSync = append(cachesToSync, informers.Apps().V1().Deployments().Informer().HasSynced)
+	cachesToSync = append(cachesToSync, informers.Apps().V1().StatefulSets().Informer().HasSynced)
+	cachesToSync = append(cachesToSync, informers.Apps().V1().DaemonSets().Informer().HasSynced)
+
+	return cachesToSync
+}
+
+// kubeInformersFor returns the kube informers for the namespace.
+// The namespace controller can release the namespace while a sync is in flight, so a missing
+// namespace is reported as an error instead of handing out nil informers.
+func (rc *RouteController) kubeInformersFor(namespace string) (informers.SharedInformerFactory, error) {
+	kubeInformers := rc.kubeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if kubeInformers == nil {
+		return nil, fmt.Errorf("namespace %q isn't watched anymore", namespace)
+	}
+	return kubeInformers, nil
+}
+
+// routeInformersFor returns the route informers for the namespace, see kubeInformersFor.
+func (rc *RouteController) routeInformersFor(namespace string) (routeinformersexternal.SharedInformerFactory, error) {
+	routeInformers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if routeInformers == nil {
+		return nil, fmt.Errorf("namespace %q isn't watched anymore", namespace)
+	}
+	return routeInformers, nil
 }
 
 func (rc *RouteController) enqueueRoute(route *routev1.Route) {
@@ -190,7 +328,7 @@ func (rc *RouteController) enqueueRoute(route *routev1.Route) {
 	rc.queue.Add(key)
 
 	_, ok := GetSyncSecretName(route)
-	if ok {
+	if ok || len(syncedSecretName(route)) != 0 || len(route.Annotations[api.AcmeSecretTargetsAnnotation]) != 0 || hasFinalizer(route, api.AcmeSecretSyncFinalizer) {
 		rc.enqueueRouteToSecret(route)
 	}
 }
@@ -207,7 +345,13 @@ func (rc *RouteController) enqueueRouteToSecret(route *routev1.Route) {
 
 func (rc *RouteController) addRoute(obj interface{}) {
 	route := obj.(*routev1.Route)
-	if !util.IsManaged(route, rc.annotation) {
+
+	if util.IsTemporary(route) {
+		rc.exposerRouteChanged(route)
+		return
+	}
+
+	if !util.IsManaged(route, rc.annotation) && !hasControllerFinalizer(route) {
 		return
 	}
 
@@ -219,7 +363,13 @@ func (rc *RouteController) updateRoute(old, cur interface{}) {
 	oldRoute := old.(*routev1.Route)
 	newRoute := cur.(*routev1.Route)
 
-	if !util.IsManaged(newRoute, rc.annotation) {
+	// Exposer Routes need to requeue the parent Route e.g. when they get admitted
+	if util.IsTemporary(newRoute) {
+		rc.exposerRouteChanged(newRoute)
+		return
+	}
+
+	if !util.IsManaged(newRoute, rc.annotation) && !hasControllerFinalizer(newRoute) {
 		return
 	}
 
@@ -242,9 +392,12 @@ func (rc *RouteController) deleteRoute(obj interface{}) {
 		}
 	}
 
-	if !util.IsManaged(route, rc.annotation) {
-		// TODO: if it is the exposer route we need to requeue the parrent route
+	if util.IsTemporary(route) {
+		rc.exposerRouteChanged(route)
+		return
+	}
 
+	if !util.IsManaged(route, rc.annotation) {
 		klog.V(5).Infof("Skipping Route %s/%s RV=%s UID=%s", route.Namespace, route.Name, route.ResourceVersion, route.UID)
 		return
 	}
@@ -253,13 +406,33 @@ func (rc *RouteController) deleteRoute(obj interface{}) {
 	rc.enqueueRoute(route)
 }
 
+func (rc *RouteController) exposerRouteChanged(route *routev1.Route) {
+	rc.enqueueOwningRoute(route)
+
+	if isSharedExposerRoute(route) && route.Namespace == rc.controllerNamespace {
+		rc.enqueueSharedExposer()
+	}
+}
+
 func (rc *RouteController) enqueueOwningRoute(obj metav1.Object) {
 	routeKey, ok := obj.GetAnnotations()[api.AcmeExposerKey]
 	if !ok {
 		return
 	}
 
-	objReadOnly, exists, err := rc.routeInformersForNamespaces.InformersForOrGlobal(obj.GetNamespace()).Route().V1().Routes().Informer().GetIndexer().GetByKey(routeKey)
+	// Shared exposer objects live in the controller namespace, not in the namespace of the owning Route.
+	namespace, _, err := cache.SplitMetaNamespaceKey(routeKey)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		return
+	}
+
+	objReadOnly, exists, err := informers.Route().V1().Routes().Informer().GetIndexer().GetByKey(routeKey)
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", routeKey, err)
 		return
@@ -276,6 +449,14 @@ func (rc *RouteController) enqueueOwningRoute(obj metav1.Object) {
 	rc.queue.Add(routeKey)
 }
 
+// pollAcme requeues the Route with capped exponential backoff so we can observe
+// state changes on the ACME server (and outside of the cluster) which we can't get events for.
+func (rc *RouteController) pollAcme(key string) {
+	delay := rc.acmePollRateLimiter.When(key)
+	klog.V(4).Infof("Route %q: polling ACME state in %v", key, delay)
+	rc.queue.AddAfter(key, delay)
+}
+
 func (rc *RouteController) addReplicaSet(obj interface{}) {
 	rc.enqueueOwningRoute(obj.(*appsv1.ReplicaSet))
 }
@@ -303,10 +484,102 @@ func (rc *RouteController) deleteReplicaSet(obj interface{}) {
 	rc.enqueueOwningRoute(rs)
 }
 
+func (rc *RouteController) addService(obj interface{}) {
+	service := obj.(*corev1.Service)
+	if rc.isSharedExposerObject(service) {
+		rc.sharedExposerObjectChanged(service)
+		return
+	}
+
+	rc.enqueueOwningRoute(service)
+}
+
+func (rc *RouteController) updateService(old, cur interface{}) {
+	newService := cur.(*corev1.Service)
+	if rc.isSharedExposerObject(newService) {
+		rc.sharedExposerObjectChanged(newService)
+		return
+	}
+
+	rc.enqueueOwningRoute(old.(*corev1.Service))
+	rc.enqueueOwningRoute(newService)
+}
+
+func (rc *RouteController) deleteService(obj interface{}) {
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("object is not a Service neither tombstone: %#v", obj))
+			return
+		}
+		service, ok = tombstone.Obj.(*corev1.Service)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a Service %#v", obj))
+			return
+		}
+	}
+
+	if rc.isSharedExposerObject(service) {
+		rc.sharedExposerObjectChanged(service)
+		return
+	}
+
+	rc.enqueueOwningRoute(service)
+}
+
+func (rc *RouteController) addPod(obj interface{}) {
+	rc.enqueueOwningRoute(obj.(*corev1.Pod))
+}
+
+func (rc *RouteController) updatePod(old, cur interface{}) {
+	oldPod := old.(*corev1.Pod)
+	newPod := cur.(*corev1.Pod)
+
+	// Periodic resyncs send update events for all pods
+	if oldPod.ResourceVersion == newPod.ResourceVersion {
+		return
+	}
+
+	rc.enqueueOwningRoute(newPod)
+}
+
+func (rc *RouteController) deletePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("object is not a Pod neither tombstone: %#v", obj))
+			return
+		}
+		pod, ok = tombstone.Obj.(*corev1.Pod)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a Pod %#v", obj))
+			return
+		}
+	}
+
+	rc.enqueueOwningRoute(pod)
+}
+
+func (rc *RouteController) addSecret(obj interface{}) {
+	rc.enqueueKeystorePasswordSecretRoutes(obj.(*corev1.Secret))
+}
+
 func (rc *RouteController) updateSecret(old, cur interface{}) {
 	oldSecret := old.(*corev1.Secret)
 	newSecret := cur.(*corev1.Secret)
 
+	// Periodic resyncs send update events for all Secrets
+	if oldSecret.ResourceVersion != newSecret.ResourceVersion {
+		rc.enqueueKeystorePasswordSecretRoutes(newSecret)
+	}
+
+	if rc.isSharedExposerObject(newSecret) {
+		rc.sharedExposerObjectChanged(newSecret)
+		return
+	}
+
 	newControllerRef := metav1.GetControllerOf(newSecret)
 	if newControllerRef == nil {
 		return
@@ -320,7 +593,7 @@ func (rc *RouteController) updateSecret(old, cur interface{}) {
 	klog.V(4).Infof("Updating Secret %s/%s RV=%s->%s UID=%s->%s.", newSecret.Namespace, newSecret.Name, oldSecret.ResourceVersion, newSecret.ResourceVersion, oldSecret.UID, newSecret.UID)
 
 	secretName, ok := GetSyncSecretName(route)
-	if ok && secretName == newSecret.Name {
+	if ok && secretName == newSecret.Name && !isPassthrough(route) {
 		// We don't need to requeue Route for sync secret change
 		rc.enqueueRouteToSecret(route)
 	} else {
@@ -346,6 +619,13 @@ func (rc *RouteController) deleteSecret(obj interface{}) {
 		}
 	}
 
+	rc.enqueueKeystorePasswordSecretRoutes(secret)
+
+	if rc.isSharedExposerObject(secret) {
+		rc.sharedExposerObjectChanged(secret)
+		return
+	}
+
 	controllerRef := metav1.GetControllerOf(secret)
 	if controllerRef == nil {
 		return
@@ -359,7 +639,7 @@ func (rc *RouteController) deleteSecret(obj interface{}) {
 	klog.V(4).Infof("Secret %s/%s deleted.", secret.Namespace, secret.Name)
 
 	secretName, ok := GetSyncSecretName(route)
-	if ok && secretName == secret.Name {
+	if ok && secretName == secret.Name && !isPassthrough(route) {
 		// We don't need to requeue Route for sync secret change
 		rc.enqueueRouteToSecret(route)
 	} else {
@@ -376,7 +656,12 @@ func (rc *RouteController) resolveControllerRef(namespace string, controllerRef
 		return nil
 	}
 
-	route, err := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace).Route().V1().Routes().Lister().Routes(namespace).Get(controllerRef.Name)
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		return nil
+	}
+
+	route, err := informers.Route().V1().Routes().Lister().Routes(namespace).Get(controllerRef.Name)
 	if err != nil {
 		return nil
 	}
@@ -388,7 +673,7 @@ func (rc *RouteController) resolveControllerRef(namespace string, controllerRef
 	return route
 }
 
-func needsCertKey(t time.Time, route *routev1.Route) (string, error) {
+func needsCertKey(t time.Time, route *routev1.Route, window renewal.Window) (string, error) {
 	if route.Spec.TLS == nil || route.Spec.TLS.Key == "" || route.Spec.TLS.Certificate == "" {
 		return "Route is missing CertKey", nil
 	}
@@ -412,30 +697,223 @@ func needsCertKey(t time.Time, route *routev1.Route) (string, error) {
 		return "Already expired", nil
 	}
 
-	// We need to trigger renewals before the certs expire
-	remains := certificate.NotAfter.Sub(t)
-	lifetime := certificate.NotAfter.Sub(certificate.NotBefore)
+	// We need to trigger renewals before the certs expire. In case many certificates were provisioned
+	// at specific time we avoid spikes by spreading the renewals. Seeding by UID keeps the time
+	// stable for a Route so it doesn't shift with every resync.
+	return window.Reason(t, certificate.NotBefore, certificate.NotAfter, string(route.UID)), nil
+}
 
-	// This is the deadline when we start renewing
-	if remains <= lifetime/3 {
-		return "In renewal period", nil
-	}
+// renewalWindowForRoute returns the renewal window from the Route annotations, falling back to the issuer and the controller defaults.
+// Invalid values are ignored and reported by the InvalidRenewalWindow condition.
+func (rc *RouteController) renewalWindowForRoute(route *routev1.Route, status *api.Status) renewal.Window {
+	window := rc.getSettings().RenewalWindow
+	var messages []string
 
-	// In case many certificates were provisioned at specific time
-	// We will try to avoid spikes by renewing randomly
-	if remains <= lifetime/2 {
-		// We need to randomize renewals to spread the load.
-		// Closer to deadline, bigger chance
-		s := rand.NewSource(t.UnixNano())
-		r := rand.New(s)
-		n := r.NormFloat64()*RenewalStandardDeviation + RenewalMean
-		// We use left half of normal distribution (all negative numbers).
-		if n < 0 {
-			return "Proactive renewal", nil
+	certIssuer, _, err := controllerutils.IssuerForObject(route.ObjectMeta, rc.controllerNamespace, rc.kubeInformersForNamespaces)
+	if err != nil {
+		klog.V(4).Infof("Can't determine renewal window from issuer for Route %s/%s: %v", route.Namespace, route.Name, err)
+	} else if certIssuer.RenewalWindow != nil {
+		issuerWindow, err := window.Override(certIssuer.RenewalWindow.RenewBefore, certIssuer.RenewalWindow.ProactiveRenewBefore)
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("Ignoring renewal window from issuer: %v", err))
+		} else {
+			window = issuerWindow
 		}
 	}
 
-	return "", nil
+	routeWindow, err := window.Override(route.Annotations[api.AcmeRenewBeforeAnnotation], route.Annotations[api.AcmeProactiveRenewBeforeAnnotation])
+	if err != nil {
+		messages = append(messages, fmt.Sprintf("Ignoring renewal window from annotations: %v", err))
+	} else {
+		window = routeWindow
+	}
+
+	if len(messages) == 0 {
+		clearInvalidRenewalWindow(status)
+		return window
+	}
+
+	// Report it only when it changes, the Route is synced over and over.
+	message := strings.Join(messages, "; ")
+	condition := api.FindCondition(status.Conditions, api.ConditionInvalidRenewalWindow)
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != message {
+		rc.recorder.Eventf(route, corev1.EventTypeWarning, "AcmeInvalidRenewalWindow", "%s", message)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionInvalidRenewalWindow,
+		Status:  api.ConditionTrue,
+		Reason:  "Ignored",
+		Message: message,
+	})
+
+	return window
+}
+
+func clearInvalidRenewalWindow(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionInvalidRenewalWindow) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionInvalidRenewalWindow,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
+
+// certificateExpiresAt returns the expiry of the certificate on the Route or nil if there is no valid certificate.
+func certificateExpiresAt(route *routev1.Route) *time.Time {
+	if route.Spec.TLS == nil || len(route.Spec.TLS.Certificate) == 0 {
+		return nil
+	}
+
+	certificate, err := util.CertificateFromPEM([]byte(route.Spec.TLS.Certificate))
+	if err != nil {
+		klog.V(5).Infof("Can't decode certificate from Route %s/%s: %v", route.Namespace, route.Name, err)
+		return nil
+	}
+
+	notAfter := certificate.NotAfter.UTC()
+	return &notAfter
+}
+
+func isPaused(route *routev1.Route) bool {
+	return route.Annotations[api.AcmePausedAnnotation] == "true"
+}
+
+// syncPaused only reports the certificate expiry for a paused Route and warns if it needs a new certificate.
+func (rc *RouteController) syncPaused(routeReadOnly *routev1.Route, key string) error {
+	status, err := rc.getStatus(routeReadOnly)
+	if err != nil {
+		return fmt.Errorf("can't get status: %v", err)
+	}
+
+	routeWithCertificate, err := rc.routeWithCertificate(routeReadOnly)
+	if err != nil {
+		return err
+	}
+	status.CertificateExpiresAt = certificateExpiresAt(routeWithCertificate)
+
+	expiry := "there is no valid certificate"
+	if status.CertificateExpiresAt != nil {
+		expiry = fmt.Sprintf("certificate expires at %s", status.CertificateExpiresAt.Format(time.RFC3339))
+	}
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionPaused,
+		Status:  api.ConditionTrue,
+		Reason:  "PausedByAnnotation",
+		Message: fmt.Sprintf("Syncing is paused by annotation %s, %s", api.AcmePausedAnnotation, expiry),
+	})
+
+	reason, err := needsCertKey(time.Now(), routeWithCertificate, rc.renewalWindowForRoute(routeReadOnly, status))
+	if err != nil {
+		return err
+	}
+
+	if len(reason) != 0 {
+		klog.V(2).Infof("Route %q needs new certificate (%s) but syncing is paused", key, reason)
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeSyncPaused", "Route needs new certificate (%s) but syncing is paused by annotation %s: %s", reason, api.AcmePausedAnnotation, expiry)
+	} else {
+		klog.V(4).Infof("Skipping Route %q because syncing is paused", key)
+	}
+
+	rc.acmePollRateLimiter.Forget(key)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+// certOrderBackoff returns the exponential backoff with jitter for retrying a failed order.
+func certOrderBackoff(failures int, initial, max time.Duration, jitter float64) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	backoff := initial
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	backoff = wait.Jitter(backoff, jitter)
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
+// recordOrderFailure increments the failures and schedules the next attempt.
+func (rc *RouteController) recordOrderFailure(key string, status *api.Status) {
+	status.ProvisioningStatus.Failures += 1
+
+	settings := rc.getSettings()
+	backoff := certOrderBackoff(status.ProvisioningStatus.Failures, settings.CertOrderBackoffInitial, settings.CertOrderBackoffMax, CertOrderBackoffJitter)
+	status.ProvisioningStatus.EarliestAttemptAt = time.Now().Add(backoff)
+
+	klog.V(2).Infof("Order for Route %q failed %d time(s), next attempt in %v", key, status.ProvisioningStatus.Failures, backoff)
+	rc.queue.AddAfter(key, backoff)
+}
+
+// deferRateLimited postpones the Route because of the CA rate limits and reports it in the status.
+func (rc *RouteController) deferRateLimited(routeReadOnly *routev1.Route, key string, status *api.Status, delay time.Duration, reason, message string) error {
+	status.ProvisioningStatus.EarliestAttemptAt = time.Now().Add(delay)
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionRateLimited,
+		Status:  api.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+
+	klog.V(2).Infof("Route %q is rate limited, next attempt in %v: %s", key, delay, message)
+	rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeRateLimited", "%s. Next attempt at %s.", message, status.ProvisioningStatus.EarliestAttemptAt.UTC().Format(time.RFC3339))
+	rc.queue.AddAfter(key, delay)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+func clearRateLimited(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionRateLimited) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionRateLimited,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
+
+// acmeClientForObject returns ACME client for the issuer of the object authenticated with the account key.
+func (rc *RouteController) acmeClientForObject(obj metav1.ObjectMeta) (*acme.Client, *api.AcmeCertIssuer, error) {
+	certIssuer, certIssuerSecret, err := controllerutils.IssuerForObject(obj, rc.controllerNamespace, rc.kubeInformersForNamespaces)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't get cert issuer: %w", err)
+	}
+	switch certIssuer.Type {
+	case api.CertIssuerTypeAcme:
+		break
+	default:
+		return nil, nil, fmt.Errorf("unsupported cert issuer type %q", certIssuer.Type)
+	}
+
+	acmeIssuer := certIssuer.AcmeCertIssuer
+	if acmeIssuer == nil {
+		return nil, nil, fmt.Errorf("ACME issuer is missing AcmeCertIssuer spec")
+	}
+
+	acmeClient := &acme.Client{
+		DirectoryURL: acmeIssuer.DirectoryURL,
+		UserAgent:    "github.com/tnozicka/openshift-acme",
+		RetryBackoff: ratelimit.AcmeRetryBackoff,
+	}
+	klog.V(4).Infof("Using ACME client with DirectoryURL %q", acmeClient.DirectoryURL)
+
+	acmeClient.Key, err = helpers.PrivateKeyFromSecret(certIssuerSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return acmeClient, acmeIssuer, nil
 }
 
 func (rc *RouteController) getStatus(routeReadOnly *routev1.Route) (*api.Status, error) {
@@ -468,9 +946,15 @@ func (rc *RouteController) updateStatus(routeReadOnly *routev1.Route, status *ap
 			}
 		}
 
+		// The synced Secret name is owned by the secret sync worker.
+		oldStatus, err := rc.getStatus(oldRouteReadOnly)
+		if err == nil {
+			status.SyncedSecretName = oldStatus.SyncedSecretName
+		}
+
 		newRoute := oldRouteReadOnly.DeepCopy()
 
-		err := setStatus(&newRoute.ObjectMeta, status)
+		err = setStatus(&newRoute.ObjectMeta, status)
 		if err != nil {
 			return fmt.Errorf("can't set status: %w", err)
 		}
@@ -504,7 +988,20 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		return err
 	}
 
-	objReadOnly, exists, err := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace).Route().V1().Routes().Informer().GetIndexer().GetByKey(key)
+	if !rc.shards.Owns(key) {
+		klog.V(4).Infof("Route %s belongs to a shard owned by another replica", key)
+		rc.acmePollRateLimiter.Forget(key)
+		return nil
+	}
+
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		klog.V(4).Infof("Route %s is in a namespace that isn't watched anymore", key)
+		rc.acmePollRateLimiter.Forget(key)
+		return nil
+	}
+
+	objReadOnly, exists, err := informers.Route().V1().Routes().Informer().GetIndexer().GetByKey(key)
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
 		return err
@@ -512,11 +1009,23 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 
 	if !exists {
 		klog.V(4).Infof("Route %s does not exist anymore\n", key)
+		rc.acmePollRateLimiter.Forget(key)
 		return nil
 	}
 
 	routeReadOnly := objReadOnly.(*routev1.Route)
 
+	// Revoke the certificate if requested before the Route goes away. Routes we stop managing keep serving
+	// the certificate so we revoke it for them only if the policy asks for it.
+	if hasFinalizer(routeReadOnly, api.AcmeRevocationFinalizer) {
+		if routeReadOnly.DeletionTimestamp != nil {
+			return rc.finalizeRevocation(routeReadOnly, key)
+		}
+		if !util.IsManaged(routeReadOnly, rc.annotation) {
+			return rc.releaseRevocation(routeReadOnly, key)
+		}
+	}
+
 	// Don't act on objects that are being deleted.
 	if routeReadOnly.DeletionTimestamp != nil {
 		return nil
@@ -534,29 +1043,55 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		return nil
 	}
 
-	status, err := rc.getStatus(routeReadOnly)
-	if err != nil {
-		return fmt.Errorf("can't get status: %v", err)
+	if isPaused(routeReadOnly) {
+		return rc.syncPaused(routeReadOnly, key)
 	}
 
-	// TODO: Update status values e.g. for cert validity, next planned update range
-	backoff := time.Duration(0)
-	for i := 0; i < status.ProvisioningStatus.Failures; i++ {
-		backoff *= rc.certOrderBackoffInitial
-		if backoff >= rc.certOrderBackoffMax {
-			backoff = rc.certOrderBackoffMax
-			break
-		}
-	}
-	status.ProvisioningStatus.EarliestAttemptAt = status.ProvisioningStatus.StartedAt.Add(backoff)
+	updated, err := rc.syncRevocationFinalizer(routeReadOnly)
+	if err != nil {
+		return err
+	}
+	if updated {
+		// The update will requeue the Route.
+		return nil
+	}
 
-	reason, err := needsCertKey(time.Now(), routeReadOnly)
+	status, err := rc.getStatus(routeReadOnly)
+	if err != nil {
+		return fmt.Errorf("can't get status: %v", err)
+	}
+
+	routeWithCertificate, err := rc.routeWithCertificate(routeReadOnly)
 	if err != nil {
 		return err
 	}
 
+	// TODO: Update status values e.g. for next planned update range
+	status.CertificateExpiresAt = certificateExpiresAt(routeWithCertificate)
+	api.RemoveCondition(&status.Conditions, api.ConditionPaused)
+
+	resetFailures := routeReadOnly.Annotations[api.AcmeResetFailuresAnnotation]
+	if len(resetFailures) != 0 && resetFailures != status.ProvisioningStatus.ObservedResetFailures {
+		klog.V(2).Infof("Resetting %d failure(s) for Route %q as requested by annotation %s=%q", status.ProvisioningStatus.Failures, key, api.AcmeResetFailuresAnnotation, resetFailures)
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeNormal, "AcmeFailuresReset", "Reset %d failed order(s) as requested by annotation %s", status.ProvisioningStatus.Failures, api.AcmeResetFailuresAnnotation)
+		status.ProvisioningStatus.Failures = 0
+		status.ProvisioningStatus.EarliestAttemptAt = time.Time{}
+		status.ProvisioningStatus.ObservedResetFailures = resetFailures
+	}
+
+	reason, err := needsCertKey(time.Now(), routeWithCertificate, rc.renewalWindowForRoute(routeReadOnly, status))
+	if err != nil {
+		return err
+	}
+
+	renewRequestedAt := routeReadOnly.Annotations[api.AcmeRenewRequestedAtAnnotation]
+	if len(reason) == 0 && len(renewRequestedAt) != 0 && renewRequestedAt != status.ProvisioningStatus.ObservedRenewRequestedAt {
+		reason = fmt.Sprintf("Renewal requested at %s", renewRequestedAt)
+	}
+
 	if len(reason) == 0 {
 		klog.V(4).Infof("Route %q doesn't need new certificate.", key)
+		rc.acmePollRateLimiter.Forget(key)
 		return rc.updateStatus(routeReadOnly, status)
 	}
 
@@ -569,10 +1104,9 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		status.ProvisioningStatus.OrderStatus = ""
 
 	case acme.StatusInvalid, acme.StatusExpired, acme.StatusRevoked, acme.StatusDeactivated:
-		delay := status.ProvisioningStatus.EarliestAttemptAt.Sub(time.Now())
-		klog.Infof("route %s, now: %v, EarliestAttemptAt: %v, delay: %v", key, time.Now(), status.ProvisioningStatus.EarliestAttemptAt, delay)
+		delay := time.Until(status.ProvisioningStatus.EarliestAttemptAt)
 		if delay > 0 {
-			klog.V(2).Infof("Retrying validation for Route %s got rate limited, next attempt in %v", key, delay)
+			klog.V(2).Infof("Retrying validation for Route %s is backed off after %d failure(s), next attempt at %v (in %v)", key, status.ProvisioningStatus.Failures, status.ProvisioningStatus.EarliestAttemptAt, delay)
 			rc.queue.AddAfter(key, delay)
 			return rc.updateStatus(routeReadOnly, status)
 		}
@@ -584,46 +1118,79 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), AcmeTimeout)
 	defer cancel()
 
-	certIssuer, certIssuerSecret, err := controllerutils.IssuerForObject(routeReadOnly.ObjectMeta, rc.controllerNamespace, rc.kubeInformersForNamespaces)
-	if err != nil {
-		return fmt.Errorf("can't get cert issuer: %w", err)
-	}
-	switch certIssuer.Type {
-	case api.CertIssuerTypeAcme:
-		break
-	default:
-		return fmt.Errorf("unsupported cert issuer type %q", certIssuer.Type)
-	}
-
-	acmeIssuer := certIssuer.AcmeCertIssuer
-	if acmeIssuer == nil {
-		return fmt.Errorf("ACME issuer is missing AcmeCertIssuer spec")
-	}
-
-	acmeClient := &acme.Client{
-		DirectoryURL: acmeIssuer.DirectoryURL,
-		UserAgent:    "github.com/tnozicka/openshift-acme",
-	}
-	klog.V(4).Infof("Using ACME client with DirectoryURL %q", acmeClient.DirectoryURL)
-
-	acmeClient.Key, err = helpers.PrivateKeyFromSecret(certIssuerSecret)
+	acmeClient, acmeIssuer, err := rc.acmeClientForObject(routeReadOnly.ObjectMeta)
 	if err != nil {
 		return err
 	}
 
 	domain := routeReadOnly.Spec.Host
+	domains := []string{domain}
+	accountURI := acmeIssuer.Account.Status.URI
 
 	if len(status.ProvisioningStatus.OrderURI) == 0 {
+		// Don't spend the CA quota on hostnames the admin hasn't allowed.
+		err = rc.checkHostnamePolicy(routeReadOnly)
+		if err != nil {
+			var denied *PolicyDeniedError
+			if errors.As(err, &denied) {
+				return rc.denyByPolicy(routeReadOnly, key, status, denied)
+			}
+			return err
+		}
+		clearDenied(status)
+
+		// Respect the rate limits persisted in the status, in case we have restarted.
+		delay := time.Until(status.ProvisioningStatus.EarliestAttemptAt)
+		if api.IsConditionTrue(status.Conditions, api.ConditionRateLimited) && delay > 0 {
+			klog.V(2).Infof("Creating order for Route %q is rate limited, next attempt in %v", key, delay)
+			rc.queue.AddAfter(key, delay)
+			return rc.updateStatus(routeReadOnly, status)
+		}
+
+		// The CA would refuse the order and count it as a failed validation.
+		err = rc.checkCAA(ctx, acmeIssuer, domains)
+		if err != nil {
+			var forbidden *caa.ForbiddenError
+			if errors.As(err, &forbidden) {
+				return rc.blockByCAA(routeReadOnly, key, status, forbidden)
+			}
+			return rc.deferCAALookup(routeReadOnly, key, status, err)
+		}
+		clearCAAForbidden(status)
+
+		// Don't issue a certificate for a passthrough Route we couldn't store.
+		err = rc.checkCertificateSecret(routeReadOnly)
+		if err != nil {
+			var collision *SecretCollisionError
+			if errors.As(err, &collision) {
+				return rc.blockBySecretCollision(routeReadOnly, key, status, collision)
+			}
+			return err
+		}
+		clearSecretCollision(status)
+
+		delay, limits := rc.orderScheduler.ReserveOrder(acmeIssuer.DirectoryURL, accountURI, domains)
+		if delay > 0 {
+			return rc.deferRateLimited(routeReadOnly, key, status, delay, "OrderDeferred", fmt.Sprintf("Creating new order would exceed CA rate limits: %s", limits))
+		}
+
 		order, err := acmeClient.AuthorizeOrder(ctx, acme.DomainIDs(domain))
 		if err != nil {
+			if retryAfter, ok := ratelimit.IsRateLimited(err); ok {
+				until := rc.orderScheduler.RecordRateLimited(acmeIssuer.DirectoryURL, accountURI, domains, retryAfter)
+				return rc.deferRateLimited(routeReadOnly, key, status, time.Until(until), "CARateLimited", fmt.Sprintf("CA rejected new order: %v", err))
+			}
 			return err
 		}
+		clearRateLimited(status)
 		// TODO: convert into event
 		klog.V(1).Infof("Created Order %q for Route %q", order.URI, key)
 
 		// We need to store the order URI immediately to prevent loosing it on error.
 		// Updating the route will make it requeue.
 		status.ProvisioningStatus.StartedAt = time.Now()
+		status.ProvisioningStatus.OrderError = nil
+		clearExposerRejected(status)
 		status.ProvisioningStatus.OrderURI = order.URI
 		status.ProvisioningStatus.OrderStatus = order.Status
 		return rc.updateStatus(routeReadOnly, status)
@@ -654,6 +1221,8 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		// Satisfy all pending authorizations.
 		klog.V(4).Infof("Route %q: Order %q contains %d authorization(s)", key, order.URI, len(order.AuthzURLs))
 
+		// We requeue at most once per sync, independently of the number of authorizations.
+		needsAcmePoll := false
 		for _, authzURL := range order.AuthzURLs {
 			authz, err := acmeClient.GetAuthorization(ctx, authzURL)
 			if err != nil {
@@ -707,337 +1276,53 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 					return err
 				}
 
-				/*
-				 * Route
-				 */
-				trueVal := true
-				desiredExposerRoute := routeReadOnly.DeepCopy()
-				filterOutAnnotations(desiredExposerRoute.Annotations)
-				filterOutLabels(desiredExposerRoute.Labels, desiredExposerRoute.Annotations)
-
-				desiredExposerRoute.Name = tmpName
-				desiredExposerRoute.ResourceVersion = ""
-				desiredExposerRoute.OwnerReferences = []metav1.OwnerReference{
-					{
-						APIVersion: controllerKind.GroupVersion().String(),
-						Kind:       controllerKind.Kind,
-						Name:       routeReadOnly.Name,
-						UID:        routeReadOnly.UID,
-						Controller: &trueVal,
-					},
-				}
-				if desiredExposerRoute.Annotations == nil {
-					desiredExposerRoute.Annotations = map[string]string{}
-				}
-				desiredExposerRoute.Annotations[api.AcmeExposerId] = id
-				desiredExposerRoute.Annotations[api.AcmeExposerKey] = key
-				if desiredExposerRoute.Labels == nil {
-					desiredExposerRoute.Labels = map[string]string{}
+				var exposed bool
+				switch rc.http01SolverMode {
+				case api.Http01SolverModeShared:
+					exposed, err = rc.ensureSharedExposer(ctx, routeReadOnly, key, id, tmpName, challengePath, challengeResponse)
+				default:
+					exposed, err = rc.ensurePerChallengeExposer(routeReadOnly, key, id, tmpName, challengePath, challengeResponse)
 				}
-				desiredExposerRoute.Labels[api.AcmeTemporaryLabel] = "true"
-				desiredExposerRoute.Labels[api.AcmeExposerUID] = string(routeReadOnly.UID)
-				desiredExposerRoute.Spec.Path = acmeClient.HTTP01ChallengePath(challenge.Token)
-				desiredExposerRoute.Spec.Port = nil
-				desiredExposerRoute.Spec.TLS = &routev1.TLSConfig{
-					Termination:                   "edge",
-					InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow,
-				}
-				desiredExposerRoute.Spec.To = routev1.RouteTargetReference{
-					Kind: "Service",
-					Name: tmpName,
-				}
-
-				exposerRoute, err := rc.routeInformersForNamespaces.InformersForOrGlobal(routeReadOnly.Namespace).Route().V1().Routes().Lister().Routes(routeReadOnly.Namespace).Get(desiredExposerRoute.Name)
 				if err != nil {
-					if !kapierrors.IsNotFound(err) {
-						return err
-					}
-
-					klog.V(2).Infof("Exposer route %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerRoute.Name)
-
-					exposerRoute, err = rc.routeClient.RouteV1().Routes(routeReadOnly.Namespace).Create(desiredExposerRoute)
-					if err != nil {
-						return err
+					var rejected *ExposerRejectedError
+					if errors.As(err, &rejected) {
+						return rc.failOrderForRejectedExposer(ctx, acmeClient, routeReadOnly, key, authz, status, rejected)
 					}
-					klog.V(2).Infof("Created exposer Route %s/%s for Route %s", exposerRoute.Namespace, exposerRoute.Name, key)
-				}
-
-				if !metav1.IsControlledBy(exposerRoute, routeReadOnly) {
-					klog.Infof("%#v", exposerRoute)
-					return fmt.Errorf("exposer Route %s/%s already exists and isn't owned by route %s", exposerRoute.Namespace, exposerRoute.Name, key)
-				}
-
-				// Check the id to avoid collisions
-				exposerRouteId, ok := exposerRoute.Annotations[api.AcmeExposerId]
-				if !ok {
-					return fmt.Errorf("exposer route %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
-				} else if exposerRouteId != id {
-					return fmt.Errorf("exposer route %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerRouteId)
-				}
-
-				ownerRefToExposerRoute := metav1.OwnerReference{
-					APIVersion: controllerKind.GroupVersion().String(),
-					Kind:       controllerKind.Kind,
-					Name:       exposerRoute.Name,
-					UID:        exposerRoute.UID,
-					Controller: &trueVal,
-				}
-
-				/*
-				 * Secret
-				 */
-				desiredExposerSecret := &corev1.Secret{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:            tmpName,
-						OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
-						Annotations: map[string]string{
-							api.AcmeExposerId:  id,
-							api.AcmeExposerKey: key,
-						},
-						Labels: map[string]string{
-							api.AcmeTemporaryLabel: "true",
-							api.AcmeExposerUID:     string(routeReadOnly.UID),
-						},
-					},
-					StringData: map[string]string{
-						ExposerFileKey: challengePath + " " + challengeResponse,
-					},
-				}
-				exposerSecret, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(routeReadOnly.Namespace).Core().V1().Secrets().Lister().Secrets(routeReadOnly.Namespace).Get(desiredExposerSecret.Name)
-				if err != nil {
-					if !kapierrors.IsNotFound(err) {
-						return err
-					}
-
-					klog.V(2).Infof("Exposer secret %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerSecret.Name)
-
-					exposerSecret, err = rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Create(desiredExposerSecret)
-					if err != nil {
-						return err
-					}
-				}
-
-				if !metav1.IsControlledBy(exposerSecret, exposerRoute) {
-					return fmt.Errorf("secret %s/%s already exists and isn't owned by expúoser route %s/%s", exposerSecret.Namespace, exposerSecret.Name, exposerRoute.Namespace, exposerRoute.Name)
-				}
-
-				// Check the id to avoid collisions
-				exposerSecretId, ok := exposerSecret.Annotations[api.AcmeExposerId]
-				if !ok {
-					return fmt.Errorf("exposer secret %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
-				} else if exposerSecretId != id {
-					return fmt.Errorf("exposer secret %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerSecretId)
-				}
-
-				/*
-				 * ReplicaSet
-				 */
-				var replicas int32 = 2
-				podLabels := map[string]string{
-					"app": tmpName,
-				}
-				podSelector := &metav1.LabelSelector{
-					MatchLabels: podLabels,
-				}
-				desiredExposerRS := &appsv1.ReplicaSet{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:            tmpName,
-						OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
-						Annotations: map[string]string{
-							api.AcmeExposerId:  id,
-							api.AcmeExposerKey: key,
-						},
-						Labels: map[string]string{
-							api.AcmeTemporaryLabel: "true",
-							api.AcmeExposerUID:     string(routeReadOnly.UID),
-						},
-					},
-					Spec: appsv1.ReplicaSetSpec{
-						Replicas: &replicas,
-						Selector: podSelector,
-						Template: corev1.PodTemplateSpec{
-							ObjectMeta: metav1.ObjectMeta{
-								Labels: podLabels,
-							},
-							Spec: corev1.PodSpec{
-								Containers: []corev1.Container{
-									{
-										Name:  "exposer",
-										Image: rc.exposerImage,
-										Command: []string{
-											"openshift-acme-exposer",
-										},
-										Args: []string{
-											"--response-file=/etc/openshift-acme-exposer/" + ExposerFileKey,
-										},
-										Ports: []corev1.ContainerPort{
-											{
-												Name:          "http",
-												Protocol:      corev1.ProtocolTCP,
-												ContainerPort: 5000,
-											},
-										},
-										VolumeMounts: []corev1.VolumeMount{
-											{
-												Name:      "exposer-data",
-												ReadOnly:  true,
-												MountPath: "/etc/openshift-acme-exposer",
-											},
-										},
-										Resources: corev1.ResourceRequirements{
-											Requests: corev1.ResourceList{
-												corev1.ResourceCPU:    *resource.NewMilliQuantity(5, resource.DecimalSI),
-												corev1.ResourceMemory: *resource.NewQuantity(50*(1024*1024), resource.BinarySI),
-											},
-											Limits: corev1.ResourceList{
-												corev1.ResourceCPU:    *resource.NewMilliQuantity(100, resource.DecimalSI),
-												corev1.ResourceMemory: *resource.NewQuantity(50*(1024*1024), resource.BinarySI),
-											},
-										},
-									},
-								},
-								Volumes: []corev1.Volume{
-									{
-										Name: "exposer-data",
-										VolumeSource: corev1.VolumeSource{
-											Secret: &corev1.SecretVolumeSource{
-												SecretName: exposerSecret.Name,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				}
-
-				limitRanges, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(routeReadOnly.Namespace).Core().V1().LimitRanges().Lister().LimitRanges(routeReadOnly.Namespace).List(labels.Everything())
-				if err != nil {
 					return err
 				}
-
-				err = adjustContainerResourceRequirements(&desiredExposerRS.Spec.Template.Spec.Containers[0].Resources, limitRanges)
-				if err != nil {
-					rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "ExposerPodResourceRequirementsError", err.Error())
-					return nil
-				}
-
-				exposerRS, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(routeReadOnly.Namespace).Apps().V1().ReplicaSets().Lister().ReplicaSets(routeReadOnly.Namespace).Get(desiredExposerRS.Name)
-				if err != nil {
-					if !kapierrors.IsNotFound(err) {
-						return err
-					}
-
-					klog.V(2).Infof("Exposer replica set %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerRS.Name)
-
-					exposerRS, err = rc.kubeClient.AppsV1().ReplicaSets(routeReadOnly.Namespace).Create(desiredExposerRS)
-					if err != nil {
-						return err
-					}
-				}
-
-				if !metav1.IsControlledBy(exposerRS, exposerRoute) {
-					return fmt.Errorf("RS %s/%s already exists and isn't owned by exposer route %s/%s", exposerRS.Namespace, exposerRS.Name, exposerRoute.Namespace, exposerRoute.Name)
-				}
-
-				// Check the id to avoid collisions
-				exposerRSId, ok := exposerRS.Annotations[api.AcmeExposerId]
-				if !ok {
-					return fmt.Errorf("exposer RS %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
-				} else if exposerRSId != id {
-					return fmt.Errorf("exposer RS %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerRSId)
+				if !exposed {
+					break
 				}
 
-				/*
-				 * Service
-				 */
-				desiredExposerService := &corev1.Service{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:            tmpName,
-						OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
-						Annotations: map[string]string{
-							api.AcmeExposerId:  id,
-							api.AcmeExposerKey: key,
-						},
-						Labels: map[string]string{
-							api.AcmeTemporaryLabel: "true",
-							api.AcmeExposerUID:     string(routeReadOnly.UID),
-						},
-					},
-					Spec: corev1.ServiceSpec{
-						Selector: podLabels,
-						Type:     corev1.ServiceTypeClusterIP,
-						Ports: []corev1.ServicePort{
-							{
-								Name:       "http",
-								Protocol:   corev1.ProtocolTCP,
-								Port:       80,
-								TargetPort: intstr.IntOrString{Type: intstr.Int, IntVal: 5000},
-							},
-						},
-					},
+				selfCheck := acmeIssuer.SelfCheck
+				if selfCheck == nil {
+					selfCheck = rc.getSettings().SelfCheck
 				}
-				exposerService, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(routeReadOnly.Namespace).Core().V1().Services().Lister().Services(routeReadOnly.Namespace).Get(desiredExposerService.Name)
+				err = selfCheckToken(ctx, selfCheck, domain, challengePath, challengeResponse)
 				if err != nil {
-					if !kapierrors.IsNotFound(err) {
-						return err
-					}
-
-					klog.V(2).Infof("Exposer service %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerService.Name)
-
-					exposerService, err = rc.kubeClient.CoreV1().Services(routeReadOnly.Namespace).Create(desiredExposerService)
-					if err != nil {
+					var failed *SelfCheckFailedError
+					if !errors.As(err, &failed) {
 						return err
 					}
-				}
-
-				if !metav1.IsControlledBy(exposerService, exposerRoute) {
-					return fmt.Errorf("service %s/%s already exists and isn't owned by exposer route %s/%s", exposerService.Namespace, exposerService.Name, exposerRoute.Namespace, exposerRoute.Name)
-				}
-
-				// Check the id to avoid collisions
-				exposerServiceId, ok := exposerService.Annotations[api.AcmeExposerId]
-				if !ok {
-					return fmt.Errorf("exposer service %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
-				} else if exposerServiceId != id {
-					return fmt.Errorf("exposer service %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerServiceId)
-				}
-
-				// TODO: id admitted=false we should stop trying and report event
-				if !routeutil.IsAdmitted(exposerRoute) {
-					klog.V(4).Infof("exposer Route %s/%s isn't admitted yet", exposerRoute.Namespace, exposerRoute.Name)
-					rc.queue.AddAfter(key, 15*time.Second) // FIXME: set up event handlers
-					break
-				}
-
-				// TODO: wait for pods to run and report into status, requeue
-				// For now, the server is bound to retry the verification by RFC8555
-				// so on happy path there shouldn't be issues. But pods can get stuck
-				// on scheduling, quota, resources, ... and we want to know why the validation fails.
-				if exposerRS.Status.ObservedGeneration != exposerRS.Generation ||
-					exposerRS.Status.AvailableReplicas != exposerRS.Status.Replicas {
-					klog.V(4).Infof("exposer ReplicaSet %s/%s isn't available yet", exposerRS.Namespace, exposerRS.Name)
-					rc.queue.AddAfter(key, 15*time.Second) // FIXME: set up event handlers
-					break
-				}
-
-				url := "http://" + domain + challengePath
-				err = controllerutils.ValidateExposedToken(url, challengeResponse)
-				if err != nil {
-					klog.Infof("Can't self validate exposed token before accepting the challenge: %v", err)
+					rc.reportSelfCheckFailed(routeReadOnly, status, failed)
 					// We are waiting for external event, make sure we requeue
-					rc.queue.AddAfter(key, 15*time.Second)
+					needsAcmePoll = true
 					break
 				}
+				clearSelfCheckFailed(status)
 
 				_, err = acmeClient.Accept(ctx, challenge)
 				if err != nil {
+					if retryAfter, ok := ratelimit.IsRateLimited(err); ok {
+						until := rc.orderScheduler.RecordRateLimited(acmeIssuer.DirectoryURL, accountURI, domains, retryAfter)
+						return rc.deferRateLimited(routeReadOnly, key, status, time.Until(until), "CARateLimited", fmt.Sprintf("CA rejected accepting the challenge: %v", err))
+					}
 					return err
 				}
 				klog.V(2).Infof("Accepted challenge for Route %s.", key)
 
 				// We are waiting for external event, make sure we requeue
-				rc.queue.AddAfter(key, 15*time.Second)
+				needsAcmePoll = true
 
 			case acme.StatusProcessing, acme.StatusValid, acme.StatusInvalid:
 				// These states will manifest into global order state over time.
@@ -1045,18 +1330,21 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 				// We could possibly report events for those but is seems too fine grained for now.
 
 				// We are waiting for external event, make sure we requeue
-				rc.queue.AddAfter(key, 15*time.Second)
+				needsAcmePoll = true
 
 			default:
 				return fmt.Errorf("route %q: order %q: authz %q: invalid status %q for challenge %q", key, order.URI, authz.URI, challenge.Status, challenge.URI)
 			}
 		}
 
+		if needsAcmePoll {
+			rc.pollAcme(key)
+		}
+
 		return rc.updateStatus(routeReadOnly, status)
 
 	case acme.StatusProcessing:
-		// TODO: backoff but capped at some reasonable time
-		rc.queue.AddAfter(key, 15*time.Second)
+		rc.pollAcme(key)
 
 		klog.V(4).Infof("Route %q: Order %q: Waiting to be validated by ACME server", key, order)
 
@@ -1071,7 +1359,7 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		template := x509.CertificateRequest{
 			DNSNames: []string{routeReadOnly.Spec.Host},
 		}
-		privateKey, err := rsa.GenerateKey(cryptorand.Reader, rc.certDefaultRSAKeyBitSize)
+		privateKey, err := rsa.GenerateKey(cryptorand.Reader, rc.getSettings().CertDefaultRSAKeyBitSize)
 		if err != nil {
 			return fmt.Errorf("failed to generate RSA key: %v", err)
 		}
@@ -1086,8 +1374,14 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		//  although that should be asynchronous. Requires fixing golang lib. (The helpers used are private.)
 		der, certUrl, err := acmeClient.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
 		if err != nil {
+			if retryAfter, ok := ratelimit.IsRateLimited(err); ok {
+				until := rc.orderScheduler.RecordRateLimited(acmeIssuer.DirectoryURL, accountURI, domains, retryAfter)
+				return rc.deferRateLimited(routeReadOnly, key, status, time.Until(until), "CARateLimited", fmt.Sprintf("CA rejected finalizing the order: %v", err))
+			}
 			return fmt.Errorf("can't create cert order: %w", err)
 		}
+		rc.orderScheduler.RecordCertificate(acmeIssuer.DirectoryURL, accountURI, domains)
+		clearRateLimited(status)
 
 		klog.V(4).Infof("Route %q: Order %q: Certificate available at %q", key, order.URI, certUrl)
 
@@ -1096,12 +1390,30 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 			return fmt.Errorf("can't convert certificate from DER to PEM: %v", err)
 		}
 
+		certificate, err := certPemData.Certificate()
+		if err != nil {
+			return fmt.Errorf("can't parse issued certificate: %w", err)
+		}
+		status.CertificateMeta = &api.CertificateMeta{
+			NotBefore: certificate.NotBefore,
+			NotAfter:  certificate.NotAfter,
+			Domains:   certificate.DNSNames,
+		}
+
 		route := routeReadOnly.DeepCopy()
 
 		// unfortunatly golang acmeClient.CreateOrderCert waits internally for transitioning state
 		// to valid and we need to reflect it in our state machine because we don't get back
 		// into the provisioning phase again after the certs are updated and valid.
 		status.ProvisioningStatus.OrderStatus = acme.StatusValid
+		status.ProvisioningStatus.ObservedRenewRequestedAt = routeReadOnly.Annotations[api.AcmeRenewRequestedAtAnnotation]
+		status.ProvisioningStatus.Failures = 0
+		status.ProvisioningStatus.EarliestAttemptAt = time.Time{}
+
+		err = rc.setCertificate(route, status, certPemData)
+		if err != nil {
+			return err
+		}
 
 		// We are updating the route and to avoid conflicts later we will also update the status together
 		err = setStatus(&route.ObjectMeta, status)
@@ -1109,16 +1421,6 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 			return fmt.Errorf("can't set status: %w", err)
 		}
 
-		if route.Spec.TLS == nil {
-			route.Spec.TLS = &routev1.TLSConfig{
-				// Defaults
-				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
-				Termination:                   routev1.TLSTerminationEdge,
-			}
-		}
-		route.Spec.TLS.Key = string(certPemData.Key)
-		route.Spec.TLS.Certificate = string(certPemData.Crt)
-
 		// TODO: consider RetryOnConflict with rechecking the managed annotation
 		_, err = rc.routeClient.RouteV1().Routes(routeReadOnly.Namespace).Update(route)
 		if err != nil {
@@ -1130,6 +1432,8 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 			klog.Errorf("Can't cleanup exposer objects: %v", err)
 		}
 
+		rc.acmePollRateLimiter.Forget(key)
+
 		// We have already updated the status when updating the Route.
 		return nil
 
@@ -1138,14 +1442,30 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 		// Unfortunately the golang acme lib actively waits in 'CreateOrderCert'
 		// so we can't take the appropriate asynchronous action here.
 		// The logic is included in handling acme.StatusReady
+		rc.acmePollRateLimiter.Forget(key)
 		return nil
 
 	case acme.StatusInvalid:
 		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeFailedOrder", "Order %q for domain %q failed: %v", order.URI, routeReadOnly.Spec.Host, order.Error)
 
 		if status.ProvisioningStatus.OrderStatus != previousOrderStatus {
-			status.ProvisioningStatus.Failures += 1
+			if api.IsConditionTrue(status.Conditions, api.ConditionExposerRejected) {
+				rc.deferRejectedExposer(key, status)
+			} else {
+				rc.recordOrderFailure(key, status)
+				rc.orderScheduler.RecordFailedValidation(acmeIssuer.DirectoryURL, accountURI, domain)
+			}
+
+			// Keep our own reason if we have failed the order.
+			if status.ProvisioningStatus.OrderError == nil && order.Error != nil {
+				status.ProvisioningStatus.OrderError = &api.OrderError{
+					StatusCode:  order.Error.StatusCode,
+					ProblemType: order.Error.ProblemType,
+					Detail:      order.Error.Detail,
+				}
+			}
 		}
+		rc.acmePollRateLimiter.Forget(key)
 		err = rc.CleanupExposerObjects(routeReadOnly)
 		if err != nil {
 			klog.Errorf("Can't cleanup exposer objects: %v", err)
@@ -1154,8 +1474,9 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 
 	case acme.StatusExpired, acme.StatusRevoked, acme.StatusDeactivated:
 		if status.ProvisioningStatus.OrderStatus != previousOrderStatus {
-			status.ProvisioningStatus.Failures += 1
+			rc.recordOrderFailure(key, status)
 		}
+		rc.acmePollRateLimiter.Forget(key)
 		err = rc.CleanupExposerObjects(routeReadOnly)
 		if err != nil {
 			klog.Errorf("Can't cleanup exposer objects: %v", err)
@@ -1167,6 +1488,290 @@ func (rc *RouteController) sync(ctx context.Context, key string) error {
 	}
 }
 
+// ensurePerChallengeExposer makes sure there is a temporary Route, Secret, ReplicaSet and Service
+// in the Route's namespace exposing the challenge response. It returns true when the token is exposed.
+func (rc *RouteController) ensurePerChallengeExposer(routeReadOnly *routev1.Route, key, id, tmpName, challengePath, challengeResponse string) (bool, error) {
+	routeInformers, err := rc.routeInformersFor(routeReadOnly.Namespace)
+	if err != nil {
+		return false, err
+	}
+	kubeInformers, err := rc.kubeInformersFor(routeReadOnly.Namespace)
+	if err != nil {
+		return false, err
+	}
+
+	/*
+	 * Route
+	 */
+	trueVal := true
+	desiredExposerRoute := routeReadOnly.DeepCopy()
+	filterOutAnnotations(desiredExposerRoute.Annotations)
+	filterOutLabels(desiredExposerRoute.Labels, desiredExposerRoute.Annotations)
+
+	desiredExposerRoute.Name = tmpName
+	desiredExposerRoute.ResourceVersion = ""
+	desiredExposerRoute.OwnerReferences = []metav1.OwnerReference{
+		{
+			APIVersion: controllerKind.GroupVersion().String(),
+			Kind:       controllerKind.Kind,
+			Name:       routeReadOnly.Name,
+			UID:        routeReadOnly.UID,
+			Controller: &trueVal,
+		},
+	}
+	if desiredExposerRoute.Annotations == nil {
+		desiredExposerRoute.Annotations = map[string]string{}
+	}
+	desiredExposerRoute.Annotations[api.AcmeExposerId] = id
+	desiredExposerRoute.Annotations[api.AcmeExposerKey] = key
+	if desiredExposerRoute.Labels == nil {
+		desiredExposerRoute.Labels = map[string]string{}
+	}
+	desiredExposerRoute.Labels[api.AcmeTemporaryLabel] = "true"
+	desiredExposerRoute.Labels[api.AcmeExposerUID] = string(routeReadOnly.UID)
+	desiredExposerRoute.Spec.Path = challengePath
+	desiredExposerRoute.Spec.Port = nil
+	desiredExposerRoute.Spec.TLS = &routev1.TLSConfig{
+		Termination:                   "edge",
+		InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow,
+	}
+	desiredExposerRoute.Spec.To = routev1.RouteTargetReference{
+		Kind: "Service",
+		Name: tmpName,
+	}
+
+	exposerRoute, err := routeInformers.Route().V1().Routes().Lister().Routes(routeReadOnly.Namespace).Get(desiredExposerRoute.Name)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return false, err
+		}
+
+		klog.V(2).Infof("Exposer route %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerRoute.Name)
+
+		exposerRoute, err = rc.routeClient.RouteV1().Routes(routeReadOnly.Namespace).Create(desiredExposerRoute)
+		if err != nil {
+			return false, err
+		}
+		klog.V(2).Infof("Created exposer Route %s/%s for Route %s", exposerRoute.Namespace, exposerRoute.Name, key)
+	}
+
+	if !metav1.IsControlledBy(exposerRoute, routeReadOnly) {
+		klog.Infof("%#v", exposerRoute)
+		return false, fmt.Errorf("exposer Route %s/%s already exists and isn't owned by route %s", exposerRoute.Namespace, exposerRoute.Name, key)
+	}
+
+	// Check the id to avoid collisions
+	exposerRouteId, ok := exposerRoute.Annotations[api.AcmeExposerId]
+	if !ok {
+		return false, fmt.Errorf("exposer route %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
+	} else if exposerRouteId != id {
+		return false, fmt.Errorf("exposer route %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerRouteId)
+	}
+
+	ownerRefToExposerRoute := metav1.OwnerReference{
+		APIVersion: controllerKind.GroupVersion().String(),
+		Kind:       controllerKind.Kind,
+		Name:       exposerRoute.Name,
+		UID:        exposerRoute.UID,
+		Controller: &trueVal,
+	}
+
+	/*
+	 * Secret
+	 */
+	desiredExposerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            tmpName,
+			OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
+			Annotations: map[string]string{
+				api.AcmeExposerId:  id,
+				api.AcmeExposerKey: key,
+			},
+			Labels: map[string]string{
+				api.AcmeTemporaryLabel: "true",
+				api.AcmeExposerUID:     string(routeReadOnly.UID),
+			},
+		},
+		StringData: map[string]string{
+			ExposerFileKey: challengePath + " " + challengeResponse,
+		},
+	}
+	exposerSecret, err := kubeInformers.Core().V1().Secrets().Lister().Secrets(routeReadOnly.Namespace).Get(desiredExposerSecret.Name)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return false, err
+		}
+
+		klog.V(2).Infof("Exposer secret %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerSecret.Name)
+
+		exposerSecret, err = rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Create(desiredExposerSecret)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !metav1.IsControlledBy(exposerSecret, exposerRoute) {
+		return false, fmt.Errorf("secret %s/%s already exists and isn't owned by expúoser route %s/%s", exposerSecret.Namespace, exposerSecret.Name, exposerRoute.Namespace, exposerRoute.Name)
+	}
+
+	// Check the id to avoid collisions
+	exposerSecretId, ok := exposerSecret.Annotations[api.AcmeExposerId]
+	if !ok {
+		return false, fmt.Errorf("exposer secret %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
+	} else if exposerSecretId != id {
+		return false, fmt.Errorf("exposer secret %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerSecretId)
+	}
+
+	/*
+	 * ReplicaSet
+	 */
+	replicas := rc.exposerReplicas()
+	podLabels := map[string]string{
+		"app": tmpName,
+	}
+	podSelector := &metav1.LabelSelector{
+		MatchLabels: podLabels,
+	}
+	desiredExposerRS := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            tmpName,
+			OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
+			Annotations: map[string]string{
+				api.AcmeExposerId:  id,
+				api.AcmeExposerKey: key,
+			},
+			Labels: map[string]string{
+				api.AcmeTemporaryLabel: "true",
+				api.AcmeExposerUID:     string(routeReadOnly.UID),
+			},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Replicas: &replicas,
+			Selector: podSelector,
+			// Pods need to be mapped back to the Route by the event handlers
+			Template: rc.exposerPodTemplate(podLabels, map[string]string{
+				api.AcmeExposerId:  id,
+				api.AcmeExposerKey: key,
+			}, exposerSecret.Name),
+		},
+	}
+
+	limitRanges, err := kubeInformers.Core().V1().LimitRanges().Lister().LimitRanges(routeReadOnly.Namespace).List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+
+	err = adjustPodResourceRequirements(&desiredExposerRS.Spec.Template.Spec, limitRanges)
+	if err != nil {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "ExposerPodResourceRequirementsError", err.Error())
+		return false, nil
+	}
+
+	exposerRS, err := kubeInformers.Apps().V1().ReplicaSets().Lister().ReplicaSets(routeReadOnly.Namespace).Get(desiredExposerRS.Name)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return false, err
+		}
+
+		klog.V(2).Infof("Exposer replica set %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerRS.Name)
+
+		exposerRS, err = rc.kubeClient.AppsV1().ReplicaSets(routeReadOnly.Namespace).Create(desiredExposerRS)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !metav1.IsControlledBy(exposerRS, exposerRoute) {
+		return false, fmt.Errorf("RS %s/%s already exists and isn't owned by exposer route %s/%s", exposerRS.Namespace, exposerRS.Name, exposerRoute.Namespace, exposerRoute.Name)
+	}
+
+	// Check the id to avoid collisions
+	exposerRSId, ok := exposerRS.Annotations[api.AcmeExposerId]
+	if !ok {
+		return false, fmt.Errorf("exposer RS %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
+	} else if exposerRSId != id {
+		return false, fmt.Errorf("exposer RS %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerRSId)
+	}
+
+	/*
+	 * Service
+	 */
+	desiredExposerService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            tmpName,
+			OwnerReferences: []metav1.OwnerReference{ownerRefToExposerRoute},
+			Annotations: map[string]string{
+				api.AcmeExposerId:  id,
+				api.AcmeExposerKey: key,
+			},
+			Labels: map[string]string{
+				api.AcmeTemporaryLabel: "true",
+				api.AcmeExposerUID:     string(routeReadOnly.UID),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       80,
+					TargetPort: intstr.FromInt(ExposerContainerPort),
+				},
+			},
+		},
+	}
+	exposerService, err := kubeInformers.Core().V1().Services().Lister().Services(routeReadOnly.Namespace).Get(desiredExposerService.Name)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return false, err
+		}
+
+		klog.V(2).Infof("Exposer service %s/%s not found, creating new one.", routeReadOnly.Namespace, desiredExposerService.Name)
+
+		exposerService, err = rc.kubeClient.CoreV1().Services(routeReadOnly.Namespace).Create(desiredExposerService)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !metav1.IsControlledBy(exposerService, exposerRoute) {
+		return false, fmt.Errorf("service %s/%s already exists and isn't owned by exposer route %s/%s", exposerService.Namespace, exposerService.Name, exposerRoute.Namespace, exposerRoute.Name)
+	}
+
+	// Check the id to avoid collisions
+	exposerServiceId, ok := exposerService.Annotations[api.AcmeExposerId]
+	if !ok {
+		return false, fmt.Errorf("exposer service %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
+	} else if exposerServiceId != id {
+		return false, fmt.Errorf("exposer service %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerServiceId)
+	}
+
+	admitted, err := checkExposerAdmission(routeReadOnly, exposerRoute)
+	if err != nil {
+		return false, err
+	}
+	if !admitted {
+		// We'll get requeued by the exposer Route event handlers.
+		klog.V(4).Infof("exposer Route %s/%s isn't admitted yet", exposerRoute.Namespace, exposerRoute.Name)
+		return false, nil
+	}
+
+	// TODO: wait for pods to run and report into status, requeue
+	// For now, the server is bound to retry the verification by RFC8555
+	// so on happy path there shouldn't be issues. But pods can get stuck
+	// on scheduling, quota, resources, ... and we want to know why the validation fails.
+	if exposerRS.Status.ObservedGeneration != exposerRS.Generation ||
+		exposerRS.Status.AvailableReplicas != exposerRS.Status.Replicas {
+		// We'll get requeued by the exposer ReplicaSet and Pod event handlers.
+		klog.V(4).Infof("exposer ReplicaSet %s/%s isn't available yet", exposerRS.Namespace, exposerRS.Name)
+		return false, nil
+	}
+
+	return true, nil
+}
+
 func (rc *RouteController) syncRouteToSecret(ctx context.Context, key string) error {
 	klog.V(4).Infof("Started syncing Route (to Secret) %q", key)
 	defer func() {
@@ -1179,7 +1784,18 @@ func (rc *RouteController) syncRouteToSecret(ctx context.Context, key string) er
 		return err
 	}
 
-	routeObjReadOnly, exists, err := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace).Route().V1().Routes().Informer().GetIndexer().GetByKey(key)
+	if !rc.shards.Owns(key) {
+		klog.V(4).Infof("Route %s belongs to a shard owned by another replica", key)
+		return nil
+	}
+
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		klog.V(4).Infof("Route %s is in a namespace that isn't watched anymore", key)
+		return nil
+	}
+
+	routeObjReadOnly, exists, err := informers.Route().V1().Routes().Informer().GetIndexer().GetByKey(key)
 	if err != nil {
 		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
 		return err
@@ -1190,46 +1806,107 @@ func (rc *RouteController) syncRouteToSecret(ctx context.Context, key string) er
 	}
 	routeReadOnly := routeObjReadOnly.(*routev1.Route)
 
+	// Clean up the Secrets in other namespaces, owner references can't do it for us.
+	if routeReadOnly.DeletionTimestamp != nil || !util.IsManaged(routeReadOnly, rc.annotation) {
+		if hasFinalizer(routeReadOnly, api.AcmeSecretSyncFinalizer) {
+			return rc.finalizeSecretTargets(routeReadOnly)
+		}
+	}
+
 	// Don't act on objects that are being deleted.
 	if routeReadOnly.DeletionTimestamp != nil {
 		return nil
 	}
 
-	if routeReadOnly.Spec.TLS == nil {
+	updated, err := rc.syncSecretTargets(routeReadOnly)
+	if err != nil {
+		return err
+	}
+	if updated {
+		// The update will requeue the Route.
 		return nil
 	}
 
+	status, err := rc.getStatus(routeReadOnly)
+	if err != nil {
+		return fmt.Errorf("can't get status: %w", err)
+	}
+	previousSecretName := status.SyncedSecretName
+
 	secretName, ok := GetSyncSecretName(routeReadOnly)
 	if !ok {
+		if len(previousSecretName) == 0 {
+			return nil
+		}
+
+		// The annotation has been removed, delete the Secret we have synced before.
+		err = rc.deleteSyncedSecret(routeReadOnly, previousSecretName)
+		if err != nil {
+			return err
+		}
+
+		return rc.updateSyncedSecretName(routeReadOnly, "")
+	}
+
+	routeWithCertificate, err := rc.routeWithCertificate(routeReadOnly)
+	if err != nil {
+		return err
+	}
+
+	if routeWithCertificate.Spec.TLS == nil || len(routeWithCertificate.Spec.TLS.Certificate) == 0 {
 		return nil
 	}
 
-	secretObjReadOnly, exists, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(namespace).Core().V1().Secrets().Informer().GetIndexer().GetByKey(key)
+	err = rc.syncSecret(routeWithCertificate, secretName)
 	if err != nil {
-		klog.Errorf("Fetching object with key %s from store failed with %v", key, err)
 		return err
 	}
-	var secretReadOnly *corev1.Secret
-	var secret *corev1.Secret
-	if exists {
-		secretReadOnly = secretObjReadOnly.(*corev1.Secret)
 
-		controllerRef := metav1.GetControllerOf(secretReadOnly)
-		if controllerRef == nil {
-			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "CollidingSecret", "Can't sync certificates for Route %s/%s into Secret %s/%s because it already exists and isn't owned by the Route!", routeReadOnly.Namespace, routeReadOnly.Name, routeReadOnly.Namespace, secretName)
-			return fmt.Errorf("secret %s/%s already exists with no owner", secretReadOnly.Namespace, secretReadOnly.Name)
+	if previousSecretName == secretName {
+		return nil
+	}
+
+	if len(previousSecretName) != 0 {
+		klog.V(2).Infof("Secret name for Route %s/%s changed from %q to %q", routeReadOnly.Namespace, routeReadOnly.Name, previousSecretName, secretName)
+		err = rc.deleteSyncedSecret(routeReadOnly, previousSecretName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rc.updateSyncedSecretName(routeReadOnly, secretName)
+}
+
+// syncSecret creates or updates the Secret in the Route's namespace with the Route certificate.
+func (rc *RouteController) syncSecret(routeReadOnly *routev1.Route, secretName string) error {
+	kubeInformers, err := rc.kubeInformersFor(routeReadOnly.Namespace)
+	if err != nil {
+		return err
+	}
+
+	secretReadOnly, err := kubeInformers.Core().V1().Secrets().Lister().Secrets(routeReadOnly.Namespace).Get(secretName)
+	exists := true
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return fmt.Errorf("can't get Secret %s/%s: %w", routeReadOnly.Namespace, secretName, err)
 		}
-		owningRoute := rc.resolveControllerRef(routeReadOnly.Namespace, controllerRef)
-		if owningRoute == nil {
+		exists = false
+	}
+
+	var secret *corev1.Secret
+	if exists {
+		err = rc.checkSecretOwner(routeReadOnly, secretReadOnly)
+		if err != nil {
 			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "CollidingSecret", "Can't sync certificates for Route %s/%s into Secret %s/%s because it already exists and isn't owned by the Route!", routeReadOnly.Namespace, routeReadOnly.Name, routeReadOnly.Namespace, secretName)
-			return fmt.Errorf("secret %s/%s already exists and isn't owned by us", secretReadOnly.Namespace, secretReadOnly.Name)
+			return err
 		}
 
 		secret = secretReadOnly.DeepCopy()
 	} else {
 		secret = &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
-				Name: secretName,
+				Namespace: routeReadOnly.Namespace,
+				Name:      secretName,
 			},
 		}
 	}
@@ -1247,26 +1924,99 @@ func (rc *RouteController) syncRouteToSecret(ctx context.Context, key string) er
 		},
 	}
 
-	if secret.Data == nil {
-		secret.Data = make(map[string][]byte)
+	err = rc.renderCertificateSecret(secret, routeReadOnly)
+	if err != nil {
+		return err
 	}
-	secret.Data[corev1.TLSCertKey] = []byte(routeReadOnly.Spec.TLS.Certificate)
-	secret.Data[corev1.TLSPrivateKeyKey] = []byte(routeReadOnly.Spec.TLS.Key)
 
 	if !exists {
 		_, err = rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Create(secret)
 		if err != nil {
 			return fmt.Errorf("can't create Secret %s/%s: %v", routeReadOnly.Namespace, secret.Name, err)
 		}
-	} else {
-		if !reflect.DeepEqual(secret, secretReadOnly) {
-			_, err = rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Update(secret)
+	} else if !reflect.DeepEqual(secret, secretReadOnly) {
+		_, err = rc.kubeClient.CoreV1().Secrets(routeReadOnly.Namespace).Update(secret)
+		if err != nil {
+			return fmt.Errorf("failed to update Secret %s/%s with TLS data: %v", routeReadOnly.Namespace, secret.Name, err)
+		}
+	}
+
+	// Workloads are reconciled even if the Secret didn't change so a failed rollout gets retried.
+	return rc.rolloutWorkloads(routeReadOnly, secret)
+}
+
+// deleteSyncedSecret deletes the Secret the certificate was previously synced into
+// unless it has been taken over by someone else in the meantime.
+func (rc *RouteController) deleteSyncedSecret(routeReadOnly *routev1.Route, secretName string) error {
+	kubeInformers, err := rc.kubeInformersFor(routeReadOnly.Namespace)
+	if err != nil {
+		return err
+	}
+
+	secret, err := kubeInformers.Core().V1().Secrets().Lister().Secrets(routeReadOnly.Namespace).Get(secretName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("can't get Secret %s/%s: %w", routeReadOnly.Namespace, secretName, err)
+	}
+
+	controllerRef := metav1.GetControllerOf(secret)
+	if controllerRef == nil || controllerRef.UID != routeReadOnly.UID {
+		klog.V(2).Infof("Not deleting Secret %s/%s previously synced from Route %s/%s because it isn't owned by the Route anymore", secret.Namespace, secret.Name, routeReadOnly.Namespace, routeReadOnly.Name)
+		return nil
+	}
+
+	klog.V(2).Infof("Deleting Secret %s/%s previously synced from Route %s/%s", secret.Namespace, secret.Name, routeReadOnly.Namespace, routeReadOnly.Name)
+	err = rc.kubeClient.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &secret.UID},
+	})
+	if err != nil && !kapierrors.IsNotFound(err) {
+		return fmt.Errorf("can't delete Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	return nil
+}
+
+// updateSyncedSecretName records the name of the synced Secret in the Route status
+// without touching the rest of the status which is owned by the Route worker.
+func (rc *RouteController) updateSyncedSecretName(routeReadOnly *routev1.Route, secretName string) error {
+	var oldRouteReadOnly *routev1.Route
+	var err error
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if oldRouteReadOnly == nil {
+			oldRouteReadOnly = routeReadOnly
+		} else {
+			oldRouteReadOnly, err = rc.routeClient.RouteV1().Routes(routeReadOnly.Namespace).Get(routeReadOnly.Name, metav1.GetOptions{})
 			if err != nil {
-				return fmt.Errorf("failed to update Secret %s/%s with TLS data: %v", routeReadOnly.Namespace, secret.Name, err)
+				return err
 			}
 		}
-	}
 
+		status, err := rc.getStatus(oldRouteReadOnly)
+		if err != nil {
+			return err
+		}
+
+		if status.SyncedSecretName == secretName {
+			return nil
+		}
+		status.SyncedSecretName = secretName
+
+		// Don't use setStatus, the Route worker hasn't necessarily observed the current generation.
+		bytes, err := yaml.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("can't encode status annotation: %w", err)
+		}
+		newRoute := oldRouteReadOnly.DeepCopy()
+		metav1.SetMetaDataAnnotation(&newRoute.ObjectMeta, api.AcmeStatusAnnotation, string(bytes))
+
+		_, err = rc.routeClient.RouteV1().Routes(newRoute.Namespace).Update(newRoute)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("can't update synced Secret name: %w", err)
+	}
 	return nil
 }
 
@@ -1274,19 +2024,28 @@ func (rc *RouteController) CleanupExposerObjects(route *routev1.Route) error {
 	var gracePeriod int64 = 0
 	propagationPolicy := metav1.DeletePropagationBackground
 	klog.V(3).Infof("Cleaning up temporary exposer for Route %s/%s (UID=%s)", route.Namespace, route.Name, route.UID)
-	err := rc.routeClient.RouteV1().Routes(route.Namespace).DeleteCollection(
-		&metav1.DeleteOptions{
-			GracePeriodSeconds: &gracePeriod,
-			PropagationPolicy:  &propagationPolicy,
-		},
-		metav1.ListOptions{
-			LabelSelector: labels.SelectorFromValidatedSet(labels.Set{
-				api.AcmeExposerUID: string(route.UID),
-			}).String(),
-		},
-	)
-	if err != nil {
-		return err
+
+	namespaces := []string{route.Namespace}
+	// Temporary Routes for the shared exposer live in the controller namespace.
+	if rc.http01SolverMode == api.Http01SolverModeShared && route.Namespace != rc.controllerNamespace {
+		namespaces = append(namespaces, rc.controllerNamespace)
+	}
+
+	for _, namespace := range namespaces {
+		err := rc.routeClient.RouteV1().Routes(namespace).DeleteCollection(
+			&metav1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+				PropagationPolicy:  &propagationPolicy,
+			},
+			metav1.ListOptions{
+				LabelSelector: labels.SelectorFromValidatedSet(labels.Set{
+					api.AcmeExposerUID: string(route.UID),
+				}).String(),
+			},
+		)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1349,6 +2108,7 @@ func (rc *RouteController) Run(ctx context.Context, workers int) {
 		klog.Info("Shutting down Route controller")
 		rc.queue.ShutDown()
 		rc.routesToSecretsQueue.ShutDown()
+		rc.sharedExposerQueue.ShutDown()
 		wg.Wait()
 		klog.Info("Route controller shut down")
 	}()
@@ -1375,6 +2135,16 @@ func (rc *RouteController) Run(ctx context.Context, workers int) {
 		}()
 	}
 
+	if rc.http01SolverMode == api.Http01SolverModeShared {
+		// There is only a single shared exposer so one worker is enough.
+		rc.enqueueSharedExposer()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, rc.runSharedExposerWorker, time.Second)
+		}()
+	}
+
 	<-ctx.Done()
 }
 
@@ -1398,9 +2168,38 @@ func setStatus(obj *metav1.ObjectMeta, status *api.Status) error {
 	return nil
 }
 
+func hasFinalizer(route *routev1.Route, finalizer string) bool {
+	for _, f := range route.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasControllerFinalizer returns true if the Route has any finalizer the controller has to act upon.
+func hasControllerFinalizer(route *routev1.Route) bool {
+	return hasFinalizer(route, api.AcmeRevocationFinalizer) || hasFinalizer(route, api.AcmeSecretSyncFinalizer)
+}
+
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	var res []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
 func GetSyncSecretName(route *routev1.Route) (string, bool) {
 	secretName, ok := route.Annotations[api.AcmeSecretName]
 	if !ok {
+		// Passthrough Routes can't carry the certificate so it always goes into a Secret.
+		if isPassthrough(route) {
+			return route.Name, true
+		}
 		return "", false
 	}
 
@@ -1412,6 +2211,16 @@ func GetSyncSecretName(route *routev1.Route) (string, bool) {
 	return secretName, true
 }
 
+// syncedSecretName returns the name of the Secret recorded in the Route status, if any.
+func syncedSecretName(route *routev1.Route) string {
+	status := &api.Status{}
+	err := yaml.Unmarshal([]byte(route.Annotations[api.AcmeStatusAnnotation]), status)
+	if err != nil {
+		return ""
+	}
+	return status.SyncedSecretName
+}
+
 func adjustContainerResourceRequirements(requirements *corev1.ResourceRequirements, limitRanges []*corev1.LimitRange) error {
 	var errors []error
 
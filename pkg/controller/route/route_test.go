@@ -1,22 +1,48 @@
 package route
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
+	routev1 "github.com/openshift/api/route/v1"
+	routefake "github.com/openshift/client-go/route/clientset/versioned/fake"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/api/validation"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	apierrors "k8s.io/apimachinery/pkg/util/errors"
 	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	kubetesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
+	routeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/route"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
 )
 
 func init() {
@@ -373,3 +399,974 @@ func TestFilterOutLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestCertOrderBackoff(t *testing.T) {
+	initial := 5 * time.Minute
+	max := 24 * time.Hour
+
+	tt := []struct {
+		name     string
+		failures int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{
+			name:     "no failures",
+			failures: 0,
+			min:      0,
+			max:      0,
+		},
+		{
+			name:     "first failure",
+			failures: 1,
+			min:      initial,
+			max:      time.Duration(float64(initial) * (1 + CertOrderBackoffJitter)),
+		},
+		{
+			name:     "third failure",
+			failures: 3,
+			min:      4 * initial,
+			max:      time.Duration(float64(4*initial) * (1 + CertOrderBackoffJitter)),
+		},
+		{
+			name:     "capped",
+			failures: 20,
+			min:      max,
+			max:      max,
+		},
+		{
+			name:     "doesn't overflow",
+			failures: 1000,
+			min:      max,
+			max:      max,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := certOrderBackoff(tc.failures, initial, max, CertOrderBackoffJitter)
+				if got < tc.min || got > tc.max {
+					t.Fatalf("expected backoff in range [%v, %v], got %v", tc.min, tc.max, got)
+				}
+			}
+		})
+	}
+}
+
+func newTestCertificatePEM(t *testing.T, notBefore, notAfter time.Time, dnsNames ...string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+	}
+
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crtPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return string(crtPem), string(keyPem)
+}
+
+func TestCertificateExpiresAt(t *testing.T) {
+	notAfter := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	crt, key := newTestCertificatePEM(t, notAfter.Add(-90*24*time.Hour), notAfter, "foo.example.com")
+
+	tt := []struct {
+		name     string
+		tls      *routev1.TLSConfig
+		expected *time.Time
+	}{
+		{
+			name:     "no TLS",
+			tls:      nil,
+			expected: nil,
+		},
+		{
+			name: "invalid certificate",
+			tls: &routev1.TLSConfig{
+				Certificate: "invalid",
+			},
+			expected: nil,
+		},
+		{
+			name: "valid certificate",
+			tls: &routev1.TLSConfig{
+				Certificate: crt,
+				Key:         key,
+			},
+			expected: &notAfter,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				Spec: routev1.RouteSpec{
+					TLS: tc.tls,
+				},
+			}
+
+			got := certificateExpiresAt(route)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestNeedsCertKey(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	window, err := renewal.DefaultWindow().Override("24h", "48h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validCrt, validKey := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(90*24*time.Hour), "foo.example.com")
+	expiringCrt, expiringKey := newTestCertificatePEM(t, now.Add(-72*time.Hour), now.Add(12*time.Hour), "foo.example.com")
+	expiredCrt, expiredKey := newTestCertificatePEM(t, now.Add(-2*time.Hour), now.Add(-time.Hour), "foo.example.com")
+
+	tt := []struct {
+		name     string
+		tls      *routev1.TLSConfig
+		host     string
+		expected string
+	}{
+		{
+			name:     "missing certificate",
+			tls:      nil,
+			host:     "foo.example.com",
+			expected: "Route is missing CertKey",
+		},
+		{
+			name:     "valid certificate",
+			tls:      &routev1.TLSConfig{Certificate: validCrt, Key: validKey},
+			host:     "foo.example.com",
+			expected: "",
+		},
+		{
+			name:     "hostname mismatch",
+			tls:      &routev1.TLSConfig{Certificate: validCrt, Key: validKey},
+			host:     "bar.example.com",
+			expected: "Existing certificate doesn't match hostname",
+		},
+		{
+			name:     "expired certificate",
+			tls:      &routev1.TLSConfig{Certificate: expiredCrt, Key: expiredKey},
+			host:     "foo.example.com",
+			expected: "Already expired",
+		},
+		{
+			name:     "certificate within the renewal window",
+			tls:      &routev1.TLSConfig{Certificate: expiringCrt, Key: expiringKey},
+			host:     "foo.example.com",
+			expected: "In renewal period",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+					UID:       "42",
+				},
+				Spec: routev1.RouteSpec{
+					Host: tc.host,
+					TLS:  tc.tls,
+				},
+			}
+
+			got, err := needsCertKey(now, route, window)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRenewalWindowForRoute(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme":      "true",
+				api.AcmeRenewBeforeAnnotation: "a while",
+			},
+		},
+	}
+
+	rc, _, _, recorder := newTestRouteController(t, []*routev1.Route{route}, nil)
+	rc.settings = Settings{
+		RenewalWindow: renewal.DefaultWindow(),
+	}
+	status := &api.Status{}
+
+	drainEvents := func() []string {
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		return events
+	}
+
+	// Invalid values are reported once, not on every sync.
+	for i := 0; i < 3; i++ {
+		window := rc.renewalWindowForRoute(route, status)
+		if !reflect.DeepEqual(window, renewal.DefaultWindow()) {
+			t.Errorf("sync %d: expected the default window, got %v", i, window)
+		}
+		if !api.IsConditionTrue(status.Conditions, api.ConditionInvalidRenewalWindow) {
+			t.Errorf("sync %d: expected %s condition to be true, got %#v", i, api.ConditionInvalidRenewalWindow, status.Conditions)
+		}
+
+		events := drainEvents()
+		expectedEvents := 0
+		if i == 0 {
+			expectedEvents = 1
+		}
+		if len(events) != expectedEvents {
+			t.Errorf("sync %d: expected %d event(s), got %q", i, expectedEvents, events)
+		}
+	}
+
+	fixedRoute := route.DeepCopy()
+	fixedRoute.Annotations[api.AcmeRenewBeforeAnnotation] = "720h"
+	rc.renewalWindowForRoute(fixedRoute, status)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionInvalidRenewalWindow)
+	if condition == nil || condition.Status != api.ConditionFalse {
+		t.Errorf("expected %s condition to be cleared, got %#v", api.ConditionInvalidRenewalWindow, condition)
+	}
+	events := drainEvents()
+	if len(events) != 0 {
+		t.Errorf("expected no events, got %q", events)
+	}
+}
+
+// newTestRouteController returns a RouteController backed by fake clients with the caches filled with the objects.
+func newTestRouteController(t *testing.T, routes []*routev1.Route, secrets []*corev1.Secret) (*RouteController, *kubefake.Clientset, *routefake.Clientset, *record.FakeRecorder) {
+	var kubeObjects []runtime.Object
+	for _, s := range secrets {
+		kubeObjects = append(kubeObjects, s)
+	}
+	kubeClient := kubefake.NewSimpleClientset(kubeObjects...)
+
+	var routeObjects []runtime.Object
+	for _, r := range routes {
+		routeObjects = append(routeObjects, r)
+	}
+	routeClient := routefake.NewSimpleClientset(routeObjects...)
+
+	kubeInformersForNamespaces := kubeinformers.NewKubeInformersForNamespaces(kubeClient, []string{""})
+	for _, s := range secrets {
+		err := kubeInformersForNamespaces.InformersFor("").Core().V1().Secrets().Informer().GetIndexer().Add(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routeInformersForNamespaces := routeinformers.NewRouteInformersForNamespaces(routeClient, []string{""})
+	err := routeInformersForNamespaces.InformersFor("").Route().V1().Routes().Informer().AddIndexers(cache.Indexers{
+		keystorePasswordSecretIndex: indexByKeystorePasswordSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range routes {
+		err := routeInformersForNamespaces.InformersFor("").Route().V1().Routes().Informer().GetIndexer().Add(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	rc := &RouteController{
+		annotation:                  "kubernetes.io/tls-acme",
+		kubeClient:                  kubeClient,
+		kubeInformersForNamespaces:  kubeInformersForNamespaces,
+		routeClient:                 routeClient,
+		routeInformersForNamespaces: routeInformersForNamespaces,
+		recorder:                    recorder,
+		queue:                       workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		routesToSecretsQueue:        workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		sharedExposerQueue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		acmePollRateLimiter:         workqueue.NewItemExponentialFailureRateLimiter(AcmePollInitialInterval, AcmePollMaxInterval),
+	}
+
+	return rc, kubeClient, routeClient, recorder
+}
+
+// drainQueue returns all keys currently present in the queue.
+func drainQueue(queue workqueue.RateLimitingInterface) []string {
+	var keys []string
+	for queue.Len() > 0 {
+		key, _ := queue.Get()
+		keys = append(keys, key.(string))
+		queue.Forget(key)
+		queue.Done(key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestEventHandlers(t *testing.T) {
+	managedRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "test",
+			Name:            "managed",
+			ResourceVersion: "1",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme": "true",
+			},
+		},
+	}
+	unmanagedRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "test",
+			Name:            "unmanaged",
+			ResourceVersion: "1",
+		},
+	}
+	finalizedRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "test",
+			Name:            "finalized",
+			ResourceVersion: "1",
+			Finalizers:      []string{api.AcmeRevocationFinalizer},
+		},
+	}
+
+	keystoreRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "test",
+			Name:            "keystore",
+			ResourceVersion: "1",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme":                 "true",
+				api.AcmeSecretFormatsAnnotation:          string(api.SecretFormatPKCS12),
+				api.AcmeKeystorePasswordSecretAnnotation: "keystore-password",
+			},
+		},
+	}
+	newPasswordSecret := func(name string, rv string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "test",
+				Name:            name,
+				ResourceVersion: rv,
+			},
+			Data: map[string][]byte{
+				api.KeystorePasswordSecretKey: []byte("password-" + rv),
+			},
+		}
+	}
+
+	newRoute := func(route *routev1.Route, rv string) *routev1.Route {
+		r := route.DeepCopy()
+		r.ResourceVersion = rv
+		return r
+	}
+	exposerMeta := func(owner string, rv string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Namespace:       "test",
+			Name:            "exposer",
+			ResourceVersion: rv,
+			Labels: map[string]string{
+				api.AcmeTemporaryLabel: "true",
+			},
+			Annotations: map[string]string{
+				api.AcmeExposerKey: owner,
+			},
+		}
+	}
+	newPod := func(owner string, rv string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: exposerMeta(owner, rv)}
+	}
+	newService := func(owner string, rv string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: exposerMeta(owner, rv)}
+	}
+	newReplicaSet := func(owner string, rv string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: exposerMeta(owner, rv)}
+	}
+	newExposerRoute := func(owner string, rv string) *routev1.Route {
+		return &routev1.Route{ObjectMeta: exposerMeta(owner, rv)}
+	}
+	sharedExposerService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "acme-controller",
+			Name:      SharedExposerName,
+		},
+	}
+
+	tt := []struct {
+		name                  string
+		handle                func(rc *RouteController)
+		expectedKeys          []string
+		expectedSharedExposer []string
+	}{
+		{
+			name: "added managed Route is enqueued",
+			handle: func(rc *RouteController) {
+				rc.addRoute(managedRoute)
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "added unmanaged Route is skipped",
+			handle: func(rc *RouteController) {
+				rc.addRoute(unmanagedRoute)
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "added unmanaged Route with our finalizer is enqueued",
+			handle: func(rc *RouteController) {
+				rc.addRoute(finalizedRoute)
+			},
+			expectedKeys: []string{"test/finalized"},
+		},
+		{
+			name: "updated managed Route is enqueued",
+			handle: func(rc *RouteController) {
+				rc.updateRoute(managedRoute, newRoute(managedRoute, "2"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "updated unmanaged Route is skipped",
+			handle: func(rc *RouteController) {
+				rc.updateRoute(unmanagedRoute, newRoute(unmanagedRoute, "2"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "deleted managed Route from a tombstone is enqueued",
+			handle: func(rc *RouteController) {
+				rc.deleteRoute(cache.DeletedFinalStateUnknown{Key: "test/managed", Obj: managedRoute})
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "deleted unmanaged Route is skipped",
+			handle: func(rc *RouteController) {
+				rc.deleteRoute(unmanagedRoute)
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "exposer Route change requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.updateRoute(newExposerRoute("test/managed", "1"), newExposerRoute("test/managed", "2"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "exposer Route change doesn't requeue an unmanaged Route",
+			handle: func(rc *RouteController) {
+				rc.addRoute(newExposerRoute("test/unmanaged", "1"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "exposer Route change doesn't requeue a missing Route",
+			handle: func(rc *RouteController) {
+				rc.addRoute(newExposerRoute("test/missing", "1"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "added exposer Pod requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.addPod(newPod("test/managed", "1"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "updated exposer Pod requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.updatePod(newPod("test/managed", "1"), newPod("test/managed", "2"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "resynced exposer Pod is skipped",
+			handle: func(rc *RouteController) {
+				rc.updatePod(newPod("test/managed", "1"), newPod("test/managed", "1"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "deleted exposer Pod from a tombstone requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.deletePod(cache.DeletedFinalStateUnknown{Key: "test/exposer", Obj: newPod("test/managed", "1")})
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "Pod without the exposer key is skipped",
+			handle: func(rc *RouteController) {
+				rc.addPod(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "test", Name: "foo"}})
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "updated exposer ReplicaSet requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.updateReplicaSet(newReplicaSet("test/managed", "1"), newReplicaSet("test/managed", "2"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "deleted exposer ReplicaSet requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.deleteReplicaSet(newReplicaSet("test/managed", "1"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "added exposer Service requeues the owning Route",
+			handle: func(rc *RouteController) {
+				rc.addService(newService("test/managed", "1"))
+			},
+			expectedKeys: []string{"test/managed"},
+		},
+		{
+			name: "updated exposer Service of an unmanaged Route is skipped",
+			handle: func(rc *RouteController) {
+				rc.updateService(newService("test/unmanaged", "1"), newService("test/unmanaged", "2"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "shared exposer Service enqueues the shared exposer",
+			handle: func(rc *RouteController) {
+				rc.deleteService(sharedExposerService)
+			},
+			expectedKeys:          nil,
+			expectedSharedExposer: []string{sharedExposerQueueKey},
+		},
+		{
+			name: "added keystore password Secret requeues the Route",
+			handle: func(rc *RouteController) {
+				rc.addSecret(newPasswordSecret("keystore-password", "1"))
+			},
+			expectedKeys: []string{"test/keystore"},
+		},
+		{
+			name: "updated keystore password Secret requeues the Route",
+			handle: func(rc *RouteController) {
+				rc.updateSecret(newPasswordSecret("keystore-password", "1"), newPasswordSecret("keystore-password", "2"))
+			},
+			expectedKeys: []string{"test/keystore"},
+		},
+		{
+			name: "resynced keystore password Secret is skipped",
+			handle: func(rc *RouteController) {
+				rc.updateSecret(newPasswordSecret("keystore-password", "1"), newPasswordSecret("keystore-password", "1"))
+			},
+			expectedKeys: nil,
+		},
+		{
+			name: "deleted keystore password Secret from a tombstone requeues the Route",
+			handle: func(rc *RouteController) {
+				rc.deleteSecret(cache.DeletedFinalStateUnknown{Key: "test/keystore-password", Obj: newPasswordSecret("keystore-password", "1")})
+			},
+			expectedKeys: []string{"test/keystore"},
+		},
+		{
+			name: "unrelated Secret is skipped",
+			handle: func(rc *RouteController) {
+				rc.addSecret(newPasswordSecret("other", "1"))
+			},
+			expectedKeys: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, _, _, _ := newTestRouteController(t, []*routev1.Route{managedRoute, unmanagedRoute, finalizedRoute, keystoreRoute}, nil)
+			rc.controllerNamespace = "acme-controller"
+			rc.http01SolverMode = api.Http01SolverModeShared
+
+			tc.handle(rc)
+
+			got := drainQueue(rc.queue)
+			if !reflect.DeepEqual(got, tc.expectedKeys) {
+				t.Errorf("expected keys %v, got %v", tc.expectedKeys, got)
+			}
+
+			gotSharedExposer := drainQueue(rc.sharedExposerQueue)
+			if !reflect.DeepEqual(gotSharedExposer, tc.expectedSharedExposer) {
+				t.Errorf("expected shared exposer keys %v, got %v", tc.expectedSharedExposer, gotSharedExposer)
+			}
+		})
+	}
+}
+
+func TestPollAcme(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme": "true",
+			},
+		},
+	}
+	key := "test/foo"
+
+	rc, _, _, _ := newTestRouteController(t, []*routev1.Route{route}, nil)
+	rc.acmePollRateLimiter = workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)
+
+	for i := 1; i <= 3; i++ {
+		rc.pollAcme(key)
+
+		err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			return rc.queue.Len() == 1, nil
+		})
+		if err != nil {
+			t.Fatalf("poll %d: Route wasn't requeued: %v", i, err)
+		}
+
+		got := drainQueue(rc.queue)
+		if !reflect.DeepEqual(got, []string{key}) {
+			t.Fatalf("poll %d: expected keys %v, got %v", i, []string{key}, got)
+		}
+
+		requeues := rc.acmePollRateLimiter.NumRequeues(key)
+		if requeues != i {
+			t.Errorf("poll %d: expected %d requeues, got %d", i, i, requeues)
+		}
+	}
+
+	// Once the Route is gone the sync must reset the backoff so it doesn't carry over.
+	err := rc.routeInformersForNamespaces.InformersFor("").Route().V1().Routes().Informer().GetIndexer().Delete(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rc.sync(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requeues := rc.acmePollRateLimiter.NumRequeues(key)
+	if requeues != 0 {
+		t.Errorf("expected the backoff to be forgotten, got %d requeues", requeues)
+	}
+
+	got := drainQueue(rc.queue)
+	if len(got) != 0 {
+		t.Errorf("expected no keys, got %v", got)
+	}
+}
+
+func TestSyncRouteToSecret(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+
+	newRoute := func(secretName *string, syncedSecretName string) *routev1.Route {
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      "foo",
+				UID:       "foo-uid",
+				Annotations: map[string]string{
+					"kubernetes.io/tls-acme": "true",
+				},
+			},
+			Spec: routev1.RouteSpec{
+				Host: "foo.example.com",
+				TLS: &routev1.TLSConfig{
+					Termination: routev1.TLSTerminationEdge,
+					Certificate: crt,
+					Key:         key,
+				},
+			},
+		}
+		if secretName != nil {
+			route.Annotations[api.AcmeSecretName] = *secretName
+		}
+		err := setStatus(&route.ObjectMeta, &api.Status{SyncedSecretName: syncedSecretName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return route
+	}
+
+	newSecret := func(name string, owner *routev1.Route) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      name,
+				UID:       types.UID(name + "-uid"),
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte("old"),
+				corev1.TLSPrivateKeyKey: []byte("old"),
+			},
+		}
+		if owner != nil {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, controllerKind)}
+		}
+		return secret
+	}
+
+	strPtr := func(s string) *string {
+		return &s
+	}
+
+	tt := []struct {
+		name                     string
+		route                    *routev1.Route
+		secrets                  []*corev1.Secret
+		expectedErr              bool
+		expectedActions          []string
+		expectedSecrets          []string
+		expectedSyncedSecretName string
+		expectedEvents           []string
+	}{
+		{
+			name:                     "creates Secret named by the annotation",
+			route:                    newRoute(strPtr("foo-tls"), ""),
+			expectedActions:          []string{"create foo-tls"},
+			expectedSecrets:          []string{"foo-tls"},
+			expectedSyncedSecretName: "foo-tls",
+		},
+		{
+			name:                     "defaults to the Route name",
+			route:                    newRoute(strPtr(""), ""),
+			expectedActions:          []string{"create foo"},
+			expectedSecrets:          []string{"foo"},
+			expectedSyncedSecretName: "foo",
+		},
+		{
+			name:                     "updates existing Secret with a name different from the Route",
+			route:                    newRoute(strPtr("foo-tls"), "foo-tls"),
+			secrets:                  []*corev1.Secret{newSecret("foo-tls", newRoute(nil, ""))},
+			expectedActions:          []string{"update foo-tls"},
+			expectedSecrets:          []string{"foo-tls"},
+			expectedSyncedSecretName: "foo-tls",
+		},
+		{
+			name:                     "rename deletes the previously synced Secret",
+			route:                    newRoute(strPtr("new-tls"), "old-tls"),
+			secrets:                  []*corev1.Secret{newSecret("old-tls", newRoute(nil, ""))},
+			expectedActions:          []string{"create new-tls", "delete old-tls"},
+			expectedSecrets:          []string{"new-tls"},
+			expectedSyncedSecretName: "new-tls",
+		},
+		{
+			name:                     "rename keeps the previous Secret if it isn't owned by the Route anymore",
+			route:                    newRoute(strPtr("new-tls"), "old-tls"),
+			secrets:                  []*corev1.Secret{newSecret("old-tls", nil)},
+			expectedActions:          []string{"create new-tls"},
+			expectedSecrets:          []string{"new-tls", "old-tls"},
+			expectedSyncedSecretName: "new-tls",
+		},
+		{
+			name:                     "removing the annotation deletes the synced Secret",
+			route:                    newRoute(nil, "foo-tls"),
+			secrets:                  []*corev1.Secret{newSecret("foo-tls", newRoute(nil, ""))},
+			expectedActions:          []string{"delete foo-tls"},
+			expectedSecrets:          nil,
+			expectedSyncedSecretName: "",
+		},
+		{
+			name:            "colliding Secret not owned by the Route",
+			route:           newRoute(strPtr("foo-tls"), ""),
+			secrets:         []*corev1.Secret{newSecret("foo-tls", nil)},
+			expectedErr:     true,
+			expectedActions: nil,
+			expectedSecrets: []string{"foo-tls"},
+			expectedEvents:  []string{"Warning CollidingSecret"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, kubeClient, routeClient, recorder := newTestRouteController(t, []*routev1.Route{tc.route}, tc.secrets)
+
+			err := rc.syncRouteToSecret(context.Background(), "test/foo")
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			var actions []string
+			for _, a := range kubeClient.Actions() {
+				switch a := a.(type) {
+				case kubetesting.CreateAction:
+					actions = append(actions, a.GetVerb()+" "+a.GetObject().(*corev1.Secret).Name)
+				case kubetesting.UpdateAction:
+					actions = append(actions, a.GetVerb()+" "+a.GetObject().(*corev1.Secret).Name)
+				case kubetesting.DeleteAction:
+					actions = append(actions, a.GetVerb()+" "+a.GetName())
+				}
+			}
+			if !reflect.DeepEqual(actions, tc.expectedActions) {
+				t.Errorf("expected actions %q, got %q", tc.expectedActions, actions)
+			}
+
+			secretList, err := kubeClient.CoreV1().Secrets("test").List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var secrets []string
+			for _, s := range secretList.Items {
+				secrets = append(secrets, s.Name)
+				if s.Name == tc.expectedSyncedSecretName && string(s.Data[corev1.TLSCertKey]) != crt {
+					t.Errorf("expected Secret %q to contain the Route certificate", s.Name)
+				}
+			}
+			sort.Strings(secrets)
+			if !reflect.DeepEqual(secrets, tc.expectedSecrets) {
+				t.Errorf("expected Secrets %q, got %q", tc.expectedSecrets, secrets)
+			}
+
+			route, err := routeClient.RouteV1().Routes("test").Get("foo", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, err := rc.getStatus(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.SyncedSecretName != tc.expectedSyncedSecretName {
+				t.Errorf("expected synced Secret name %q, got %q", tc.expectedSyncedSecretName, status.SyncedSecretName)
+			}
+
+			close(recorder.Events)
+			var events []string
+			for e := range recorder.Events {
+				parts := strings.SplitN(e, " ", 3)
+				events = append(events, strings.Join(parts[:2], " "))
+			}
+			if !reflect.DeepEqual(events, tc.expectedEvents) {
+				t.Errorf("expected events %q, got %q", tc.expectedEvents, events)
+			}
+		})
+	}
+}
+
+func TestReleasedNamespace(t *testing.T) {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme":                 "true",
+				api.AcmeKeystorePasswordSecretAnnotation: "foo-password",
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: "foo.example.com",
+			TLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationPassthrough,
+			},
+		},
+	}
+
+	kubeClient := kubefake.NewSimpleClientset()
+	routeClient := routefake.NewSimpleClientset()
+	kubeInformersForNamespaces := kubeinformers.NewKubeInformersForNamespaces(kubeClient, []string{"test"})
+	routeInformersForNamespaces := routeinformers.NewRouteInformersForNamespaces(routeClient, []string{"test"})
+	rc := &RouteController{
+		annotation:                  "kubernetes.io/tls-acme",
+		kubeClient:                  kubeClient,
+		kubeInformersForNamespaces:  kubeInformersForNamespaces,
+		routeClient:                 routeClient,
+		routeInformersForNamespaces: routeInformersForNamespaces,
+		recorder:                    record.NewFakeRecorder(10),
+	}
+	// The namespace controller can release the namespace while a sync is in flight.
+	kubeInformersForNamespaces.RemoveNamespace("test")
+	routeInformersForNamespaces.RemoveNamespace("test")
+
+	tt := []struct {
+		name string
+		f    func() error
+	}{
+		{
+			name: "syncSecret",
+			f: func() error {
+				return rc.syncSecret(route, "foo-tls")
+			},
+		},
+		{
+			name: "deleteSyncedSecret",
+			f: func() error {
+				return rc.deleteSyncedSecret(route, "foo-tls")
+			},
+		},
+		{
+			name: "keystorePassword",
+			f: func() error {
+				_, err := rc.keystorePassword(route)
+				return err
+			},
+		},
+		{
+			name: "checkCertificateSecret",
+			f: func() error {
+				return rc.checkCertificateSecret(route)
+			},
+		},
+		{
+			name: "routeWithCertificate",
+			f: func() error {
+				_, err := rc.routeWithCertificate(route)
+				return err
+			},
+		},
+		{
+			name: "certificatesInNamespace",
+			f: func() error {
+				_, err := rc.certificatesInNamespace(route)
+				return err
+			},
+		},
+		{
+			name: "ensurePerChallengeExposer",
+			f: func() error {
+				_, err := rc.ensurePerChallengeExposer(route, "key", "id", "foo-tmp", "/.well-known/acme-challenge/token", "response")
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.f()
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
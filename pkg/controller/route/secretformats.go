@@ -0,0 +1,284 @@
+package route
+
+import (
+	"bytes"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/helpers"
+	"github.com/tnozicka/openshift-acme/pkg/keystore"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+// KeystoreAlias is the alias (friendly name) of the private key entry in the rendered keystores.
+const KeystoreAlias = "tls"
+
+const keystorePasswordSecretIndex = "keystorePasswordSecret"
+
+var supportedSecretFormats = []api.SecretFormat{
+	api.SecretFormatCACert,
+	api.SecretFormatCombinedPEM,
+	api.SecretFormatPKCS12,
+	api.SecretFormatJKS,
+}
+
+func parseSecretFormats(s string) ([]api.SecretFormat, error) {
+	var formats []api.SecretFormat
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		format := api.SecretFormat(item)
+		supported := false
+		for _, f := range supportedSecretFormats {
+			if f == format {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("unsupported secret format %q, supported formats are %q", item, supportedSecretFormats)
+		}
+
+		if !hasSecretFormat(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+
+	return formats, nil
+}
+
+func hasSecretFormat(formats []api.SecretFormat, format api.SecretFormat) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func needsKeystorePassword(formats []api.SecretFormat) bool {
+	return hasSecretFormat(formats, api.SecretFormatPKCS12) || hasSecretFormat(formats, api.SecretFormatJKS)
+}
+
+func indexByKeystorePasswordSecret(obj interface{}) ([]string, error) {
+	route, ok := obj.(*routev1.Route)
+	if !ok {
+		return nil, fmt.Errorf("expected *routev1.Route, got %T", obj)
+	}
+
+	secretName := route.Annotations[api.AcmeKeystorePasswordSecretAnnotation]
+	if len(secretName) == 0 {
+		return nil, nil
+	}
+
+	return []string{route.Namespace + "/" + secretName}, nil
+}
+
+// enqueueKeystorePasswordSecretRoutes requeues the Routes using the Secret as the keystore password
+// so the keystores get rendered with the new password.
+func (rc *RouteController) enqueueKeystorePasswordSecretRoutes(secret *corev1.Secret) {
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(secret.Namespace)
+	if informers == nil {
+		return
+	}
+
+	objs, err := informers.Route().V1().Routes().Informer().GetIndexer().ByIndex(keystorePasswordSecretIndex, secret.Namespace+"/"+secret.Name)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("can't list Routes using keystore password Secret %s/%s: %w", secret.Namespace, secret.Name, err))
+		return
+	}
+
+	for _, obj := range objs {
+		route := obj.(*routev1.Route)
+		if !util.IsManaged(route, rc.annotation) {
+			continue
+		}
+
+		klog.V(4).Infof("Requeuing Route %s/%s because its keystore password Secret %s changed", route.Namespace, route.Name, secret.Name)
+		rc.enqueueRoute(route)
+	}
+}
+
+// keystorePassword returns the password from the Secret referenced by the Route.
+func (rc *RouteController) keystorePassword(route *routev1.Route) (string, error) {
+	secretName := route.Annotations[api.AcmeKeystorePasswordSecretAnnotation]
+	if len(secretName) == 0 {
+		return "", fmt.Errorf("keystore formats require annotation %q referencing a Secret with key %q", api.AcmeKeystorePasswordSecretAnnotation, api.KeystorePasswordSecretKey)
+	}
+
+	kubeInformers, err := rc.kubeInformersFor(route.Namespace)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := kubeInformers.Core().V1().Secrets().Lister().Secrets(route.Namespace).Get(secretName)
+	if err != nil {
+		return "", fmt.Errorf("can't get keystore password Secret %s/%s: %w", route.Namespace, secretName, err)
+	}
+
+	password, ok := secret.Data[api.KeystorePasswordSecretKey]
+	if !ok {
+		return "", fmt.Errorf("keystore password Secret %s/%s is missing key %q", route.Namespace, secretName, api.KeystorePasswordSecretKey)
+	}
+
+	return string(password), nil
+}
+
+func certificatesFromPEM(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+
+	return certificates, nil
+}
+
+func secretContentHash(route *routev1.Route, formats []api.SecretFormat, password string) string {
+	h := sha256.New()
+	for _, f := range formats {
+		_, _ = fmt.Fprintf(h, "%s\x00", f)
+	}
+	_, _ = fmt.Fprintf(h, "%s\x00%s\x00%s", route.Spec.TLS.Certificate, route.Spec.TLS.Key, password)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// setCertificateSecretData renders the Route certificate into the Secret in all requested formats.
+// Keystores are encrypted with random salts, so to avoid updating the Secret on every sync
+// they are re-rendered only when the inputs change as tracked by the content hash annotation.
+func setCertificateSecretData(secret *corev1.Secret, route *routev1.Route, formats []api.SecretFormat, password string) error {
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[corev1.TLSCertKey] = []byte(route.Spec.TLS.Certificate)
+	secret.Data[corev1.TLSPrivateKeyKey] = []byte(route.Spec.TLS.Key)
+
+	hash := secretContentHash(route, formats, password)
+	unchanged := secret.Annotations[api.AcmeSecretContentHashAnnotation] == hash
+
+	for _, f := range supportedSecretFormats {
+		if !hasSecretFormat(formats, f) {
+			delete(secret.Data, string(f))
+		}
+	}
+
+	if len(formats) == 0 {
+		delete(secret.Annotations, api.AcmeSecretContentHashAnnotation)
+		return nil
+	}
+
+	certificates, err := certificatesFromPEM([]byte(route.Spec.TLS.Certificate))
+	if err != nil {
+		return fmt.Errorf("can't decode certificates: %w", err)
+	}
+
+	for _, f := range formats {
+		switch f {
+		case api.SecretFormatCACert:
+			buf := &bytes.Buffer{}
+			for _, c := range certificates[1:] {
+				err = pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+				if err != nil {
+					return err
+				}
+			}
+			secret.Data[string(f)] = buf.Bytes()
+
+		case api.SecretFormatCombinedPEM:
+			combined := append([]byte{}, []byte(route.Spec.TLS.Certificate)...)
+			if len(combined) != 0 && combined[len(combined)-1] != '\n' {
+				combined = append(combined, '\n')
+			}
+			secret.Data[string(f)] = append(combined, []byte(route.Spec.TLS.Key)...)
+
+		case api.SecretFormatPKCS12, api.SecretFormatJKS:
+			if _, ok := secret.Data[string(f)]; ok && unchanged {
+				continue
+			}
+
+			privateKey, err := helpers.PrivateKeyFromPEM([]byte(route.Spec.TLS.Key))
+			if err != nil {
+				return fmt.Errorf("can't decode private key: %w", err)
+			}
+
+			var data []byte
+			if f == api.SecretFormatPKCS12 {
+				data, err = keystore.EncodePKCS12(cryptorand.Reader, privateKey, certificates, password)
+			} else {
+				data, err = keystore.EncodeJKS(privateKey, certificates, KeystoreAlias, password, certificates[0].NotBefore)
+			}
+			if err != nil {
+				return fmt.Errorf("can't encode %s: %w", f, err)
+			}
+			secret.Data[string(f)] = data
+		}
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[api.AcmeSecretContentHashAnnotation] = hash
+
+	return nil
+}
+
+// certificateSecretFormats returns the requested formats and the keystore password if needed.
+func (rc *RouteController) certificateSecretFormats(route *routev1.Route) ([]api.SecretFormat, string, error) {
+	formats, err := parseSecretFormats(route.Annotations[api.AcmeSecretFormatsAnnotation])
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !needsKeystorePassword(formats) {
+		return formats, "", nil
+	}
+
+	password, err := rc.keystorePassword(route)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return formats, password, nil
+}
+
+// renderCertificateSecret sets the certificate data in all formats requested by the Route into the Secret.
+func (rc *RouteController) renderCertificateSecret(secret *corev1.Secret, route *routev1.Route) error {
+	formats, password, err := rc.certificateSecretFormats(route)
+	if err != nil {
+		rc.recorder.Eventf(route, corev1.EventTypeWarning, "InvalidSecretFormats", "Can't render certificates into Secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		return err
+	}
+
+	return setCertificateSecretData(secret, route, formats, password)
+}
@@ -0,0 +1,155 @@
+package route
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"golang.org/x/crypto/pkcs12"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestParseSecretFormats(t *testing.T) {
+	tt := []struct {
+		name        string
+		value       string
+		expected    []api.SecretFormat
+		expectedErr bool
+	}{
+		{
+			name:     "empty",
+			value:    "",
+			expected: nil,
+		},
+		{
+			name:     "all formats with duplicates",
+			value:    "ca.crt, tls-combined.pem,keystore.p12,keystore.jks,ca.crt",
+			expected: []api.SecretFormat{api.SecretFormatCACert, api.SecretFormatCombinedPEM, api.SecretFormatPKCS12, api.SecretFormatJKS},
+		},
+		{
+			name:        "unsupported format",
+			value:       "ca.crt,keystore.bks",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSecretFormats(tc.value)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetCertificateSecretData(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+	renewedCrt, renewedKey := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(2*time.Hour), "foo.example.com")
+
+	newRoute := func(crt, key string) *routev1.Route {
+		return &routev1.Route{
+			Spec: routev1.RouteSpec{
+				TLS: &routev1.TLSConfig{
+					Certificate: crt,
+					Key:         key,
+				},
+			},
+		}
+	}
+
+	route := newRoute(crt, key)
+	secret := &corev1.Secret{}
+	formats := []api.SecretFormat{api.SecretFormatCACert, api.SecretFormatCombinedPEM, api.SecretFormatPKCS12, api.SecretFormatJKS}
+
+	err := setCertificateSecretData(secret, route, formats, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, "ca.crt", "tls-combined.pem", "keystore.p12", "keystore.jks"} {
+		if _, ok := secret.Data[k]; !ok {
+			t.Errorf("expected key %q to be present", k)
+		}
+	}
+
+	if !bytes.Equal(secret.Data["tls-combined.pem"], []byte(crt+key)) {
+		t.Errorf("expected combined PEM to contain the certificate followed by the key, got %q", secret.Data["tls-combined.pem"])
+	}
+
+	_, certificate, err := pkcs12.Decode(secret.Data["keystore.p12"], "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.NotAfter.Equal(now.Add(time.Hour).Truncate(time.Second)) {
+		t.Errorf("unexpected certificate in keystore with NotAfter %v", certificate.NotAfter)
+	}
+
+	// Keystores have to stay the same if nothing changed so we don't update the Secret on every sync.
+	previous := secret.DeepCopy()
+	err = setCertificateSecretData(secret, route, formats, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(secret, previous) {
+		t.Errorf("expected the Secret not to change")
+	}
+
+	// Renewal has to update all keys.
+	err = setCertificateSecretData(secret, newRoute(renewedCrt, renewedKey), formats, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, certificate, err = pkcs12.Decode(secret.Data["keystore.p12"], "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !certificate.NotAfter.Equal(now.Add(2 * time.Hour).Truncate(time.Second)) {
+		t.Errorf("expected renewed certificate in keystore, got NotAfter %v", certificate.NotAfter)
+	}
+	if bytes.Equal(secret.Data["keystore.jks"], previous.Data["keystore.jks"]) {
+		t.Errorf("expected JKS keystore to be updated")
+	}
+
+	// Password change has to re-encrypt the keystores.
+	err = setCertificateSecretData(secret, newRoute(renewedCrt, renewedKey), formats, "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = pkcs12.Decode(secret.Data["keystore.p12"], "changed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Formats that are no longer requested have to be removed.
+	err = setCertificateSecretData(secret, newRoute(renewedCrt, renewedKey), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedKeys := []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}
+	var keys []string
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	if len(keys) != len(expectedKeys) {
+		t.Errorf("expected keys %q, got %q", expectedKeys, keys)
+	}
+	if _, ok := secret.Annotations[api.AcmeSecretContentHashAnnotation]; ok {
+		t.Errorf("expected content hash annotation to be removed")
+	}
+}
@@ -0,0 +1,375 @@
+package route
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+// parseSecretTargets parses comma separated namespace/name pairs of Secrets in other namespaces.
+func parseSecretTargets(s string, routeNamespace string) ([]types.NamespacedName, error) {
+	var targets []types.NamespacedName
+	seen := sets.NewString()
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+
+		parts := strings.Split(item, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid secret target %q: expected namespace/name", item)
+		}
+
+		target := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+
+		errs := kvalidation.IsDNS1123Label(target.Namespace)
+		if len(errs) != 0 {
+			return nil, fmt.Errorf("invalid secret target %q: invalid namespace: %s", item, strings.Join(errs, ", "))
+		}
+
+		errs = kvalidation.IsDNS1123Subdomain(target.Name)
+		if len(errs) != 0 {
+			return nil, fmt.Errorf("invalid secret target %q: invalid name: %s", item, strings.Join(errs, ", "))
+		}
+
+		if target.Namespace == routeNamespace {
+			return nil, fmt.Errorf("invalid secret target %q: use %q annotation for Secrets in the Route's namespace", item, api.AcmeSecretName)
+		}
+
+		if seen.Has(target.String()) {
+			continue
+		}
+		seen.Insert(target.String())
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+const sourceRouteUIDIndex = "sourceRouteUID"
+
+// SecretSyncInformers cache the objects needed to sync certificates into other namespaces.
+// They are cluster wide but only hold the objects related to syncing Secrets.
+type SecretSyncInformers struct {
+	// Secrets holds only the Secrets synced from Routes.
+	Secrets informers.SharedInformerFactory
+	// Namespaces holds only the namespaces that opted in to receiving Secrets.
+	Namespaces informers.SharedInformerFactory
+}
+
+func NewSecretSyncInformers(kubeClient kubernetes.Interface) *SecretSyncInformers {
+	return &SecretSyncInformers{
+		Secrets: informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = api.AcmeSecretSourceRouteUIDLabel
+		})),
+		Namespaces: informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(labels.Set{
+				api.AcmeSecretSyncAllowedLabel: "true",
+			}).String()
+		})),
+	}
+}
+
+func (i *SecretSyncInformers) Start(stopCh <-chan struct{}) {
+	i.Secrets.Start(stopCh)
+	i.Namespaces.Start(stopCh)
+}
+
+func indexBySourceRouteUID(obj interface{}) ([]string, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("expected *corev1.Secret, got %T", obj)
+	}
+
+	uid, ok := secret.Labels[api.AcmeSecretSourceRouteUIDLabel]
+	if !ok {
+		return nil, nil
+	}
+
+	return []string{uid}, nil
+}
+
+// setUpSecretSyncInformers registers the indexers and returns the caches we need to wait for.
+func (rc *RouteController) setUpSecretSyncInformers(secretSyncInformers *SecretSyncInformers) []cache.InformerSynced {
+	secretInformer := secretSyncInformers.Secrets.Core().V1().Secrets().Informer()
+	err := secretInformer.AddIndexers(cache.Indexers{
+		sourceRouteUIDIndex: indexBySourceRouteUID,
+	})
+	if err != nil {
+		panic(fmt.Errorf("can't add source route UID index: %w", err))
+	}
+
+	namespaceInformer := secretSyncInformers.Namespaces.Core().V1().Namespaces().Informer()
+
+	return []cache.InformerSynced{
+		secretInformer.HasSynced,
+		namespaceInformer.HasSynced,
+	}
+}
+
+func secretTargetSelector(route *routev1.Route) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{
+		api.AcmeSecretSourceRouteUIDLabel: string(route.UID),
+	})
+}
+
+// syncedTargetSecrets lists the Secrets we have synced from the Route into other namespaces.
+// Target namespaces don't need to be watched by the controller, so without the secret sync informers
+// we have to use a live list.
+func (rc *RouteController) syncedTargetSecrets(route *routev1.Route) ([]*corev1.Secret, error) {
+	if rc.secretSyncInformers == nil {
+		list, err := rc.kubeClient.CoreV1().Secrets(metav1.NamespaceAll).List(metav1.ListOptions{
+			LabelSelector: secretTargetSelector(route).String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't list Secrets synced from Route %s/%s: %w", route.Namespace, route.Name, err)
+		}
+
+		var secrets []*corev1.Secret
+		for i := range list.Items {
+			secrets = append(secrets, &list.Items[i])
+		}
+		return secrets, nil
+	}
+
+	objs, err := rc.secretSyncInformers.Secrets.Core().V1().Secrets().Informer().GetIndexer().ByIndex(sourceRouteUIDIndex, string(route.UID))
+	if err != nil {
+		return nil, fmt.Errorf("can't list Secrets synced from Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	var secrets []*corev1.Secret
+	for _, obj := range objs {
+		secrets = append(secrets, obj.(*corev1.Secret))
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Namespace+"/"+secrets[i].Name < secrets[j].Namespace+"/"+secrets[j].Name
+	})
+
+	return secrets, nil
+}
+
+func (rc *RouteController) isSecretSyncAllowed(namespace string) (bool, error) {
+	var ns *corev1.Namespace
+	var err error
+	if rc.secretSyncInformers == nil {
+		ns, err = rc.kubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	} else {
+		ns, err = rc.secretSyncInformers.Namespaces.Core().V1().Namespaces().Lister().Get(namespace)
+	}
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return ns.Labels[api.AcmeSecretSyncAllowedLabel] == "true", nil
+}
+
+func (rc *RouteController) updateSecretSyncFinalizer(routeReadOnly *routev1.Route, wantsFinalizer bool) error {
+	route := routeReadOnly.DeepCopy()
+	if wantsFinalizer {
+		route.Finalizers = append(route.Finalizers, api.AcmeSecretSyncFinalizer)
+	} else {
+		route.Finalizers = removeFinalizer(route.Finalizers, api.AcmeSecretSyncFinalizer)
+	}
+
+	klog.V(2).Infof("Updating secret sync finalizer on Route %s/%s", route.Namespace, route.Name)
+	_, err := rc.routeClient.RouteV1().Routes(route.Namespace).Update(route)
+	if err != nil {
+		return fmt.Errorf("can't update secret sync finalizer on Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	return nil
+}
+
+func (rc *RouteController) ensureTargetSecret(routeReadOnly *routev1.Route, target types.NamespacedName, existingReadOnly *corev1.Secret) error {
+	var secret *corev1.Secret
+	if existingReadOnly != nil {
+		secret = existingReadOnly.DeepCopy()
+	} else {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: target.Namespace,
+				Name:      target.Name,
+			},
+		}
+	}
+
+	secret.Type = corev1.SecretTypeTLS
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[api.AcmeSecretSourceRouteUIDLabel] = string(routeReadOnly.UID)
+	metav1.SetMetaDataAnnotation(&secret.ObjectMeta, api.AcmeSecretSourceRouteAnnotation, routeReadOnly.Namespace+"/"+routeReadOnly.Name)
+
+	err := rc.renderCertificateSecret(secret, routeReadOnly)
+	if err != nil {
+		return err
+	}
+
+	if existingReadOnly == nil {
+		_, err = rc.kubeClient.CoreV1().Secrets(target.Namespace).Create(secret)
+		if err != nil {
+			return fmt.Errorf("can't create Secret %s: %w", target, err)
+		}
+	} else if !reflect.DeepEqual(secret, existingReadOnly) {
+		_, err = rc.kubeClient.CoreV1().Secrets(target.Namespace).Update(secret)
+		if err != nil {
+			return fmt.Errorf("can't update Secret %s: %w", target, err)
+		}
+	}
+
+	// Workloads are reconciled even if the Secret didn't change so a failed rollout gets retried.
+	return rc.rolloutWorkloads(routeReadOnly, secret)
+}
+
+// syncSecretTargets syncs the Route certificate into Secrets in other namespaces that opted in
+// and removes the ones that are no longer wanted. It returns true if the Route was updated.
+func (rc *RouteController) syncSecretTargets(routeReadOnly *routev1.Route) (bool, error) {
+	targets, err := parseSecretTargets(routeReadOnly.Annotations[api.AcmeSecretTargetsAnnotation], routeReadOnly.Namespace)
+	if err != nil {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "InvalidSecretTargets", "Can't sync certificates into other namespaces: %v", err)
+		// Keep the existing Secrets until the annotation is fixed.
+		return false, nil
+	}
+
+	if len(targets) != 0 && !hasFinalizer(routeReadOnly, api.AcmeSecretSyncFinalizer) {
+		return true, rc.updateSecretSyncFinalizer(routeReadOnly, true)
+	}
+
+	if len(targets) == 0 && !hasFinalizer(routeReadOnly, api.AcmeSecretSyncFinalizer) {
+		return false, nil
+	}
+
+	synced, err := rc.syncedTargetSecrets(routeReadOnly)
+	if err != nil {
+		return false, err
+	}
+
+	routeWithCertificate, err := rc.routeWithCertificate(routeReadOnly)
+	if err != nil {
+		return false, err
+	}
+
+	existing := map[types.NamespacedName]*corev1.Secret{}
+	for _, secret := range synced {
+		existing[types.NamespacedName{Namespace: secret.Namespace, Name: secret.Name}] = secret
+	}
+
+	var errs []error
+	wanted := map[types.NamespacedName]bool{}
+	for _, target := range targets {
+		allowed, err := rc.isSecretSyncAllowed(target.Namespace)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't check namespace %q: %w", target.Namespace, err))
+			// Don't delete Secrets because of a transient error.
+			wanted[target] = true
+			continue
+		}
+
+		if !allowed {
+			rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "SecretSyncNotAllowed", "Can't sync certificates into Secret %s because namespace %q doesn't have label %s=true", target, target.Namespace, api.AcmeSecretSyncAllowedLabel)
+			continue
+		}
+		wanted[target] = true
+
+		if routeWithCertificate.Spec.TLS == nil || len(routeWithCertificate.Spec.TLS.Certificate) == 0 {
+			continue
+		}
+
+		existingSecret := existing[target]
+		if existingSecret == nil {
+			// The Secret might exist without our label.
+			s, err := rc.kubeClient.CoreV1().Secrets(target.Namespace).Get(target.Name, metav1.GetOptions{})
+			if err == nil {
+				rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "CollidingSecret", "Can't sync certificates for Route %s/%s into Secret %s because it already exists and isn't owned by the Route!", routeReadOnly.Namespace, routeReadOnly.Name, target)
+				errs = append(errs, fmt.Errorf("secret %s/%s already exists and isn't owned by us", s.Namespace, s.Name))
+				continue
+			}
+			if !kapierrors.IsNotFound(err) {
+				errs = append(errs, err)
+				continue
+			}
+		}
+
+		err = rc.ensureTargetSecret(routeWithCertificate, target, existingSecret)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var stale []types.NamespacedName
+	for key := range existing {
+		if !wanted[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].String() < stale[j].String()
+	})
+
+	for _, key := range stale {
+		klog.V(2).Infof("Deleting Secret %s synced from Route %s/%s because it's no longer a target", key, routeReadOnly.Namespace, routeReadOnly.Name)
+		err := rc.kubeClient.CoreV1().Secrets(key.Namespace).Delete(key.Name, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &existing[key].UID},
+		})
+		if err != nil && !kapierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("can't delete Secret %s: %w", key, err))
+		}
+	}
+
+	if len(errs) != 0 {
+		return false, apierrors.NewAggregate(errs)
+	}
+
+	if len(targets) == 0 {
+		return true, rc.updateSecretSyncFinalizer(routeReadOnly, false)
+	}
+
+	return false, nil
+}
+
+// finalizeSecretTargets deletes the Secrets synced into other namespaces and removes the finalizer so the Route can be deleted.
+func (rc *RouteController) finalizeSecretTargets(routeReadOnly *routev1.Route) error {
+	synced, err := rc.syncedTargetSecrets(routeReadOnly)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, secret := range synced {
+		klog.V(2).Infof("Deleting Secret %s/%s synced from Route %s/%s", secret.Namespace, secret.Name, routeReadOnly.Namespace, routeReadOnly.Name)
+		err := rc.kubeClient.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &secret.UID},
+		})
+		if err != nil && !kapierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("can't delete Secret %s/%s: %w", secret.Namespace, secret.Name, err))
+		}
+	}
+	if len(errs) != 0 {
+		return apierrors.NewAggregate(errs)
+	}
+
+	return rc.updateSecretSyncFinalizer(routeReadOnly, false)
+}
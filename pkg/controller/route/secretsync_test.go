@@ -0,0 +1,155 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestParseSecretTargets(t *testing.T) {
+	tt := []struct {
+		name        string
+		value       string
+		expected    []types.NamespacedName
+		expectedErr bool
+	}{
+		{
+			name:     "empty",
+			value:    "",
+			expected: nil,
+		},
+		{
+			name:  "multiple targets",
+			value: "mesh/foo-tls, backend/foo",
+			expected: []types.NamespacedName{
+				{Namespace: "mesh", Name: "foo-tls"},
+				{Namespace: "backend", Name: "foo"},
+			},
+		},
+		{
+			name:  "duplicates and empty items are skipped",
+			value: "mesh/foo,,mesh/foo,",
+			expected: []types.NamespacedName{
+				{Namespace: "mesh", Name: "foo"},
+			},
+		},
+		{
+			name:        "missing namespace",
+			value:       "foo",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid name",
+			value:       "mesh/Foo_Bar",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid namespace",
+			value:       "mesh.local/foo",
+			expectedErr: true,
+		},
+		{
+			name:        "route namespace",
+			value:       "test/foo",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSecretTargets(tc.value, "test")
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSecretSyncInformers(t *testing.T) {
+	secretSyncInformers := NewSecretSyncInformers(kubefake.NewSimpleClientset())
+	rc := &RouteController{
+		secretSyncInformers: secretSyncInformers,
+	}
+	rc.setUpSecretSyncInformers(secretSyncInformers)
+
+	syncedSecret := func(namespace, name, uid string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+				Labels: map[string]string{
+					api.AcmeSecretSourceRouteUIDLabel: uid,
+				},
+			},
+		}
+	}
+	secrets := []*corev1.Secret{
+		syncedSecret("b", "foo", "uid-foo"),
+		syncedSecret("a", "foo", "uid-foo"),
+		syncedSecret("a", "bar", "uid-bar"),
+	}
+	for _, secret := range secrets {
+		err := secretSyncInformers.Secrets.Core().V1().Secrets().Informer().GetIndexer().Add(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := secretSyncInformers.Namespaces.Core().V1().Namespaces().Informer().GetIndexer().Add(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "a",
+			Labels: map[string]string{
+				api.AcmeSecretSyncAllowedLabel: "true",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			UID:       "uid-foo",
+		},
+	}
+	got, err := rc.syncedTargetSecrets(route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*corev1.Secret{secrets[1], secrets[0]}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	for namespace, expected := range map[string]bool{
+		"a": true,
+		"b": false,
+	} {
+		allowed, err := rc.isSecretSyncAllowed(namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != expected {
+			t.Errorf("expected secret sync into namespace %q to be allowed: %t, got %t", namespace, expected, allowed)
+		}
+	}
+}
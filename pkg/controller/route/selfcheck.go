@@ -0,0 +1,207 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+)
+
+const (
+	DefaultSelfCheckRouterAddress = "router-internal-default.openshift-ingress.svc"
+	DefaultSelfCheckRetries       = 2
+	DefaultSelfCheckRetryInterval = 2 * time.Second
+
+	selfCheckReasonInvalidConfig = "InvalidConfig"
+	selfCheckReasonUnresolvable  = "Unresolvable"
+)
+
+// SelfCheckFailedError means the controller couldn't verify the http-01 token is reachable.
+type SelfCheckFailedError struct {
+	Reason  string
+	Message string
+}
+
+func (e *SelfCheckFailedError) Error() string {
+	return e.Message
+}
+
+// selfCheckTarget is a single request the token has to be served for.
+type selfCheckTarget struct {
+	url  string
+	host string
+}
+
+// selfCheckTargets returns the requests to check for the selfCheck mode.
+func selfCheckTargets(ctx context.Context, selfCheck *api.SelfCheck, domain, challengePath string) ([]selfCheckTarget, error) {
+	tokenURL := "http://" + domain + challengePath
+
+	switch selfCheck.Mode {
+	case "", api.SelfCheckModeDirect:
+		return []selfCheckTarget{{url: tokenURL}}, nil
+
+	case api.SelfCheckModeRouter:
+		address := selfCheck.RouterAddress
+		if len(address) == 0 {
+			address = DefaultSelfCheckRouterAddress
+		}
+		return []selfCheckTarget{{url: "http://" + address + challengePath, host: domain}}, nil
+
+	case api.SelfCheckModeResolver:
+		addresses := selfCheck.Addresses
+		if len(addresses) == 0 {
+			if len(selfCheck.Resolver) == 0 {
+				return nil, &SelfCheckFailedError{
+					Reason:  selfCheckReasonInvalidConfig,
+					Message: "self check mode Resolver needs either resolver or addresses",
+				}
+			}
+
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, selfCheck.Resolver)
+				},
+			}
+			var err error
+			addresses, err = resolver.LookupHost(ctx, domain)
+			if err != nil {
+				return nil, &SelfCheckFailedError{
+					Reason:  selfCheckReasonUnresolvable,
+					Message: fmt.Sprintf("can't resolve %q using resolver %q: %v", domain, selfCheck.Resolver, err),
+				}
+			}
+		}
+
+		var targets []selfCheckTarget
+		for _, address := range addresses {
+			_, _, err := net.SplitHostPort(address)
+			if err != nil {
+				address = net.JoinHostPort(address, "80")
+			}
+			targets = append(targets, selfCheckTarget{url: "http://" + address + challengePath, host: domain})
+		}
+		return targets, nil
+
+	case api.SelfCheckModeExternal:
+		if len(selfCheck.ProbeURL) == 0 {
+			return nil, &SelfCheckFailedError{
+				Reason:  selfCheckReasonInvalidConfig,
+				Message: "self check mode External needs probeURL",
+			}
+		}
+
+		probeURL, err := url.Parse(selfCheck.ProbeURL)
+		if err != nil {
+			return nil, &SelfCheckFailedError{
+				Reason:  selfCheckReasonInvalidConfig,
+				Message: fmt.Sprintf("invalid probeURL %q: %v", selfCheck.ProbeURL, err),
+			}
+		}
+		query := probeURL.Query()
+		query.Set("url", tokenURL)
+		probeURL.RawQuery = query.Encode()
+		return []selfCheckTarget{{url: probeURL.String()}}, nil
+
+	default:
+		return nil, &SelfCheckFailedError{
+			Reason:  selfCheckReasonInvalidConfig,
+			Message: fmt.Sprintf("invalid self check mode %q, supported values are %q, %q, %q, %q and %q", selfCheck.Mode, api.SelfCheckModeOff, api.SelfCheckModeDirect, api.SelfCheckModeRouter, api.SelfCheckModeResolver, api.SelfCheckModeExternal),
+		}
+	}
+}
+
+// selfCheckToken verifies the token is served for the domain the way the issuer configures, retrying failed checks.
+// It returns SelfCheckFailedError if the token isn't reachable.
+func selfCheckToken(ctx context.Context, selfCheck *api.SelfCheck, domain, challengePath, challengeResponse string) error {
+	if selfCheck == nil {
+		selfCheck = &api.SelfCheck{}
+	}
+
+	if selfCheck.Mode == api.SelfCheckModeOff {
+		return nil
+	}
+
+	retries := DefaultSelfCheckRetries
+	if selfCheck.Retries != nil {
+		retries = *selfCheck.Retries
+	}
+	retryInterval := DefaultSelfCheckRetryInterval
+	if selfCheck.RetryInterval != nil {
+		retryInterval = selfCheck.RetryInterval.Duration
+	}
+
+	targets, err := selfCheckTargets(ctx, selfCheck, domain, challengePath)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		for attempt := 0; ; attempt++ {
+			err = controllerutils.CheckExposedToken(ctx, target.url, target.host, challengeResponse)
+			if err == nil {
+				break
+			}
+
+			if attempt >= retries {
+				reason := controllerutils.TokenValidationReasonUnreachable
+				var tokenErr *controllerutils.TokenValidationError
+				if errors.As(err, &tokenErr) {
+					reason = tokenErr.Reason
+				}
+				return &SelfCheckFailedError{
+					Reason:  reason,
+					Message: fmt.Sprintf("self check of domain %q failed after %d attempt(s): %v", domain, attempt+1, err),
+				}
+			}
+
+			klog.V(4).Infof("Self check of domain %q failed, retrying in %v: %v", domain, retryInterval, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+
+	return nil
+}
+
+// reportSelfCheckFailed records why the challenge isn't accepted yet.
+func (rc *RouteController) reportSelfCheckFailed(routeReadOnly *routev1.Route, status *api.Status, failed *SelfCheckFailedError) {
+	klog.Infof("Can't self validate exposed token before accepting the challenge: %v", failed)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionSelfCheckFailed)
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != failed.Message {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "AcmeSelfCheckFailed", "Not accepting the challenge yet: %v", failed)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionSelfCheckFailed,
+		Status:  api.ConditionTrue,
+		Reason:  failed.Reason,
+		Message: failed.Message,
+	})
+}
+
+func clearSelfCheckFailed(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionSelfCheckFailed) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionSelfCheckFailed,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
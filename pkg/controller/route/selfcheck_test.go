@@ -0,0 +1,175 @@
+package route
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+)
+
+func TestSelfCheckToken(t *testing.T) {
+	const (
+		domain            = "foo.example.com"
+		challengePath     = "/.well-known/acme-challenge/token"
+		challengeResponse = "token.thumbprint"
+	)
+
+	intPtr := func(i int) *int {
+		return &i
+	}
+	noRetries := func(selfCheck *api.SelfCheck) *api.SelfCheck {
+		selfCheck.Retries = intPtr(0)
+		return selfCheck
+	}
+
+	// tokenServer serves the token only for requests with the domain in the Host header,
+	// failing the first failures requests.
+	tokenServer := func(failures int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.Host != domain || r.URL.Path != challengePath {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(challengeResponse))
+		}))
+	}
+
+	router := tokenServer(0)
+	defer router.Close()
+	routerAddress := strings.TrimPrefix(router.URL, "http://")
+
+	flakyRouter := tokenServer(1)
+	defer flakyRouter.Close()
+	flakyRouterAddress := strings.TrimPrefix(flakyRouter.URL, "http://")
+
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") != "http://"+domain+challengePath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(challengeResponse))
+	}))
+	defer probe.Close()
+	probeAddress := strings.TrimPrefix(probe.URL, "http://")
+
+	wrongContent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("unexpected"))
+	}))
+	defer wrongContent.Close()
+
+	tt := []struct {
+		name           string
+		selfCheck      *api.SelfCheck
+		expectedReason string
+	}{
+		{
+			name: "off",
+			selfCheck: &api.SelfCheck{
+				Mode: api.SelfCheckModeOff,
+			},
+			expectedReason: "",
+		},
+		{
+			name: "router",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode:          api.SelfCheckModeRouter,
+				RouterAddress: routerAddress,
+			}),
+			expectedReason: "",
+		},
+		{
+			name: "resolver with static addresses",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode:      api.SelfCheckModeResolver,
+				Addresses: []string{routerAddress},
+			}),
+			expectedReason: "",
+		},
+		{
+			name: "resolver with an address not serving the token",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode:      api.SelfCheckModeResolver,
+				Addresses: []string{routerAddress, probeAddress},
+			}),
+			expectedReason: controllerutils.TokenValidationReasonUnexpectedStatus,
+		},
+		{
+			name: "resolver without resolver and addresses",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode: api.SelfCheckModeResolver,
+			}),
+			expectedReason: selfCheckReasonInvalidConfig,
+		},
+		{
+			name: "external probe",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode:     api.SelfCheckModeExternal,
+				ProbeURL: probe.URL + "/check",
+			}),
+			expectedReason: "",
+		},
+		{
+			name: "external without probe URL",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode: api.SelfCheckModeExternal,
+			}),
+			expectedReason: selfCheckReasonInvalidConfig,
+		},
+		{
+			name: "wrong content",
+			selfCheck: noRetries(&api.SelfCheck{
+				Mode:     api.SelfCheckModeExternal,
+				ProbeURL: wrongContent.URL,
+			}),
+			expectedReason: controllerutils.TokenValidationReasonUnexpectedContent,
+		},
+		{
+			name: "unknown mode",
+			selfCheck: &api.SelfCheck{
+				Mode: "Magic",
+			},
+			expectedReason: selfCheckReasonInvalidConfig,
+		},
+		{
+			name: "retries recover from a transient failure",
+			selfCheck: &api.SelfCheck{
+				Mode:          api.SelfCheckModeRouter,
+				RouterAddress: flakyRouterAddress,
+				Retries:       intPtr(1),
+				RetryInterval: &metav1.Duration{Duration: time.Millisecond},
+			},
+			expectedReason: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := selfCheckToken(context.Background(), tc.selfCheck, domain, challengePath, challengeResponse)
+
+			var reason string
+			if err != nil {
+				var failed *SelfCheckFailedError
+				if !errors.As(err, &failed) {
+					t.Fatal(err)
+				}
+				reason = failed.Reason
+			}
+			if reason != tc.expectedReason {
+				t.Errorf("expected reason %q, got %q (%v)", tc.expectedReason, reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package route
+
+import (
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
+)
+
+// Settings are the controller defaults that can be changed at runtime without restarting the controller.
+type Settings struct {
+	CertOrderBackoffInitial  time.Duration
+	CertOrderBackoffMax      time.Duration
+	CertDefaultRSAKeyBitSize int
+	RenewalWindow            renewal.Window
+
+	ExposerImage string
+	// ExposerResources are the resource requirements of the exposer containers
+	// before they are adjusted to the LimitRanges in the namespace.
+	ExposerResources corev1.ResourceRequirements
+	// ExposerReplicas is the number of pods for every exposer. Zero means api.DefaultExposerReplicas.
+	ExposerReplicas int32
+	// ExposerPodTemplate is merged into the exposer pods, e.g. to set node selectors, tolerations,
+	// security contexts or image pull secrets. Resources set for the exposer container take precedence
+	// over ExposerResources.
+	ExposerPodTemplate *corev1.PodTemplateSpec
+
+	// DefaultTLS is the TLS config for Routes that don't have one unless the issuer or the Route override it.
+	DefaultTLS api.DefaultTLSConfig
+
+	// SelfCheck is used for issuers that don't configure the self-check. Nil means Direct mode.
+	SelfCheck *api.SelfCheck
+}
+
+func (rc *RouteController) getSettings() Settings {
+	rc.settingsMutex.RLock()
+	defer rc.settingsMutex.RUnlock()
+
+	return rc.settings
+}
+
+// SetSettings replaces the settings and requeues all Routes if they changed.
+func (rc *RouteController) SetSettings(settings Settings) {
+	rc.settingsMutex.Lock()
+	changed := !reflect.DeepEqual(rc.settings, settings)
+	rc.settings = settings
+	rc.settingsMutex.Unlock()
+
+	if !changed {
+		return
+	}
+
+	klog.Infof("Route controller settings changed")
+	// Renewal windows and TLS defaults apply to existing Routes and the shared exposer can change as well.
+	rc.enqueueAllRoutes()
+	rc.enqueueSharedExposer()
+}
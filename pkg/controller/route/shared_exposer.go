@@ -0,0 +1,534 @@
+package route
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+	"github.com/tnozicka/openshift-acme/pkg/httpserver"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+const (
+	// SharedExposerName is the name of the shared exposer Deployment, Service and Secret in the controller namespace.
+	SharedExposerName = "openshift-acme-exposer"
+
+	// SharedExposerReloadCheckInterval is the delay for rechecking that all shared exposer pods
+	// have reloaded the data. Kubelet propagates Secret changes into volumes without any events.
+	SharedExposerReloadCheckInterval = 5 * time.Second
+
+	// sharedExposerQueueKey is the only key used in the shared exposer queue as there is just one shared exposer.
+	sharedExposerQueueKey = "shared-exposer"
+)
+
+func (rc *RouteController) isSharedExposerObject(obj metav1.Object) bool {
+	return obj.GetNamespace() == rc.controllerNamespace && obj.GetName() == SharedExposerName
+}
+
+func isSharedExposerRoute(route *routev1.Route) bool {
+	if !util.IsTemporary(route) {
+		return false
+	}
+
+	_, ok := route.Annotations[api.AcmeExposerResponse]
+	return ok
+}
+
+func (rc *RouteController) enqueueSharedExposer() {
+	if rc.http01SolverMode != api.Http01SolverModeShared {
+		return
+	}
+
+	rc.sharedExposerQueue.Add(sharedExposerQueueKey)
+}
+
+// enqueueSharedExposerRoutes requeues all Routes that are using the shared exposer.
+func (rc *RouteController) enqueueSharedExposerRoutes() {
+	exposerRoutes, err := rc.routeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Route().V1().Routes().Lister().Routes(rc.controllerNamespace).List(labels.SelectorFromSet(labels.Set{
+		api.AcmeTemporaryLabel: "true",
+	}))
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("can't list shared exposer Routes: %w", err))
+		return
+	}
+
+	for _, exposerRoute := range exposerRoutes {
+		if !isSharedExposerRoute(exposerRoute) {
+			continue
+		}
+
+		rc.enqueueOwningRoute(exposerRoute)
+	}
+}
+
+// sharedExposerObjectChanged handles changes to the shared exposer Deployment, Service or Secret.
+func (rc *RouteController) sharedExposerObjectChanged(obj metav1.Object) {
+	klog.V(4).Infof("Shared exposer object %s/%s changed", obj.GetNamespace(), obj.GetName())
+	rc.enqueueSharedExposer()
+	rc.enqueueSharedExposerRoutes()
+}
+
+func (rc *RouteController) addDeployment(obj interface{}) {
+	deployment := obj.(*appsv1.Deployment)
+	if !rc.isSharedExposerObject(deployment) {
+		return
+	}
+
+	rc.sharedExposerObjectChanged(deployment)
+}
+
+func (rc *RouteController) updateDeployment(old, cur interface{}) {
+	deployment := cur.(*appsv1.Deployment)
+	if !rc.isSharedExposerObject(deployment) {
+		return
+	}
+
+	rc.sharedExposerObjectChanged(deployment)
+}
+
+func (rc *RouteController) deleteDeployment(obj interface{}) {
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("object is not a Deployment neither tombstone: %#v", obj))
+			return
+		}
+		deployment, ok = tombstone.Obj.(*appsv1.Deployment)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("tombstone contained object that is not a Deployment %#v", obj))
+			return
+		}
+	}
+
+	if !rc.isSharedExposerObject(deployment) {
+		return
+	}
+
+	rc.sharedExposerObjectChanged(deployment)
+}
+
+// sharedExposerLine scopes the response to the host so tokens for different hosts can't collide.
+func sharedExposerLine(host, path, response string) string {
+	return httpserver.NormalizeHost(host) + " " + path + " " + response
+}
+
+func hashData(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// ensureSharedExposer makes sure there is a temporary Route in the controller namespace exposing the challenge
+// response through the shared exposer. It returns true when the token is exposed.
+func (rc *RouteController) ensureSharedExposer(ctx context.Context, routeReadOnly *routev1.Route, key, id, tmpName, challengePath, challengeResponse string) (bool, error) {
+	/*
+	 * Route
+	 */
+	// Routes can only point to Services in their own namespace so the temporary Route has to live
+	// in the controller namespace. We can't use owner references across namespaces and the shared exposer
+	// sync garbage collects temporary Routes whose parent Route is gone.
+	parentCopy := routeReadOnly.DeepCopy()
+	filterOutAnnotations(parentCopy.Annotations)
+	filterOutLabels(parentCopy.Labels, parentCopy.Annotations)
+
+	desiredExposerRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        tmpName,
+			Namespace:   rc.controllerNamespace,
+			Labels:      parentCopy.Labels,
+			Annotations: parentCopy.Annotations,
+		},
+		Spec: *parentCopy.Spec.DeepCopy(),
+	}
+	if desiredExposerRoute.Annotations == nil {
+		desiredExposerRoute.Annotations = map[string]string{}
+	}
+	desiredExposerRoute.Annotations[api.AcmeExposerId] = id
+	desiredExposerRoute.Annotations[api.AcmeExposerKey] = key
+	desiredExposerRoute.Annotations[api.AcmeExposerResponse] = challengeResponse
+	if desiredExposerRoute.Labels == nil {
+		desiredExposerRoute.Labels = map[string]string{}
+	}
+	desiredExposerRoute.Labels[api.AcmeTemporaryLabel] = "true"
+	desiredExposerRoute.Labels[api.AcmeExposerUID] = string(routeReadOnly.UID)
+	desiredExposerRoute.Spec.Path = challengePath
+	desiredExposerRoute.Spec.Port = nil
+	desiredExposerRoute.Spec.TLS = &routev1.TLSConfig{
+		Termination:                   "edge",
+		InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyAllow,
+	}
+	desiredExposerRoute.Spec.To = routev1.RouteTargetReference{
+		Kind: "Service",
+		Name: SharedExposerName,
+	}
+	desiredExposerRoute.Spec.AlternateBackends = nil
+
+	exposerRoute, err := rc.routeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Route().V1().Routes().Lister().Routes(rc.controllerNamespace).Get(desiredExposerRoute.Name)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return false, err
+		}
+
+		klog.V(2).Infof("Shared exposer route %s/%s not found, creating new one.", rc.controllerNamespace, desiredExposerRoute.Name)
+
+		exposerRoute, err = rc.routeClient.RouteV1().Routes(rc.controllerNamespace).Create(desiredExposerRoute)
+		if err != nil {
+			return false, err
+		}
+		klog.V(2).Infof("Created shared exposer Route %s/%s for Route %s", exposerRoute.Namespace, exposerRoute.Name, key)
+	}
+
+	if exposerRoute.Labels[api.AcmeExposerUID] != string(routeReadOnly.UID) {
+		return false, fmt.Errorf("shared exposer Route %s/%s already exists and isn't owned by route %s", exposerRoute.Namespace, exposerRoute.Name, key)
+	}
+
+	// Check the id to avoid collisions
+	exposerRouteId, ok := exposerRoute.Annotations[api.AcmeExposerId]
+	if !ok {
+		return false, fmt.Errorf("shared exposer route %s/%s misses exposer id", exposerRoute.Namespace, exposerRoute.Name)
+	} else if exposerRouteId != id {
+		return false, fmt.Errorf("shared exposer route %s/%s id missmatch: expected %q, got %q", exposerRoute.Namespace, exposerRoute.Name, id, exposerRouteId)
+	}
+
+	admitted, err := checkExposerAdmission(routeReadOnly, exposerRoute)
+	if err != nil {
+		return false, err
+	}
+	if !admitted {
+		// We'll get requeued by the exposer Route event handlers.
+		klog.V(4).Infof("shared exposer Route %s/%s isn't admitted yet", exposerRoute.Namespace, exposerRoute.Name)
+		return false, nil
+	}
+
+	/*
+	 * Shared exposer
+	 */
+	// The shared exposer is reconciled asynchronously. We'll get requeued by its event handlers.
+	secret, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().Secrets().Lister().Secrets(rc.controllerNamespace).Get(SharedExposerName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			klog.V(4).Infof("shared exposer Secret %s/%s doesn't exist yet", rc.controllerNamespace, SharedExposerName)
+			return false, nil
+		}
+		return false, err
+	}
+
+	data := secret.Data[ExposerFileKey]
+	line := sharedExposerLine(routeReadOnly.Spec.Host, challengePath, challengeResponse)
+	found := false
+	for _, l := range strings.Split(string(data), "\n") {
+		if l == line {
+			found = true
+			break
+		}
+	}
+	if !found {
+		klog.V(4).Infof("shared exposer Secret %s/%s doesn't contain the token for Route %s yet", rc.controllerNamespace, SharedExposerName, key)
+		return false, nil
+	}
+
+	deployment, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Apps().V1().Deployments().Lister().Deployments(rc.controllerNamespace).Get(SharedExposerName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			klog.V(4).Infof("shared exposer Deployment %s/%s doesn't exist yet", rc.controllerNamespace, SharedExposerName)
+			return false, nil
+		}
+		return false, err
+	}
+
+	var replicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	if deployment.Status.ObservedGeneration < deployment.Generation ||
+		deployment.Status.UpdatedReplicas != replicas ||
+		deployment.Status.Replicas != replicas ||
+		deployment.Status.AvailableReplicas != replicas {
+		klog.V(4).Infof("shared exposer Deployment %s/%s isn't rolled out yet", deployment.Namespace, deployment.Name)
+		return false, nil
+	}
+
+	// The exposer reloads the data from the mounted Secret but kubelet propagates the changes with a delay.
+	// Every pod has to serve the token because we don't know which one the CA will hit.
+	pods, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().Pods().Lister().Pods(rc.controllerNamespace).List(labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels))
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || len(pod.Status.PodIP) == 0 || !isPodReady(pod) {
+			continue
+		}
+
+		url := "http://" + net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(ExposerContainerPort)) + challengePath
+		err = controllerutils.CheckExposedToken(ctx, url, routeReadOnly.Spec.Host, challengeResponse)
+		if err != nil {
+			klog.V(4).Infof("shared exposer pod %s/%s doesn't serve the token for Route %s yet: %v", pod.Namespace, pod.Name, key, err)
+			rc.queue.AddAfter(key, SharedExposerReloadCheckInterval)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// sharedExposerParentExists checks that the Route which created the temporary Route still exists.
+func (rc *RouteController) sharedExposerParentExists(exposerRoute *routev1.Route) (bool, error) {
+	parentKey := exposerRoute.Annotations[api.AcmeExposerKey]
+	namespace, name, err := cache.SplitMetaNamespaceKey(parentKey)
+	if err != nil {
+		return false, err
+	}
+
+	informers := rc.routeInformersForNamespaces.InformersForOrGlobal(namespace)
+	if informers == nil {
+		// We aren't watching the namespace and can't tell.
+		return true, nil
+	}
+
+	parent, err := informers.Route().V1().Routes().Lister().Routes(namespace).Get(name)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return string(parent.UID) == exposerRoute.Labels[api.AcmeExposerUID], nil
+}
+
+func (rc *RouteController) syncSharedExposer(ctx context.Context) error {
+	klog.V(4).Infof("Started syncing shared exposer")
+	defer func() {
+		klog.V(4).Infof("Finished syncing shared exposer")
+	}()
+
+	if rc.http01SolverMode != api.Http01SolverModeShared {
+		return nil
+	}
+
+	// Only the replica owning the shard of the shared exposer Deployment manages it.
+	if !rc.shards.Owns(rc.controllerNamespace + "/" + SharedExposerName) {
+		klog.V(4).Infof("Shared exposer belongs to a shard owned by another replica")
+		return nil
+	}
+
+	exposerRoutes, err := rc.routeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Route().V1().Routes().Lister().Routes(rc.controllerNamespace).List(labels.SelectorFromSet(labels.Set{
+		api.AcmeTemporaryLabel: "true",
+	}))
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, exposerRoute := range exposerRoutes {
+		if !isSharedExposerRoute(exposerRoute) || exposerRoute.DeletionTimestamp != nil {
+			continue
+		}
+
+		exists, err := rc.sharedExposerParentExists(exposerRoute)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			klog.V(2).Infof("Deleting shared exposer Route %s/%s because its parent Route is gone", exposerRoute.Namespace, exposerRoute.Name)
+			err = rc.routeClient.RouteV1().Routes(exposerRoute.Namespace).Delete(exposerRoute.Name, &metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &exposerRoute.UID},
+			})
+			if err != nil && !kapierrors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+
+		lines = append(lines, sharedExposerLine(exposerRoute.Spec.Host, exposerRoute.Spec.Path, exposerRoute.Annotations[api.AcmeExposerResponse]))
+	}
+	sort.Strings(lines)
+	data := []byte(strings.Join(lines, "\n"))
+
+	podLabels := map[string]string{
+		"app": SharedExposerName,
+	}
+
+	/*
+	 * Secret
+	 */
+	desiredSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   SharedExposerName,
+			Labels: podLabels,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			ExposerFileKey: data,
+		},
+	}
+	secret, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().Secrets().Lister().Secrets(rc.controllerNamespace).Get(SharedExposerName)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return err
+		}
+
+		_, err = rc.kubeClient.CoreV1().Secrets(rc.controllerNamespace).Create(desiredSecret)
+		if err != nil {
+			return fmt.Errorf("can't create shared exposer Secret %s/%s: %w", rc.controllerNamespace, desiredSecret.Name, err)
+		}
+	} else if string(secret.Data[ExposerFileKey]) != string(data) {
+		secret = secret.DeepCopy()
+		secret.Data = desiredSecret.Data
+		_, err = rc.kubeClient.CoreV1().Secrets(rc.controllerNamespace).Update(secret)
+		if err != nil {
+			return fmt.Errorf("can't update shared exposer Secret %s/%s: %w", rc.controllerNamespace, secret.Name, err)
+		}
+	}
+
+	/*
+	 * Service
+	 */
+	desiredService := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   SharedExposerName,
+			Labels: podLabels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: podLabels,
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       80,
+					TargetPort: intstr.FromInt(ExposerContainerPort),
+				},
+			},
+		},
+	}
+	_, err = rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().Services().Lister().Services(rc.controllerNamespace).Get(SharedExposerName)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return err
+		}
+
+		_, err = rc.kubeClient.CoreV1().Services(rc.controllerNamespace).Create(desiredService)
+		if err != nil {
+			return fmt.Errorf("can't create shared exposer Service %s/%s: %w", rc.controllerNamespace, desiredService.Name, err)
+		}
+	}
+
+	/*
+	 * Deployment
+	 */
+	replicas := rc.exposerReplicas()
+	desiredDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        SharedExposerName,
+			Labels:      podLabels,
+			Annotations: map[string]string{},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels,
+			},
+			Template: rc.exposerPodTemplate(podLabels, nil, SharedExposerName),
+		},
+	}
+
+	limitRanges, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Core().V1().LimitRanges().Lister().LimitRanges(rc.controllerNamespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	err = adjustPodResourceRequirements(&desiredDeployment.Spec.Template.Spec, limitRanges)
+	if err != nil {
+		return fmt.Errorf("can't adjust shared exposer resource requirements: %w", err)
+	}
+
+	specBytes, err := json.Marshal(desiredDeployment.Spec)
+	if err != nil {
+		return err
+	}
+	desiredDeployment.Annotations[api.AcmeExposerSpecHash] = hashData(specBytes)
+
+	deployment, err := rc.kubeInformersForNamespaces.InformersForOrGlobal(rc.controllerNamespace).Apps().V1().Deployments().Lister().Deployments(rc.controllerNamespace).Get(SharedExposerName)
+	if err != nil {
+		if !kapierrors.IsNotFound(err) {
+			return err
+		}
+
+		_, err = rc.kubeClient.AppsV1().Deployments(rc.controllerNamespace).Create(desiredDeployment)
+		if err != nil {
+			return fmt.Errorf("can't create shared exposer Deployment %s/%s: %w", rc.controllerNamespace, desiredDeployment.Name, err)
+		}
+
+		return nil
+	}
+
+	// Comparing the spec directly would always differ because of defaulting.
+	if deployment.Annotations[api.AcmeExposerSpecHash] != desiredDeployment.Annotations[api.AcmeExposerSpecHash] {
+		deployment = deployment.DeepCopy()
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[api.AcmeExposerSpecHash] = desiredDeployment.Annotations[api.AcmeExposerSpecHash]
+		deployment.Spec = desiredDeployment.Spec
+		_, err = rc.kubeClient.AppsV1().Deployments(rc.controllerNamespace).Update(deployment)
+		if err != nil {
+			return fmt.Errorf("can't update shared exposer Deployment %s/%s: %w", rc.controllerNamespace, deployment.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (rc *RouteController) processNextSharedExposerItem(ctx context.Context) bool {
+	key, quit := rc.sharedExposerQueue.Get()
+	if quit {
+		return false
+	}
+	defer rc.sharedExposerQueue.Done(key)
+
+	err := rc.syncSharedExposer(ctx)
+	if err == nil {
+		rc.sharedExposerQueue.Forget(key)
+		return true
+	}
+
+	utilruntime.HandleError(fmt.Errorf("%v failed with : %v", key, err))
+	rc.sharedExposerQueue.AddRateLimited(key)
+
+	return true
+}
+
+func (rc *RouteController) runSharedExposerWorker(ctx context.Context) {
+	for rc.processNextSharedExposerItem(ctx) {
+	}
+}
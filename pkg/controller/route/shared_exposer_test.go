@@ -0,0 +1,481 @@
+package route
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+const (
+	testControllerNamespace = "acme-controller"
+	testChallengePath       = "/.well-known/acme-challenge/token"
+	testChallengeResponse   = "token.thumbprint"
+)
+
+func newTestParentRoute(name string) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      name,
+			UID:       types.UID(name + "-uid"),
+			Annotations: map[string]string{
+				"kubernetes.io/tls-acme": "true",
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: name + ".example.com",
+		},
+	}
+}
+
+func newTestSharedExposerRoute(parent *routev1.Route, admitted bool) *routev1.Route {
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testControllerNamespace,
+			Name:      parent.Name + "-exposer",
+			Labels: map[string]string{
+				api.AcmeTemporaryLabel: "true",
+				api.AcmeExposerUID:     string(parent.UID),
+			},
+			Annotations: map[string]string{
+				api.AcmeExposerId:       "id",
+				api.AcmeExposerKey:      parent.Namespace + "/" + parent.Name,
+				api.AcmeExposerResponse: parent.Name + "." + testChallengeResponse,
+			},
+		},
+		Spec: routev1.RouteSpec{
+			Host: parent.Spec.Host,
+			Path: testChallengePath,
+		},
+	}
+	if admitted {
+		route.Status.Ingress = []routev1.RouteIngress{
+			{
+				Host:       parent.Spec.Host,
+				RouterName: "default",
+				Conditions: []routev1.RouteIngressCondition{
+					{
+						Type:   routev1.RouteAdmitted,
+						Status: corev1.ConditionTrue,
+					},
+				},
+			},
+		}
+	}
+	return route
+}
+
+func newTestSharedExposerSecret(lines ...string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testControllerNamespace,
+			Name:      SharedExposerName,
+		},
+		Data: map[string][]byte{
+			ExposerFileKey: []byte(strings.Join(lines, "\n")),
+		},
+	}
+}
+
+func newTestSharedExposerDeployment(availableReplicas int32) *appsv1.Deployment {
+	var replicas int32 = 2
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  testControllerNamespace,
+			Name:       SharedExposerName,
+			Generation: 1,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app": SharedExposerName,
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           replicas,
+			UpdatedReplicas:    replicas,
+			AvailableReplicas:  availableReplicas,
+		},
+	}
+}
+
+func newTestSharedExposerPod(name string, ready bool, terminating bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testControllerNamespace,
+			Name:      name,
+			Labels: map[string]string{
+				"app": SharedExposerName,
+			},
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.1",
+			Conditions: []corev1.PodCondition{
+				{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionFalse,
+				},
+			},
+		},
+	}
+	if ready {
+		pod.Status.Conditions[0].Status = corev1.ConditionTrue
+	}
+	if terminating {
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+	}
+	return pod
+}
+
+func TestEnsureSharedExposer(t *testing.T) {
+	parent := newTestParentRoute("foo")
+	tokenLine := sharedExposerLine(parent.Spec.Host, testChallengePath, parent.Name+"."+testChallengeResponse)
+
+	tt := []struct {
+		name            string
+		routes          []*routev1.Route
+		secrets         []*corev1.Secret
+		deployments     []*appsv1.Deployment
+		pods            []*corev1.Pod
+		expectedExposed bool
+		expectedErr     string
+		expectedCreate  bool
+	}{
+		{
+			name:            "creates the exposer Route",
+			expectedExposed: false,
+			expectedCreate:  true,
+		},
+		{
+			name: "fails for exposer Route owned by another Route",
+			routes: []*routev1.Route{
+				func() *routev1.Route {
+					r := newTestSharedExposerRoute(parent, true)
+					r.Labels[api.AcmeExposerUID] = "other-uid"
+					return r
+				}(),
+			},
+			expectedExposed: false,
+			expectedErr:     "already exists and isn't owned by route test/foo",
+		},
+		{
+			name:            "waits for the exposer Route to be admitted",
+			routes:          []*routev1.Route{newTestSharedExposerRoute(parent, false)},
+			expectedExposed: false,
+		},
+		{
+			name:            "waits for the shared Secret",
+			routes:          []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			expectedExposed: false,
+		},
+		{
+			name:            "waits for the token to be aggregated into the shared Secret",
+			routes:          []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			secrets:         []*corev1.Secret{newTestSharedExposerSecret("other.example.com /foo bar")},
+			deployments:     []*appsv1.Deployment{newTestSharedExposerDeployment(2)},
+			expectedExposed: false,
+		},
+		{
+			name:            "waits for the shared Deployment",
+			routes:          []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			secrets:         []*corev1.Secret{newTestSharedExposerSecret(tokenLine)},
+			expectedExposed: false,
+		},
+		{
+			name:            "waits for the shared Deployment to roll out",
+			routes:          []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			secrets:         []*corev1.Secret{newTestSharedExposerSecret(tokenLine)},
+			deployments:     []*appsv1.Deployment{newTestSharedExposerDeployment(1)},
+			expectedExposed: false,
+		},
+		{
+			name:        "waits for ready pods to serve the token",
+			routes:      []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			secrets:     []*corev1.Secret{newTestSharedExposerSecret(tokenLine)},
+			deployments: []*appsv1.Deployment{newTestSharedExposerDeployment(2)},
+			pods: []*corev1.Pod{
+				newTestSharedExposerPod("ready", true, false),
+			},
+			expectedExposed: false,
+		},
+		{
+			name:        "skips pods that aren't ready or are terminating",
+			routes:      []*routev1.Route{newTestSharedExposerRoute(parent, true)},
+			secrets:     []*corev1.Secret{newTestSharedExposerSecret("other.example.com /foo bar", tokenLine)},
+			deployments: []*appsv1.Deployment{newTestSharedExposerDeployment(2)},
+			pods: []*corev1.Pod{
+				newTestSharedExposerPod("unready", false, false),
+				newTestSharedExposerPod("terminating", true, true),
+			},
+			expectedExposed: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, _, routeClient, _ := newTestRouteController(t, append([]*routev1.Route{parent}, tc.routes...), tc.secrets)
+			rc.controllerNamespace = testControllerNamespace
+			rc.http01SolverMode = api.Http01SolverModeShared
+
+			informers := rc.kubeInformersForNamespaces.InformersFor("")
+			for _, d := range tc.deployments {
+				err := informers.Apps().V1().Deployments().Informer().GetIndexer().Add(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, p := range tc.pods {
+				err := informers.Core().V1().Pods().Informer().GetIndexer().Add(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The token check must be bound to the sync context so we never wait on a pod that hangs.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			exposed, err := rc.ensureSharedExposer(ctx, parent, "test/foo", "id", parent.Name+"-exposer", testChallengePath, parent.Name+"."+testChallengeResponse)
+			if len(tc.expectedErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if exposed != tc.expectedExposed {
+				t.Errorf("expected exposed %t, got %t", tc.expectedExposed, exposed)
+			}
+
+			var created *routev1.Route
+			for _, action := range routeClient.Actions() {
+				if action.GetVerb() == "create" && action.GetResource().Resource == "routes" {
+					created = action.(kubetesting.CreateAction).GetObject().(*routev1.Route)
+				}
+			}
+			if tc.expectedCreate != (created != nil) {
+				t.Fatalf("expected exposer Route created %t, got %#v", tc.expectedCreate, created)
+			}
+			if created != nil {
+				if created.Namespace != testControllerNamespace {
+					t.Errorf("expected exposer Route in namespace %q, got %q", testControllerNamespace, created.Namespace)
+				}
+				if !isSharedExposerRoute(created) {
+					t.Errorf("created Route isn't a shared exposer Route: %#v", created)
+				}
+				if created.Spec.To.Name != SharedExposerName {
+					t.Errorf("expected exposer Route to point to %q, got %q", SharedExposerName, created.Spec.To.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncSharedExposer(t *testing.T) {
+	foo := newTestParentRoute("foo")
+	bar := newTestParentRoute("bar")
+	gone := newTestParentRoute("gone")
+	fooLine := sharedExposerLine(foo.Spec.Host, testChallengePath, foo.Name+"."+testChallengeResponse)
+	barLine := sharedExposerLine(bar.Spec.Host, testChallengePath, bar.Name+"."+testChallengeResponse)
+
+	tt := []struct {
+		name            string
+		mode            api.Http01SolverMode
+		routes          []*routev1.Route
+		secrets         []*corev1.Secret
+		expectedData    *string
+		expectedActions []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "does nothing in PerChallenge mode",
+			mode:            api.Http01SolverModePerChallenge,
+			routes:          []*routev1.Route{foo, newTestSharedExposerRoute(foo, true)},
+			expectedActions: nil,
+		},
+		{
+			name: "aggregates tokens and creates the shared exposer",
+			mode: api.Http01SolverModeShared,
+			routes: []*routev1.Route{
+				foo,
+				bar,
+				newTestSharedExposerRoute(foo, true),
+				newTestSharedExposerRoute(bar, false),
+			},
+			expectedData: func() *string {
+				s := barLine + "\n" + fooLine
+				return &s
+			}(),
+			expectedActions: []string{"create secrets", "create services", "create deployments"},
+		},
+		{
+			name: "deletes exposer Routes whose parent is gone",
+			mode: api.Http01SolverModeShared,
+			routes: []*routev1.Route{
+				foo,
+				newTestSharedExposerRoute(foo, true),
+				newTestSharedExposerRoute(gone, true),
+			},
+			expectedData: func() *string {
+				s := fooLine
+				return &s
+			}(),
+			expectedActions: []string{"create secrets", "create services", "create deployments"},
+			expectedDeleted: []string{"gone-exposer"},
+		},
+		{
+			name: "updates stale tokens in the shared Secret",
+			mode: api.Http01SolverModeShared,
+			routes: []*routev1.Route{
+				foo,
+				newTestSharedExposerRoute(foo, true),
+			},
+			secrets: []*corev1.Secret{newTestSharedExposerSecret(barLine)},
+			expectedData: func() *string {
+				s := fooLine
+				return &s
+			}(),
+			expectedActions: []string{"update secrets", "create services", "create deployments"},
+		},
+		{
+			name: "keeps up to date shared Secret",
+			mode: api.Http01SolverModeShared,
+			routes: []*routev1.Route{
+				foo,
+				newTestSharedExposerRoute(foo, true),
+			},
+			secrets:         []*corev1.Secret{newTestSharedExposerSecret(fooLine)},
+			expectedActions: []string{"create services", "create deployments"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, kubeClient, routeClient, _ := newTestRouteController(t, tc.routes, tc.secrets)
+			rc.controllerNamespace = testControllerNamespace
+			rc.http01SolverMode = tc.mode
+			kubeClient.ClearActions()
+
+			err := rc.syncSharedExposer(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actions []string
+			var secret *corev1.Secret
+			var deployment *appsv1.Deployment
+			for _, action := range kubeClient.Actions() {
+				actions = append(actions, action.GetVerb()+" "+action.GetResource().Resource)
+				if action.GetNamespace() != testControllerNamespace {
+					t.Errorf("expected action in namespace %q, got %q", testControllerNamespace, action.GetNamespace())
+				}
+
+				switch a := action.(type) {
+				case kubetesting.CreateAction:
+					switch obj := a.GetObject().(type) {
+					case *corev1.Secret:
+						secret = obj
+					case *appsv1.Deployment:
+						deployment = obj
+					}
+				case kubetesting.UpdateAction:
+					if obj, ok := a.GetObject().(*corev1.Secret); ok {
+						secret = obj
+					}
+				}
+			}
+			if strings.Join(actions, ", ") != strings.Join(tc.expectedActions, ", ") {
+				t.Errorf("expected actions %q, got %q", tc.expectedActions, actions)
+			}
+
+			if tc.expectedData != nil {
+				if secret == nil {
+					t.Fatalf("expected shared Secret to be written")
+				}
+				got := string(secret.Data[ExposerFileKey])
+				if got != *tc.expectedData {
+					t.Errorf("expected shared Secret data %q, got %q", *tc.expectedData, got)
+				}
+			}
+
+			if deployment != nil {
+				if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != api.DefaultExposerReplicas {
+					t.Errorf("expected %d replicas, got %v", api.DefaultExposerReplicas, deployment.Spec.Replicas)
+				}
+				if len(deployment.Annotations[api.AcmeExposerSpecHash]) == 0 {
+					t.Errorf("expected shared Deployment to have the spec hash annotation")
+				}
+			}
+
+			var deleted []string
+			for _, action := range routeClient.Actions() {
+				if action.GetVerb() == "delete" {
+					deleted = append(deleted, action.(kubetesting.DeleteAction).GetName())
+				}
+			}
+			if strings.Join(deleted, ", ") != strings.Join(tc.expectedDeleted, ", ") {
+				t.Errorf("expected deleted Routes %q, got %q", tc.expectedDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestCleanupExposerObjects(t *testing.T) {
+	route := newTestParentRoute("foo")
+
+	tt := []struct {
+		name               string
+		mode               api.Http01SolverMode
+		expectedNamespaces []string
+	}{
+		{
+			name:               "PerChallenge mode cleans up the Route namespace only",
+			mode:               api.Http01SolverModePerChallenge,
+			expectedNamespaces: []string{"test"},
+		},
+		{
+			name:               "Shared mode cleans up the controller namespace too",
+			mode:               api.Http01SolverModeShared,
+			expectedNamespaces: []string{"test", testControllerNamespace},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, _, routeClient, _ := newTestRouteController(t, nil, nil)
+			rc.controllerNamespace = testControllerNamespace
+			rc.http01SolverMode = tc.mode
+
+			err := rc.CleanupExposerObjects(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var namespaces []string
+			for _, action := range routeClient.Actions() {
+				if action.GetVerb() != "delete-collection" {
+					t.Errorf("unexpected action %q", action.GetVerb())
+					continue
+				}
+				namespaces = append(namespaces, action.GetNamespace())
+			}
+			if strings.Join(namespaces, ", ") != strings.Join(tc.expectedNamespaces, ", ") {
+				t.Errorf("expected cleanup in namespaces %q, got %q", tc.expectedNamespaces, namespaces)
+			}
+		})
+	}
+}
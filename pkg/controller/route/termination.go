@@ -0,0 +1,280 @@
+package route
+
+import (
+	"fmt"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/cert"
+	"github.com/tnozicka/openshift-acme/pkg/controllerutils"
+)
+
+func isPassthrough(route *routev1.Route) bool {
+	return route.Spec.TLS != nil && route.Spec.TLS.Termination == routev1.TLSTerminationPassthrough
+}
+
+// defaultTLSConfig returns the TLS config for Routes that don't have one when neither the issuer nor the Route override it.
+func defaultTLSConfig() *routev1.TLSConfig {
+	return &routev1.TLSConfig{
+		Termination:                   routev1.TLSTerminationEdge,
+		InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+	}
+}
+
+// overrideTLSConfig returns a copy of the TLS config with the non-empty values set.
+func overrideTLSConfig(tls *routev1.TLSConfig, termination, insecureEdgeTerminationPolicy string) (*routev1.TLSConfig, error) {
+	res := tls.DeepCopy()
+
+	if len(termination) != 0 {
+		switch t := routev1.TLSTerminationType(termination); t {
+		case routev1.TLSTerminationEdge, routev1.TLSTerminationReencrypt, routev1.TLSTerminationPassthrough:
+			res.Termination = t
+		default:
+			return nil, fmt.Errorf("unsupported termination %q", termination)
+		}
+	}
+
+	if len(insecureEdgeTerminationPolicy) != 0 {
+		switch p := routev1.InsecureEdgeTerminationPolicyType(insecureEdgeTerminationPolicy); p {
+		case routev1.InsecureEdgeTerminationPolicyNone, routev1.InsecureEdgeTerminationPolicyAllow, routev1.InsecureEdgeTerminationPolicyRedirect:
+			res.InsecureEdgeTerminationPolicy = p
+		default:
+			return nil, fmt.Errorf("unsupported insecure edge termination policy %q", insecureEdgeTerminationPolicy)
+		}
+	}
+
+	if res.Termination == routev1.TLSTerminationPassthrough && res.InsecureEdgeTerminationPolicy == routev1.InsecureEdgeTerminationPolicyAllow {
+		return nil, fmt.Errorf("insecure edge termination policy %q isn't supported with %q termination", res.InsecureEdgeTerminationPolicy, res.Termination)
+	}
+
+	return res, nil
+}
+
+// defaultTLSConfigForRoute returns the TLS config for a Route that doesn't have one from the Route annotations,
+// falling back to the issuer and the controller defaults.
+func (rc *RouteController) defaultTLSConfigForRoute(route *routev1.Route) *routev1.TLSConfig {
+	tls := defaultTLSConfig()
+
+	settings := rc.getSettings()
+	controllerTLS, err := overrideTLSConfig(tls, settings.DefaultTLS.Termination, settings.DefaultTLS.InsecureEdgeTerminationPolicy)
+	if err != nil {
+		klog.Errorf("Ignoring invalid default TLS config: %v", err)
+	} else {
+		tls = controllerTLS
+	}
+
+	certIssuer, _, err := controllerutils.IssuerForObject(route.ObjectMeta, rc.controllerNamespace, rc.kubeInformersForNamespaces)
+	if err != nil {
+		klog.V(4).Infof("Can't determine default TLS config from issuer for Route %s/%s: %v", route.Namespace, route.Name, err)
+	} else if certIssuer.DefaultTLS != nil {
+		issuerTLS, err := overrideTLSConfig(tls, certIssuer.DefaultTLS.Termination, certIssuer.DefaultTLS.InsecureEdgeTerminationPolicy)
+		if err != nil {
+			rc.recorder.Eventf(route, corev1.EventTypeWarning, "AcmeInvalidTLSDefaults", "Ignoring default TLS config from issuer: %v", err)
+		} else {
+			tls = issuerTLS
+		}
+	}
+
+	routeTLS, err := overrideTLSConfig(tls, route.Annotations[api.AcmeTerminationAnnotation], route.Annotations[api.AcmeInsecureEdgeTerminationPolicyAnnotation])
+	if err != nil {
+		rc.recorder.Eventf(route, corev1.EventTypeWarning, "AcmeInvalidTLSDefaults", "Ignoring default TLS config from annotations: %v", err)
+	} else {
+		tls = routeTLS
+	}
+
+	return tls
+}
+
+// passthroughSecretName returns the name of the Secret holding the certificate for a passthrough Route.
+// Until the secret sync worker moves the certificate after a rename it stays in the previously synced Secret.
+func passthroughSecretName(route *routev1.Route) string {
+	secretName := syncedSecretName(route)
+	if len(secretName) == 0 {
+		secretName, _ = GetSyncSecretName(route)
+	}
+	return secretName
+}
+
+// SecretGetter gets a Secret either from a cache or from the API server.
+type SecretGetter func(namespace, name string) (*corev1.Secret, error)
+
+// routeWithCertificate returns the Route with the certificate and key it is serving.
+// The returned Route must never be written back.
+func (rc *RouteController) routeWithCertificate(route *routev1.Route) (*routev1.Route, error) {
+	return RouteWithCertificate(route, func(namespace, name string) (*corev1.Secret, error) {
+		kubeInformers, err := rc.kubeInformersFor(namespace)
+		if err != nil {
+			return nil, err
+		}
+		return kubeInformers.Core().V1().Secrets().Lister().Secrets(namespace).Get(name)
+	})
+}
+
+// RouteWithCertificate returns the Route with the certificate and key it is serving.
+// The router ignores certificates on passthrough Routes, so for those they are taken from the synced Secret instead.
+// The returned Route must never be written back.
+func RouteWithCertificate(route *routev1.Route, getSecret SecretGetter) (*routev1.Route, error) {
+	if !isPassthrough(route) {
+		return route, nil
+	}
+
+	secretName := passthroughSecretName(route)
+	secret, err := getSecret(route.Namespace, secretName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return route, nil
+		}
+		return nil, fmt.Errorf("can't get Secret %s/%s: %w", route.Namespace, secretName, err)
+	}
+
+	// Don't trust certificates we haven't put there.
+	controllerRef := metav1.GetControllerOf(secret)
+	if controllerRef == nil || controllerRef.UID != route.UID {
+		return route, nil
+	}
+
+	res := route.DeepCopy()
+	res.Spec.TLS.Certificate = string(secret.Data[corev1.TLSCertKey])
+	res.Spec.TLS.Key = string(secret.Data[corev1.TLSPrivateKeyKey])
+	return res, nil
+}
+
+// SecretCollisionError is returned when the Secret the certificate has to be stored in
+// already exists and isn't owned by the Route.
+type SecretCollisionError struct {
+	Namespace string
+	Name      string
+}
+
+func (e *SecretCollisionError) Error() string {
+	return fmt.Sprintf("secret %s/%s already exists and isn't owned by the Route", e.Namespace, e.Name)
+}
+
+// checkSecretOwner returns SecretCollisionError unless the Secret is controlled by the Route.
+func (rc *RouteController) checkSecretOwner(route *routev1.Route, secret *corev1.Secret) error {
+	controllerRef := metav1.GetControllerOf(secret)
+	if controllerRef != nil {
+		owningRoute := rc.resolveControllerRef(route.Namespace, controllerRef)
+		if owningRoute != nil && owningRoute.UID == route.UID {
+			return nil
+		}
+	}
+
+	return &SecretCollisionError{
+		Namespace: secret.Namespace,
+		Name:      secret.Name,
+	}
+}
+
+// checkCertificateSecret returns SecretCollisionError if the certificate for a passthrough Route
+// couldn't be stored in its Secret.
+func (rc *RouteController) checkCertificateSecret(route *routev1.Route) error {
+	tls := route.Spec.TLS
+	if tls == nil {
+		tls = rc.defaultTLSConfigForRoute(route)
+	}
+	if tls.Termination != routev1.TLSTerminationPassthrough {
+		return nil
+	}
+
+	routeWithTLS := route.DeepCopy()
+	routeWithTLS.Spec.TLS = tls
+	secretName, _ := GetSyncSecretName(routeWithTLS)
+
+	kubeInformers, err := rc.kubeInformersFor(route.Namespace)
+	if err != nil {
+		return err
+	}
+
+	secret, err := kubeInformers.Core().V1().Secrets().Lister().Secrets(route.Namespace).Get(secretName)
+	if err != nil {
+		if kapierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("can't get Secret %s/%s: %w", route.Namespace, secretName, err)
+	}
+
+	return rc.checkSecretOwner(route, secret)
+}
+
+// blockBySecretCollision reports the Route as blocked by a colliding Secret and checks again later,
+// as we don't get events for Secrets the Route doesn't own.
+// It doesn't count as a failed order because we haven't created any.
+func (rc *RouteController) blockBySecretCollision(routeReadOnly *routev1.Route, key string, status *api.Status, collision *SecretCollisionError) error {
+	klog.V(2).Infof("Route %q is blocked by a colliding Secret: %v", key, collision)
+
+	condition := api.FindCondition(status.Conditions, api.ConditionSecretCollision)
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != collision.Error() {
+		rc.recorder.Eventf(routeReadOnly, corev1.EventTypeWarning, "CollidingSecret", "Not creating order: %v", collision)
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:    api.ConditionSecretCollision,
+		Status:  api.ConditionTrue,
+		Reason:  "SecretCollision",
+		Message: collision.Error(),
+	})
+
+	rc.acmePollRateLimiter.Forget(key)
+	rc.queue.AddAfter(key, rc.getSettings().CertOrderBackoffInitial)
+
+	return rc.updateStatus(routeReadOnly, status)
+}
+
+func clearSecretCollision(status *api.Status) {
+	if api.FindCondition(status.Conditions, api.ConditionSecretCollision) == nil {
+		return
+	}
+
+	api.SetCondition(&status.Conditions, api.Condition{
+		Type:   api.ConditionSecretCollision,
+		Status: api.ConditionFalse,
+		Reason: "AsExpected",
+	})
+}
+
+// setCertificate puts the new certificate where the Route serves it from.
+func (rc *RouteController) setCertificate(route *routev1.Route, status *api.Status, certPemData *cert.CertPemData) error {
+	if route.Spec.TLS == nil {
+		route.Spec.TLS = rc.defaultTLSConfigForRoute(route)
+	}
+
+	if isPassthrough(route) {
+		return rc.issueIntoSecret(route, status, certPemData)
+	}
+
+	// Only the certificate is ours, e.g. destinationCACertificate of reencrypt Routes has to stay intact.
+	route.Spec.TLS.Key = string(certPemData.Key)
+	route.Spec.TLS.Certificate = string(certPemData.Crt)
+
+	return nil
+}
+
+// issueIntoSecret stores the new certificate for a passthrough Route in the synced Secret, leaving spec.tls untouched,
+// and records the Secret name in the status.
+func (rc *RouteController) issueIntoSecret(route *routev1.Route, status *api.Status, certPemData *cert.CertPemData) error {
+	secretName, _ := GetSyncSecretName(route)
+
+	routeWithCertificate := route.DeepCopy()
+	routeWithCertificate.Spec.TLS.Key = string(certPemData.Key)
+	routeWithCertificate.Spec.TLS.Certificate = string(certPemData.Crt)
+	err := rc.syncSecret(routeWithCertificate, secretName)
+	if err != nil {
+		return fmt.Errorf("can't store certificate for passthrough Route %s/%s: %w", route.Namespace, route.Name, err)
+	}
+
+	if len(status.SyncedSecretName) != 0 && status.SyncedSecretName != secretName {
+		err = rc.deleteSyncedSecret(route, status.SyncedSecretName)
+		if err != nil {
+			return err
+		}
+	}
+	status.SyncedSecretName = secretName
+
+	return nil
+}
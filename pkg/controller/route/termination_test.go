@@ -0,0 +1,403 @@
+package route
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/cert"
+)
+
+func TestOverrideTLSConfig(t *testing.T) {
+	tt := []struct {
+		name           string
+		termination    string
+		insecurePolicy string
+		expected       *routev1.TLSConfig
+		expectedErr    bool
+	}{
+		{
+			name:     "no override",
+			expected: defaultTLSConfig(),
+		},
+		{
+			name:           "reencrypt without insecure traffic",
+			termination:    "reencrypt",
+			insecurePolicy: "None",
+			expected: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationReencrypt,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyNone,
+			},
+		},
+		{
+			name:        "passthrough keeps redirect",
+			termination: "passthrough",
+			expected: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationPassthrough,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+			},
+		},
+		{
+			name:           "passthrough doesn't support allowing insecure traffic",
+			termination:    "passthrough",
+			insecurePolicy: "Allow",
+			expectedErr:    true,
+		},
+		{
+			name:        "unsupported termination",
+			termination: "bogus",
+			expectedErr: true,
+		},
+		{
+			name:           "unsupported insecure policy",
+			insecurePolicy: "redirect",
+			expectedErr:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := overrideTLSConfig(defaultTLSConfig(), tc.termination, tc.insecurePolicy)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestSetCertificate(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+	certPemData := &cert.CertPemData{
+		Crt: []byte(crt),
+		Key: []byte(key),
+	}
+
+	newRoute := func(tls *routev1.TLSConfig, annotations map[string]string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "test",
+				Name:        "foo",
+				UID:         "foo-uid",
+				Annotations: annotations,
+			},
+			Spec: routev1.RouteSpec{
+				Host: "foo.example.com",
+				TLS:  tls,
+			},
+		}
+	}
+
+	previousSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "previous-tls",
+			UID:       "previous-tls-uid",
+		},
+	}
+	previousSecret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(newRoute(nil, nil), controllerKind)}
+
+	tt := []struct {
+		name                     string
+		route                    *routev1.Route
+		status                   *api.Status
+		secrets                  []*corev1.Secret
+		expectedTLS              *routev1.TLSConfig
+		expectedSecrets          []string
+		expectedSyncedSecretName string
+		expectedEvents           int
+	}{
+		{
+			name:   "new TLS config defaults to edge termination",
+			route:  newRoute(nil, nil),
+			status: &api.Status{},
+			expectedTLS: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationEdge,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+				Certificate:                   crt,
+				Key:                           key,
+			},
+		},
+		{
+			name: "invalid annotation falls back to the defaults",
+			route: newRoute(nil, map[string]string{
+				api.AcmeTerminationAnnotation: "bogus",
+			}),
+			status: &api.Status{},
+			expectedTLS: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationEdge,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyRedirect,
+				Certificate:                   crt,
+				Key:                           key,
+			},
+			expectedEvents: 1,
+		},
+		{
+			name: "reencrypt keeps the destination CA",
+			route: newRoute(&routev1.TLSConfig{
+				Termination:              routev1.TLSTerminationReencrypt,
+				DestinationCACertificate: "destination CA",
+			}, nil),
+			status: &api.Status{},
+			expectedTLS: &routev1.TLSConfig{
+				Termination:              routev1.TLSTerminationReencrypt,
+				DestinationCACertificate: "destination CA",
+				Certificate:              crt,
+				Key:                      key,
+			},
+		},
+		{
+			name: "new passthrough TLS config by annotation issues into Secret",
+			route: newRoute(nil, map[string]string{
+				api.AcmeTerminationAnnotation:                   "passthrough",
+				api.AcmeInsecureEdgeTerminationPolicyAnnotation: "None",
+			}),
+			status: &api.Status{},
+			expectedTLS: &routev1.TLSConfig{
+				Termination:                   routev1.TLSTerminationPassthrough,
+				InsecureEdgeTerminationPolicy: routev1.InsecureEdgeTerminationPolicyNone,
+			},
+			expectedSecrets:          []string{"foo"},
+			expectedSyncedSecretName: "foo",
+		},
+		{
+			name: "passthrough issues into the named Secret and deletes the previous one",
+			route: newRoute(&routev1.TLSConfig{
+				Termination: routev1.TLSTerminationPassthrough,
+			}, map[string]string{
+				api.AcmeSecretName: "foo-tls",
+			}),
+			status:  &api.Status{SyncedSecretName: "previous-tls"},
+			secrets: []*corev1.Secret{previousSecret},
+			expectedTLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationPassthrough,
+			},
+			expectedSecrets:          []string{"foo-tls"},
+			expectedSyncedSecretName: "foo-tls",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, kubeClient, _, recorder := newTestRouteController(t, []*routev1.Route{tc.route}, tc.secrets)
+
+			route := tc.route.DeepCopy()
+			err := rc.setCertificate(route, tc.status, certPemData)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(route.Spec.TLS, tc.expectedTLS) {
+				t.Errorf("expected TLS config %#v, got %#v", tc.expectedTLS, route.Spec.TLS)
+			}
+
+			if tc.status.SyncedSecretName != tc.expectedSyncedSecretName {
+				t.Errorf("expected synced Secret name %q, got %q", tc.expectedSyncedSecretName, tc.status.SyncedSecretName)
+			}
+
+			secretList, err := kubeClient.CoreV1().Secrets("test").List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var secrets []string
+			for _, s := range secretList.Items {
+				secrets = append(secrets, s.Name)
+				if string(s.Data[corev1.TLSCertKey]) != crt {
+					t.Errorf("expected Secret %q to contain the new certificate", s.Name)
+				}
+			}
+			if !reflect.DeepEqual(secrets, tc.expectedSecrets) {
+				t.Errorf("expected Secrets %q, got %q", tc.expectedSecrets, secrets)
+			}
+
+			if len(recorder.Events) != tc.expectedEvents {
+				t.Errorf("expected %d event(s), got %d", tc.expectedEvents, len(recorder.Events))
+			}
+		})
+	}
+}
+
+func TestRouteWithCertificate(t *testing.T) {
+	now := time.Now()
+	crt, key := newTestCertificatePEM(t, now.Add(-time.Hour), now.Add(time.Hour), "foo.example.com")
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "foo",
+			UID:       "foo-uid",
+		},
+		Spec: routev1.RouteSpec{
+			Host: "foo.example.com",
+			TLS: &routev1.TLSConfig{
+				Termination: routev1.TLSTerminationPassthrough,
+			},
+		},
+	}
+
+	newSecret := func(owner *routev1.Route) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      "foo",
+			},
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       []byte(crt),
+				corev1.TLSPrivateKeyKey: []byte(key),
+			},
+		}
+		if owner != nil {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, controllerKind)}
+		}
+		return secret
+	}
+
+	tt := []struct {
+		name                string
+		secrets             []*corev1.Secret
+		expectedCertificate string
+	}{
+		{
+			name:                "no Secret",
+			expectedCertificate: "",
+		},
+		{
+			name:                "Secret owned by the Route",
+			secrets:             []*corev1.Secret{newSecret(route)},
+			expectedCertificate: crt,
+		},
+		{
+			name:                "Secret not owned by the Route",
+			secrets:             []*corev1.Secret{newSecret(nil)},
+			expectedCertificate: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, _, _, _ := newTestRouteController(t, []*routev1.Route{route}, tc.secrets)
+
+			got, err := rc.routeWithCertificate(route)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Spec.TLS.Certificate != tc.expectedCertificate {
+				t.Errorf("expected certificate %q, got %q", tc.expectedCertificate, got.Spec.TLS.Certificate)
+			}
+
+			if len(route.Spec.TLS.Certificate) != 0 {
+				t.Errorf("the Route must not be modified")
+			}
+		})
+	}
+}
+
+func TestCheckCertificateSecret(t *testing.T) {
+	newRoute := func(termination routev1.TLSTerminationType, annotations map[string]string) *routev1.Route {
+		return &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "test",
+				Name:        "foo",
+				UID:         "foo-uid",
+				Annotations: annotations,
+			},
+			Spec: routev1.RouteSpec{
+				Host: "foo.example.com",
+				TLS: &routev1.TLSConfig{
+					Termination: termination,
+				},
+			},
+		}
+	}
+	otherRoute := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "bar",
+			UID:       "bar-uid",
+		},
+	}
+
+	newSecret := func(name string, owner *routev1.Route) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "test",
+				Name:      name,
+			},
+		}
+		if owner != nil {
+			secret.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(owner, controllerKind)}
+		}
+		return secret
+	}
+
+	tt := []struct {
+		name              string
+		route             *routev1.Route
+		secrets           []*corev1.Secret
+		expectedCollision bool
+	}{
+		{
+			name:              "edge Route doesn't need a Secret",
+			route:             newRoute(routev1.TLSTerminationEdge, nil),
+			secrets:           []*corev1.Secret{newSecret("foo", nil)},
+			expectedCollision: false,
+		},
+		{
+			name:              "passthrough Route without Secret",
+			route:             newRoute(routev1.TLSTerminationPassthrough, nil),
+			expectedCollision: false,
+		},
+		{
+			name:              "passthrough Route owning the Secret",
+			route:             newRoute(routev1.TLSTerminationPassthrough, nil),
+			secrets:           []*corev1.Secret{newSecret("foo", newRoute(routev1.TLSTerminationPassthrough, nil))},
+			expectedCollision: false,
+		},
+		{
+			name:              "passthrough Route with Secret without owner",
+			route:             newRoute(routev1.TLSTerminationPassthrough, nil),
+			secrets:           []*corev1.Secret{newSecret("foo", nil)},
+			expectedCollision: true,
+		},
+		{
+			name: "passthrough Route with named Secret owned by other Route",
+			route: newRoute(routev1.TLSTerminationPassthrough, map[string]string{
+				api.AcmeSecretName: "shared",
+			}),
+			secrets:           []*corev1.Secret{newSecret("shared", otherRoute)},
+			expectedCollision: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, _, _, _ := newTestRouteController(t, []*routev1.Route{tc.route, otherRoute}, tc.secrets)
+
+			err := rc.checkCertificateSecret(tc.route)
+			var collision *SecretCollisionError
+			if errors.As(err, &collision) != tc.expectedCollision {
+				t.Errorf("expected collision %t, got error %v", tc.expectedCollision, err)
+			}
+			if !tc.expectedCollision && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package route
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	kvalidation "k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	"github.com/tnozicka/openshift-acme/pkg/renewal"
+)
+
+var annotationsPath = field.NewPath("metadata", "annotations")
+
+func validateName(value string, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, msg := range kvalidation.IsDNS1123Subdomain(value) {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, msg))
+	}
+	return allErrs
+}
+
+func validateRegex(value string, fldPath *field.Path) field.ErrorList {
+	_, err := regexp.Compile(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	return nil
+}
+
+func validateThreshold(value string, fldPath *field.Path) field.ErrorList {
+	_, err := renewal.ParseThreshold(value)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	return nil
+}
+
+// ValidateRoute validates the ACME annotations of a managed Route the same way the controller parses them.
+func ValidateRoute(route *routev1.Route) field.ErrorList {
+	var allErrs field.ErrorList
+	annotations := route.Annotations
+
+	if v, ok := annotations[api.AcmeSecretName]; ok && len(v) != 0 {
+		allErrs = append(allErrs, validateName(v, annotationsPath.Key(api.AcmeSecretName))...)
+	}
+
+	if v, ok := annotations[api.AcmeCertIssuerName]; ok && len(v) != 0 {
+		allErrs = append(allErrs, validateName(v, annotationsPath.Key(api.AcmeCertIssuerName))...)
+	}
+
+	for _, key := range []string{api.AcmeExposerHttpFilterOutAnnotationsAnnotation, api.AcmeExposerHttpFilterOutLabelsAnnotation} {
+		if v, ok := annotations[key]; ok && len(v) != 0 {
+			allErrs = append(allErrs, validateRegex(v, annotationsPath.Key(key))...)
+		}
+	}
+
+	if v, ok := annotations[api.AcmeRevocationPolicyAnnotation]; ok {
+		_, err := parseRevocationPolicy(v)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(api.AcmeRevocationPolicyAnnotation), v, err.Error()))
+		}
+	}
+
+	for _, key := range []string{api.AcmeRenewBeforeAnnotation, api.AcmeProactiveRenewBeforeAnnotation} {
+		if v, ok := annotations[key]; ok && len(v) != 0 {
+			allErrs = append(allErrs, validateThreshold(v, annotationsPath.Key(key))...)
+		}
+	}
+
+	termination := annotations[api.AcmeTerminationAnnotation]
+	insecureEdgeTerminationPolicy := annotations[api.AcmeInsecureEdgeTerminationPolicyAnnotation]
+	_, err := overrideTLSConfig(defaultTLSConfig(), termination, insecureEdgeTerminationPolicy)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(annotationsPath.Key(api.AcmeTerminationAnnotation), termination, err.Error()))
+	}
+
+	if v, ok := annotations[api.AcmeSecretFormatsAnnotation]; ok {
+		formats, err := parseSecretFormats(v)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(api.AcmeSecretFormatsAnnotation), v, err.Error()))
+		} else if needsKeystorePassword(formats) && len(annotations[api.AcmeKeystorePasswordSecretAnnotation]) == 0 {
+			allErrs = append(allErrs, field.Required(annotationsPath.Key(api.AcmeKeystorePasswordSecretAnnotation), "keystore formats need a Secret with the password"))
+		}
+	}
+
+	if v, ok := annotations[api.AcmeKeystorePasswordSecretAnnotation]; ok && len(v) != 0 {
+		allErrs = append(allErrs, validateName(v, annotationsPath.Key(api.AcmeKeystorePasswordSecretAnnotation))...)
+	}
+
+	if v, ok := annotations[api.AcmeSecretTargetsAnnotation]; ok {
+		_, err := parseSecretTargets(v, route.Namespace)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(api.AcmeSecretTargetsAnnotation), v, err.Error()))
+		}
+	}
+
+	// Only "true" enables these so other values strconv.ParseBool accepts, like "1" or "True", would be misleading.
+	for _, key := range []string{api.AcmePausedAnnotation, api.AcmeSkipRevocationAnnotation} {
+		if v, ok := annotations[key]; ok {
+			if v != "true" && v != "false" {
+				allErrs = append(allErrs, field.Invalid(annotationsPath.Key(key), v, "must be \"true\" or \"false\""))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateSelfCheck validates the self-check settings of an issuer or the controller defaults.
+func ValidateSelfCheck(selfCheck *api.SelfCheck, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch selfCheck.Mode {
+	case "", api.SelfCheckModeOff, api.SelfCheckModeDirect, api.SelfCheckModeRouter:
+		break
+	case api.SelfCheckModeResolver:
+		if len(selfCheck.Resolver) == 0 && len(selfCheck.Addresses) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("resolver"), "either resolver or addresses are required in Resolver mode"))
+		}
+	case api.SelfCheckModeExternal:
+		if len(selfCheck.ProbeURL) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("probeURL"), "probeURL is required in External mode"))
+		} else {
+			_, err := url.Parse(selfCheck.ProbeURL)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Child("probeURL"), selfCheck.ProbeURL, err.Error()))
+			}
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("mode"), selfCheck.Mode, []string{
+			string(api.SelfCheckModeOff),
+			string(api.SelfCheckModeDirect),
+			string(api.SelfCheckModeRouter),
+			string(api.SelfCheckModeResolver),
+			string(api.SelfCheckModeExternal),
+		}))
+	}
+
+	if selfCheck.Retries != nil && *selfCheck.Retries < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retries"), *selfCheck.Retries, "must be non-negative"))
+	}
+
+	if selfCheck.RetryInterval != nil && selfCheck.RetryInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("retryInterval"), selfCheck.RetryInterval.Duration.String(), "must be non-negative"))
+	}
+
+	return allErrs
+}
+
+// ValidateRenewalWindow validates the thresholds of an issuer or the controller defaults.
+func ValidateRenewalWindow(window *api.RenewalWindow, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if len(window.RenewBefore) != 0 {
+		allErrs = append(allErrs, validateThreshold(window.RenewBefore, fldPath.Child("renewBefore"))...)
+	}
+	if len(window.ProactiveRenewBefore) != 0 {
+		allErrs = append(allErrs, validateThreshold(window.ProactiveRenewBefore, fldPath.Child("proactiveRenewBefore"))...)
+	}
+
+	return allErrs
+}
+
+// ValidateDefaultTLS validates the default TLS config of an issuer or the controller defaults.
+func ValidateDefaultTLS(tls *api.DefaultTLSConfig, fldPath *field.Path) field.ErrorList {
+	_, err := overrideTLSConfig(defaultTLSConfig(), tls.Termination, tls.InsecureEdgeTerminationPolicy)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, tls, err.Error())}
+	}
+
+	return nil
+}
+
+// ValidateIssuerConfigMap validates the priority and the CertIssuer payload of an issuer ConfigMap.
+// Unlike the controller it rejects unknown fields to catch typos.
+func ValidateIssuerConfigMap(cm *corev1.ConfigMap) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if v, ok := cm.Annotations[api.AcmePriorityAnnotation]; ok && len(v) != 0 {
+		_, err := strconv.Atoi(v)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(annotationsPath.Key(api.AcmePriorityAnnotation), v, "must be an integer"))
+		}
+	}
+
+	dataPath := field.NewPath("data").Key(api.CertIssuerDataKey)
+	certIssuerData, ok := cm.Data[api.CertIssuerDataKey]
+	if !ok {
+		return append(allErrs, field.Required(dataPath, "issuer ConfigMaps need the CertIssuer"))
+	}
+
+	certIssuerJSON, err := yaml.YAMLToJSON([]byte(certIssuerData))
+	if err != nil {
+		return append(allErrs, field.Invalid(dataPath, certIssuerData, err.Error()))
+	}
+	certIssuer := &api.CertIssuer{}
+	decoder := json.NewDecoder(bytes.NewReader(certIssuerJSON))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(certIssuer)
+	if err != nil {
+		return append(allErrs, field.Invalid(dataPath, certIssuerData, err.Error()))
+	}
+
+	if len(certIssuer.SecretName) != 0 {
+		allErrs = append(allErrs, validateName(certIssuer.SecretName, dataPath.Child("secretName"))...)
+	}
+
+	switch certIssuer.Type {
+	case api.CertIssuerTypeAcme:
+		acmeIssuerPath := dataPath.Child("acmeCertIssuer")
+		if certIssuer.AcmeCertIssuer == nil {
+			allErrs = append(allErrs, field.Required(acmeIssuerPath, "ACME issuers need acmeCertIssuer"))
+			break
+		}
+
+		directoryURL := certIssuer.AcmeCertIssuer.DirectoryURL
+		if len(directoryURL) == 0 {
+			allErrs = append(allErrs, field.Required(acmeIssuerPath.Child("directoryURL"), ""))
+		} else {
+			u, err := url.Parse(directoryURL)
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(acmeIssuerPath.Child("directoryURL"), directoryURL, err.Error()))
+			} else if u.Scheme != "https" && u.Scheme != "http" {
+				allErrs = append(allErrs, field.Invalid(acmeIssuerPath.Child("directoryURL"), directoryURL, "must be an http or https URL"))
+			}
+		}
+
+		if certIssuer.AcmeCertIssuer.SelfCheck != nil {
+			allErrs = append(allErrs, ValidateSelfCheck(certIssuer.AcmeCertIssuer.SelfCheck, acmeIssuerPath.Child("selfCheck"))...)
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(dataPath.Child("type"), certIssuer.Type, []string{string(api.CertIssuerTypeAcme)}))
+	}
+
+	if certIssuer.RenewalWindow != nil {
+		allErrs = append(allErrs, ValidateRenewalWindow(certIssuer.RenewalWindow, dataPath.Child("renewalWindow"))...)
+	}
+
+	if certIssuer.DefaultTLS != nil {
+		allErrs = append(allErrs, ValidateDefaultTLS(certIssuer.DefaultTLS, dataPath.Child("defaultTLS"))...)
+	}
+
+	_, err = parseRevocationPolicy(string(certIssuer.RevocationPolicy))
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(dataPath.Child("revocationPolicy"), certIssuer.RevocationPolicy, err.Error()))
+	}
+
+	return allErrs
+}
@@ -0,0 +1,252 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+func TestValidateRoute(t *testing.T) {
+	tt := []struct {
+		name           string
+		annotations    map[string]string
+		expectedFields []string
+	}{
+		{
+			name: "valid annotations",
+			annotations: map[string]string{
+				api.AcmeSecretName:                              "my-cert",
+				api.AcmeCertIssuerName:                          "letsencrypt-live",
+				api.AcmeExposerHttpFilterOutLabelsAnnotation:    "^app$",
+				api.AcmeRevocationPolicyAnnotation:              "Revoke",
+				api.AcmeRenewBeforeAnnotation:                   "720h",
+				api.AcmeProactiveRenewBeforeAnnotation:          "1/2",
+				api.AcmeTerminationAnnotation:                   "reencrypt",
+				api.AcmeInsecureEdgeTerminationPolicyAnnotation: "None",
+				api.AcmeSecretFormatsAnnotation:                 "ca.crt,keystore.p12",
+				api.AcmeKeystorePasswordSecretAnnotation:        "keystore-password",
+				api.AcmeSecretTargetsAnnotation:                 "other/my-cert",
+				api.AcmePausedAnnotation:                        "false",
+			},
+			expectedFields: nil,
+		},
+		{
+			name: "empty secret name defaults to the Route name",
+			annotations: map[string]string{
+				api.AcmeSecretName: "",
+			},
+			expectedFields: nil,
+		},
+		{
+			name: "invalid names",
+			annotations: map[string]string{
+				api.AcmeSecretName:     "My_Cert",
+				api.AcmeCertIssuerName: "letsencrypt/live",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/secret-name]",
+				"metadata.annotations[acme.openshift.io/cert-issuer-name]",
+			},
+		},
+		{
+			name: "invalid regexes",
+			annotations: map[string]string{
+				api.AcmeExposerHttpFilterOutAnnotationsAnnotation: "(",
+				api.AcmeExposerHttpFilterOutLabelsAnnotation:      "[a-",
+			},
+			expectedFields: []string{
+				"metadata.annotations[http.exposer.acme.openshift.io/filter-out-annotations]",
+				"metadata.annotations[http.exposer.acme.openshift.io/filter-out-labels]",
+			},
+		},
+		{
+			name: "invalid enums and thresholds",
+			annotations: map[string]string{
+				api.AcmeRevocationPolicyAnnotation: "Always",
+				api.AcmeRenewBeforeAnnotation:      "1 month",
+				api.AcmeTerminationAnnotation:      "edgy",
+				api.AcmePausedAnnotation:           "yes",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/revocation-policy]",
+				"metadata.annotations[acme.openshift.io/renew-before]",
+				"metadata.annotations[acme.openshift.io/termination]",
+				"metadata.annotations[acme.openshift.io/paused]",
+			},
+		},
+		{
+			name: "paused annotation accepts only lowercase true or false",
+			annotations: map[string]string{
+				api.AcmePausedAnnotation: "True",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/paused]",
+			},
+		},
+		{
+			name: "paused annotation doesn't accept numbers",
+			annotations: map[string]string{
+				api.AcmePausedAnnotation: "1",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/paused]",
+			},
+		},
+		{
+			name: "skip-revocation annotation accepts only lowercase true or false",
+			annotations: map[string]string{
+				api.AcmeSkipRevocationAnnotation: "yes",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/skip-revocation]",
+			},
+		},
+		{
+			name: "keystore format without password",
+			annotations: map[string]string{
+				api.AcmeSecretFormatsAnnotation: "keystore.jks",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/keystore-password-secret]",
+			},
+		},
+		{
+			name: "invalid secret formats and targets",
+			annotations: map[string]string{
+				api.AcmeSecretFormatsAnnotation: "tls.pfx",
+				api.AcmeSecretTargetsAnnotation: "test/my-cert",
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/secret-formats]",
+				"metadata.annotations[acme.openshift.io/secret-targets]",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			route := &routev1.Route{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "test",
+					Name:        "foo",
+					Annotations: tc.annotations,
+				},
+			}
+
+			var fields []string
+			for _, err := range ValidateRoute(route) {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tc.expectedFields) {
+				t.Errorf("expected errors for %q, got %q", tc.expectedFields, fields)
+			}
+		})
+	}
+}
+
+func TestValidateIssuerConfigMap(t *testing.T) {
+	tt := []struct {
+		name           string
+		priority       string
+		data           map[string]string
+		expectedFields []string
+	}{
+		{
+			name:     "valid issuer",
+			priority: "100",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"ACME","acmeCertIssuer":{"directoryUrl":"https://acme-v02.api.letsencrypt.org/directory","selfCheck":{"mode":"Router"}},"renewalWindow":{"renewBefore":"1/3"},"defaultTLS":{"termination":"edge"},"revocationPolicy":"Revoke"}`,
+			},
+			expectedFields: nil,
+		},
+		{
+			name:     "invalid priority",
+			priority: "high",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"ACME","acmeCertIssuer":{"directoryURL":"https://acme-v02.api.letsencrypt.org/directory"}}`,
+			},
+			expectedFields: []string{
+				"metadata.annotations[acme.openshift.io/priority]",
+			},
+		},
+		{
+			name: "missing payload",
+			data: nil,
+			expectedFields: []string{
+				"data[cert-issuer.types.acme.openshift.io]",
+			},
+		},
+		{
+			name: "unknown field",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"ACME","acmeCertIssuer":{"directoryURL":"https://acme-v02.api.letsencrypt.org/directory"},"renewalWindw":{}}`,
+			},
+			expectedFields: []string{
+				"data[cert-issuer.types.acme.openshift.io]",
+			},
+		},
+		{
+			name: "unsupported type",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"Vault"}`,
+			},
+			expectedFields: []string{
+				"data[cert-issuer.types.acme.openshift.io].type",
+			},
+		},
+		{
+			name: "invalid ACME issuer",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"ACME","secretName":"Account_Key","acmeCertIssuer":{"directoryURL":"ftp://example.com","selfCheck":{"mode":"External","retries":-1}}}`,
+			},
+			expectedFields: []string{
+				"data[cert-issuer.types.acme.openshift.io].secretName",
+				"data[cert-issuer.types.acme.openshift.io].acmeCertIssuer.directoryURL",
+				"data[cert-issuer.types.acme.openshift.io].acmeCertIssuer.selfCheck.probeURL",
+				"data[cert-issuer.types.acme.openshift.io].acmeCertIssuer.selfCheck.retries",
+			},
+		},
+		{
+			name: "invalid defaults",
+			data: map[string]string{
+				api.CertIssuerDataKey: `{"type":"ACME","acmeCertIssuer":{"directoryURL":"https://acme-v02.api.letsencrypt.org/directory"},"renewalWindow":{"proactiveRenewBefore":"2"},"defaultTLS":{"insecureEdgeTerminationPolicy":"Deny"},"revocationPolicy":"Sometimes"}`,
+			},
+			expectedFields: []string{
+				"data[cert-issuer.types.acme.openshift.io].renewalWindow.proactiveRenewBefore",
+				"data[cert-issuer.types.acme.openshift.io].defaultTLS",
+				"data[cert-issuer.types.acme.openshift.io].revocationPolicy",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "acme",
+					Name:      "letsencrypt-live",
+					Labels:    api.AccountLabelSet,
+				},
+				Data: tc.data,
+			}
+			if len(tc.priority) != 0 {
+				cm.Annotations = map[string]string{
+					api.AcmePriorityAnnotation: tc.priority,
+				}
+			}
+
+			var fields []string
+			for _, err := range ValidateIssuerConfigMap(cm) {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, tc.expectedFields) {
+				t.Errorf("expected errors for %q, got %q", tc.expectedFields, fields)
+			}
+		})
+	}
+}
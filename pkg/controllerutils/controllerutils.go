@@ -1,17 +1,26 @@
 package controllerutils
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/tnozicka/openshift-acme/pkg/util"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog"
 
 	_ "github.com/openshift/client-go/route/clientset/versioned/scheme"
@@ -19,11 +28,61 @@ import (
 	kubeinformers "github.com/tnozicka/openshift-acme/pkg/machinery/informers/kube"
 )
 
-func getIssuerConfigMapsForObject(obj metav1.ObjectMeta, globalIssuerNamesapce string, kubeInformersForNamespaces kubeinformers.Interface) ([]*corev1.ConfigMap, error) {
+// ErrNoIssuer is returned when there is no issuer for an object.
+var ErrNoIssuer = errors.New("can't find any issuer")
+
+// ConfigMapGetter reads ConfigMaps so issuers can be looked up using informers as well as clients.
+type ConfigMapGetter interface {
+	Get(namespace, name string) (*corev1.ConfigMap, error)
+	List(namespace string, selector labels.Selector) ([]*corev1.ConfigMap, error)
+}
+
+type informerConfigMapGetter struct {
+	kubeInformersForNamespaces kubeinformers.Interface
+}
+
+// NewInformerConfigMapGetter returns a ConfigMapGetter reading from the informer caches.
+func NewInformerConfigMapGetter(kubeInformersForNamespaces kubeinformers.Interface) ConfigMapGetter {
+	return informerConfigMapGetter{kubeInformersForNamespaces: kubeInformersForNamespaces}
+}
+
+func (g informerConfigMapGetter) Get(namespace, name string) (*corev1.ConfigMap, error) {
+	return g.kubeInformersForNamespaces.InformersForOrGlobal(namespace).Core().V1().ConfigMaps().Lister().ConfigMaps(namespace).Get(name)
+}
+
+func (g informerConfigMapGetter) List(namespace string, selector labels.Selector) ([]*corev1.ConfigMap, error) {
+	return g.kubeInformersForNamespaces.InformersForOrGlobal(namespace).Core().V1().ConfigMaps().Lister().ConfigMaps(namespace).List(selector)
+}
+
+// ClientConfigMapGetter reads ConfigMaps directly from the apiserver.
+type ClientConfigMapGetter struct {
+	Client kubernetes.Interface
+}
+
+func (g ClientConfigMapGetter) Get(namespace, name string) (*corev1.ConfigMap, error) {
+	return g.Client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (g ClientConfigMapGetter) List(namespace string, selector labels.Selector) ([]*corev1.ConfigMap, error) {
+	list, err := g.Client.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*corev1.ConfigMap, 0, len(list.Items))
+	for i := range list.Items {
+		res = append(res, &list.Items[i])
+	}
+
+	return res, nil
+}
+
+// IssuerConfigMapsForObject returns the issuer ConfigMaps matching the object ordered by their priority.
+func IssuerConfigMapsForObject(obj metav1.ObjectMeta, globalIssuerNamesapce string, configMapGetter ConfigMapGetter) ([]*corev1.ConfigMap, error) {
 	// Lookup explicitly referenced issuer first. If explicitly referenced this should be the only match.
 	issuerName, found := obj.Annotations[api.AcmeCertIssuerName]
 	if found && len(issuerName) > 0 {
-		issuerConfigMap, err := kubeInformersForNamespaces.InformersForOrGlobal(obj.Namespace).Core().V1().ConfigMaps().Lister().ConfigMaps(obj.Namespace).Get(issuerName)
+		issuerConfigMap, err := configMapGetter.Get(obj.Namespace, issuerName)
 		if err != nil {
 			return nil, fmt.Errorf("can't get issuer %s/%s: %w", obj.Namespace, issuerName, err)
 		}
@@ -32,20 +91,22 @@ func getIssuerConfigMapsForObject(obj metav1.ObjectMeta, globalIssuerNamesapce s
 
 	var issuerConfigMaps []*corev1.ConfigMap
 
-	localConfigMapList, err := kubeInformersForNamespaces.InformersForOrGlobal(obj.Namespace).Core().V1().ConfigMaps().Lister().ConfigMaps(obj.Namespace).List(api.AccountLabelSet.AsSelector())
+	localConfigMapList, err := configMapGetter.List(obj.Namespace, api.AccountLabelSet.AsSelector())
 	if err != nil {
 		return nil, fmt.Errorf("can't look up local issuers: %w", err)
 	}
 	issuerConfigMaps = append(issuerConfigMaps, localConfigMapList...)
 
-	globalConfigMapList, err := kubeInformersForNamespaces.InformersForOrGlobal(globalIssuerNamesapce).Core().V1().ConfigMaps().Lister().ConfigMaps(globalIssuerNamesapce).List(api.AccountLabelSet.AsSelector())
-	if err != nil {
-		return nil, fmt.Errorf("can't look up global issuers: %w", err)
+	if len(globalIssuerNamesapce) != 0 && globalIssuerNamesapce != obj.Namespace {
+		globalConfigMapList, err := configMapGetter.List(globalIssuerNamesapce, api.AccountLabelSet.AsSelector())
+		if err != nil {
+			return nil, fmt.Errorf("can't look up global issuers: %w", err)
+		}
+		issuerConfigMaps = append(issuerConfigMaps, globalConfigMapList...)
 	}
-	issuerConfigMaps = append(issuerConfigMaps, globalConfigMapList...)
 
 	if len(issuerConfigMaps) < 1 {
-		return nil, fmt.Errorf("can't find any issuer")
+		return nil, ErrNoIssuer
 	}
 
 	sort.Slice(issuerConfigMaps, func(i, j int) bool {
@@ -88,8 +149,24 @@ func getIssuerConfigMapsForObject(obj metav1.ObjectMeta, globalIssuerNamesapce s
 	return issuerConfigMaps, nil
 }
 
+// CertIssuerFromConfigMap decodes the CertIssuer stored in the issuer ConfigMap.
+func CertIssuerFromConfigMap(cm *corev1.ConfigMap) (*api.CertIssuer, error) {
+	certIssuerData, ok := cm.Data[api.CertIssuerDataKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s is matching CertIssuer selectors %q but missing key %q", cm.Namespace, cm.Name, api.AccountLabelSet, api.CertIssuerDataKey)
+	}
+
+	certIssuer := &api.CertIssuer{}
+	err := yaml.Unmarshal([]byte(certIssuerData), certIssuer)
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s/%s is matching CertIssuer selectors %q but contains invalid object: %w", cm.Namespace, cm.Name, api.AccountLabelSet, err)
+	}
+
+	return certIssuer, nil
+}
+
 func IssuerForObject(obj metav1.ObjectMeta, globalIssuerNamespace string, kubeInformersForNamespaces kubeinformers.Interface) (*api.CertIssuer, *corev1.Secret, error) {
-	issuerConfigMaps, err := getIssuerConfigMapsForObject(obj, globalIssuerNamespace, kubeInformersForNamespaces)
+	issuerConfigMaps, err := IssuerConfigMapsForObject(obj, globalIssuerNamespace, informerConfigMapGetter{kubeInformersForNamespaces: kubeInformersForNamespaces})
 	if err != nil {
 		return nil, nil, err
 	}
@@ -97,15 +174,9 @@ func IssuerForObject(obj metav1.ObjectMeta, globalIssuerNamespace string, kubeIn
 	// TODO: Filter out non-matching issuers and solvers
 	certIssuerCM := issuerConfigMaps[0]
 
-	certIssuerData, ok := certIssuerCM.Data[api.CertIssuerDataKey]
-	if !ok {
-		return nil, nil, fmt.Errorf("configmap %s/%s is matching CertIssuer selectors %q but missing key %q", obj.Namespace, obj.Name, api.AccountLabelSet, api.CertIssuerDataKey)
-	}
-
-	certIssuer := &api.CertIssuer{}
-	err = yaml.Unmarshal([]byte(certIssuerData), certIssuer)
+	certIssuer, err := CertIssuerFromConfigMap(certIssuerCM)
 	if err != nil {
-		return nil, nil, fmt.Errorf("configmap %s/%s is matching CertIssuer selectors %q but contains invalid object: %w", obj.Namespace, obj.Name, api.AccountLabelSet, err)
+		return nil, nil, err
 	}
 
 	if len(certIssuer.SecretName) == 0 {
@@ -120,35 +191,121 @@ func IssuerForObject(obj metav1.ObjectMeta, globalIssuerNamespace string, kubeIn
 	return certIssuer, secret, nil
 }
 
-func ValidateExposedToken(url, expectedData string) error {
-	tr := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
+const (
+	// TokenValidationReasonUnreachable means the request for the token failed.
+	TokenValidationReasonUnreachable = "Unreachable"
+
+	// TokenValidationReasonUnexpectedStatus means the response status code wasn't 200.
+	TokenValidationReasonUnexpectedStatus = "UnexpectedStatus"
+
+	// TokenValidationReasonUnexpectedContent means the response didn't contain the token.
+	TokenValidationReasonUnexpectedContent = "UnexpectedContent"
+
+	// No response should be longer that this, we need to prevent against DoS
+	maxTokenResponseSize = 2048
+)
+
+// tokenCheckClient is shared by all the token checks so they reuse connections instead of leaking a transport each.
+var tokenCheckClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: tokenCheckProxy,
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: true,
 		},
+		IdleConnTimeout: 30 * time.Second,
+	},
+}
+
+// inClusterNetworks are the private networks pods and services use.
+var inClusterNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "fc00::/7", "::1/128"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isInClusterHost returns true for hosts a proxy outside of the cluster can't reach,
+// like pod IPs or the names of internal services.
+func isInClusterHost(host string) bool {
+	ip := net.ParseIP(host)
+	if ip != nil {
+		for _, network := range inClusterNetworks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return host == "localhost" || !strings.Contains(host, ".") || strings.HasSuffix(host, ".svc") || strings.Contains(host, ".svc.")
+}
+
+// tokenCheckProxy uses the proxy from the environment except for the in-cluster targets.
+func tokenCheckProxy(req *http.Request) (*url.URL, error) {
+	if isInClusterHost(req.URL.Hostname()) {
+		return nil, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// TokenValidationError explains why the exposed token couldn't be validated.
+type TokenValidationError struct {
+	Reason  string
+	Message string
+}
+
+func (e *TokenValidationError) Error() string {
+	return e.Message
+}
+
+// CheckExposedToken checks that the url serves the expected data. The request is sent with the given Host header,
+// empty host uses the host from the url. Failures are reported as TokenValidationError.
+func CheckExposedToken(ctx context.Context, url, host, expectedData string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("can't create request for %q: %w", url, err)
+	}
+	req = req.WithContext(ctx)
+	if len(host) != 0 {
+		req.Host = host
 	}
-	client := &http.Client{Transport: tr}
 
-	response, err := client.Get(url)
+	response, err := tokenCheckClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("can't GET %q: %w", url, err)
+		return &TokenValidationError{
+			Reason:  TokenValidationReasonUnreachable,
+			Message: fmt.Sprintf("can't GET %q: %v", url, err),
+		}
 	}
 	defer response.Body.Close()
 
-	// No response should be longer that this, we need to prevent against DoS
-	buffer := make([]byte, 2048)
-	n, err := response.Body.Read(buffer)
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("can't read response body into buffer: %w", err)
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxTokenResponseSize+1))
+	if err != nil {
+		return &TokenValidationError{
+			Reason:  TokenValidationReasonUnreachable,
+			Message: fmt.Sprintf("can't read response body from %q: %v", url, err),
+		}
 	}
-	body := string(buffer[:n])
+	body := string(data)
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("getting %q return status code %d, expected %d: status %q: content head: %s", url, response.StatusCode, http.StatusOK, response.Status, util.FirstNLines(util.MaxNCharacters(body, 160), 5))
+		return &TokenValidationError{
+			Reason:  TokenValidationReasonUnexpectedStatus,
+			Message: fmt.Sprintf("getting %q return status code %d, expected %d: status %q: content head: %s", url, response.StatusCode, http.StatusOK, response.Status, util.FirstNLines(util.MaxNCharacters(body, 160), 5)),
+		}
 	}
 
 	if body != expectedData {
-		return fmt.Errorf("response body doesn't match expected data")
+		return &TokenValidationError{
+			Reason:  TokenValidationReasonUnexpectedContent,
+			Message: fmt.Sprintf("response body from %q doesn't match expected data", url),
+		}
 	}
 
 	return nil
@@ -0,0 +1,35 @@
+package controllerutils
+
+import (
+	"testing"
+)
+
+func TestIsInClusterHost(t *testing.T) {
+	tt := []struct {
+		host     string
+		expected bool
+	}{
+		{host: "10.128.2.15", expected: true},
+		{host: "172.30.0.10", expected: true},
+		{host: "192.168.1.1", expected: true},
+		{host: "127.0.0.1", expected: true},
+		{host: "fd00::1", expected: true},
+		{host: "localhost", expected: true},
+		{host: "router-internal-default", expected: true},
+		{host: "router-internal-default.openshift-ingress.svc", expected: true},
+		{host: "router-internal-default.openshift-ingress.svc.cluster.local.", expected: true},
+		{host: "8.8.8.8", expected: false},
+		{host: "2001:4860:4860::8888", expected: false},
+		{host: "foo.example.com", expected: false},
+		{host: "svc.example.com", expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.host, func(t *testing.T) {
+			got := isInClusterHost(tc.host)
+			if got != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+type accessLogEntry struct {
+	Time            string  `json:"time"`
+	ClientIP        string  `json:"client_ip"`
+	RemoteAddr      string  `json:"remote_addr"`
+	ForwardedFor    string  `json:"forwarded_for,omitempty"`
+	Host            string  `json:"host"`
+	Method          string  `json:"method"`
+	URI             string  `json:"uri"`
+	Proto           string  `json:"proto"`
+	Status          int     `json:"status"`
+	Bytes           int     `json:"bytes"`
+	UserAgent       string  `json:"user_agent"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// jsonAccessLogger writes one JSON object per request.
+type jsonAccessLogger struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func newJSONAccessLogger(w io.Writer) *jsonAccessLogger {
+	return &jsonAccessLogger{
+		encoder: json.NewEncoder(w),
+	}
+}
+
+func (l *jsonAccessLogger) log(entry *accessLogEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	err := l.encoder.Encode(entry)
+	if err != nil {
+		klog.Errorf("Can't write access log: %v", err)
+	}
+}
+
+// statusRecorder remembers the status code and the number of bytes written for the access log and metrics.
+type statusRecorder struct {
+	http.ResponseWriter
+
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func newAccessLogEntry(r *http.Request, clientIP string, rec *statusRecorder, start time.Time) *accessLogEntry {
+	return &accessLogEntry{
+		Time:            start.UTC().Format(time.RFC3339Nano),
+		ClientIP:        clientIP,
+		RemoteAddr:      r.RemoteAddr,
+		ForwardedFor:    r.Header.Get("X-Forwarded-For"),
+		Host:            r.Host,
+		Method:          r.Method,
+		URI:             r.URL.String(),
+		Proto:           r.Proto,
+		Status:          rec.status,
+		Bytes:           rec.bytes,
+		UserAgent:       r.UserAgent(),
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+}
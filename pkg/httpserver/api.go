@@ -0,0 +1,149 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+)
+
+const (
+	ResponsesAPIPath = "/api/v1/responses"
+
+	// maxResponseSize limits the size of responses accepted by the API.
+	maxResponseSize = 4096
+)
+
+// APIServer exposes an authenticated API for managing responses served by a Server
+// so a single exposer can serve many challenges over its lifetime.
+//
+// PUT    /api/v1/responses?uri=<URI>[&host=<Host>]   sets the response for the URI to the request body
+// DELETE /api/v1/responses?uri=<URI>[&host=<Host>]   removes the response for the URI
+//
+// Responses without a host match any host.
+type APIServer struct {
+	responses *Server
+	token     string
+
+	server http.Server
+
+	listeningAddr      string
+	listeningAddrMutex sync.Mutex
+}
+
+func NewAPIServer(listenAddr string, token string, responses *Server) *APIServer {
+	return &APIServer{
+		responses: responses,
+		token:     token,
+
+		server: http.Server{
+			Addr: listenAddr,
+		},
+	}
+}
+
+func (s *APIServer) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, prefix) {
+		return false
+	}
+
+	token := strings.TrimPrefix(authorization, prefix)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *APIServer) handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+
+	if !s.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	host := r.URL.Query().Get("host")
+	uri := r.URL.Query().Get("uri")
+	if len(uri) == 0 || !strings.HasPrefix(uri, "/") {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, "query parameter 'uri' has to be an absolute path")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxResponseSize))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(body) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, "response can't be empty")
+			return
+		}
+
+		s.responses.SetResponse(host, uri, string(body))
+		klog.V(2).Infof("API: set response for host %q URI %q", host, uri)
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if !s.responses.DeleteResponse(host, uri) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		klog.V(2).Infof("API: deleted response for host %q URI %q", host, uri)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodPut, http.MethodDelete}, ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *APIServer) setListeningAddr(addr string) {
+	s.listeningAddrMutex.Lock()
+	defer s.listeningAddrMutex.Unlock()
+	s.listeningAddr = addr
+}
+
+func (s *APIServer) getListeningAddr() string {
+	s.listeningAddrMutex.Lock()
+	defer s.listeningAddrMutex.Unlock()
+	return s.listeningAddr
+}
+
+func (s *APIServer) Run() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(ResponsesAPIPath, s.handler)
+	s.server.Handler = mux
+
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	s.setListeningAddr(listener.Addr().String())
+	klog.V(1).Infof("API: server listening on http://%s/", s.getListeningAddr())
+
+	err = s.server.Serve(listener)
+	if err == http.ErrServerClosed {
+		klog.Infof("API server closed gracefully")
+		return nil
+	}
+
+	return err
+}
+
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	klog.Infof("Shutting down API server...")
+	defer klog.Infof("API server shut down")
+
+	return s.server.Shutdown(ctx)
+}
@@ -1,10 +1,14 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,8 +17,27 @@ import (
 	"k8s.io/klog"
 )
 
+// Server serves responses for URIs. Responses can be bound to a specific host
+// and are indexed by `host + URI` or just by the URI if they should match any host.
 type Server struct {
+	// uriToResponse holds the responses loaded from data or the response file.
 	uriToResponse map[string]string
+	// apiURIToResponse holds the responses managed through the API. They survive reloading the response file.
+	apiURIToResponse map[string]string
+	// responseFileData is the content of the response file at the time it was last loaded.
+	responseFileData []byte
+	responsesMutex   sync.RWMutex
+
+	// ReadTimeout, WriteTimeout and IdleTimeout are applied to the underlying http.Server. Zero means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// RateLimiter limits the number of requests per client IP. Nil disables rate limiting.
+	RateLimiter *IPRateLimiter
+	// TrustForwardedFor makes the server determine the client IP from X-Forwarded-For header set by the router.
+	TrustForwardedFor bool
+	// AccessLog receives an access log entry in JSON format for every request. Nil disables access logs.
+	AccessLog io.Writer
 
 	server http.Server
 
@@ -27,7 +50,8 @@ func NewServer(listenAddr string, uriToResponse map[string]string) *Server {
 		uriToResponse = make(map[string]string)
 	}
 	return &Server{
-		uriToResponse: uriToResponse,
+		uriToResponse:    uriToResponse,
+		apiURIToResponse: make(map[string]string),
 
 		server: http.Server{
 			Addr: listenAddr,
@@ -38,21 +62,18 @@ func NewServer(listenAddr string, uriToResponse map[string]string) *Server {
 func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 
-	// host, _, err := net.SplitHostPort(r.Host)
-	// if err != nil {
-	// 	klog.Error(err)
-	// 	host = r.Host
-	// }
-	// uri := host + r.URL.String()
+	host := NormalizeHost(r.Host)
 	uri := r.URL.String()
-	response, found := s.uriToResponse[uri]
-	klog.V(4).Infof("URI %q %sfound", uri, func() string {
+	response, found := s.lookup(host, uri)
+	klog.V(4).Infof("Host %q URI %q %sfound", host, uri, func() string {
 		if !found {
 			return "not "
 		}
 		return ""
 	}())
 
+	s.recordLookup(uri, found)
+
 	if found {
 		w.WriteHeader(http.StatusOK)
 		_, err := fmt.Fprint(w, response)
@@ -67,7 +88,138 @@ func (s *Server) handler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (s *Server) ParseData(data []byte) error {
+// NormalizeHost strips the port and trailing dot from the host and lowercases it
+// because hostnames are case-insensitive.
+func NormalizeHost(host string) string {
+	h, _, err := net.SplitHostPort(host)
+	if err == nil {
+		host = h
+	}
+
+	host = strings.TrimSuffix(host, ".")
+
+	return strings.ToLower(host)
+}
+
+func responseKey(host, uri string) string {
+	return NormalizeHost(host) + uri
+}
+
+func (s *Server) lookup(host, uri string) (string, bool) {
+	s.responsesMutex.RLock()
+	defer s.responsesMutex.RUnlock()
+
+	// Responses for a specific host take precedence over the ones matching any host.
+	for _, key := range []string{responseKey(host, uri), uri} {
+		response, found := s.apiURIToResponse[key]
+		if found {
+			return response, true
+		}
+
+		response, found = s.uriToResponse[key]
+		if found {
+			return response, true
+		}
+	}
+
+	return "", false
+}
+
+// servesURI returns true if there is a response for the URI for any host. Callers must hold responsesMutex.
+func (s *Server) servesURI(uri string) bool {
+	for _, m := range []map[string]string{s.apiURIToResponse, s.uriToResponse} {
+		for key := range m {
+			// Keys are `host + URI` and hosts can't contain a slash.
+			if strings.HasSuffix(key, uri) && !strings.Contains(strings.TrimSuffix(key, uri), "/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// servedURIs returns the URIs that have a response for any host. Callers must hold responsesMutex.
+func (s *Server) servedURIs() map[string]struct{} {
+	uris := make(map[string]struct{})
+	for _, m := range []map[string]string{s.apiURIToResponse, s.uriToResponse} {
+		for key := range m {
+			// Keys are `host + URI` and hosts can't contain a slash.
+			i := strings.Index(key, "/")
+			if i < 0 {
+				continue
+			}
+			uris[key[i:]] = struct{}{}
+		}
+	}
+
+	return uris
+}
+
+// recordLookup counts the lookup of the URI. Only URIs that are served for some host get their own series.
+func (s *Server) recordLookup(uri string, found bool) {
+	s.responsesMutex.RLock()
+	defer s.responsesMutex.RUnlock()
+
+	switch {
+	case !s.servesURI(uri):
+		lookupsTotal.WithLabelValues(lookupPathOther, lookupResultUnknown).Inc()
+	case found:
+		lookupsTotal.WithLabelValues(uri, lookupResultHit).Inc()
+	default:
+		lookupsTotal.WithLabelValues(uri, lookupResultMiss).Inc()
+	}
+}
+
+// forgetRemovedURIs deletes the lookup series for URIs that were served previously but aren't anymore.
+// Callers must hold responsesMutex for writing.
+func (s *Server) forgetRemovedURIs(previous map[string]struct{}) {
+	current := s.servedURIs()
+	for uri := range previous {
+		if _, ok := current[uri]; ok {
+			continue
+		}
+
+		lookupsTotal.DeleteLabelValues(uri, lookupResultHit)
+		lookupsTotal.DeleteLabelValues(uri, lookupResultMiss)
+	}
+}
+
+// instrument wraps the handler with rate limiting, metrics and access logs.
+func (s *Server) instrument(handler http.Handler) http.Handler {
+	var accessLogger *jsonAccessLogger
+	if s.AccessLog != nil {
+		accessLogger = newJSONAccessLogger(s.AccessLog)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ip := clientIP(r, s.TrustForwardedFor)
+		rec := &statusRecorder{ResponseWriter: w}
+
+		if s.RateLimiter != nil && !s.RateLimiter.Allow(ip) {
+			klog.V(4).Infof("Rate limiting request from %s", ip)
+			rec.WriteHeader(http.StatusTooManyRequests)
+		} else {
+			handler.ServeHTTP(rec, r)
+		}
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		requestsTotal.WithLabelValues(strconv.Itoa(rec.status)).Inc()
+
+		if accessLogger != nil {
+			accessLogger.log(newAccessLogEntry(r, ip, rec, start))
+		}
+	})
+}
+
+// parseData parses lines using format `Host URI Response` or `URI Response` for responses matching any host.
+func parseData(data []byte) (map[string]string, error) {
+	uriToResponse := make(map[string]string)
+
 	lines := strings.Split(string(data), "\n")
 	klog.Infof("Parsing %d line(s)", len(lines))
 	for n, l := range lines {
@@ -75,19 +227,125 @@ func (s *Server) ParseData(data []byte) error {
 			continue
 		}
 
+		// URIs are always absolute paths so we can tell the formats apart by the first field.
+		var host string
+		if !strings.HasPrefix(l, "/") {
+			parts := strings.SplitN(l, " ", 2)
+			if len(parts) != 2 || len(parts[0]) == 0 {
+				// don't print the content as it contains secret data
+				return nil, fmt.Errorf("can't parse line %d", n)
+			}
+			host = parts[0]
+			l = parts[1]
+
+			if !strings.HasPrefix(l, "/") {
+				return nil, fmt.Errorf("can't parse line %d: URI has to be an absolute path", n)
+			}
+		}
+
 		parts := strings.SplitN(l, " ", 2)
 		if len(parts) != 2 {
 			// don't print the content as it contains secret data
-			return fmt.Errorf("can't parse line %d", n)
+			return nil, fmt.Errorf("can't parse line %d", n)
 		}
 		uri := parts[0]
 		response := parts[1]
+		uriToResponse[responseKey(host, uri)] = response
+	}
+
+	return uriToResponse, nil
+}
+
+// ParseData adds responses from data using format `Host URI Response` or `URI Response` on every line.
+func (s *Server) ParseData(data []byte) error {
+	uriToResponse, err := parseData(data)
+	if err != nil {
+		return err
+	}
+
+	s.responsesMutex.Lock()
+	defer s.responsesMutex.Unlock()
+
+	for uri, response := range uriToResponse {
 		s.uriToResponse[uri] = response
 	}
 
 	return nil
 }
 
+// ReplaceData replaces all responses not managed through the API with the ones from data.
+func (s *Server) ReplaceData(data []byte) error {
+	uriToResponse, err := parseData(data)
+	if err != nil {
+		return err
+	}
+
+	s.responsesMutex.Lock()
+	defer s.responsesMutex.Unlock()
+
+	previous := s.servedURIs()
+	s.uriToResponse = uriToResponse
+	s.forgetRemovedURIs(previous)
+
+	return nil
+}
+
+// LoadResponseFile replaces the responses not managed through the API with the content of the file.
+// It returns true if the content has changed since it was last loaded.
+func (s *Server) LoadResponseFile(path string) (bool, error) {
+	// Kubelet updates mounted Secrets and ConfigMaps by swapping symlinks,
+	// so we compare the content instead of relying on file events.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	s.responsesMutex.RLock()
+	changed := s.responseFileData == nil || !bytes.Equal(s.responseFileData, data)
+	s.responsesMutex.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	uriToResponse, err := parseData(data)
+	if err != nil {
+		return false, fmt.Errorf("can't parse response file %q: %w", path, err)
+	}
+
+	s.responsesMutex.Lock()
+	defer s.responsesMutex.Unlock()
+
+	previous := s.servedURIs()
+	s.uriToResponse = uriToResponse
+	s.responseFileData = data
+	s.forgetRemovedURIs(previous)
+
+	return true, nil
+}
+
+// SetResponse sets a response for the host and URI which survives reloading the response file.
+// Empty host matches any host.
+func (s *Server) SetResponse(host, uri, response string) {
+	s.responsesMutex.Lock()
+	defer s.responsesMutex.Unlock()
+
+	s.apiURIToResponse[responseKey(host, uri)] = response
+}
+
+// DeleteResponse removes a response for the host and URI previously set by SetResponse.
+func (s *Server) DeleteResponse(host, uri string) bool {
+	s.responsesMutex.Lock()
+	defer s.responsesMutex.Unlock()
+
+	key := responseKey(host, uri)
+	_, found := s.apiURIToResponse[key]
+	previous := s.servedURIs()
+	delete(s.apiURIToResponse, key)
+	s.forgetRemovedURIs(previous)
+
+	return found
+}
+
 func (s *Server) setListeningAddr(addr string) {
 	s.listeningAddrMutex.Lock()
 	defer s.listeningAddrMutex.Unlock()
@@ -103,7 +361,10 @@ func (s *Server) getListeningAddr() string {
 func (s *Server) Run() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handler)
-	s.server.Handler = mux
+	s.server.Handler = s.instrument(mux)
+	s.server.ReadTimeout = s.ReadTimeout
+	s.server.WriteTimeout = s.WriteTimeout
+	s.server.IdleTimeout = s.IdleTimeout
 
 	listener, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
@@ -1,17 +1,26 @@
 package httpserver
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
 	"k8s.io/klog"
 )
 
@@ -86,6 +95,37 @@ func TestParseData(t *testing.T) {
 			uriToResponse: map[string]string{},
 			expectedErr:   nil,
 		},
+		{
+			name: "URI only format",
+			data: []byte("/foo bar\n/foo2 bar2 with spaces\n"),
+			uriToResponse: map[string]string{
+				"/foo":  "bar",
+				"/foo2": "bar2 with spaces",
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "host format is normalized",
+			data: []byte("Example.COM:80 /foo bar\nexample.org. /foo bar2\n/foo bar3"),
+			uriToResponse: map[string]string{
+				"example.com/foo": "bar",
+				"example.org/foo": "bar2",
+				"/foo":            "bar3",
+			},
+			expectedErr: nil,
+		},
+		{
+			name:          "host without URI",
+			data:          []byte("example.com foo bar"),
+			uriToResponse: map[string]string{},
+			expectedErr:   fmt.Errorf("can't parse line 0: URI has to be an absolute path"),
+		},
+		{
+			name:          "missing response",
+			data:          []byte("/foo"),
+			uriToResponse: map[string]string{},
+			expectedErr:   fmt.Errorf("can't parse line 0"),
+		},
 	}
 
 	for _, tc := range tt {
@@ -187,3 +227,410 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadResponseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openshift-acme-exposer-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := os.RemoveAll(dir)
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+	path := filepath.Join(dir, "exposer-file")
+
+	s := NewServer("localhost", nil)
+	s.SetResponse("", "/api", "api-response")
+
+	tt := []struct {
+		name            string
+		data            []byte
+		expectedChanged bool
+		expectedErr     bool
+		expected        map[string]string
+	}{
+		{
+			name:            "initial load",
+			data:            []byte("/foo bar\n/foo2 bar2\n"),
+			expectedChanged: true,
+			expected: map[string]string{
+				"/foo":  "bar",
+				"/foo2": "bar2",
+				"/api":  "api-response",
+			},
+		},
+		{
+			name:            "unchanged file",
+			data:            []byte("/foo bar\n/foo2 bar2\n"),
+			expectedChanged: false,
+			expected: map[string]string{
+				"/foo":  "bar",
+				"/foo2": "bar2",
+				"/api":  "api-response",
+			},
+		},
+		{
+			name:            "removed and added responses",
+			data:            []byte("/foo2 bar2\n/foo3 bar3"),
+			expectedChanged: true,
+			expected: map[string]string{
+				"/foo2": "bar2",
+				"/foo3": "bar3",
+				"/api":  "api-response",
+			},
+		},
+		{
+			name:            "invalid file keeps previous responses",
+			data:            []byte("invalid"),
+			expectedChanged: false,
+			expectedErr:     true,
+			expected: map[string]string{
+				"/foo2": "bar2",
+				"/foo3": "bar3",
+				"/api":  "api-response",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ioutil.WriteFile(path, tc.data, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changed, err := s.LoadResponseFile(path)
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("expected error %t, got %v", tc.expectedErr, err)
+			}
+			if changed != tc.expectedChanged {
+				t.Errorf("expected changed %t, got %t", tc.expectedChanged, changed)
+			}
+
+			for uri, expectedResponse := range tc.expected {
+				response, found := s.lookup("", uri)
+				if !found {
+					t.Errorf("response for %q not found", uri)
+					continue
+				}
+				if response != expectedResponse {
+					t.Errorf("expected response %q for %q, got %q", expectedResponse, uri, response)
+				}
+			}
+
+			for _, uri := range []string{"/foo", "/foo2", "/foo3"} {
+				_, expected := tc.expected[uri]
+				_, found := s.lookup("", uri)
+				if found != expected {
+					t.Errorf("expected %q to be found %t, got %t", uri, expected, found)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIServer(t *testing.T) {
+	s := NewServer("localhost", nil)
+	apiServer := NewAPIServer("localhost", "secret-token", s)
+
+	tt := []struct {
+		name             string
+		method           string
+		uri              string
+		authorization    string
+		body             string
+		expectedCode     int
+		expectedResponse string
+		expectedFound    bool
+	}{
+		{
+			name:          "missing token",
+			method:        http.MethodPut,
+			uri:           "/foo",
+			authorization: "",
+			body:          "bar",
+			expectedCode:  http.StatusUnauthorized,
+			expectedFound: false,
+		},
+		{
+			name:          "wrong token",
+			method:        http.MethodPut,
+			uri:           "/foo",
+			authorization: "Bearer wrong-token",
+			body:          "bar",
+			expectedCode:  http.StatusUnauthorized,
+			expectedFound: false,
+		},
+		{
+			name:          "relative uri",
+			method:        http.MethodPut,
+			uri:           "foo",
+			authorization: "Bearer secret-token",
+			body:          "bar",
+			expectedCode:  http.StatusBadRequest,
+			expectedFound: false,
+		},
+		{
+			name:             "set response",
+			method:           http.MethodPut,
+			uri:              "/foo",
+			authorization:    "Bearer secret-token",
+			body:             "bar",
+			expectedCode:     http.StatusNoContent,
+			expectedResponse: "bar",
+			expectedFound:    true,
+		},
+		{
+			name:          "unsupported method",
+			method:        http.MethodPost,
+			uri:           "/foo",
+			authorization: "Bearer secret-token",
+			expectedCode:  http.StatusMethodNotAllowed,
+			// Previous response stays
+			expectedResponse: "bar",
+			expectedFound:    true,
+		},
+		{
+			name:          "delete response",
+			method:        http.MethodDelete,
+			uri:           "/foo",
+			authorization: "Bearer secret-token",
+			expectedCode:  http.StatusNoContent,
+			expectedFound: false,
+		},
+		{
+			name:          "delete missing response",
+			method:        http.MethodDelete,
+			uri:           "/foo",
+			authorization: "Bearer secret-token",
+			expectedCode:  http.StatusNotFound,
+			expectedFound: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, ResponsesAPIPath+"?uri="+url.QueryEscape(tc.uri), strings.NewReader(tc.body))
+			if len(tc.authorization) != 0 {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			apiServer.handler(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d", tc.expectedCode, w.Code)
+			}
+
+			response, found := s.lookup("", tc.uri)
+			if found != tc.expectedFound {
+				t.Errorf("expected found %t, got %t", tc.expectedFound, found)
+			}
+			if response != tc.expectedResponse {
+				t.Errorf("expected response %q, got %q", tc.expectedResponse, response)
+			}
+		})
+	}
+}
+
+func TestHandlerHostMatching(t *testing.T) {
+	s := NewServer("localhost", nil)
+	err := s.ParseData([]byte("example.com /foo bar\nexample.org /foo bar2\n/any any"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name             string
+		host             string
+		uri              string
+		expectedCode     int
+		expectedResponse string
+	}{
+		{
+			name:             "matching host",
+			host:             "example.com",
+			uri:              "/foo",
+			expectedCode:     http.StatusOK,
+			expectedResponse: "bar",
+		},
+		{
+			name:             "matching host ignores port and case",
+			host:             "EXAMPLE.org:8080",
+			uri:              "/foo",
+			expectedCode:     http.StatusOK,
+			expectedResponse: "bar2",
+		},
+		{
+			name:         "different host",
+			host:         "example.net",
+			uri:          "/foo",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:             "response for any host",
+			host:             "example.net",
+			uri:              "/any",
+			expectedCode:     http.StatusOK,
+			expectedResponse: "any",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.uri, nil)
+			req.Host = tc.host
+			w := httptest.NewRecorder()
+
+			s.handler(w, req)
+
+			if w.Code != tc.expectedCode {
+				t.Errorf("expected status code %d, got %d", tc.expectedCode, w.Code)
+			}
+
+			if w.Body.String() != tc.expectedResponse {
+				t.Errorf("expected response %q, got %q", tc.expectedResponse, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	var accessLog bytes.Buffer
+	s := NewServer("localhost", map[string]string{
+		"/foo": "bar",
+	})
+	s.AccessLog = &accessLog
+	s.RateLimiter = NewIPRateLimiter(rate.Limit(1), 1)
+	handler := s.instrument(http.HandlerFunc(s.handler))
+
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/foo", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("User-Agent", "acme-validator")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		statuses = append(statuses, w.Code)
+	}
+
+	expectedStatuses := []int{http.StatusOK, http.StatusTooManyRequests}
+	if !reflect.DeepEqual(statuses, expectedStatuses) {
+		t.Errorf("expected statuses %v, got %v", expectedStatuses, statuses)
+	}
+
+	decoder := json.NewDecoder(&accessLog)
+	for _, expectedStatus := range expectedStatuses {
+		var entry accessLogEntry
+		err := decoder.Decode(&entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if entry.Status != expectedStatus || entry.ClientIP != "10.0.0.1" || entry.UserAgent != "acme-validator" || entry.URI != "/foo" {
+			t.Errorf("unexpected access log entry: %#v", entry)
+		}
+	}
+}
+
+// lookupsCount returns the value of the lookups counter for the path and result and whether the series exists.
+func lookupsCount(t *testing.T, path, result string) (float64, bool) {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "openshift_acme_exposer_lookups_total" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["path"] == path && labels["result"] == result {
+				return metric.GetCounter().GetValue(), true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func TestLookupMetrics(t *testing.T) {
+	const (
+		filePath = "/.well-known/acme-challenge/metrics-file"
+		apiPath  = "/.well-known/acme-challenge/metrics-api"
+	)
+
+	s := NewServer("localhost", nil)
+	err := s.ReplaceData([]byte("example.com " + filePath + " file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetResponse("example.com", apiPath, "api")
+
+	otherBefore, _ := lookupsCount(t, lookupPathOther, lookupResultUnknown)
+
+	for _, r := range []struct {
+		host string
+		uri  string
+	}{
+		{host: "example.com", uri: filePath},
+		{host: "example.com", uri: filePath},
+		{host: "example.org", uri: filePath},
+		{host: "example.com", uri: apiPath},
+		{host: "example.com", uri: "/.well-known/acme-challenge/random-1"},
+		{host: "example.com", uri: "/.well-known/acme-challenge/random-2"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, r.uri, nil)
+		req.Host = r.host
+		s.handler(httptest.NewRecorder(), req)
+	}
+
+	for _, tc := range []struct {
+		path     string
+		result   string
+		expected float64
+	}{
+		{path: filePath, result: lookupResultHit, expected: 2},
+		{path: filePath, result: lookupResultMiss, expected: 1},
+		{path: apiPath, result: lookupResultHit, expected: 1},
+	} {
+		got, _ := lookupsCount(t, tc.path, tc.result)
+		if got != tc.expected {
+			t.Errorf("expected %v %s lookups for %q, got %v", tc.expected, tc.result, tc.path, got)
+		}
+	}
+
+	otherAfter, _ := lookupsCount(t, lookupPathOther, lookupResultUnknown)
+	if otherAfter-otherBefore != 2 {
+		t.Errorf("expected 2 lookups of paths that aren't served, got %v", otherAfter-otherBefore)
+	}
+
+	// Series for tokens that aren't served anymore have to go away.
+	err = s.ReplaceData(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range []string{lookupResultHit, lookupResultMiss} {
+		_, exists := lookupsCount(t, filePath, result)
+		if exists {
+			t.Errorf("expected %s series for %q to be deleted", result, filePath)
+		}
+	}
+	_, exists := lookupsCount(t, apiPath, lookupResultHit)
+	if !exists {
+		t.Errorf("expected series for %q to be kept", apiPath)
+	}
+
+	s.DeleteResponse("example.com", apiPath)
+	_, exists = lookupsCount(t, apiPath, lookupResultHit)
+	if exists {
+		t.Errorf("expected series for %q to be deleted", apiPath)
+	}
+}
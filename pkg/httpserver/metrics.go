@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog"
+)
+
+const (
+	MetricsPath = "/metrics"
+
+	// lookupResultHit is used for tokens served for the host.
+	lookupResultHit = "hit"
+	// lookupResultMiss is used for tokens served only for other hosts.
+	lookupResultMiss = "miss"
+	// lookupResultUnknown is used for paths that aren't served for any host.
+	lookupResultUnknown = "unknown"
+
+	// lookupPathOther is the path label used for all paths that aren't served for any host.
+	lookupPathOther = "other"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "openshift_acme_exposer_requests_total",
+			Help: "Number of http-01 requests handled by the exposer partitioned by response code.",
+		},
+		[]string{"code"},
+	)
+
+	// lookupsTotal uses the path as a label only while a token is served for it. Other paths share
+	// a single series and the series are deleted when the token goes away so random requests
+	// and rotating tokens can't blow up the metrics cardinality.
+	lookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "openshift_acme_exposer_lookups_total",
+			Help: "Number of token lookups partitioned by the served path and result (hit, miss or unknown).",
+		},
+		[]string{"path", "result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal)
+	prometheus.MustRegister(lookupsTotal)
+}
+
+// MetricsServer exposes Prometheus metrics.
+type MetricsServer struct {
+	server http.Server
+}
+
+func NewMetricsServer(listenAddr string) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, promhttp.Handler())
+
+	return &MetricsServer{
+		server: http.Server{
+			Addr:    listenAddr,
+			Handler: mux,
+		},
+	}
+}
+
+func (s *MetricsServer) Run() error {
+	klog.V(1).Infof("Metrics: server listening on http://%s%s", s.server.Addr, MetricsPath)
+
+	err := s.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		klog.Infof("Metrics server closed gracefully")
+		return nil
+	}
+
+	return err
+}
+
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	klog.Infof("Shutting down metrics server...")
+	defer klog.Infof("Metrics server shut down")
+
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimiterIdleTimeout is how long a client has to be inactive before we forget its limiter.
+	rateLimiterIdleTimeout = 3 * time.Minute
+)
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// IPRateLimiter limits requests per client IP using a token bucket for every client.
+type IPRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	now func() time.Time
+
+	mutex       sync.Mutex
+	limiters    map[string]*clientLimiter
+	lastCleanup time.Time
+}
+
+func NewIPRateLimiter(limit rate.Limit, burst int) *IPRateLimiter {
+	return &IPRateLimiter{
+		limit:    limit,
+		burst:    burst,
+		now:      time.Now,
+		limiters: make(map[string]*clientLimiter),
+	}
+}
+
+// Allow reports whether a request from the ip may happen now.
+func (l *IPRateLimiter) Allow(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+
+	if now.Sub(l.lastCleanup) > rateLimiterIdleTimeout {
+		for k, v := range l.limiters {
+			if now.Sub(v.lastSeen) > rateLimiterIdleTimeout {
+				delete(l.limiters, k)
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	cl, found := l.limiters[ip]
+	if !found {
+		cl = &clientLimiter{
+			limiter: rate.NewLimiter(l.limit, l.burst),
+		}
+		l.limiters[ip] = cl
+	}
+	cl.lastSeen = now
+
+	return cl.limiter.AllowN(now, 1)
+}
+
+// clientIP returns the IP of the client. When trustForwardedFor is set it uses the last address
+// from X-Forwarded-For header which is the one added by the router in front of us.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		forwardedFor := r.Header.Get("X-Forwarded-For")
+		if len(forwardedFor) != 0 {
+			parts := strings.Split(forwardedFor, ",")
+			ip := strings.TrimSpace(parts[len(parts)-1])
+			if len(ip) != 0 {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
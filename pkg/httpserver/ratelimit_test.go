@@ -0,0 +1,88 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestIPRateLimiter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewIPRateLimiter(rate.Limit(1), 2)
+	l.now = func() time.Time { return now }
+
+	for i, expected := range []bool{true, true, false} {
+		got := l.Allow("10.0.0.1")
+		if got != expected {
+			t.Errorf("request %d from 10.0.0.1: expected %t, got %t", i, expected, got)
+		}
+	}
+
+	if !l.Allow("10.0.0.2") {
+		t.Errorf("other client IPs shouldn't be limited")
+	}
+
+	now = now.Add(time.Second)
+	if !l.Allow("10.0.0.1") {
+		t.Errorf("expected a new token after 1s")
+	}
+
+	now = now.Add(2 * rateLimiterIdleTimeout)
+	l.Allow("10.0.0.3")
+	if len(l.limiters) != 1 {
+		t.Errorf("expected idle limiters to be cleaned up, got %d limiters", len(l.limiters))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tt := []struct {
+		name              string
+		remoteAddr        string
+		forwardedFor      string
+		trustForwardedFor bool
+		expected          string
+	}{
+		{
+			name:       "remote address",
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:         "untrusted X-Forwarded-For is ignored",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: "1.2.3.4",
+			expected:     "10.0.0.1",
+		},
+		{
+			name:              "trusted X-Forwarded-For uses the address added by the router",
+			remoteAddr:        "10.0.0.1:1234",
+			forwardedFor:      "6.6.6.6, 1.2.3.4",
+			trustForwardedFor: true,
+			expected:          "1.2.3.4",
+		},
+		{
+			name:              "trusted X-Forwarded-For falls back to the remote address",
+			remoteAddr:        "[fd00::1]:1234",
+			trustForwardedFor: true,
+			expected:          "fd00::1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if len(tc.forwardedFor) != 0 {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			got := clientIP(req, tc.trustForwardedFor)
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package keystore encodes certificates and private keys into keystore formats
+// used by Java and .NET workloads.
+package keystore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	jks "github.com/pavel-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// EncodePKCS12 encodes the private key and the certificate chain into a password protected PKCS#12 keystore.
+// The first certificate has to match the private key. It uses the legacy encryption algorithms
+// so older Java and Windows releases can read it.
+func EncodePKCS12(rand io.Reader, privateKey interface{}, chain []*x509.Certificate, password string) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain can't be empty")
+	}
+
+	return pkcs12.Encode(rand, privateKey, chain[0], chain[1:], password)
+}
+
+// EncodeJKS encodes the private key and the certificate chain into a Java KeyStore
+// with a single private key entry. The same password protects the key and the keystore.
+func EncodeJKS(privateKey interface{}, chain []*x509.Certificate, alias, password string, creationTime time.Time) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain can't be empty")
+	}
+
+	pkcs8Key, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal private key: %w", err)
+	}
+
+	entry := jks.PrivateKeyEntry{
+		CreationTime: creationTime,
+		PrivateKey:   pkcs8Key,
+	}
+	for _, c := range chain {
+		entry.CertificateChain = append(entry.CertificateChain, jks.Certificate{
+			Type:    "X.509",
+			Content: c.Raw,
+		})
+	}
+
+	ks := jks.New()
+	err = ks.SetPrivateKeyEntry(alias, entry, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	err = ks.Store(buf, []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,245 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	jks "github.com/pavel-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func newTestChain(t *testing.T, public interface{}) []*x509.Certificate {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "foo.example.com"},
+		DNSNames:     []string{"foo.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, public, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []*x509.Certificate{leaf, ca}
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name   string
+		key    interface{}
+		public interface{}
+	}{
+		{
+			name:   "RSA key",
+			key:    rsaKey,
+			public: &rsaKey.PublicKey,
+		},
+		{
+			name:   "EC key",
+			key:    ecKey,
+			public: &ecKey.PublicKey,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := newTestChain(t, tc.public)
+
+			data, err := EncodePKCS12(rand.Reader, tc.key, chain, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			key, certificate, caCerts, err := pkcs12.DecodeChain(data, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(key, tc.key) {
+				t.Errorf("decoded key doesn't match")
+			}
+
+			if !certificate.Equal(chain[0]) {
+				t.Errorf("decoded certificate doesn't match")
+			}
+
+			if len(caCerts) != 1 || !caCerts[0].Equal(chain[1]) {
+				t.Errorf("decoded chain doesn't match")
+			}
+
+			_, _, _, err = pkcs12.DecodeChain(data, "wrong")
+			if err != pkcs12.ErrIncorrectPassword {
+				t.Errorf("expected %v, got %v", pkcs12.ErrIncorrectPassword, err)
+			}
+		})
+	}
+}
+
+func TestEncodeJKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain(t, &key.PublicKey)
+
+	data, err := EncodeJKS(key, chain, "tls", "secret", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := jks.New()
+	err = ks.Load(bytes.NewReader(data), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := ks.Aliases()
+	if !reflect.DeepEqual(aliases, []string{"tls"}) {
+		t.Fatalf("expected aliases %q, got %q", []string{"tls"}, aliases)
+	}
+
+	entry, err := ks.GetPrivateKeyEntry("tls", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedKey, err := x509.ParsePKCS8PrivateKey(entry.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decodedKey, key) {
+		t.Errorf("decoded key doesn't match")
+	}
+
+	if len(entry.CertificateChain) != 2 ||
+		entry.CertificateChain[0].Type != "X.509" ||
+		!bytes.Equal(entry.CertificateChain[0].Content, chain[0].Raw) ||
+		!bytes.Equal(entry.CertificateChain[1].Content, chain[1].Raw) {
+		t.Errorf("decoded chain doesn't match")
+	}
+
+	err = ks.Load(bytes.NewReader(data), []byte("wrong"))
+	if err == nil {
+		t.Errorf("expected error for wrong password")
+	}
+
+	_, err = EncodeJKS(key, chain, "tls", "short", time.Now())
+	if err == nil {
+		t.Errorf("expected error for password shorter than 6 characters")
+	}
+}
+
+// TestEncodePKCS12OpenSSL checks that the keystore can be read by openssl.
+func TestEncodePKCS12OpenSSL(t *testing.T) {
+	opensslPath, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl isn't available")
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newTestChain(t, &key.PublicKey)
+
+	data, err := EncodePKCS12(rand.Reader, key, chain, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p12Path := filepath.Join(dir, "keystore.p12")
+	err = ioutil.WriteFile(p12Path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"pkcs12", "-in", p12Path, "-passin", "pass:secret", "-nodes"}
+	out, err := exec.Command(opensslPath, args...).Output()
+	if err != nil {
+		// OpenSSL 3 needs the legacy provider for the RC2 encrypted certificates.
+		out, err = exec.Command(opensslPath, append(args, "-legacy")...).Output()
+		if err != nil {
+			t.Fatalf("openssl can't read the keystore: %v", err)
+		}
+	}
+
+	var certificates [][]byte
+	var privateKeys int
+	for rest := out; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			certificates = append(certificates, block.Bytes)
+		case "PRIVATE KEY", "RSA PRIVATE KEY":
+			privateKeys++
+		}
+	}
+
+	if privateKeys != 1 {
+		t.Errorf("expected 1 private key, got %d", privateKeys)
+	}
+	if len(certificates) != 2 || !bytes.Equal(certificates[0], chain[0].Raw) || !bytes.Equal(certificates[1], chain[1].Raw) {
+		t.Errorf("openssl output doesn't contain the chain")
+	}
+}
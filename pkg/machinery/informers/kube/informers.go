@@ -1,58 +1,165 @@
 package kube
 
 import (
+	"sort"
+	"sync"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 )
 
+// NamespaceHandler sets up the informers for a namespace added after the controllers were created,
+// before they are started. It must not call back into the Interface.
+type NamespaceHandler func(namespace string, informers informers.SharedInformerFactory)
+
 type Interface interface {
 	Start(stopCh <-chan struct{})
 	InformersFor(namespace string) informers.SharedInformerFactory
 	InformersForOrGlobal(namespace string) informers.SharedInformerFactory
 	Namespaces() []string
+	HasInformersFor(namespace string) bool
+
+	// AddNamespaceHandler registers a handler called for every namespace added later on.
+	AddNamespaceHandler(handler NamespaceHandler)
+	// AddNamespace creates the informers for the namespace and starts them if Start was already called.
+	// It returns false if the namespace already has informers.
+	AddNamespace(namespace string) bool
+	// RemoveNamespace stops the informers for the namespace and forgets them.
+	RemoveNamespace(namespace string)
 }
 
-type kubeInformersForNamespaces map[string]informers.SharedInformerFactory
+type kubeInformersForNamespaces struct {
+	kubeClient kubernetes.Interface
 
-var _ Interface = kubeInformersForNamespaces{}
+	lock      sync.RWMutex
+	informers map[string]informers.SharedInformerFactory
+	stopChs   map[string]chan struct{}
+	handlers  []NamespaceHandler
+	// stopCh is set once the informers are started.
+	stopCh <-chan struct{}
+}
 
-func NewKubeInformersForNamespaces(kubeClient kubernetes.Interface, namespaces []string) kubeInformersForNamespaces {
-	res := kubeInformersForNamespaces{}
+var _ Interface = &kubeInformersForNamespaces{}
+
+func NewKubeInformersForNamespaces(kubeClient kubernetes.Interface, namespaces []string) *kubeInformersForNamespaces {
+	res := &kubeInformersForNamespaces{
+		kubeClient: kubeClient,
+		informers:  map[string]informers.SharedInformerFactory{},
+		stopChs:    map[string]chan struct{}{},
+	}
 
 	for _, namespace := range namespaces {
-		res[namespace] = informers.NewSharedInformerFactoryWithOptions(kubeClient, 0, informers.WithNamespace(namespace))
+		res.informers[namespace] = res.newInformers(namespace)
+		res.stopChs[namespace] = make(chan struct{})
 	}
 
 	return res
 }
 
-func (i kubeInformersForNamespaces) Start(stopCh <-chan struct{}) {
-	for _, informer := range i {
-		informer.Start(stopCh)
+func (i *kubeInformersForNamespaces) newInformers(namespace string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(i.kubeClient, 0, informers.WithNamespace(namespace))
+}
+
+// start runs the informers until either the namespace is removed or everything is stopped.
+func (i *kubeInformersForNamespaces) start(namespace string) {
+	namespaceStopCh := i.stopChs[namespace]
+	stopCh := make(chan struct{})
+	go func() {
+		defer close(stopCh)
+		select {
+		case <-i.stopCh:
+		case <-namespaceStopCh:
+		}
+	}()
+
+	i.informers[namespace].Start(stopCh)
+}
+
+func (i *kubeInformersForNamespaces) Start(stopCh <-chan struct{}) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.stopCh = stopCh
+	for namespace := range i.informers {
+		i.start(namespace)
 	}
 }
 
-func (i kubeInformersForNamespaces) Namespaces() []string {
+func (i *kubeInformersForNamespaces) Namespaces() []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	var ns []string
-	for n := range i {
+	for n := range i.informers {
 		ns = append(ns, n)
 	}
+	sort.Strings(ns)
 	return ns
 }
 
-func (i kubeInformersForNamespaces) InformersFor(namespace string) informers.SharedInformerFactory {
-	return i[namespace]
+func (i *kubeInformersForNamespaces) InformersFor(namespace string) informers.SharedInformerFactory {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.informers[namespace]
 }
 
-func (i kubeInformersForNamespaces) InformersForOrGlobal(namespace string) informers.SharedInformerFactory {
-	informer, ok := i[namespace]
+func (i *kubeInformersForNamespaces) InformersForOrGlobal(namespace string) informers.SharedInformerFactory {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	informer, ok := i.informers[namespace]
 	if !ok {
-		return i[metav1.NamespaceAll]
+		return i.informers[metav1.NamespaceAll]
 	}
 	return informer
 }
 
-func (i kubeInformersForNamespaces) HasInformersFor(namespace string) bool {
+func (i *kubeInformersForNamespaces) HasInformersFor(namespace string) bool {
 	return i.InformersFor(namespace) != nil
 }
+
+func (i *kubeInformersForNamespaces) AddNamespaceHandler(handler NamespaceHandler) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *kubeInformersForNamespaces) AddNamespace(namespace string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	_, ok := i.informers[namespace]
+	if ok {
+		return false
+	}
+
+	informers := i.newInformers(namespace)
+	for _, handler := range i.handlers {
+		handler(namespace, informers)
+	}
+
+	i.informers[namespace] = informers
+	i.stopChs[namespace] = make(chan struct{})
+	if i.stopCh != nil {
+		i.start(namespace)
+	}
+
+	return true
+}
+
+func (i *kubeInformersForNamespaces) RemoveNamespace(namespace string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	stopCh, ok := i.stopChs[namespace]
+	if !ok {
+		return
+	}
+
+	close(stopCh)
+	delete(i.stopChs, namespace)
+	delete(i.informers, namespace)
+}
@@ -1,58 +1,165 @@
 package kube
 
 import (
+	"sort"
+	"sync"
+
 	routeclientset "github.com/openshift/client-go/route/clientset/versioned"
 	routeinformers "github.com/openshift/client-go/route/informers/externalversions"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// NamespaceHandler sets up the informers for a namespace added after the controllers were created,
+// before they are started. It must not call back into the Interface.
+type NamespaceHandler func(namespace string, informers routeinformers.SharedInformerFactory)
+
 type Interface interface {
 	Start(stopCh <-chan struct{})
 	InformersFor(namespace string) routeinformers.SharedInformerFactory
 	InformersForOrGlobal(namespace string) routeinformers.SharedInformerFactory
 	Namespaces() []string
+	HasInformersFor(namespace string) bool
+
+	// AddNamespaceHandler registers a handler called for every namespace added later on.
+	AddNamespaceHandler(handler NamespaceHandler)
+	// AddNamespace creates the informers for the namespace and starts them if Start was already called.
+	// It returns false if the namespace already has informers.
+	AddNamespace(namespace string) bool
+	// RemoveNamespace stops the informers for the namespace and forgets them.
+	RemoveNamespace(namespace string)
 }
 
-type routeInformersForNamespaces map[string]routeinformers.SharedInformerFactory
+type routeInformersForNamespaces struct {
+	routeClient routeclientset.Interface
 
-var _ Interface = routeInformersForNamespaces{}
+	lock      sync.RWMutex
+	informers map[string]routeinformers.SharedInformerFactory
+	stopChs   map[string]chan struct{}
+	handlers  []NamespaceHandler
+	// stopCh is set once the informers are started.
+	stopCh <-chan struct{}
+}
 
-func NewRouteInformersForNamespaces(routeClient routeclientset.Interface, namespaces []string) routeInformersForNamespaces {
-	res := routeInformersForNamespaces{}
+var _ Interface = &routeInformersForNamespaces{}
+
+func NewRouteInformersForNamespaces(routeClient routeclientset.Interface, namespaces []string) *routeInformersForNamespaces {
+	res := &routeInformersForNamespaces{
+		routeClient: routeClient,
+		informers:   map[string]routeinformers.SharedInformerFactory{},
+		stopChs:     map[string]chan struct{}{},
+	}
 
 	for _, namespace := range namespaces {
-		res[namespace] = routeinformers.NewSharedInformerFactoryWithOptions(routeClient, 0, routeinformers.WithNamespace(namespace))
+		res.informers[namespace] = res.newInformers(namespace)
+		res.stopChs[namespace] = make(chan struct{})
 	}
 
 	return res
 }
 
-func (i routeInformersForNamespaces) Start(stopCh <-chan struct{}) {
-	for _, informer := range i {
-		informer.Start(stopCh)
+func (i *routeInformersForNamespaces) newInformers(namespace string) routeinformers.SharedInformerFactory {
+	return routeinformers.NewSharedInformerFactoryWithOptions(i.routeClient, 0, routeinformers.WithNamespace(namespace))
+}
+
+// start runs the informers until either the namespace is removed or everything is stopped.
+func (i *routeInformersForNamespaces) start(namespace string) {
+	namespaceStopCh := i.stopChs[namespace]
+	stopCh := make(chan struct{})
+	go func() {
+		defer close(stopCh)
+		select {
+		case <-i.stopCh:
+		case <-namespaceStopCh:
+		}
+	}()
+
+	i.informers[namespace].Start(stopCh)
+}
+
+func (i *routeInformersForNamespaces) Start(stopCh <-chan struct{}) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.stopCh = stopCh
+	for namespace := range i.informers {
+		i.start(namespace)
 	}
 }
 
-func (i routeInformersForNamespaces) Namespaces() []string {
+func (i *routeInformersForNamespaces) Namespaces() []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
 	var ns []string
-	for n := range i {
+	for n := range i.informers {
 		ns = append(ns, n)
 	}
+	sort.Strings(ns)
 	return ns
 }
 
-func (i routeInformersForNamespaces) InformersFor(namespace string) routeinformers.SharedInformerFactory {
-	return i[namespace]
+func (i *routeInformersForNamespaces) InformersFor(namespace string) routeinformers.SharedInformerFactory {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	return i.informers[namespace]
 }
 
-func (i routeInformersForNamespaces) InformersForOrGlobal(namespace string) routeinformers.SharedInformerFactory {
-	informer, ok := i[namespace]
+func (i *routeInformersForNamespaces) InformersForOrGlobal(namespace string) routeinformers.SharedInformerFactory {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	informer, ok := i.informers[namespace]
 	if !ok {
-		return i[metav1.NamespaceAll]
+		return i.informers[metav1.NamespaceAll]
 	}
 	return informer
 }
 
-func (i routeInformersForNamespaces) HasInformersFor(namespace string) bool {
+func (i *routeInformersForNamespaces) HasInformersFor(namespace string) bool {
 	return i.InformersFor(namespace) != nil
 }
+
+func (i *routeInformersForNamespaces) AddNamespaceHandler(handler NamespaceHandler) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *routeInformersForNamespaces) AddNamespace(namespace string) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	_, ok := i.informers[namespace]
+	if ok {
+		return false
+	}
+
+	informers := i.newInformers(namespace)
+	for _, handler := range i.handlers {
+		handler(namespace, informers)
+	}
+
+	i.informers[namespace] = informers
+	i.stopChs[namespace] = make(chan struct{})
+	if i.stopCh != nil {
+		i.start(namespace)
+	}
+
+	return true
+}
+
+func (i *routeInformersForNamespaces) RemoveNamespace(namespace string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	stopCh, ok := i.stopChs[namespace]
+	if !ok {
+		return
+	}
+
+	close(stopCh)
+	delete(i.stopChs, namespace)
+	delete(i.informers, namespace)
+}
@@ -0,0 +1,498 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/net/publicsuffix"
+	"k8s.io/klog"
+)
+
+const (
+	// DefaultRateLimitedDelay is used when the CA reports that we are rate limited without sending Retry-After.
+	DefaultRateLimitedDelay = 15 * time.Minute
+
+	// gcInterval is the time that has to pass before the next garbage collection of idle buckets.
+	gcInterval = 10 * time.Minute
+
+	// maxRetryBackoff caps the delay between retries of failed requests within a single ACME call.
+	maxRetryBackoff = 10 * time.Second
+
+	LetsEncryptProductionDirectoryURL = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingDirectoryURL    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+)
+
+// Limit allows Count events per Window. Zero Count disables the limit.
+type Limit struct {
+	Count  int
+	Window time.Duration
+}
+
+// Limits models the rate limits enforced by a CA.
+type Limits struct {
+	// NewOrdersPerAccount limits the number of new orders created by an account.
+	NewOrdersPerAccount Limit
+	// CertificatesPerRegisteredDomain limits the number of certificates issued for a registered domain.
+	CertificatesPerRegisteredDomain Limit
+	// DuplicateCertificates limits the number of certificates issued for the exact same set of hostnames.
+	DuplicateCertificates Limit
+	// FailedValidations limits the number of failed validations per account and hostname.
+	FailedValidations Limit
+}
+
+var (
+	// LetsEncryptProductionLimits as documented at https://letsencrypt.org/docs/rate-limits/
+	LetsEncryptProductionLimits = Limits{
+		NewOrdersPerAccount:             Limit{Count: 300, Window: 3 * time.Hour},
+		CertificatesPerRegisteredDomain: Limit{Count: 50, Window: 7 * 24 * time.Hour},
+		DuplicateCertificates:           Limit{Count: 5, Window: 7 * 24 * time.Hour},
+		FailedValidations:               Limit{Count: 5, Window: time.Hour},
+	}
+
+	// LetsEncryptStagingLimits as documented at https://letsencrypt.org/docs/staging-environment/
+	LetsEncryptStagingLimits = Limits{
+		NewOrdersPerAccount:             Limit{Count: 1500, Window: 3 * time.Hour},
+		CertificatesPerRegisteredDomain: Limit{Count: 30000, Window: 7 * 24 * time.Hour},
+		DuplicateCertificates:           Limit{Count: 30000, Window: 7 * 24 * time.Hour},
+		FailedValidations:               Limit{Count: 60, Window: time.Hour},
+	}
+)
+
+// LimitsForDirectoryURL returns the known limits for a CA. Unknown CAs aren't limited proactively
+// and we rely only on them reporting that we are rate limited.
+func LimitsForDirectoryURL(directoryURL string) Limits {
+	switch strings.TrimSuffix(directoryURL, "/") {
+	case LetsEncryptProductionDirectoryURL:
+		return LetsEncryptProductionLimits
+	case LetsEncryptStagingDirectoryURL:
+		return LetsEncryptStagingLimits
+	default:
+		return Limits{}
+	}
+}
+
+// ForShards returns the share of the limits for one of count shards, so replicas managing different shards
+// can't exceed the limits together. Only the limits shared by many Routes are divided; duplicate certificates
+// and failed validations are counted per hostname, which belongs to a single shard.
+// Every divided limit keeps at least 1 so it isn't disabled.
+func (l Limits) ForShards(count int) Limits {
+	if count <= 1 {
+		return l
+	}
+
+	divide := func(limit Limit) Limit {
+		if limit.Count <= 0 {
+			return limit
+		}
+		limit.Count /= count
+		if limit.Count < 1 {
+			limit.Count = 1
+		}
+		return limit
+	}
+
+	res := l
+	res.NewOrdersPerAccount = divide(l.NewOrdersPerAccount)
+	res.CertificatesPerRegisteredDomain = divide(l.CertificatesPerRegisteredDomain)
+	return res
+}
+
+// tokenBucket holds up to capacity tokens and refills them continuously over the window.
+type tokenBucket struct {
+	capacity float64
+	// refillRate is the number of tokens added per second.
+	refillRate float64
+	tokens     float64
+	last       time.Time
+}
+
+func newTokenBucket(limit Limit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity:   float64(limit.Count),
+		refillRate: float64(limit.Count) / limit.Window.Seconds(),
+		tokens:     float64(limit.Count),
+		last:       now,
+	}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.refillRate)
+		b.last = now
+	}
+}
+
+// delay returns the time until a token is available.
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	b.advance(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration(math.Ceil((1 - b.tokens) / b.refillRate * float64(time.Second)))
+}
+
+func (b *tokenBucket) take(now time.Time) {
+	b.advance(now)
+	b.tokens--
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	b.advance(now)
+	return b.tokens >= b.capacity
+}
+
+// bucketSet holds token buckets for a single kind of limit partitioned by a key.
+type bucketSet struct {
+	limit   Limit
+	buckets map[string]*tokenBucket
+}
+
+func newBucketSet(limit Limit) *bucketSet {
+	return &bucketSet{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (s *bucketSet) get(key string, now time.Time) *tokenBucket {
+	if s.limit.Count <= 0 || s.limit.Window <= 0 {
+		return nil
+	}
+
+	b, found := s.buckets[key]
+	if !found {
+		b = newTokenBucket(s.limit, now)
+		s.buckets[key] = b
+	}
+
+	return b
+}
+
+func (s *bucketSet) delay(key string, now time.Time) time.Duration {
+	b := s.get(key, now)
+	if b == nil {
+		return 0
+	}
+
+	return b.delay(now)
+}
+
+func (s *bucketSet) take(key string, now time.Time) {
+	b := s.get(key, now)
+	if b == nil {
+		return
+	}
+
+	b.take(now)
+}
+
+// gc removes buckets which are full and therefore equivalent to new ones.
+func (s *bucketSet) gc(now time.Time) {
+	for k, b := range s.buckets {
+		if b.full(now) {
+			delete(s.buckets, k)
+		}
+	}
+}
+
+type issuerState struct {
+	newOrders                       *bucketSet
+	certificatesPerRegisteredDomain *bucketSet
+	duplicateCertificates           *bucketSet
+	failedValidations               *bucketSet
+
+	// blockedUntil holds the time until which the CA told us not to create orders for a registered domain.
+	blockedUntil map[string]time.Time
+}
+
+func newIssuerState(limits Limits) *issuerState {
+	return &issuerState{
+		newOrders:                       newBucketSet(limits.NewOrdersPerAccount),
+		certificatesPerRegisteredDomain: newBucketSet(limits.CertificatesPerRegisteredDomain),
+		duplicateCertificates:           newBucketSet(limits.DuplicateCertificates),
+		failedValidations:               newBucketSet(limits.FailedValidations),
+		blockedUntil:                    make(map[string]time.Time),
+	}
+}
+
+// Scheduler decides when orders can be created so we stay within the CA rate limits
+// instead of burning attempts. It is shared by all workers and keeps the state per issuer (CA and account).
+type Scheduler struct {
+	mutex   sync.Mutex
+	now     func() time.Time
+	issuers map[string]*issuerState
+	limits  map[string]Limits
+	// shards is the number of shards sharing the limits. Every Scheduler manages a single shard's share.
+	shards int
+	lastGC time.Time
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		now:     time.Now,
+		issuers: make(map[string]*issuerState),
+		limits:  make(map[string]Limits),
+	}
+}
+
+// SetLimits overrides the limits for a CA identified by its directory URL.
+func (s *Scheduler) SetLimits(directoryURL string, limits Limits) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.limits[directoryURL] = limits
+	for key := range s.issuers {
+		if strings.HasPrefix(key, directoryURL+" ") {
+			delete(s.issuers, key)
+		}
+	}
+}
+
+// SetShards divides the limits between the shards, as every replica tracks only the orders it creates itself.
+func (s *Scheduler) SetShards(count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.shards = count
+	s.issuers = make(map[string]*issuerState)
+}
+
+func (s *Scheduler) issuer(directoryURL, accountURI string) *issuerState {
+	key := directoryURL + " " + accountURI
+	state, found := s.issuers[key]
+	if !found {
+		limits, found := s.limits[directoryURL]
+		if !found {
+			limits = LimitsForDirectoryURL(directoryURL)
+		}
+		state = newIssuerState(limits.ForShards(s.shards))
+		s.issuers[key] = state
+	}
+
+	return state
+}
+
+func (s *Scheduler) gc(now time.Time) {
+	if now.Sub(s.lastGC) < gcInterval {
+		return
+	}
+	s.lastGC = now
+
+	for _, state := range s.issuers {
+		state.newOrders.gc(now)
+		state.certificatesPerRegisteredDomain.gc(now)
+		state.duplicateCertificates.gc(now)
+		state.failedValidations.gc(now)
+		for k, t := range state.blockedUntil {
+			if !now.Before(t) {
+				delete(state.blockedUntil, k)
+			}
+		}
+	}
+}
+
+// RegisteredDomain returns the domain name registered with a public suffix registry, e.g. example.com for www.example.com.
+func RegisteredDomain(domain string) string {
+	registeredDomain, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return domain
+	}
+
+	return registeredDomain
+}
+
+func registeredDomains(domains []string) []string {
+	set := make(map[string]struct{}, len(domains))
+	for _, d := range domains {
+		set[RegisteredDomain(d)] = struct{}{}
+	}
+
+	var res []string
+	for d := range set {
+		res = append(res, d)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func domainSetKey(domains []string) string {
+	sorted := make([]string, len(domains))
+	copy(sorted, domains)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// ReserveOrder checks whether a new order for the domains can be created now. If it can,
+// it consumes the tokens for the new order and returns zero delay. Otherwise it returns
+// the delay after which it makes sense to try again and the reason.
+func (s *Scheduler) ReserveOrder(directoryURL, accountURI string, domains []string) (time.Duration, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	s.gc(now)
+	state := s.issuer(directoryURL, accountURI)
+
+	var delay time.Duration
+	var reasons []string
+	check := func(d time.Duration, reason string) {
+		if d <= 0 {
+			return
+		}
+		if d > delay {
+			delay = d
+		}
+		reasons = append(reasons, reason)
+	}
+
+	for _, d := range registeredDomains(domains) {
+		check(state.blockedUntil[d].Sub(now), fmt.Sprintf("CA reported rate limit for registered domain %q", d))
+		check(state.certificatesPerRegisteredDomain.delay(d, now), fmt.Sprintf("certificates per registered domain %q", d))
+	}
+	check(state.newOrders.delay("", now), "new orders per account")
+	check(state.duplicateCertificates.delay(domainSetKey(domains), now), "duplicate certificates")
+	for _, d := range domains {
+		check(state.failedValidations.delay(d, now), fmt.Sprintf("failed validations for %q", d))
+	}
+
+	if delay > 0 {
+		return delay, strings.Join(reasons, ", ")
+	}
+
+	state.newOrders.take("", now)
+
+	return 0, ""
+}
+
+// RecordCertificate accounts for a certificate issued for the domains.
+func (s *Scheduler) RecordCertificate(directoryURL, accountURI string, domains []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	state := s.issuer(directoryURL, accountURI)
+
+	for _, d := range registeredDomains(domains) {
+		state.certificatesPerRegisteredDomain.take(d, now)
+	}
+	state.duplicateCertificates.take(domainSetKey(domains), now)
+}
+
+// RecordFailedValidation accounts for a failed validation of the domain.
+func (s *Scheduler) RecordFailedValidation(directoryURL, accountURI string, domain string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.issuer(directoryURL, accountURI).failedValidations.take(domain, s.now())
+}
+
+// RecordRateLimited blocks new orders for the registered domains because the CA reported we are rate limited.
+// Zero retryAfter uses DefaultRateLimitedDelay. It returns the time until which the orders are blocked.
+func (s *Scheduler) RecordRateLimited(directoryURL, accountURI string, domains []string, retryAfter time.Duration) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if retryAfter <= 0 {
+		retryAfter = DefaultRateLimitedDelay
+	}
+
+	now := s.now()
+	until := now.Add(retryAfter)
+	state := s.issuer(directoryURL, accountURI)
+	for _, d := range registeredDomains(domains) {
+		if until.After(state.blockedUntil[d]) {
+			state.blockedUntil[d] = until
+		}
+	}
+
+	klog.V(2).Infof("CA %q rate limited orders for %v until %v", directoryURL, domains, until)
+
+	return until
+}
+
+// ParseRetryAfter parses the value of Retry-After header which is either a number of seconds or an HTTP date.
+func ParseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(v)
+	if err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
+
+// IsRateLimited reports whether the err is an ACME rateLimited problem and the Retry-After duration, if the CA sent it.
+func IsRateLimited(err error) (time.Duration, bool) {
+	var acmeErr *acme.Error
+	if !errors.As(err, &acmeErr) {
+		return 0, false
+	}
+
+	// Some CA implementations may return incorrect problem type case.
+	if !strings.HasSuffix(strings.ToLower(acmeErr.ProblemType), ":ratelimited") && acmeErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if acmeErr.Header == nil {
+		return 0, true
+	}
+
+	retryAfter, _ := ParseRetryAfter(acmeErr.Header.Get("Retry-After"), time.Now())
+
+	return retryAfter, true
+}
+
+// AcmeRetryBackoff is used as acme.Client.RetryBackoff. It doesn't retry when we are rate limited
+// so the Scheduler can defer the Route instead of blocking a worker for the whole Retry-After period.
+func AcmeRetryBackoff(n int, r *http.Request, resp *http.Response) time.Duration {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0
+	}
+
+	d, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		if n < 1 {
+			n = 1
+		}
+		if n > 30 {
+			n = 30
+		}
+		d = time.Duration(1<<uint(n-1)) * time.Second
+	}
+
+	if d <= 0 {
+		d = time.Millisecond
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+
+	return d
+}
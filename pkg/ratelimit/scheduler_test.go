@@ -0,0 +1,283 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const testDirectoryURL = "https://acme.example.com/directory"
+
+func newTestScheduler(now *time.Time, limits Limits) *Scheduler {
+	s := NewScheduler()
+	s.now = func() time.Time { return *now }
+	s.SetLimits(testDirectoryURL, limits)
+	return s
+}
+
+func TestSchedulerNewOrders(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestScheduler(&now, Limits{
+		NewOrdersPerAccount: Limit{Count: 2, Window: 2 * time.Hour},
+	})
+
+	for i := 0; i < 2; i++ {
+		delay, reason := s.ReserveOrder(testDirectoryURL, "account", []string{fmt.Sprintf("%d.example.com", i)})
+		if delay != 0 {
+			t.Fatalf("order %d: expected no delay, got %v: %s", i, delay, reason)
+		}
+	}
+
+	delay, _ := s.ReserveOrder(testDirectoryURL, "account", []string{"3.example.com"})
+	if delay != time.Hour {
+		t.Errorf("expected delay %v, got %v", time.Hour, delay)
+	}
+
+	delay, _ = s.ReserveOrder(testDirectoryURL, "other-account", []string{"3.example.com"})
+	if delay != 0 {
+		t.Errorf("expected accounts to be limited independently, got delay %v", delay)
+	}
+
+	now = now.Add(time.Hour)
+	delay, _ = s.ReserveOrder(testDirectoryURL, "account", []string{"3.example.com"})
+	if delay != 0 {
+		t.Errorf("expected the bucket to refill, got delay %v", delay)
+	}
+}
+
+func TestSchedulerCertificates(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestScheduler(&now, Limits{
+		CertificatesPerRegisteredDomain: Limit{Count: 2, Window: 7 * 24 * time.Hour},
+		DuplicateCertificates:           Limit{Count: 1, Window: 7 * 24 * time.Hour},
+	})
+
+	s.RecordCertificate(testDirectoryURL, "account", []string{"a.example.com"})
+
+	delay, _ := s.ReserveOrder(testDirectoryURL, "account", []string{"a.example.com"})
+	if delay == 0 {
+		t.Errorf("expected duplicate certificate to be deferred")
+	}
+
+	delay, reason := s.ReserveOrder(testDirectoryURL, "account", []string{"b.example.com"})
+	if delay != 0 {
+		t.Errorf("expected no delay, got %v: %s", delay, reason)
+	}
+
+	s.RecordCertificate(testDirectoryURL, "account", []string{"b.example.com"})
+
+	delay, _ = s.ReserveOrder(testDirectoryURL, "account", []string{"c.example.com"})
+	if delay == 0 {
+		t.Errorf("expected registered domain example.com to be limited")
+	}
+
+	delay, reason = s.ReserveOrder(testDirectoryURL, "account", []string{"c.example.org"})
+	if delay != 0 {
+		t.Errorf("expected other registered domains not to be limited, got %v: %s", delay, reason)
+	}
+}
+
+func TestSchedulerFailedValidations(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestScheduler(&now, Limits{
+		FailedValidations: Limit{Count: 1, Window: time.Hour},
+	})
+
+	s.RecordFailedValidation(testDirectoryURL, "account", "a.example.com")
+
+	delay, _ := s.ReserveOrder(testDirectoryURL, "account", []string{"a.example.com"})
+	if delay != time.Hour {
+		t.Errorf("expected delay %v, got %v", time.Hour, delay)
+	}
+
+	delay, _ = s.ReserveOrder(testDirectoryURL, "account", []string{"b.example.com"})
+	if delay != 0 {
+		t.Errorf("expected other hostnames not to be limited, got %v", delay)
+	}
+}
+
+func TestSchedulerRecordRateLimited(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestScheduler(&now, Limits{})
+
+	until := s.RecordRateLimited(testDirectoryURL, "account", []string{"a.example.com"}, 0)
+	if !until.Equal(now.Add(DefaultRateLimitedDelay)) {
+		t.Errorf("expected default delay, got until %v", until)
+	}
+
+	delay, _ := s.ReserveOrder(testDirectoryURL, "account", []string{"b.example.com"})
+	if delay != DefaultRateLimitedDelay {
+		t.Errorf("expected the whole registered domain to be blocked for %v, got %v", DefaultRateLimitedDelay, delay)
+	}
+
+	now = now.Add(DefaultRateLimitedDelay)
+	delay, _ = s.ReserveOrder(testDirectoryURL, "account", []string{"b.example.com"})
+	if delay != 0 {
+		t.Errorf("expected the block to expire, got %v", delay)
+	}
+}
+
+func TestLimitsForShards(t *testing.T) {
+	limits := LetsEncryptProductionLimits.ForShards(8)
+
+	expected := Limits{
+		NewOrdersPerAccount:             Limit{Count: 37, Window: 3 * time.Hour},
+		CertificatesPerRegisteredDomain: Limit{Count: 6, Window: 7 * 24 * time.Hour},
+		DuplicateCertificates:           Limit{Count: 5, Window: 7 * 24 * time.Hour},
+		FailedValidations:               Limit{Count: 5, Window: time.Hour},
+	}
+	if limits != expected {
+		t.Errorf("expected %#v, got %#v", expected, limits)
+	}
+
+	limits = Limits{NewOrdersPerAccount: Limit{Count: 3, Window: time.Hour}}.ForShards(8)
+	if limits.NewOrdersPerAccount.Count != 1 {
+		t.Errorf("expected divided limit to stay enabled, got %d", limits.NewOrdersPerAccount.Count)
+	}
+	if limits.CertificatesPerRegisteredDomain.Count != 0 {
+		t.Errorf("expected disabled limit to stay disabled, got %d", limits.CertificatesPerRegisteredDomain.Count)
+	}
+
+	if limits := LetsEncryptProductionLimits.ForShards(1); limits != LetsEncryptProductionLimits {
+		t.Errorf("expected a single shard to get all the limits, got %#v", limits)
+	}
+}
+
+func TestSchedulerShards(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newTestScheduler(&now, Limits{
+		NewOrdersPerAccount: Limit{Count: 4, Window: 4 * time.Hour},
+	})
+	s.SetShards(2)
+
+	for i := 0; i < 2; i++ {
+		delay, reason := s.ReserveOrder(testDirectoryURL, "account", []string{fmt.Sprintf("%d.example.com", i)})
+		if delay != 0 {
+			t.Fatalf("order %d: expected no delay, got %v: %s", i, delay, reason)
+		}
+	}
+
+	delay, _ := s.ReserveOrder(testDirectoryURL, "account", []string{"2.example.com"})
+	if delay != 2*time.Hour {
+		t.Errorf("expected delay %v, got %v", 2*time.Hour, delay)
+	}
+}
+
+func TestLimitsForDirectoryURL(t *testing.T) {
+	if LimitsForDirectoryURL(LetsEncryptProductionDirectoryURL) != LetsEncryptProductionLimits {
+		t.Errorf("expected Let's Encrypt production limits")
+	}
+	if LimitsForDirectoryURL(LetsEncryptStagingDirectoryURL+"/") != LetsEncryptStagingLimits {
+		t.Errorf("expected Let's Encrypt staging limits")
+	}
+	if LimitsForDirectoryURL(testDirectoryURL) != (Limits{}) {
+		t.Errorf("expected no limits for unknown CA")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:  "empty",
+			value: "",
+			ok:    false,
+		},
+		{
+			name:     "seconds",
+			value:    "120",
+			expected: 2 * time.Minute,
+			ok:       true,
+		},
+		{
+			name:  "negative seconds",
+			value: "-1",
+			ok:    false,
+		},
+		{
+			name:     "HTTP date",
+			value:    now.Add(time.Hour).Format(http.TimeFormat),
+			expected: time.Hour,
+			ok:       true,
+		},
+		{
+			name:     "HTTP date in the past",
+			value:    now.Add(-time.Hour).Format(http.TimeFormat),
+			expected: 0,
+			ok:       true,
+		},
+		{
+			name:  "garbage",
+			value: "soon",
+			ok:    false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := ParseRetryAfter(tc.value, now)
+			if ok != tc.ok || got != tc.expected {
+				t.Errorf("expected (%v, %t), got (%v, %t)", tc.expected, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	tt := []struct {
+		name       string
+		err        error
+		retryAfter time.Duration
+		ok         bool
+	}{
+		{
+			name: "other error",
+			err:  fmt.Errorf("boom"),
+			ok:   false,
+		},
+		{
+			name: "other ACME problem",
+			err: &acme.Error{
+				StatusCode:  http.StatusBadRequest,
+				ProblemType: "urn:ietf:params:acme:error:malformed",
+			},
+			ok: false,
+		},
+		{
+			name: "rate limited without Retry-After",
+			err: &acme.Error{
+				StatusCode:  http.StatusTooManyRequests,
+				ProblemType: "urn:ietf:params:acme:error:rateLimited",
+			},
+			ok: true,
+		},
+		{
+			name: "wrapped rate limited with Retry-After",
+			err: fmt.Errorf("can't create order: %w", &acme.Error{
+				StatusCode:  http.StatusTooManyRequests,
+				ProblemType: "urn:ietf:params:acme:error:rateLimited",
+				Header:      http.Header{"Retry-After": []string{"3600"}},
+			}),
+			retryAfter: time.Hour,
+			ok:         true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			retryAfter, ok := IsRateLimited(tc.err)
+			if ok != tc.ok || retryAfter != tc.retryAfter {
+				t.Errorf("expected (%v, %t), got (%v, %t)", tc.retryAfter, tc.ok, retryAfter, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package renewal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxFraction caps how early in the certificate lifetime a renewal can start
+	// so a misconfigured window can't make a fresh certificate due for renewal right away.
+	MaxFraction = 0.9
+
+	DefaultRenewBefore          = "1/3"
+	DefaultProactiveRenewBefore = "1/2"
+)
+
+// Threshold is the time remaining until the certificate expiry, given either
+// as an absolute duration or as a fraction of the certificate lifetime.
+type Threshold struct {
+	value    string
+	duration time.Duration
+	fraction float64
+}
+
+// ParseThreshold parses a duration (e.g. "720h") or a fraction of the lifetime
+// written as a decimal number (e.g. "0.25") or a ratio (e.g. "1/3").
+func ParseThreshold(s string) (Threshold, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return Threshold{}, fmt.Errorf("threshold can't be empty")
+	}
+
+	var fraction float64
+	var err error
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) == 2 {
+		var numerator, denominator float64
+		numerator, err = strconv.ParseFloat(parts[0], 64)
+		if err == nil {
+			denominator, err = strconv.ParseFloat(parts[1], 64)
+		}
+		if err != nil {
+			return Threshold{}, fmt.Errorf("invalid ratio %q: %w", s, err)
+		}
+		if denominator == 0 {
+			return Threshold{}, fmt.Errorf("invalid ratio %q: division by zero", s)
+		}
+		fraction = numerator / denominator
+	} else {
+		fraction, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			duration, err := time.ParseDuration(s)
+			if err != nil {
+				return Threshold{}, fmt.Errorf("%q is neither a duration nor a fraction", s)
+			}
+			if duration <= 0 {
+				return Threshold{}, fmt.Errorf("duration %q has to be positive", s)
+			}
+
+			return Threshold{value: s, duration: duration}, nil
+		}
+	}
+
+	if math.IsNaN(fraction) || fraction <= 0 || fraction > MaxFraction {
+		return Threshold{}, fmt.Errorf("fraction %q has to be in (0, %v]", s, MaxFraction)
+	}
+
+	return Threshold{value: s, fraction: fraction}, nil
+}
+
+func MustParseThreshold(s string) Threshold {
+	t, err := ParseThreshold(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Before returns the remaining time before the expiry for a certificate with the lifetime.
+func (t Threshold) Before(lifetime time.Duration) time.Duration {
+	max := time.Duration(float64(lifetime) * MaxFraction)
+	if t.duration != 0 {
+		if t.duration > max {
+			return max
+		}
+		return t.duration
+	}
+
+	return time.Duration(float64(lifetime) * t.fraction)
+}
+
+func (t Threshold) String() string {
+	return t.value
+}
+
+// Window determines when a certificate gets renewed. Renewal is required once less than RenewBefore
+// remains until the expiry. Between ProactiveRenewBefore and RenewBefore the renewals are spread
+// to avoid spikes when many certificates were issued at the same time.
+type Window struct {
+	RenewBefore          Threshold
+	ProactiveRenewBefore Threshold
+}
+
+func DefaultWindow() Window {
+	return Window{
+		RenewBefore:          MustParseThreshold(DefaultRenewBefore),
+		ProactiveRenewBefore: MustParseThreshold(DefaultProactiveRenewBefore),
+	}
+}
+
+// Override returns a copy of the window with thresholds replaced by the non-empty values.
+func (w Window) Override(renewBefore, proactiveRenewBefore string) (Window, error) {
+	res := w
+
+	if len(renewBefore) != 0 {
+		t, err := ParseThreshold(renewBefore)
+		if err != nil {
+			return w, fmt.Errorf("invalid renew before: %w", err)
+		}
+		res.RenewBefore = t
+	}
+
+	if len(proactiveRenewBefore) != 0 {
+		t, err := ParseThreshold(proactiveRenewBefore)
+		if err != nil {
+			return w, fmt.Errorf("invalid proactive renew before: %w", err)
+		}
+		res.ProactiveRenewBefore = t
+	}
+
+	return res, nil
+}
+
+// RenewAt returns the time when the certificate should be renewed. The time within the proactive
+// period is chosen deterministically from the seed so it doesn't shift between evaluations.
+func (w Window) RenewAt(notBefore, notAfter time.Time, seed string) time.Time {
+	lifetime := notAfter.Sub(notBefore)
+	deadline := w.RenewBefore.Before(lifetime)
+	proactive := w.ProactiveRenewBefore.Before(lifetime)
+
+	before := deadline
+	if proactive > deadline {
+		before += time.Duration(float64(proactive-deadline) * seedFraction(seed))
+	}
+
+	return notAfter.Add(-before)
+}
+
+// Reason returns why the certificate needs to be renewed at the time or an empty string if it doesn't.
+func (w Window) Reason(t, notBefore, notAfter time.Time, seed string) string {
+	lifetime := notAfter.Sub(notBefore)
+	if !t.Before(notAfter.Add(-w.RenewBefore.Before(lifetime))) {
+		return "In renewal period"
+	}
+
+	if !t.Before(w.RenewAt(notBefore, notAfter, seed)) {
+		return "Proactive renewal"
+	}
+
+	return ""
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("renew before %s, proactively before %s", w.RenewBefore, w.ProactiveRenewBefore)
+}
+
+// seedFraction maps the seed uniformly to [0, 1).
+func seedFraction(seed string) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
@@ -0,0 +1,186 @@
+package renewal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseThreshold(t *testing.T) {
+	lifetime := 90 * 24 * time.Hour
+
+	tt := []struct {
+		name          string
+		value         string
+		expectedErr   bool
+		expectedValue time.Duration
+	}{
+		{
+			name:          "duration",
+			value:         "720h",
+			expectedValue: 720 * time.Hour,
+		},
+		{
+			name:          "duration longer than the lifetime is capped",
+			value:         "8760h",
+			expectedValue: time.Duration(float64(lifetime) * MaxFraction),
+		},
+		{
+			name:          "decimal fraction",
+			value:         "0.5",
+			expectedValue: lifetime / 2,
+		},
+		{
+			name:          "ratio",
+			value:         "1/3",
+			expectedValue: lifetime / 3,
+		},
+		{
+			name:        "empty",
+			value:       "",
+			expectedErr: true,
+		},
+		{
+			name:        "negative duration",
+			value:       "-1h",
+			expectedErr: true,
+		},
+		{
+			name:        "zero fraction",
+			value:       "0",
+			expectedErr: true,
+		},
+		{
+			name:        "fraction above maximum",
+			value:       "1",
+			expectedErr: true,
+		},
+		{
+			name:        "division by zero",
+			value:       "1/0",
+			expectedErr: true,
+		},
+		{
+			name:        "garbage",
+			value:       "soon",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			threshold, err := ParseThreshold(tc.value)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got %#v", threshold)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := threshold.Before(lifetime)
+			if got != tc.expectedValue {
+				t.Errorf("expected %v, got %v", tc.expectedValue, got)
+			}
+		})
+	}
+}
+
+func TestWindowReason(t *testing.T) {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * time.Hour)
+
+	window, err := DefaultWindow().Override("10h", "40h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name     string
+		window   Window
+		t        time.Time
+		seed     string
+		expected string
+	}{
+		{
+			name:     "fresh certificate",
+			window:   window,
+			t:        notBefore,
+			seed:     "uid",
+			expected: "",
+		},
+		{
+			name:     "before the proactive period",
+			window:   window,
+			t:        notAfter.Add(-41 * time.Hour),
+			seed:     "uid",
+			expected: "",
+		},
+		{
+			name:     "in renewal period",
+			window:   window,
+			t:        notAfter.Add(-10 * time.Hour),
+			seed:     "uid",
+			expected: "In renewal period",
+		},
+		{
+			name:     "default window in renewal period",
+			window:   DefaultWindow(),
+			t:        notAfter.Add(-30 * time.Hour),
+			seed:     "uid",
+			expected: "In renewal period",
+		},
+		{
+			name:     "default window before proactive period",
+			window:   DefaultWindow(),
+			t:        notAfter.Add(-46 * time.Hour),
+			seed:     "uid",
+			expected: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.window.Reason(tc.t, notBefore, notAfter, tc.seed)
+			if got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWindowRenewAt(t *testing.T) {
+	notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := notBefore.Add(90 * time.Hour)
+	window := DefaultWindow()
+
+	earliest := notAfter.Add(-45 * time.Hour)
+	latest := notAfter.Add(-30 * time.Hour)
+
+	renewAt := window.RenewAt(notBefore, notAfter, "uid-1")
+	if renewAt.Before(earliest) || renewAt.After(latest) {
+		t.Fatalf("expected renewal in [%v, %v], got %v", earliest, latest, renewAt)
+	}
+
+	if again := window.RenewAt(notBefore, notAfter, "uid-1"); !again.Equal(renewAt) {
+		t.Errorf("expected the same renewal time for the same seed, got %v and %v", renewAt, again)
+	}
+
+	if window.Reason(renewAt.Add(-time.Second), notBefore, notAfter, "uid-1") != "" {
+		t.Errorf("expected no renewal just before %v", renewAt)
+	}
+
+	if got := window.Reason(renewAt, notBefore, notAfter, "uid-1"); got != "Proactive renewal" {
+		t.Errorf("expected proactive renewal at %v, got %q", renewAt, got)
+	}
+
+	// Different seeds have to spread the renewals.
+	distinct := map[time.Time]struct{}{}
+	for _, seed := range []string{"a", "b", "c", "d", "e"} {
+		distinct[window.RenewAt(notBefore, notAfter, seed)] = struct{}{}
+	}
+	if len(distinct) < 2 {
+		t.Errorf("expected renewals to be spread, got %v", distinct)
+	}
+}
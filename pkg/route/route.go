@@ -2,6 +2,7 @@ package route
 
 import (
 	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func IsAdmitted(route *routev1.Route) bool {
@@ -19,3 +20,32 @@ func IsAdmitted(route *routev1.Route) bool {
 	}
 	return admittedSet && admittedValue
 }
+
+// AdmittingRouters returns the names of the routers that have admitted the Route.
+func AdmittingRouters(route *routev1.Route) []string {
+	var routers []string
+	for _, ingress := range route.Status.Ingress {
+		for _, condition := range ingress.Conditions {
+			if condition.Type == routev1.RouteAdmitted && condition.Status == corev1.ConditionTrue {
+				routers = append(routers, ingress.RouterName)
+			}
+		}
+	}
+	return routers
+}
+
+// AdmissionCondition returns the Admitted condition reported by the router
+// or nil if the router hasn't processed the Route yet.
+func AdmissionCondition(route *routev1.Route, routerName string) *routev1.RouteIngressCondition {
+	for _, ingress := range route.Status.Ingress {
+		if ingress.RouterName != routerName {
+			continue
+		}
+		for i := range ingress.Conditions {
+			if ingress.Conditions[i].Type == routev1.RouteAdmitted {
+				return &ingress.Conditions[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog"
+)
+
+// Elector competes for a lease per shard and records the shards it holds in the Set.
+type Elector struct {
+	set       *Set
+	maxShards int
+	locks     []resourcelock.Interface
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+}
+
+// NewElector creates an Elector using newLock to create the lock for every shard.
+// Zero maxShards lets a single replica own all of them.
+func NewElector(set *Set, maxShards int, newLock func(shard int) (resourcelock.Interface, error), leaseDuration, renewDeadline, retryPeriod time.Duration) (*Elector, error) {
+	e := &Elector{
+		set:           set,
+		maxShards:     maxShards,
+		leaseDuration: leaseDuration,
+		renewDeadline: renewDeadline,
+		retryPeriod:   retryPeriod,
+	}
+
+	for shard := 0; shard < set.Count(); shard++ {
+		lock, err := newLock(shard)
+		if err != nil {
+			return nil, fmt.Errorf("can't create lock for shard %d: %w", shard, err)
+		}
+		e.locks = append(e.locks, lock)
+	}
+
+	// Validate the config once so we don't have to deal with errors in the loops.
+	_, err := e.newLeaderElector(0, leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(context.Context) {},
+		OnStoppedLeading: func() {},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *Elector) newLeaderElector(shard int, callbacks leaderelection.LeaderCallbacks) (*leaderelection.LeaderElector, error) {
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            e.locks[shard],
+		LeaseDuration:   e.leaseDuration,
+		RenewDeadline:   e.renewDeadline,
+		RetryPeriod:     e.retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks:       callbacks,
+		Name:            fmt.Sprintf("openshift-acme-shard-%d", shard),
+	})
+}
+
+// elect holds the shard until the lease is lost or ctx is done.
+func (e *Elector) elect(ctx context.Context, shard int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// OnStartedLeading runs asynchronously and may come after OnStoppedLeading.
+	var mutex sync.Mutex
+	stopped := false
+
+	le, err := e.newLeaderElector(shard, leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(context.Context) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if stopped {
+				return
+			}
+
+			if !e.set.acquire(shard, e.maxShards) {
+				klog.V(2).Infof("Releasing shard %d, we already own %d shards", shard, e.maxShards)
+				cancel()
+				return
+			}
+			klog.Infof("Acquired shard %d", shard)
+		},
+		OnStoppedLeading: func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			stopped = true
+			if e.set.release(shard) {
+				klog.Infof("Released shard %d", shard)
+			}
+		},
+	})
+	if err != nil {
+		// The config was validated in NewElector.
+		panic(err)
+	}
+
+	// Stop waiting for the lease when we fill up with other shards so replicas with room can take it.
+	go wait.Until(func() {
+		if !e.set.OwnsShard(shard) && e.set.full(e.maxShards) {
+			cancel()
+		}
+	}, e.retryPeriod, ctx.Done())
+
+	le.Run(ctx)
+}
+
+func (e *Elector) runShard(ctx context.Context, shard int) {
+	for {
+		// Don't compete for more shards than we can own.
+		err := wait.PollImmediateUntil(e.retryPeriod, func() (bool, error) {
+			return !e.set.full(e.maxShards), nil
+		}, ctx.Done())
+		if err != nil {
+			return
+		}
+
+		e.elect(ctx, shard)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retryPeriod):
+		}
+	}
+}
+
+// Run competes for all shards until ctx is done and releases the owned ones on exit.
+func (e *Elector) Run(ctx context.Context) {
+	klog.Infof("Starting shard elector for %d shards", e.set.Count())
+	defer klog.Info("Shard elector shut down")
+
+	var wg sync.WaitGroup
+	for shard := 0; shard < e.set.Count(); shard++ {
+		wg.Add(1)
+		go func(shard int) {
+			defer wg.Done()
+			e.runShard(ctx, shard)
+		}(shard)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestElector(t *testing.T) {
+	const shards = 4
+	kubeClient := kubefake.NewSimpleClientset()
+
+	newElector := func(identity string, set *Set, maxShards int) *Elector {
+		e, err := NewElector(set, maxShards, func(shard int) (resourcelock.Interface, error) {
+			return resourcelock.New(
+				resourcelock.LeasesResourceLock,
+				"acme",
+				fmt.Sprintf("acme-controller-locks-shard-%d", shard),
+				kubeClient.CoreV1(),
+				kubeClient.CoordinationV1(),
+				resourcelock.ResourceLockConfig{Identity: identity},
+			)
+		}, 2*time.Second, 1*time.Second, 100*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	run := func(e *Elector) context.CancelFunc {
+		ctx, cancel := context.WithCancel(context.Background())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Run(ctx)
+		}()
+		return cancel
+	}
+
+	a := NewSet(shards)
+	cancelA := run(newElector("a", a, 2))
+	defer cancelA()
+
+	b := NewSet(shards)
+	cancelB := run(newElector("b", b, 0))
+	defer cancelB()
+
+	err := wait.Poll(50*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return len(a.Owned())+len(b.Owned()) == shards, nil
+	})
+	if err != nil {
+		t.Fatalf("shards weren't acquired: a owns %v, b owns %v", a.Owned(), b.Owned())
+	}
+
+	if len(a.Owned()) > 2 {
+		t.Errorf("a owns more than 2 shards: %v", a.Owned())
+	}
+	for _, shard := range a.Owned() {
+		if b.OwnsShard(shard) {
+			t.Errorf("shard %d is owned by both replicas", shard)
+		}
+	}
+
+	// Released leases have to be picked up by the other replica.
+	cancelA()
+	err = wait.Poll(50*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return len(a.Owned()) == 0 && len(b.Owned()) == shards, nil
+	})
+	if err != nil {
+		t.Fatalf("shards weren't taken over: a owns %v, b owns %v", a.Owned(), b.Owned())
+	}
+}
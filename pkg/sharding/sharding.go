@@ -0,0 +1,124 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// For returns the shard owning the key. Shards own contiguous ranges of the 32-bit FNV-1a hash space
+// so the ownership of existing keys doesn't depend on anything but the number of shards.
+func For(key string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(uint64(h.Sum32()) * uint64(count) >> 32)
+}
+
+// Handler is called after a shard is acquired so the controllers can requeue the objects it owns.
+type Handler func(shard int)
+
+// Set tracks the shards owned by this replica. A nil Set owns every key.
+type Set struct {
+	count int
+
+	mutex    sync.RWMutex
+	owned    map[int]struct{}
+	handlers []Handler
+}
+
+func NewSet(count int) *Set {
+	return &Set{
+		count: count,
+		owned: map[int]struct{}{},
+	}
+}
+
+// Count returns the total number of shards.
+func (s *Set) Count() int {
+	return s.count
+}
+
+// Owns returns true if this replica owns the shard of the key.
+func (s *Set) Owns(key string) bool {
+	if s == nil {
+		return true
+	}
+
+	return s.OwnsShard(For(key, s.count))
+}
+
+func (s *Set) OwnsShard(shard int) bool {
+	if s == nil {
+		return true
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	_, ok := s.owned[shard]
+	return ok
+}
+
+// Owned returns the sorted list of owned shards.
+func (s *Set) Owned() []int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var owned []int
+	for shard := range s.owned {
+		owned = append(owned, shard)
+	}
+	sort.Ints(owned)
+
+	return owned
+}
+
+func (s *Set) AddHandler(handler Handler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers = append(s.handlers, handler)
+}
+
+// full returns true if we already own max shards. Zero max means unlimited.
+func (s *Set) full(max int) bool {
+	if max <= 0 {
+		return false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return len(s.owned) >= max
+}
+
+// acquire marks the shard as owned unless we already own max shards and runs the handlers.
+func (s *Set) acquire(shard int, max int) bool {
+	s.mutex.Lock()
+	if max > 0 && len(s.owned) >= max {
+		s.mutex.Unlock()
+		return false
+	}
+	s.owned[shard] = struct{}{}
+	handlers := make([]Handler, len(s.handlers))
+	copy(handlers, s.handlers)
+	s.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(shard)
+	}
+
+	return true
+}
+
+// release marks the shard as not owned. It returns true if we owned it.
+func (s *Set) release(shard int) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.owned[shard]
+	delete(s.owned, shard)
+
+	return ok
+}
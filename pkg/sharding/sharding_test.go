@@ -0,0 +1,89 @@
+package sharding
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	for _, count := range []int{1, 2, 3, 16} {
+		t.Run(fmt.Sprintf("%d shards", count), func(t *testing.T) {
+			used := map[int]int{}
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("namespace-%d/route-%d", i%7, i)
+
+				shard := For(key, count)
+				if shard < 0 || shard >= count {
+					t.Fatalf("key %q mapped to shard %d out of %d", key, shard, count)
+				}
+				if For(key, count) != shard {
+					t.Fatalf("key %q isn't mapped consistently", key)
+				}
+				used[shard]++
+			}
+
+			if len(used) != count {
+				t.Errorf("expected all %d shards to be used, got %v", count, used)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	var nilSet *Set
+	if !nilSet.Owns("test/foo") {
+		t.Errorf("nil set has to own every key")
+	}
+
+	s := NewSet(4)
+	var acquired []int
+	s.AddHandler(func(shard int) {
+		acquired = append(acquired, shard)
+	})
+
+	if s.Owns("test/foo") {
+		t.Errorf("empty set can't own any key")
+	}
+
+	if !s.acquire(For("test/foo", 4), 2) {
+		t.Fatalf("can't acquire the first shard")
+	}
+	if !s.Owns("test/foo") {
+		t.Errorf("set doesn't own the key of an acquired shard")
+	}
+
+	other := (For("test/foo", 4) + 1) % 4
+	if !s.acquire(other, 2) {
+		t.Fatalf("can't acquire the second shard")
+	}
+	if !s.full(2) {
+		t.Errorf("set with 2 shards has to be full for max 2")
+	}
+	if s.full(0) {
+		t.Errorf("set can't be full without a limit")
+	}
+
+	last := (other + 1) % 4
+	if s.acquire(last, 2) {
+		t.Errorf("acquired a shard over the limit")
+	}
+	if s.OwnsShard(last) {
+		t.Errorf("set owns a shard over the limit")
+	}
+
+	expected := []int{For("test/foo", 4), other}
+	if !reflect.DeepEqual(acquired, expected) {
+		t.Errorf("expected handlers to be called for %v, got %v", expected, acquired)
+	}
+
+	if !s.release(other) {
+		t.Errorf("releasing owned shard has to return true")
+	}
+	if s.release(other) {
+		t.Errorf("releasing shard we don't own has to return false")
+	}
+	if !reflect.DeepEqual(s.Owned(), []int{For("test/foo", 4)}) {
+		t.Errorf("unexpected owned shards %v", s.Owned())
+	}
+}
@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// certificateReloader serves the serving certificate from files and reloads it when they change
+// so rotated certificates are picked up without a restart.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func modTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	t, err := modTime(r.certFile, r.keyFile)
+	if err != nil {
+		if r.certificate != nil {
+			klog.Warningf("Can't check serving certificate for changes, using the previous one: %v", err)
+			return r.certificate, nil
+		}
+		return nil, err
+	}
+
+	if r.certificate != nil && t.Equal(r.modTime) {
+		return r.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.certificate != nil {
+			// The files might be in the middle of an update.
+			klog.Warningf("Can't reload serving certificate, using the previous one: %v", err)
+			return r.certificate, nil
+		}
+		return nil, fmt.Errorf("can't load serving certificate: %w", err)
+	}
+	klog.V(2).Infof("Loaded serving certificate from %q", r.certFile)
+
+	r.certificate = &certificate
+	r.modTime = t
+
+	return r.certificate, nil
+}
+
+// Server serves the Validator over TLS.
+type Server struct {
+	certificates *certificateReloader
+
+	server http.Server
+}
+
+func NewServer(listenAddr string, certFile, keyFile string, validator *Validator) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, validator)
+
+	return &Server{
+		certificates: &certificateReloader{
+			certFile: certFile,
+			keyFile:  keyFile,
+		},
+
+		server: http.Server{
+			Addr:    listenAddr,
+			Handler: mux,
+			// Admission webhooks time out after 30s at most.
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Run() error {
+	// Fail early if the certificate is missing instead of failing every handshake.
+	_, err := s.certificates.GetCertificate(nil)
+	if err != nil {
+		return err
+	}
+
+	s.server.TLSConfig = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.certificates.GetCertificate,
+	}
+
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	klog.V(1).Infof("Admission webhook listening on https://%s%s", listener.Addr().String(), ValidatePath)
+
+	err = s.server.ServeTLS(listener, "", "")
+	if err == http.ErrServerClosed {
+		klog.Infof("Admission webhook closed gracefully")
+		return nil
+	}
+
+	return err
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	klog.Infof("Shutting down admission webhook...")
+	defer klog.Infof("Admission webhook shut down")
+
+	return s.server.Shutdown(ctx)
+}
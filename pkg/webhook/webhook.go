@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	routev1 "github.com/openshift/api/route/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+	routecontroller "github.com/tnozicka/openshift-acme/pkg/controller/route"
+	"github.com/tnozicka/openshift-acme/pkg/util"
+)
+
+const (
+	ValidatePath = "/validate"
+
+	// maxRequestSize limits the size of AdmissionReviews we accept. The apiserver limits objects to a few MBs.
+	maxRequestSize = 8 * 1024 * 1024
+)
+
+var (
+	routeResource     = metav1.GroupVersionResource{Group: routev1.GroupName, Version: "v1", Resource: "routes"}
+	configMapResource = metav1.GroupVersionResource{Group: corev1.GroupName, Version: "v1", Resource: "configmaps"}
+)
+
+// Validator decides AdmissionRequests for Routes and issuer ConfigMaps.
+type Validator struct {
+	// annotation marks Routes managed by the controller.
+	annotation string
+
+	// statusWriters are the users allowed to change the status annotation, usually only the controller.
+	statusWriters sets.String
+}
+
+func NewValidator(annotation string, statusWriters []string) *Validator {
+	return &Validator{
+		annotation:    annotation,
+		statusWriters: sets.NewString(statusWriters...),
+	}
+}
+
+func allowed() *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: true,
+	}
+}
+
+func denied(err apierrors.APIStatus) *admissionv1beta1.AdmissionResponse {
+	status := err.Status()
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result:  &status,
+	}
+}
+
+func (v *Validator) validateRoute(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	route := &routev1.Route{}
+	err := json.Unmarshal(req.Object.Raw, route)
+	if err != nil {
+		return denied(apierrors.NewBadRequest(fmt.Sprintf("can't decode Route: %v", err)))
+	}
+
+	var oldStatus string
+	if req.Operation == admissionv1beta1.Update {
+		oldRoute := &routev1.Route{}
+		err := json.Unmarshal(req.OldObject.Raw, oldRoute)
+		if err != nil {
+			return denied(apierrors.NewBadRequest(fmt.Sprintf("can't decode old Route: %v", err)))
+		}
+		oldStatus = oldRoute.Annotations[api.AcmeStatusAnnotation]
+	}
+
+	// The controller has to be able to write the status and finalizers even if the user broke the annotations.
+	if v.statusWriters.Has(req.UserInfo.Username) {
+		return allowed()
+	}
+
+	if route.Annotations[api.AcmeStatusAnnotation] != oldStatus {
+		return denied(apierrors.NewForbidden(
+			schema.GroupResource{Group: routev1.GroupName, Resource: "routes"},
+			route.Name,
+			fmt.Errorf("annotation %q is managed by the controller and can't be changed by user %q", api.AcmeStatusAnnotation, req.UserInfo.Username),
+		))
+	}
+
+	if !util.IsManaged(route, v.annotation) {
+		return allowed()
+	}
+
+	errs := routecontroller.ValidateRoute(route)
+	if len(errs) != 0 {
+		return denied(apierrors.NewInvalid(schema.GroupKind{Group: routev1.GroupName, Kind: "Route"}, route.Name, errs))
+	}
+
+	return allowed()
+}
+
+func (v *Validator) validateConfigMap(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	cm := &corev1.ConfigMap{}
+	err := json.Unmarshal(req.Object.Raw, cm)
+	if err != nil {
+		return denied(apierrors.NewBadRequest(fmt.Sprintf("can't decode ConfigMap: %v", err)))
+	}
+
+	if !api.AccountLabelSet.AsSelector().Matches(labels.Set(cm.Labels)) {
+		return allowed()
+	}
+
+	errs := routecontroller.ValidateIssuerConfigMap(cm)
+	if len(errs) != 0 {
+		return denied(apierrors.NewInvalid(schema.GroupKind{Group: corev1.GroupName, Kind: "ConfigMap"}, cm.Name, errs))
+	}
+
+	return allowed()
+}
+
+// Validate decides whether the request is admitted.
+func (v *Validator) Validate(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	switch req.Operation {
+	case admissionv1beta1.Create, admissionv1beta1.Update:
+		break
+	default:
+		return allowed()
+	}
+
+	// Subresources like status are written by routers and kubelets and don't carry our annotations.
+	if len(req.SubResource) != 0 {
+		return allowed()
+	}
+
+	switch req.Resource {
+	case routeResource:
+		return v.validateRoute(req)
+	case configMapResource:
+		return v.validateConfigMap(req)
+	default:
+		return allowed()
+	}
+}
+
+// ServeHTTP answers AdmissionReviews sent by the apiserver.
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	review := &admissionv1beta1.AdmissionReview{}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(review)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "can't decode AdmissionReview: %v", err)
+		return
+	}
+	if review.Request == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, "AdmissionReview is missing request")
+		return
+	}
+
+	response := v.Validate(review.Request)
+	response.UID = review.Request.UID
+	if !response.Allowed {
+		klog.V(2).Infof("Denied %s of %s %s/%s by %q: %s", review.Request.Operation, review.Request.Resource.Resource, review.Request.Namespace, review.Request.Name, review.Request.UserInfo.Username, response.Result.Message)
+	}
+
+	data, err := json.Marshal(&admissionv1beta1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: response,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		klog.Errorf("Can't encode AdmissionReview: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(data)
+	if err != nil {
+		klog.Errorf("Can't write AdmissionReview: %v", err)
+	}
+}
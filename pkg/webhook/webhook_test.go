@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	routev1 "github.com/openshift/api/route/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/tnozicka/openshift-acme/pkg/api"
+)
+
+const controllerUser = "system:serviceaccount:acme:openshift-acme"
+
+func newRoute(annotations map[string]string) *routev1.Route {
+	return &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "test",
+			Name:        "foo",
+			Annotations: annotations,
+		},
+	}
+}
+
+func rawExtension(t *testing.T, obj interface{}) runtime.RawExtension {
+	if obj == nil {
+		return runtime.RawExtension{}
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: data}
+}
+
+func TestValidate(t *testing.T) {
+	tt := []struct {
+		name            string
+		operation       admissionv1beta1.Operation
+		resource        metav1.GroupVersionResource
+		subResource     string
+		user            string
+		object          interface{}
+		oldObject       interface{}
+		expectedAllowed bool
+		expectedReason  metav1.StatusReason
+	}{
+		{
+			name:      "valid managed Route",
+			operation: admissionv1beta1.Create,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeSecretName:           "foo-cert",
+			}),
+			expectedAllowed: true,
+		},
+		{
+			name:      "invalid managed Route",
+			operation: admissionv1beta1.Create,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeSecretName:           "Foo_Cert",
+			}),
+			expectedAllowed: false,
+			expectedReason:  metav1.StatusReasonInvalid,
+		},
+		{
+			name:      "unmanaged Route isn't validated",
+			operation: admissionv1beta1.Create,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.AcmeSecretName: "Foo_Cert",
+			}),
+			expectedAllowed: true,
+		},
+		{
+			name:      "user can't change the status",
+			operation: admissionv1beta1.Update,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeStatusAnnotation:     "provisioningStatus:\n  failures: 0\n",
+			}),
+			oldObject: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeStatusAnnotation:     "provisioningStatus:\n  failures: 5\n",
+			}),
+			expectedAllowed: false,
+			expectedReason:  metav1.StatusReasonForbidden,
+		},
+		{
+			name:      "user can't create a Route with status",
+			operation: admissionv1beta1.Create,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.AcmeStatusAnnotation: "provisioningStatus: {}",
+			}),
+			expectedAllowed: false,
+			expectedReason:  metav1.StatusReasonForbidden,
+		},
+		{
+			name:      "user can change other annotations",
+			operation: admissionv1beta1.Update,
+			resource:  routeResource,
+			user:      "alice",
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeStatusAnnotation:     "provisioningStatus: {}",
+				api.AcmePausedAnnotation:     "true",
+			}),
+			oldObject: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeStatusAnnotation:     "provisioningStatus: {}",
+			}),
+			expectedAllowed: true,
+		},
+		{
+			name:      "controller can change the status of a Route with invalid annotations",
+			operation: admissionv1beta1.Update,
+			resource:  routeResource,
+			user:      controllerUser,
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeSecretName:           "Foo_Cert",
+				api.AcmeStatusAnnotation:     "provisioningStatus:\n  failures: 1\n",
+			}),
+			oldObject: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeSecretName:           "Foo_Cert",
+			}),
+			expectedAllowed: true,
+		},
+		{
+			name:        "status subresource isn't validated",
+			operation:   admissionv1beta1.Update,
+			resource:    routeResource,
+			subResource: "status",
+			user:        "system:serviceaccount:openshift-ingress:router",
+			object: newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation: "true",
+				api.AcmeSecretName:           "Foo_Cert",
+			}),
+			oldObject:       newRoute(nil),
+			expectedAllowed: true,
+		},
+		{
+			name:      "invalid issuer ConfigMap",
+			operation: admissionv1beta1.Create,
+			resource:  configMapResource,
+			user:      "alice",
+			object: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "acme",
+					Name:      "letsencrypt-live",
+					Labels:    api.AccountLabelSet,
+					Annotations: map[string]string{
+						api.AcmePriorityAnnotation: "high",
+					},
+				},
+				Data: map[string]string{
+					api.CertIssuerDataKey: `{"type":"ACME","acmeCertIssuer":{"directoryURL":"https://acme-v02.api.letsencrypt.org/directory"}}`,
+				},
+			},
+			expectedAllowed: false,
+			expectedReason:  metav1.StatusReasonInvalid,
+		},
+		{
+			name:      "other ConfigMaps aren't validated",
+			operation: admissionv1beta1.Create,
+			resource:  configMapResource,
+			user:      "alice",
+			object: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "acme",
+					Name:      "something-else",
+					Annotations: map[string]string{
+						api.AcmePriorityAnnotation: "high",
+					},
+				},
+			},
+			expectedAllowed: true,
+		},
+		{
+			name:            "delete is allowed",
+			operation:       admissionv1beta1.Delete,
+			resource:        routeResource,
+			user:            "alice",
+			oldObject:       newRoute(map[string]string{api.AcmeStatusAnnotation: "provisioningStatus: {}"}),
+			expectedAllowed: true,
+		},
+	}
+
+	v := NewValidator(api.DefaultTlsAcmeAnnotation, []string{controllerUser})
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			response := v.Validate(&admissionv1beta1.AdmissionRequest{
+				Operation:   tc.operation,
+				Resource:    tc.resource,
+				SubResource: tc.subResource,
+				UserInfo: authenticationv1.UserInfo{
+					Username: tc.user,
+				},
+				Object:    rawExtension(t, tc.object),
+				OldObject: rawExtension(t, tc.oldObject),
+			})
+
+			if response.Allowed != tc.expectedAllowed {
+				t.Fatalf("expected allowed %t, got %t: %#v", tc.expectedAllowed, response.Allowed, response.Result)
+			}
+
+			var reason metav1.StatusReason
+			if response.Result != nil {
+				reason = response.Result.Reason
+			}
+			if reason != tc.expectedReason {
+				t.Errorf("expected reason %q, got %q: %#v", tc.expectedReason, reason, response.Result)
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	server := httptest.NewServer(NewValidator(api.DefaultTlsAcmeAnnotation, []string{controllerUser}))
+	defer server.Close()
+
+	request := &admissionv1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "admission.k8s.io/v1beta1",
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       types.UID("42"),
+			Operation: admissionv1beta1.Create,
+			Resource:  routeResource,
+			UserInfo: authenticationv1.UserInfo{
+				Username: "alice",
+			},
+			Object: rawExtension(t, newRoute(map[string]string{
+				api.DefaultTlsAcmeAnnotation:                 "true",
+				api.AcmeExposerHttpFilterOutLabelsAnnotation: "(",
+			})),
+		},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(server.URL+ValidatePath, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	review := &admissionv1beta1.AdmissionReview{}
+	err = json.NewDecoder(resp.Body).Decode(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if review.APIVersion != request.APIVersion || review.Kind != request.Kind {
+		t.Errorf("expected %s %s, got %s %s", request.APIVersion, request.Kind, review.APIVersion, review.Kind)
+	}
+	if review.Response == nil {
+		t.Fatal("response is missing")
+	}
+	if review.Response.UID != request.Request.UID {
+		t.Errorf("expected UID %q, got %q", request.Request.UID, review.Response.UID)
+	}
+	if review.Response.Allowed {
+		t.Errorf("expected the Route to be denied")
+	}
+}